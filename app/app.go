@@ -4,9 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/elevation"
+	"github.com/theleeeo/thor/group"
+	"github.com/theleeeo/thor/invitation"
+	"github.com/theleeeo/thor/local"
+	"github.com/theleeeo/thor/mfa"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/org"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/permission"
+	"github.com/theleeeo/thor/policy"
+	"github.com/theleeeo/thor/providertoken"
 	"github.com/theleeeo/thor/repo"
 	"github.com/theleeeo/thor/role"
 	"github.com/theleeeo/thor/sdk"
@@ -14,19 +25,62 @@ import (
 )
 
 type App struct {
-	auth        *authorizer.Authorizer
-	userService *user.Service
-	roleService *role.Service
+	auth              *authorizer.Authorizer
+	userService       *user.Service
+	roleService       *role.Service
+	groupService      *group.Service
+	orgService        *org.Service
+	localService      *local.Service
+	mfaService        *mfa.Service
+	passkeyService    *passkey.Service
+	invitationService *invitation.Service
+	tokenService      *providertoken.Service
+	elevationService  *elevation.Service
+	policyService     *policy.Service
 }
 
-func New(auth *authorizer.Authorizer, userService *user.Service, roleService *role.Service) *App {
+// Services are what the app is built on.
+// Local, MFA, Passkeys, Invitations, ProviderTokens and Elevations are optional, the features are disabled if they are nil.
+type Services struct {
+	Auth           *authorizer.Authorizer
+	Users          *user.Service
+	Roles          *role.Service
+	Groups         *group.Service
+	Orgs           *org.Service
+	Local          *local.Service
+	MFA            *mfa.Service
+	Passkeys       *passkey.Service
+	Invitations    *invitation.Service
+	ProviderTokens *providertoken.Service
+	Elevations     *elevation.Service
+	Policies       *policy.Service
+}
+
+// New creates the app.
+func New(services *Services) *App {
 	return &App{
-		auth:        auth,
-		userService: userService,
-		roleService: roleService,
+		auth:              services.Auth,
+		userService:       services.Users,
+		roleService:       services.Roles,
+		groupService:      services.Groups,
+		orgService:        services.Orgs,
+		localService:      services.Local,
+		mfaService:        services.MFA,
+		passkeyService:    services.Passkeys,
+		invitationService: services.Invitations,
+		tokenService:      services.ProviderTokens,
+		elevationService:  services.Elevations,
+		policyService:     services.Policies,
 	}
 }
 
+// isAdmin reports whether the user is an admin of Thor.
+// Only tokens without an active org count, since the roles of an org are managed by others than the admins of Thor.
+func isAdmin(ctx context.Context) bool {
+	claims := sdk.ClaimFromCtx(ctx)
+	return sdk.UserHas(ctx, "admin", "true") && claims.OrgID == ""
+}
+
 func (a *App) PublicKey() []byte {
 	return a.auth.PublicKey()
 }
@@ -50,7 +104,7 @@ func (a *App) WhoAmI(ctx context.Context, token string) (user.User, error) {
 }
 
 func (a *App) GetUserByID(ctx context.Context, id string) (user.User, error) {
-	if !sdk.UserHas(ctx, "admin", "true") && !sdk.UserIs(ctx, id) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, id) {
 		return user.User{}, errors.New("forbidden")
 	}
 
@@ -63,7 +117,7 @@ func (a *App) GetUserByID(ctx context.Context, id string) (user.User, error) {
 }
 
 func (a *App) GetUserByEmail(ctx context.Context, email string) (user.User, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return user.User{}, errors.New("forbidden")
 	}
 
@@ -76,7 +130,7 @@ func (a *App) GetUserByEmail(ctx context.Context, email string) (user.User, erro
 }
 
 func (a *App) GetUserByProviderID(ctx context.Context, providerID string) (user.User, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return user.User{}, errors.New("forbidden")
 	}
 
@@ -88,21 +142,21 @@ func (a *App) GetUserByProviderID(ctx context.Context, providerID string) (user.
 	return u, nil
 }
 
-func (a *App) ListUsers(ctx context.Context, params repo.ListUsersParams) ([]user.User, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
-		return nil, errors.New("forbidden")
+func (a *App) ListUsers(ctx context.Context, params repo.ListUsersParams) ([]user.User, string, error) {
+	if !isAdmin(ctx) {
+		return nil, "", errors.New("forbidden")
 	}
 
-	users, err := a.userService.List(ctx, params)
+	users, next, err := a.userService.List(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, "", fmt.Errorf("failed to list users: %w", err)
 	}
 
-	return users, nil
+	return users, next, nil
 }
 
 func (a *App) CreateUser(ctx context.Context, userModel models.User, provider models.UserProvider) (user.User, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return user.User{}, errors.New("forbidden")
 	}
 
@@ -114,8 +168,297 @@ func (a *App) CreateUser(ctx context.Context, userModel models.User, provider mo
 	return u, nil
 }
 
+// UpdateUser changes the name and email of the user, the fields that are nil are left as they are.
+func (a *App) UpdateUser(ctx context.Context, id string, name, email *string) (user.User, error) {
+	if !isAdmin(ctx) {
+		return user.User{}, errors.New("forbidden")
+	}
+
+	u, err := a.userService.Get(ctx, repo.GetUserParams{ID: &id})
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if name != nil {
+		u.Name = *name
+	}
+	if email != nil {
+		u.Email = *email
+	}
+
+	u, err = a.userService.Update(ctx, u.User)
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return u, nil
+}
+
+func (a *App) DisableUser(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.userService.Disable(ctx, id); err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) EnableUser(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.userService.Enable(ctx, id); err != nil {
+		return fmt.Errorf("failed to enable user: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes the user, it is purged after the retention period.
+func (a *App) DeleteUser(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.userService.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) CreateLocalUser(ctx context.Context, userModel models.User, username, password string) (user.User, error) {
+	if !isAdmin(ctx) {
+		return user.User{}, errors.New("forbidden")
+	}
+
+	if a.localService == nil {
+		return user.User{}, errors.New("local accounts are not enabled")
+	}
+
+	u, err := a.localService.CreateUser(ctx, userModel, username, password)
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to create local user: %w", err)
+	}
+
+	return u, nil
+}
+
+func (a *App) SetPassword(ctx context.Context, userID, password string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if a.localService == nil {
+		return errors.New("local accounts are not enabled")
+	}
+
+	if err := a.localService.SetPassword(ctx, userID, password); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	return nil
+}
+
+// EnrollMFA starts the TOTP enrollment of the user.
+// Only the users themselves can enroll since the secret has to end up in their authenticator app.
+func (a *App) EnrollMFA(ctx context.Context, userID string) (mfa.Enrollment, error) {
+	if !sdk.UserIs(ctx, userID) {
+		return mfa.Enrollment{}, errors.New("forbidden")
+	}
+
+	if a.mfaService == nil {
+		return mfa.Enrollment{}, errors.New("mfa is not enabled")
+	}
+
+	u, err := a.userService.Get(ctx, repo.GetUserParams{ID: &userID})
+	if err != nil {
+		return mfa.Enrollment{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	enrollment, err := a.mfaService.Enroll(ctx, u)
+	if err != nil {
+		return mfa.Enrollment{}, fmt.Errorf("failed to enroll mfa: %w", err)
+	}
+
+	return enrollment, nil
+}
+
+func (a *App) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	if !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	if a.mfaService == nil {
+		return nil, errors.New("mfa is not enabled")
+	}
+
+	codes, err := a.mfaService.Confirm(ctx, userID, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm mfa: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (a *App) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	if !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	if a.mfaService == nil {
+		return nil, errors.New("mfa is not enabled")
+	}
+
+	enrolled, err := a.mfaService.IsEnrolled(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check mfa enrollment: %w", err)
+	}
+
+	if !enrolled {
+		return nil, mfa.ErrNotEnrolled
+	}
+
+	codes, err := a.mfaService.RegenerateRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to regenerate recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// DisableMFA removes the TOTP of the user.
+// Admins can disable it for users that have lost their authenticator app and recovery codes.
+func (a *App) DisableMFA(ctx context.Context, userID string) error {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return errors.New("forbidden")
+	}
+
+	if a.mfaService == nil {
+		return errors.New("mfa is not enabled")
+	}
+
+	if err := a.mfaService.Disable(ctx, userID); err != nil {
+		return fmt.Errorf("failed to disable mfa: %w", err)
+	}
+
+	return nil
+}
+
+// ListPasskeys lists the passkeys of the user.
+// New passkeys are registered through the browser at /passkeys.
+func (a *App) ListPasskeys(ctx context.Context, userID string) ([]passkey.Credential, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	if a.passkeyService == nil {
+		return nil, errors.New("passkeys are not enabled")
+	}
+
+	creds, err := a.passkeyService.List(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	return creds, nil
+}
+
+// DeletePasskey removes a passkey of the user.
+// Admins can remove passkeys of users that have lost their authenticator.
+func (a *App) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return errors.New("forbidden")
+	}
+
+	if a.passkeyService == nil {
+		return errors.New("passkeys are not enabled")
+	}
+
+	if err := a.passkeyService.Delete(ctx, userID, passkeyID); err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	return nil
+}
+
+// GetProviderToken returns a valid access token that the provider issued to the user, refreshing it if needed.
+// It lets trusted services call the provider on behalf of the user, so only admins can get it.
+func (a *App) GetProviderToken(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (providertoken.AccessToken, error) {
+	if !isAdmin(ctx) {
+		return providertoken.AccessToken{}, errors.New("forbidden")
+	}
+
+	if a.tokenService == nil {
+		return providertoken.AccessToken{}, errors.New("provider tokens are not enabled")
+	}
+
+	token, err := a.tokenService.Get(ctx, userID, providerType, providerName)
+	if err != nil {
+		return providertoken.AccessToken{}, fmt.Errorf("failed to get provider token: %w", err)
+	}
+
+	return token.Access(), nil
+}
+
+// CreateInvitation invites the email and sends the invitation link to it.
+// Whoever logs in through the link gets the roles.
+func (a *App) CreateInvitation(ctx context.Context, email string, roleIDs []string) (models.Invitation, error) {
+	if !isAdmin(ctx) {
+		return models.Invitation{}, errors.New("forbidden")
+	}
+
+	if a.invitationService == nil {
+		return models.Invitation{}, errors.New("invitations are not enabled")
+	}
+
+	invitation, err := a.invitationService.Create(ctx, email, roleIDs, sdk.ClaimFromCtx(ctx).UserID)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+func (a *App) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	if a.invitationService == nil {
+		return nil, errors.New("invitations are not enabled")
+	}
+
+	invitations, err := a.invitationService.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+func (a *App) RevokeInvitation(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if a.invitationService == nil {
+		return errors.New("invitations are not enabled")
+	}
+
+	if err := a.invitationService.Revoke(ctx, id); err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return nil
+}
+
 func (a *App) CreateRole(ctx context.Context, roleModel models.Role, permissions []models.Permission) (role.Role, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return role.Role{}, errors.New("forbidden")
 	}
 
@@ -128,7 +471,7 @@ func (a *App) CreateRole(ctx context.Context, roleModel models.Role, permissions
 }
 
 func (a *App) GetRoleByID(ctx context.Context, id string) (role.Role, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return role.Role{}, errors.New("forbidden")
 	}
 
@@ -140,21 +483,134 @@ func (a *App) GetRoleByID(ctx context.Context, id string) (role.Role, error) {
 	return r, nil
 }
 
-func (a *App) ListRoles(ctx context.Context, params repo.ListRolesParams) ([]role.Role, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+func (a *App) ListRoles(ctx context.Context, params repo.ListRolesParams) ([]role.Role, string, error) {
+	if !isAdmin(ctx) {
+		return nil, "", errors.New("forbidden")
+	}
+
+	roles, next, err := a.roleService.List(ctx, params)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	return roles, next, nil
+}
+
+// ListPermissionDefinitions returns the catalog of the permissions that roles can be given.
+func (a *App) ListPermissionDefinitions(ctx context.Context) ([]permission.Definition, error) {
+	if !isAdmin(ctx) {
 		return nil, errors.New("forbidden")
 	}
 
-	roles, err := a.roleService.List(ctx, params)
+	return a.roleService.PermissionDefinitions(), nil
+}
+
+// UpdateRole changes the name and description of the role, the fields that are nil are left as they are.
+func (a *App) UpdateRole(ctx context.Context, id string, name, description *string) (role.Role, error) {
+	if !isAdmin(ctx) {
+		return role.Role{}, errors.New("forbidden")
+	}
+
+	r, err := a.roleService.Get(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list roles: %w", err)
+		return role.Role{}, fmt.Errorf("failed to get role: %w", err)
 	}
 
-	return roles, nil
+	if name != nil {
+		r.Name = *name
+	}
+	if description != nil {
+		r.Description = *description
+	}
+
+	r, err = a.roleService.Update(ctx, r.Role)
+	if err != nil {
+		return role.Role{}, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return r, nil
+}
+
+func (a *App) SetRolePermissions(ctx context.Context, id string, permissions []models.Permission) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.roleService.SetPermissions(ctx, id, permissions); err != nil {
+		return fmt.Errorf("failed to set permissions of role: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) UpdateRolePermissions(ctx context.Context, id string, add, remove []models.Permission) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.roleService.UpdatePermissions(ctx, id, add, remove); err != nil {
+		return fmt.Errorf("failed to update permissions of role: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) GetParentsOfRole(ctx context.Context, id string) ([]role.Role, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	parents, err := a.roleService.GetParents(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parents of role: %w", err)
+	}
+
+	return parents, nil
+}
+
+func (a *App) SetRoleParents(ctx context.Context, id string, parentIDs []string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.roleService.SetParents(ctx, id, parentIDs); err != nil {
+		return fmt.Errorf("failed to set parents of role: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole deletes the role and returns the users that got permissions from it,
+// directly, through a group or through a role inheriting it.
+// With dryRun the role is kept, so the affected users can be reviewed first.
+func (a *App) DeleteRole(ctx context.Context, id string, dryRun bool) ([]models.User, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	if _, err := a.roleService.Get(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	users, err := a.roleService.GetAffectedUsers(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users affected by role: %w", err)
+	}
+
+	if dryRun {
+		return users, nil
+	}
+
+	if err := a.roleService.Delete(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return users, nil
 }
 
-func (a *App) AssignRole(ctx context.Context, userID, roleID string) error {
-	if !sdk.UserHas(ctx, "admin", "true") {
+// AssignRole assigns the role to the user, until expiresAt if it is not nil.
+func (a *App) AssignRole(ctx context.Context, userID, roleID string, expiresAt *time.Time) error {
+	if !isAdmin(ctx) {
 		return errors.New("forbidden")
 	}
 
@@ -163,7 +619,24 @@ func (a *App) AssignRole(ctx context.Context, userID, roleID string) error {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if err := u.AssignRole(ctx, roleID); err != nil {
+	r, err := a.roleService.Get(ctx, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	// The roles of an org can only be assigned to its members
+	if r.OrgID != "" {
+		if err := a.orgService.CheckMember(ctx, r.OrgID, userID); err != nil {
+			return fmt.Errorf("failed to assign role: %w", err)
+		}
+	}
+
+	if expiresAt != nil {
+		err = u.AssignRoleUntil(ctx, roleID, *expiresAt)
+	} else {
+		err = u.AssignRole(ctx, roleID)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to assign role: %w", err)
 	}
 
@@ -171,7 +644,7 @@ func (a *App) AssignRole(ctx context.Context, userID, roleID string) error {
 }
 
 func (a *App) RemoveRole(ctx context.Context, userID, roleID string) error {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return errors.New("forbidden")
 	}
 
@@ -188,7 +661,7 @@ func (a *App) RemoveRole(ctx context.Context, userID, roleID string) error {
 }
 
 func (a *App) GetRolesOfUser(ctx context.Context, userID string) ([]role.Role, error) {
-	if !sdk.UserHas(ctx, "admin", "true") && !sdk.UserIs(ctx, userID) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
 		return nil, errors.New("forbidden")
 	}
 
@@ -201,7 +674,7 @@ func (a *App) GetRolesOfUser(ctx context.Context, userID string) ([]role.Role, e
 }
 
 func (a *App) GetPermissionsOfRole(ctx context.Context, roleID string) ([]models.Permission, error) {
-	if !sdk.UserHas(ctx, "admin", "true") {
+	if !isAdmin(ctx) {
 		return nil, errors.New("forbidden")
 	}
 
@@ -213,15 +686,540 @@ func (a *App) GetPermissionsOfRole(ctx context.Context, roleID string) ([]models
 	return permissions, nil
 }
 
-func (a *App) GetPermissionsOfUser(ctx context.Context, userID string) ([]models.Permission, error) {
-	if !sdk.UserHas(ctx, "admin", "true") && !sdk.UserIs(ctx, userID) {
+// GetPermissionGrantsOfUser returns the effective permissions of the user in the org and which roles they came from.
+// Only the global roles are included if orgID is empty.
+func (a *App) GetPermissionGrantsOfUser(ctx context.Context, userID string, orgID string) ([]models.PermissionGrant, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
 		return nil, errors.New("forbidden")
 	}
 
-	permissions, err := a.userService.GetPermissionsOfUser(ctx, userID)
+	grants, err := a.userService.GetPermissionGrantsOfUser(ctx, userID, orgID)
 	if err != nil {
-		return []models.Permission{}, fmt.Errorf("failed to get permissions of user: %w", err)
+		return nil, fmt.Errorf("failed to get permission grants of user: %w", err)
 	}
 
-	return permissions, nil
+	return grants, nil
+}
+
+func (a *App) GetPermissionsOfUser(ctx context.Context, userID string, orgID string) ([]models.Permission, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	permissions, err := a.userService.GetPermissionsOfUser(ctx, userID, orgID)
+	if err != nil {
+		return []models.Permission{}, fmt.Errorf("failed to get permissions of user: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// CheckPermissions explains whether the user has each of the permissions in the org, users can check their own.
+func (a *App) CheckPermissions(ctx context.Context, userID string, orgID string, permissions []models.Permission) ([]models.PermissionCheck, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	checks, err := a.userService.CheckPermissions(ctx, userID, orgID, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions of user: %w", err)
+	}
+
+	return checks, nil
+}
+
+func (a *App) CreateGroup(ctx context.Context, groupModel models.Group) (models.Group, error) {
+	if !isAdmin(ctx) {
+		return models.Group{}, errors.New("forbidden")
+	}
+
+	g, err := a.groupService.Create(ctx, groupModel)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	return g, nil
+}
+
+func (a *App) GetGroupByID(ctx context.Context, id string) (models.Group, error) {
+	if !isAdmin(ctx) {
+		return models.Group{}, errors.New("forbidden")
+	}
+
+	g, err := a.groupService.Get(ctx, id)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return g, nil
+}
+
+func (a *App) ListGroups(ctx context.Context) ([]models.Group, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	groups, err := a.groupService.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// UpdateGroup changes the name and description of the group, the fields that are nil are left as they are.
+func (a *App) UpdateGroup(ctx context.Context, id string, name, description *string) (models.Group, error) {
+	if !isAdmin(ctx) {
+		return models.Group{}, errors.New("forbidden")
+	}
+
+	g, err := a.groupService.Get(ctx, id)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	if name != nil {
+		g.Name = *name
+	}
+	if description != nil {
+		g.Description = *description
+	}
+
+	g, err = a.groupService.Update(ctx, g)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("failed to update group: %w", err)
+	}
+
+	return g, nil
+}
+
+func (a *App) DeleteGroup(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.groupService.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) GetGroupMembers(ctx context.Context, id string) ([]models.User, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	users, err := a.groupService.GetMembers(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of group: %w", err)
+	}
+
+	return users, nil
+}
+
+func (a *App) AddGroupMember(ctx context.Context, groupID, userID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.groupService.AddMember(ctx, groupID, userID); err != nil {
+		return fmt.Errorf("failed to add member to group: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.groupService.RemoveMember(ctx, groupID, userID); err != nil {
+		return fmt.Errorf("failed to remove member from group: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) GetGroupsOfUser(ctx context.Context, userID string) ([]models.Group, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	groups, err := a.groupService.GetGroupsOfUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups of user: %w", err)
+	}
+
+	return groups, nil
+}
+
+func (a *App) GetRolesOfGroup(ctx context.Context, id string) ([]models.Role, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	roles, err := a.groupService.GetRoles(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles of group: %w", err)
+	}
+
+	return roles, nil
+}
+
+func (a *App) AssignGroupRole(ctx context.Context, groupID, roleID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.groupService.AssignRole(ctx, groupID, roleID); err != nil {
+		return fmt.Errorf("failed to assign role to group: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) RemoveGroupRole(ctx context.Context, groupID, roleID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.groupService.RemoveRole(ctx, groupID, roleID); err != nil {
+		return fmt.Errorf("failed to remove role from group: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) CreateOrg(ctx context.Context, orgModel models.Org) (models.Org, error) {
+	if !isAdmin(ctx) {
+		return models.Org{}, errors.New("forbidden")
+	}
+
+	o, err := a.orgService.Create(ctx, orgModel)
+	if err != nil {
+		return models.Org{}, fmt.Errorf("failed to create org: %w", err)
+	}
+
+	return o, nil
+}
+
+func (a *App) GetOrgByID(ctx context.Context, id string) (models.Org, error) {
+	if !isAdmin(ctx) {
+		return models.Org{}, errors.New("forbidden")
+	}
+
+	o, err := a.orgService.Get(ctx, id)
+	if err != nil {
+		return models.Org{}, fmt.Errorf("failed to get org: %w", err)
+	}
+
+	return o, nil
+}
+
+func (a *App) ListOrgs(ctx context.Context) ([]models.Org, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	orgs, err := a.orgService.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orgs: %w", err)
+	}
+
+	return orgs, nil
+}
+
+func (a *App) RenameOrg(ctx context.Context, id string, name string) (models.Org, error) {
+	if !isAdmin(ctx) {
+		return models.Org{}, errors.New("forbidden")
+	}
+
+	o, err := a.orgService.Update(ctx, models.Org{ID: id, Name: name})
+	if err != nil {
+		return models.Org{}, fmt.Errorf("failed to update org: %w", err)
+	}
+
+	return o, nil
+}
+
+// DeleteOrg deletes the org and the roles of it.
+func (a *App) DeleteOrg(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.orgService.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete org: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) GetOrgMembers(ctx context.Context, id string) ([]models.User, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	users, err := a.orgService.GetMembers(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of org: %w", err)
+	}
+
+	return users, nil
+}
+
+func (a *App) AddOrgMember(ctx context.Context, orgID, userID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.orgService.AddMember(ctx, orgID, userID); err != nil {
+		return fmt.Errorf("failed to add member to org: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveOrgMember removes the user from the org, the roles of the org that the user had are removed with it.
+func (a *App) RemoveOrgMember(ctx context.Context, orgID, userID string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.orgService.RemoveMember(ctx, orgID, userID); err != nil {
+		return fmt.Errorf("failed to remove member from org: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) GetOrgsOfUser(ctx context.Context, userID string) ([]models.Org, error) {
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, userID) {
+		return nil, errors.New("forbidden")
+	}
+
+	orgs, err := a.orgService.GetOrgsOfUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orgs of user: %w", err)
+	}
+
+	return orgs, nil
+}
+
+// SwitchOrg issues a new token for the user of the current token with orgID as the active org.
+// The token has no active org if orgID is empty. The new token expires when the current one does.
+func (a *App) SwitchOrg(ctx context.Context, orgID string) (string, error) {
+	claims := sdk.ClaimFromCtx(ctx)
+	if claims == nil {
+		return "", errors.New("unauthorized")
+	}
+
+	if orgID != "" {
+		if err := a.orgService.CheckMember(ctx, orgID, claims.UserID); err != nil {
+			return "", fmt.Errorf("failed to switch org: %w", err)
+		}
+	}
+
+	u, err := a.userService.Get(ctx, repo.GetUserParams{ID: &claims.UserID})
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if u.Disabled {
+		return "", errors.New("forbidden")
+	}
+
+	token, err := a.auth.CreateToken(ctx, u, authorizer.TokenParams{
+		AuthMethods: claims.AuthMethods,
+		OrgID:       orgID,
+		ExpiresAt:   claims.ExpiresAt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RequestElevation requests the role for the user of the token for the duration, to be approved by an admin.
+func (a *App) RequestElevation(ctx context.Context, roleID, reason string, duration time.Duration) (models.ElevationRequest, error) {
+	claims := sdk.ClaimFromCtx(ctx)
+	if claims == nil {
+		return models.ElevationRequest{}, errors.New("unauthorized")
+	}
+
+	if a.elevationService == nil {
+		return models.ElevationRequest{}, errors.New("elevation requests are not enabled")
+	}
+
+	r, err := a.roleService.Get(ctx, roleID)
+	if err != nil {
+		return models.ElevationRequest{}, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if r.OrgID != "" {
+		if err := a.orgService.CheckMember(ctx, r.OrgID, claims.UserID); err != nil {
+			return models.ElevationRequest{}, fmt.Errorf("failed to request elevation: %w", err)
+		}
+	}
+
+	request, err := a.elevationService.Request(ctx, claims.UserID, roleID, reason, duration)
+	if err != nil {
+		return models.ElevationRequest{}, fmt.Errorf("failed to request elevation: %w", err)
+	}
+
+	return request, nil
+}
+
+func (a *App) GetElevationRequest(ctx context.Context, id string) (models.ElevationRequest, error) {
+	if sdk.ClaimFromCtx(ctx) == nil {
+		return models.ElevationRequest{}, errors.New("unauthorized")
+	}
+
+	if a.elevationService == nil {
+		return models.ElevationRequest{}, errors.New("elevation requests are not enabled")
+	}
+
+	request, err := a.elevationService.Get(ctx, id)
+	if err != nil {
+		return models.ElevationRequest{}, fmt.Errorf("failed to get elevation request: %w", err)
+	}
+
+	if !isAdmin(ctx) && !sdk.UserIs(ctx, request.UserID) {
+		return models.ElevationRequest{}, errors.New("forbidden")
+	}
+
+	return request, nil
+}
+
+// ListElevationRequests lists the requests matching the params. Users that are not admins can list their own requests.
+func (a *App) ListElevationRequests(ctx context.Context, params repo.ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	if !isAdmin(ctx) && (params.UserID == "" || !sdk.UserIs(ctx, params.UserID)) {
+		return nil, errors.New("forbidden")
+	}
+
+	if a.elevationService == nil {
+		return nil, errors.New("elevation requests are not enabled")
+	}
+
+	requests, err := a.elevationService.List(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list elevation requests: %w", err)
+	}
+
+	return requests, nil
+}
+
+func (a *App) ApproveElevationRequest(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if a.elevationService == nil {
+		return errors.New("elevation requests are not enabled")
+	}
+
+	if err := a.elevationService.Approve(ctx, id, sdk.ClaimFromCtx(ctx).UserID); err != nil {
+		return fmt.Errorf("failed to approve elevation request: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) DenyElevationRequest(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if a.elevationService == nil {
+		return errors.New("elevation requests are not enabled")
+	}
+
+	if err := a.elevationService.Deny(ctx, id, sdk.ClaimFromCtx(ctx).UserID); err != nil {
+		return fmt.Errorf("failed to deny elevation request: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) CreatePolicy(ctx context.Context, policyModel models.Policy) (models.Policy, error) {
+	if !isAdmin(ctx) {
+		return models.Policy{}, errors.New("forbidden")
+	}
+
+	p, err := a.policyService.Create(ctx, policyModel)
+	if err != nil {
+		return models.Policy{}, fmt.Errorf("failed to create policy: %w", err)
+	}
+
+	return p, nil
+}
+
+func (a *App) GetPolicyByID(ctx context.Context, id string) (models.Policy, error) {
+	if !isAdmin(ctx) {
+		return models.Policy{}, errors.New("forbidden")
+	}
+
+	p, err := a.policyService.Get(ctx, id)
+	if err != nil {
+		return models.Policy{}, fmt.Errorf("failed to get policy: %w", err)
+	}
+
+	return p, nil
+}
+
+func (a *App) ListPolicies(ctx context.Context) ([]models.Policy, error) {
+	if !isAdmin(ctx) {
+		return nil, errors.New("forbidden")
+	}
+
+	policies, err := a.policyService.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// UpdatePolicy replaces the policy with the id of policyModel.
+func (a *App) UpdatePolicy(ctx context.Context, policyModel models.Policy) (models.Policy, error) {
+	if !isAdmin(ctx) {
+		return models.Policy{}, errors.New("forbidden")
+	}
+
+	p, err := a.policyService.Update(ctx, policyModel)
+	if err != nil {
+		return models.Policy{}, fmt.Errorf("failed to update policy: %w", err)
+	}
+
+	return p, nil
+}
+
+func (a *App) DeletePolicy(ctx context.Context, id string) error {
+	if !isAdmin(ctx) {
+		return errors.New("forbidden")
+	}
+
+	if err := a.policyService.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete policy: %w", err)
+	}
+
+	return nil
+}
+
+// Authorize decides by the policies whether the user of the token may take the action of the request.
+func (a *App) Authorize(ctx context.Context, req sdk.AuthorizeRequest) (sdk.Decision, error) {
+	claims := sdk.ClaimFromCtx(ctx)
+	if claims == nil {
+		return sdk.Decision{}, errors.New("unauthorized")
+	}
+
+	decision, err := a.policyService.Decide(ctx, claims, req)
+	if err != nil {
+		return sdk.Decision{}, fmt.Errorf("failed to decide: %w", err)
+	}
+
+	return decision, nil
 }
@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/theleeeo/thor/models"
 	"github.com/theleeeo/thor/user"
 )
 
@@ -47,6 +49,11 @@ func (a *Authorizer) PublicKey() []byte {
 	return a.rawPublicKey
 }
 
+// ValidDuration is how long the created tokens are valid.
+func (a *Authorizer) ValidDuration() time.Duration {
+	return a.validDuration
+}
+
 func (a *Authorizer) ServePublicKeys(w http.ResponseWriter, r *http.Request) {
 
 	type key struct {
@@ -77,23 +84,46 @@ func (a *Authorizer) Decode(token string) (*Claims, error) {
 	return claims, nil
 }
 
-func (a *Authorizer) CreateToken(ctx context.Context, u user.User) (string, error) {
-	perms, err := u.Permissions(ctx)
+type TokenParams struct {
+	// How the user authenticated, see the AuthMethod constants
+	AuthMethods []string
+	// The active org of the token, its permissions are included. The token has no org if it is empty.
+	OrgID string
+	// When the token expires if it is before the valid duration has passed, e.g. to not outlive the token it replaces
+	ExpiresAt time.Time
+}
+
+func (a *Authorizer) CreateToken(ctx context.Context, u user.User, params TokenParams) (string, error) {
+	perms, err := u.Permissions(ctx, params.OrgID)
 	if err != nil {
 		return "", fmt.Errorf("error getting permissions of user: %w", err)
 	}
 
-	permissions := make(map[string]string)
-	for _, p := range perms {
-		permissions[p.Key] = p.Val
+	permissions := MergePermissions(perms)
+
+	expiresAt := time.Now().Add(a.validDuration)
+	if !params.ExpiresAt.IsZero() && params.ExpiresAt.Before(expiresAt) {
+		expiresAt = params.ExpiresAt
+	}
+
+	// The token must not carry a permission past the expiry of the roles granting it
+	permsExpireAt, err := u.PermissionsExpireAt(ctx, params.OrgID)
+	if err != nil {
+		return "", fmt.Errorf("error getting when the permissions of the user expire: %w", err)
+	}
+	if permsExpireAt != nil && permsExpireAt.Before(expiresAt) {
+		expiresAt = *permsExpireAt
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA,
 		&Claims{
 			Issuer:      a.appUrl,
 			UserID:      u.ID,
-			ExpiresAt:   time.Now().Add(a.validDuration),
+			ExpiresAt:   expiresAt,
+			OrgID:       params.OrgID,
 			Permissions: permissions,
+			AuthMethods: params.AuthMethods,
+			AuthContext: authContext(params.AuthMethods),
 		},
 	)
 
@@ -104,3 +134,29 @@ func (a *Authorizer) CreateToken(ctx context.Context, u user.User) (string, erro
 
 	return tokenString, nil
 }
+
+func authContext(authMethods []string) string {
+	for _, m := range authMethods {
+		if m == AuthMethodMFA {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// MergePermissions groups the permissions by key. When several values of a key are granted the user has all of them,
+// the values are sorted so that the result does not depend on the order of the roles.
+func MergePermissions(perms []models.Permission) map[string]PermissionValues {
+	merged := make(map[string]PermissionValues)
+	for _, p := range perms {
+		if !merged[p.Key].Has(p.Val) {
+			merged[p.Key] = append(merged[p.Key], p.Val)
+		}
+	}
+
+	for _, values := range merged {
+		slices.Sort(values)
+	}
+
+	return merged
+}
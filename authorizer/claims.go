@@ -1,16 +1,77 @@
 package authorizer
 
 import (
+	"encoding/json"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Authentication methods used in the amr claim.
+// The values follow RFC 8176 where there is a matching one.
+const (
+	// Logged in through an external identity provider
+	AuthMethodFederated = "fed"
+	// Logged in by a link sent by email
+	AuthMethodEmail    = "email"
+	AuthMethodPassword = "pwd"
+	// A time-based one-time password or a recovery code
+	AuthMethodOTP = "otp"
+	// A proof of possession of a hardware-secured key, e.g. a passkey
+	AuthMethodHardwareKey = "hwk"
+	// More than one authentication method was used
+	AuthMethodMFA = "mfa"
+)
+
+// Authentication context classes used in the acr claim.
+const (
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
 type Claims struct {
-	Issuer      string            `json:"iss"`
-	UserID      string            `json:"sub"`
-	ExpiresAt   time.Time         `json:"exp"`
-	Permissions map[string]string `json:"perms"`
+	Issuer    string    `json:"iss"`
+	UserID    string    `json:"sub"`
+	ExpiresAt time.Time `json:"exp"`
+	// The active org, the permissions are those of the user in the org. Empty if no org is active.
+	OrgID       string                      `json:"org,omitempty"`
+	Permissions map[string]PermissionValues `json:"perms"`
+	// How the user authenticated, e.g. ["fed", "otp", "mfa"]
+	AuthMethods []string `json:"amr,omitempty"`
+	// The strength of the authentication, ACRMultiFactor if MFA was used
+	AuthContext string `json:"acr,omitempty"`
+}
+
+// PermissionValues are the values of a permission key that the user is granted, sorted.
+// A single value is encoded as a string and several values as an array.
+type PermissionValues []string
+
+func (v PermissionValues) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+func (v *PermissionValues) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*v = PermissionValues{value}
+		return nil
+	}
+
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*v = values
+	return nil
+}
+
+// Has reports whether the value is one of the values.
+func (v PermissionValues) Has(value string) bool {
+	return slices.Contains(v, value)
 }
 
 func (c *Claims) GetAudience() (jwt.ClaimStrings, error) {
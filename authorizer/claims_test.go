@@ -0,0 +1,100 @@
+package authorizer
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+)
+
+func Test_PermissionValuesJSON(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		values PermissionValues
+		want   string
+	}{
+		{desc: "one value", values: PermissionValues{"true"}, want: `"true"`},
+		{desc: "several values", values: PermissionValues{"a", "b", "c"}, want: `["a","b","c"]`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			data, err := json.Marshal(tC.values)
+			if err != nil || string(data) != tC.want {
+				t.Fatalf("Marshal() = %s, %v; want %s", data, err, tC.want)
+			}
+
+			var got PermissionValues
+			if err := json.Unmarshal(data, &got); err != nil || !slices.Equal(got, tC.values) {
+				t.Errorf("Unmarshal() = %v, %v; want %v", got, err, tC.values)
+			}
+		})
+	}
+}
+
+func Test_PermissionValuesUnmarshalInvalid(t *testing.T) {
+	var got PermissionValues
+	if err := json.Unmarshal([]byte(`{"a":"b"}`), &got); err == nil {
+		t.Errorf("Unmarshal() of an object = %v, nil; want error", got)
+	}
+}
+
+func Test_MergePermissions(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		perms []models.Permission
+		want  map[string]PermissionValues
+	}{
+		{
+			desc: "none",
+			want: map[string]PermissionValues{},
+		},
+		{
+			desc:  "one value",
+			perms: []models.Permission{{Key: "admin", Val: "true"}},
+			want:  map[string]PermissionValues{"admin": {"true"}},
+		},
+		{
+			desc:  "values are sorted",
+			perms: []models.Permission{{Key: "team", Val: "c"}, {Key: "team", Val: "a"}, {Key: "team", Val: "b"}},
+			want:  map[string]PermissionValues{"team": {"a", "b", "c"}},
+		},
+		{
+			desc:  "duplicates are removed",
+			perms: []models.Permission{{Key: "team", Val: "b"}, {Key: "team", Val: "a"}, {Key: "team", Val: "b"}, {Key: "admin", Val: "true"}, {Key: "admin", Val: "true"}},
+			want:  map[string]PermissionValues{"team": {"a", "b"}, "admin": {"true"}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := MergePermissions(tC.perms)
+			if len(got) != len(tC.want) {
+				t.Fatalf("MergePermissions() = %v; want %v", got, tC.want)
+			}
+			for key, values := range tC.want {
+				if !slices.Equal(got[key], values) {
+					t.Errorf("MergePermissions()[%q] = %v; want %v", key, got[key], values)
+				}
+			}
+		})
+	}
+}
+
+func Test_MergePermissionsIsDeterministic(t *testing.T) {
+	perms := []models.Permission{{Key: "team", Val: "b"}, {Key: "team", Val: "a"}, {Key: "env", Val: "prod"}, {Key: "env", Val: "dev"}}
+	reversed := slices.Clone(perms)
+	slices.Reverse(reversed)
+
+	// The token is the same whichever order the roles granted the permissions in
+	a, err := json.Marshal(MergePermissions(perms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(MergePermissions(reversed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Errorf("MergePermissions() in reverse order = %s; want %s", b, a)
+	}
+}
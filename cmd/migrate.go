@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/theleeeo/thor/repo"
+)
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+}
+
+// loadMigrator creates the repo of the config without migrating it.
+func loadMigrator() (repo.Repo, repo.Migrator, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.RepoCfg == nil {
+		return nil, nil, fmt.Errorf("no repo configuration found")
+	}
+
+	repoCfg := *cfg.RepoCfg
+	repoCfg.AutoMigrate = false
+
+	r, err := repo.New(&repoCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, ok := r.(repo.Migrator)
+	if !ok {
+		r.Close()
+		return nil, nil, fmt.Errorf("the repo does not support migrations")
+	}
+
+	return r, m, nil
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the schema of the database",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all migrations that are not applied yet",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, m, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		applied, err := m.MigrateUp(cmd.Context())
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("the database is up to date")
+		}
+
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [steps]",
+	Short: "Revert the most recently applied migrations, one by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps := 1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive number: %s", args[0])
+			}
+			steps = n
+		}
+
+		r, m, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		reverted, err := m.MigrateDown(cmd.Context(), steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(reverted) == 0 {
+			fmt.Println("no migrations are applied")
+		}
+
+		return nil
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the migrations and when they were applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, m, err := loadMigrator()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		statuses, err := m.MigrationStatus(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = "applied at " + s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+
+		return nil
+	},
+}
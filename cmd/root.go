@@ -18,6 +18,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is ~/.thor.yml)")
 
 	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(migrateCmd)
 }
 
 func Execute() error {
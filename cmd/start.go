@@ -35,6 +35,7 @@ var startCmd = &cobra.Command{
 			return err
 		}
 
+		// The secrets in the config are tagged with json:"-" so that they are not printed
 		log.Println("Config:", prettyPrint(cfg))
 
 		if err := runner.Run(cfg); err != nil {
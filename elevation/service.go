@@ -0,0 +1,110 @@
+package elevation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+const defaultMaxDuration = 8 * time.Hour
+
+var (
+	ErrMissingReason   = errors.New("a reason is required")
+	ErrInvalidDuration = errors.New("the duration must be positive and at most the max duration")
+	// Someone else than the requester has to decide on a request
+	ErrOwnRequest = errors.New("the request was made by the same user")
+)
+
+type Config struct {
+	// The longest a role can be requested for. Defaults to 8 hours.
+	MaxDuration time.Duration `yaml:"max-duration"`
+}
+
+// Service manages the requests of users to be assigned a role for a while, which someone else approves or denies.
+type Service struct {
+	repo repo.Repo
+
+	maxDuration time.Duration
+}
+
+func NewService(cfg *Config, repo repo.Repo) *Service {
+	s := &Service{
+		repo:        repo,
+		maxDuration: cfg.MaxDuration,
+	}
+
+	if s.maxDuration == 0 {
+		s.maxDuration = defaultMaxDuration
+	}
+
+	return s
+}
+
+// Request creates a pending request by the user for the role, for the duration rounded down to whole seconds.
+func (s *Service) Request(ctx context.Context, userID, roleID, reason string, duration time.Duration) (models.ElevationRequest, error) {
+	if reason == "" {
+		return models.ElevationRequest{}, ErrMissingReason
+	}
+
+	if duration < time.Second || duration > s.maxDuration {
+		return models.ElevationRequest{}, ErrInvalidDuration
+	}
+
+	request := models.ElevationRequest{
+		ID:              uuid.NewString(),
+		UserID:          userID,
+		RoleID:          roleID,
+		Reason:          reason,
+		DurationSeconds: int64(duration / time.Second),
+		Status:          models.ElevationPending,
+		RequestedAt:     time.Now(),
+	}
+
+	if err := s.repo.CreateElevationRequest(ctx, request); err != nil {
+		return models.ElevationRequest{}, err
+	}
+
+	return request, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (models.ElevationRequest, error) {
+	return s.repo.GetElevationRequest(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context, params repo.ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	return s.repo.ListElevationRequests(ctx, params)
+}
+
+// Approve assigns the role of the pending request to its user for the requested duration, starting now.
+func (s *Service) Approve(ctx context.Context, id, approverID string) error {
+	if err := s.checkApprover(ctx, id, approverID); err != nil {
+		return err
+	}
+
+	return s.repo.ApproveElevationRequest(ctx, id, approverID, time.Now())
+}
+
+func (s *Service) Deny(ctx context.Context, id, approverID string) error {
+	if err := s.checkApprover(ctx, id, approverID); err != nil {
+		return err
+	}
+
+	return s.repo.DenyElevationRequest(ctx, id, approverID, time.Now())
+}
+
+func (s *Service) checkApprover(ctx context.Context, id, approverID string) error {
+	request, err := s.repo.GetElevationRequest(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if request.UserID == approverID {
+		return ErrOwnRequest
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package elevation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+type fixture struct {
+	r         repo.Repo
+	s         *Service
+	requester models.User
+	approver  models.User
+	role      models.Role
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+
+	ctx := context.Background()
+	r := repo.NewMemory()
+	f := fixture{
+		r:         r,
+		s:         NewService(&Config{MaxDuration: 4 * time.Hour}, r),
+		requester: models.User{ID: "requester", Name: "Leo", Email: "leo@example.com"},
+		approver:  models.User{ID: "approver", Name: "Admin", Email: "admin@example.com"},
+		role:      models.Role{ID: "role", Name: "deployers"},
+	}
+
+	for i, u := range []models.User{f.requester, f.approver} {
+		if err := r.CreateUser(ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: string(rune('1' + i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.CreateRole(ctx, f.role, []models.Permission{{Key: "deploy", Val: "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func Test_Request(t *testing.T) {
+	f := newFixture(t)
+
+	testCases := []struct {
+		desc     string
+		roleID   string
+		reason   string
+		duration time.Duration
+		wantErr  error
+	}{
+		{desc: "valid", roleID: f.role.ID, reason: "incident", duration: time.Hour},
+		{desc: "the max duration", roleID: f.role.ID, reason: "incident", duration: 4 * time.Hour},
+		{desc: "missing reason", roleID: f.role.ID, duration: time.Hour, wantErr: ErrMissingReason},
+		{desc: "too short", roleID: f.role.ID, reason: "incident", duration: time.Millisecond, wantErr: ErrInvalidDuration},
+		{desc: "negative", roleID: f.role.ID, reason: "incident", duration: -time.Hour, wantErr: ErrInvalidDuration},
+		{desc: "over the max duration", roleID: f.role.ID, reason: "incident", duration: 4*time.Hour + time.Second, wantErr: ErrInvalidDuration},
+		{desc: "missing role", roleID: "missing", reason: "incident", duration: time.Hour, wantErr: repo.ErrNotFound},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			request, err := f.s.Request(context.Background(), f.requester.ID, tC.roleID, tC.reason, tC.duration)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("Request() = %v; want %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr == nil && (request.Status != models.ElevationPending || request.DurationSeconds != int64(tC.duration/time.Second)) {
+				t.Errorf("Request() = %+v; want pending for %v", request, tC.duration)
+			}
+		})
+	}
+}
+
+func Test_Decide(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		decide  func(f fixture, id string) error
+		wantErr error
+	}{
+		{
+			desc:   "approved by someone else",
+			decide: func(f fixture, id string) error { return f.s.Approve(context.Background(), id, f.approver.ID) },
+		},
+		{
+			desc:    "approved by the requester",
+			decide:  func(f fixture, id string) error { return f.s.Approve(context.Background(), id, f.requester.ID) },
+			wantErr: ErrOwnRequest,
+		},
+		{
+			desc:   "denied by someone else",
+			decide: func(f fixture, id string) error { return f.s.Deny(context.Background(), id, f.approver.ID) },
+		},
+		{
+			desc:    "denied by the requester",
+			decide:  func(f fixture, id string) error { return f.s.Deny(context.Background(), id, f.requester.ID) },
+			wantErr: ErrOwnRequest,
+		},
+		{
+			desc:    "missing request",
+			decide:  func(f fixture, id string) error { return f.s.Approve(context.Background(), "missing", f.approver.ID) },
+			wantErr: repo.ErrNotFound,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			f := newFixture(t)
+
+			request, err := f.s.Request(context.Background(), f.requester.ID, f.role.ID, "incident", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tC.decide(f, request.ID); !errors.Is(err, tC.wantErr) {
+				t.Errorf("deciding = %v; want %v", err, tC.wantErr)
+			}
+
+			got, err := f.s.Get(context.Background(), request.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decided := got.Status != models.ElevationPending; decided != (tC.wantErr == nil) {
+				t.Errorf("Status = %v after deciding with %v", got.Status, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_DecidedOnce(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	approved, err := f.s.Request(ctx, f.requester.ID, f.role.ID, "incident", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.s.Approve(ctx, approved.ID, f.approver.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	denied, err := f.s.Request(ctx, f.requester.ID, f.role.ID, "incident", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.s.Deny(ctx, denied.ID, f.approver.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{approved.ID, denied.ID} {
+		if err := f.s.Approve(ctx, id, f.approver.ID); !errors.Is(err, repo.ErrNotFound) {
+			t.Errorf("Approve() of a decided request = %v; want %v", err, repo.ErrNotFound)
+		}
+		if err := f.s.Deny(ctx, id, f.approver.ID); !errors.Is(err, repo.ErrNotFound) {
+			t.Errorf("Deny() of a decided request = %v; want %v", err, repo.ErrNotFound)
+		}
+	}
+}
+
+func Test_ApproveAssignsRoleUntilExpiry(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	request, err := f.s.Request(ctx, f.requester.ID, f.role.ID, "incident", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := f.s.Approve(ctx, request.ID, f.approver.ID); err != nil {
+		t.Fatalf("Approve() = %v; want nil", err)
+	}
+
+	got, err := f.s.Get(ctx, request.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.ElevationApproved || got.DecidedBy == nil || *got.DecidedBy != f.approver.ID {
+		t.Errorf("Get() = %+v; want approved by %v", got, f.approver.ID)
+	}
+	if got.ExpiresAt == nil || got.ExpiresAt.Before(before.Add(time.Hour-time.Second)) || got.ExpiresAt.After(time.Now().Add(time.Hour+time.Second)) {
+		t.Errorf("ExpiresAt = %v; want an hour after the approval", got.ExpiresAt)
+	}
+
+	permissions, err := f.r.GetPermissionsOfUser(ctx, f.requester.ID, "")
+	if err != nil || len(permissions) != 1 {
+		t.Fatalf("GetPermissionsOfUser() = %v, %v; want the permission of the role", permissions, err)
+	}
+
+	// The assignment expires with the request, not before
+	if n, err := f.r.DeleteExpiredRoleAssignments(ctx, before.Add(30*time.Minute)); err != nil || n != 0 {
+		t.Errorf("DeleteExpiredRoleAssignments() before the expiry = %d, %v; want 0", n, err)
+	}
+	if n, err := f.r.DeleteExpiredRoleAssignments(ctx, before.Add(2*time.Hour)); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredRoleAssignments() after the expiry = %d, %v; want 1", n, err)
+	}
+	if permissions, err := f.r.GetPermissionsOfUser(ctx, f.requester.ID, ""); err != nil || len(permissions) != 0 {
+		t.Errorf("GetPermissionsOfUser() after the expiry = %v, %v; want none", permissions, err)
+	}
+}
+
+func Test_ApproveKeepsPermanentRole(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	if err := f.r.AssignRole(ctx, f.requester.ID, f.role.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := f.s.Request(ctx, f.requester.ID, f.role.ID, "incident", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.s.Approve(ctx, request.ID, f.approver.ID); err != nil {
+		t.Fatalf("Approve() of a role the user already has = %v; want nil", err)
+	}
+
+	if n, err := f.r.DeleteExpiredRoleAssignments(ctx, time.Now().Add(2*time.Hour)); err != nil || n != 0 {
+		t.Errorf("DeleteExpiredRoleAssignments() = %d, %v; want the permanent assignment kept", n, err)
+	}
+}
@@ -1,41 +1,121 @@
 package entrypoints
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/theleeeo/thor/app"
+	"github.com/theleeeo/thor/elevation"
+	"github.com/theleeeo/thor/mfa"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/org"
+	"github.com/theleeeo/thor/policy"
+	"github.com/theleeeo/thor/providertoken"
 	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/role"
+	"github.com/theleeeo/thor/sdk"
+	"github.com/theleeeo/thor/user"
 )
 
 type restHandler struct {
 	app        *app.App
 	cookieName string
+	// If the token cookies are only sent over https
+	secureCookie bool
 }
 
-func NewRestHandler(app *app.App, cookieName string) *restHandler {
+func NewRestHandler(app *app.App, cookieName string, secureCookie bool) *restHandler {
 	return &restHandler{
-		app:        app,
-		cookieName: cookieName,
+		app:          app,
+		cookieName:   cookieName,
+		secureCookie: secureCookie,
 	}
 }
 
 func (h *restHandler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("GET /public-key", h.PublicKey)
 	mux.HandleFunc("GET /whoami", h.WhoAmI)
+	mux.HandleFunc("POST /switch-org", h.SwitchOrg)
 
 	mux.HandleFunc("GET /users/{id}", h.GetUserByID)
+	mux.HandleFunc("PATCH /users/{id}", h.UpdateUser)
+	mux.HandleFunc("DELETE /users/{id}", h.DeleteUser)
+	mux.HandleFunc("POST /users/{id}/disable", h.DisableUser)
+	mux.HandleFunc("POST /users/{id}/enable", h.EnableUser)
 	mux.HandleFunc("GET /users/{id}/permissions", h.GetPermissionsOfUser)
+	mux.HandleFunc("GET /users/{id}/permissions/grants", h.GetPermissionGrantsOfUser)
+	mux.HandleFunc("GET /users/{id}/check", h.CheckPermission)
+	mux.HandleFunc("POST /users/{id}/check", h.CheckPermissions)
 	mux.HandleFunc("GET /users", h.ListUsers)
+	mux.HandleFunc("POST /users/local", h.CreateLocalUser)
+	mux.HandleFunc("PUT /users/{id}/password", h.SetPassword)
+	mux.HandleFunc("POST /users/{id}/mfa/totp", h.EnrollMFA)
+	mux.HandleFunc("POST /users/{id}/mfa/totp/confirm", h.ConfirmMFA)
+	mux.HandleFunc("DELETE /users/{id}/mfa/totp", h.DisableMFA)
+	mux.HandleFunc("POST /users/{id}/mfa/recovery-codes", h.RegenerateRecoveryCodes)
+	mux.HandleFunc("GET /users/{id}/passkeys", h.ListPasskeys)
+	mux.HandleFunc("DELETE /users/{id}/passkeys/{passkey_id}", h.DeletePasskey)
+	mux.HandleFunc("GET /users/{id}/provider-tokens/{provider}/{name}", h.GetProviderToken)
 	mux.HandleFunc("PATCH /users/{id}/roles/{role_id}", h.AssignRole)
 	mux.HandleFunc("DELETE /users/{id}/roles/{role_id}", h.RemoveRole)
 	mux.HandleFunc("GET /users/{id}/roles", h.GetRolesOfUser)
+	mux.HandleFunc("GET /users/{id}/groups", h.GetGroupsOfUser)
+	mux.HandleFunc("GET /users/{id}/orgs", h.GetOrgsOfUser)
 
 	mux.HandleFunc("GET /roles", h.ListRoles)
 	mux.HandleFunc("GET /roles/{id}", h.GetRoleByID)
 	mux.HandleFunc("POST /roles", h.CreateRole)
+	mux.HandleFunc("PATCH /roles/{id}", h.UpdateRole)
+	mux.HandleFunc("DELETE /roles/{id}", h.DeleteRole)
 	mux.HandleFunc("GET /roles/{id}/permissions", h.GetPermissionsOfRole)
+	mux.HandleFunc("PUT /roles/{id}/permissions", h.SetRolePermissions)
+	mux.HandleFunc("PATCH /roles/{id}/permissions", h.UpdateRolePermissions)
+
+	mux.HandleFunc("GET /permissions", h.ListPermissionDefinitions)
+	mux.HandleFunc("GET /roles/{id}/parents", h.GetParentsOfRole)
+	mux.HandleFunc("PUT /roles/{id}/parents", h.SetRoleParents)
+
+	mux.HandleFunc("GET /groups", h.ListGroups)
+	mux.HandleFunc("GET /groups/{id}", h.GetGroupByID)
+	mux.HandleFunc("POST /groups", h.CreateGroup)
+	mux.HandleFunc("PATCH /groups/{id}", h.UpdateGroup)
+	mux.HandleFunc("DELETE /groups/{id}", h.DeleteGroup)
+	mux.HandleFunc("GET /groups/{id}/members", h.GetGroupMembers)
+	mux.HandleFunc("PATCH /groups/{id}/members/{user_id}", h.AddGroupMember)
+	mux.HandleFunc("DELETE /groups/{id}/members/{user_id}", h.RemoveGroupMember)
+	mux.HandleFunc("GET /groups/{id}/roles", h.GetRolesOfGroup)
+	mux.HandleFunc("PATCH /groups/{id}/roles/{role_id}", h.AssignGroupRole)
+	mux.HandleFunc("DELETE /groups/{id}/roles/{role_id}", h.RemoveGroupRole)
+
+	mux.HandleFunc("GET /orgs", h.ListOrgs)
+	mux.HandleFunc("GET /orgs/{id}", h.GetOrgByID)
+	mux.HandleFunc("POST /orgs", h.CreateOrg)
+	mux.HandleFunc("PATCH /orgs/{id}", h.RenameOrg)
+	mux.HandleFunc("DELETE /orgs/{id}", h.DeleteOrg)
+	mux.HandleFunc("GET /orgs/{id}/members", h.GetOrgMembers)
+	mux.HandleFunc("PATCH /orgs/{id}/members/{user_id}", h.AddOrgMember)
+	mux.HandleFunc("DELETE /orgs/{id}/members/{user_id}", h.RemoveOrgMember)
+
+	mux.HandleFunc("GET /invitations", h.ListInvitations)
+	mux.HandleFunc("POST /invitations", h.CreateInvitation)
+	mux.HandleFunc("DELETE /invitations/{id}", h.RevokeInvitation)
+
+	mux.HandleFunc("GET /elevation-requests", h.ListElevationRequests)
+	mux.HandleFunc("GET /elevation-requests/{id}", h.GetElevationRequest)
+	mux.HandleFunc("POST /elevation-requests", h.RequestElevation)
+	mux.HandleFunc("POST /elevation-requests/{id}/approve", h.ApproveElevationRequest)
+	mux.HandleFunc("POST /elevation-requests/{id}/deny", h.DenyElevationRequest)
+
+	mux.HandleFunc("GET /policies", h.ListPolicies)
+	mux.HandleFunc("GET /policies/{id}", h.GetPolicyByID)
+	mux.HandleFunc("POST /policies", h.CreatePolicy)
+	mux.HandleFunc("PUT /policies/{id}", h.UpdatePolicy)
+	mux.HandleFunc("DELETE /policies/{id}", h.DeletePolicy)
+	mux.HandleFunc("POST /authorize", h.Authorize)
 }
 
 func (h *restHandler) PublicKey(w http.ResponseWriter, r *http.Request) {
@@ -116,8 +196,20 @@ func (h *restHandler) GetRoleByID(w http.ResponseWriter, r *http.Request) {
 	respond(w, role)
 }
 
+type ListUsersResponse struct {
+	Users []user.User `json:"users"`
+	// Pass as the cursor to get the next page, omitted on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 func (h *restHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.app.ListUsers(r.Context(), repo.ListUsersParams{})
+	params, err := parseListUsersParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, next, err := h.app.ListUsers(r.Context(), params)
 	if err != nil {
 		if err.Error() == "not found" {
 			http.Error(w, "not found", http.StatusNotFound)
@@ -131,16 +223,65 @@ func (h *restHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
 
 		respondError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	respond(w, users)
+	respond(w, ListUsersResponse{Users: users, NextCursor: next})
+}
+
+// parseListUsersParams parses the query of GET /users, e.g. ?email_prefix=a&provider=github&sort=-created_at&limit=20.
+func parseListUsersParams(r *http.Request) (repo.ListUsersParams, error) {
+	query := r.URL.Query()
+	params := repo.ListUsersParams{
+		EmailPrefix:  query.Get("email_prefix"),
+		NamePrefix:   query.Get("name_prefix"),
+		ProviderType: models.UserProviderType(query.Get("provider")),
+		RoleID:       query.Get("role"),
+		Cursor:       query.Get("cursor"),
+	}
+
+	var err error
+	if params.CreatedAfter, err = parseTimeQuery(query, "created_after"); err != nil {
+		return repo.ListUsersParams{}, err
+	}
+	if params.CreatedBefore, err = parseTimeQuery(query, "created_before"); err != nil {
+		return repo.ListUsersParams{}, err
+	}
+	if params.Limit, err = parseLimitQuery(query); err != nil {
+		return repo.ListUsersParams{}, err
+	}
+
+	sort, descending := parseSortQuery(query)
+	switch repo.UserSort(sort) {
+	case "", repo.UserSortCreatedAt, repo.UserSortEmail, repo.UserSortName:
+		params.Sort, params.Descending = repo.UserSort(sort), descending
+	default:
+		return repo.ListUsersParams{}, fmt.Errorf("invalid sort, must be created_at, email or name")
+	}
+
+	return params, nil
+}
+
+type ListRolesResponse struct {
+	Roles []role.Role `json:"roles"`
+	// Pass as the cursor to get the next page, omitted on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 func (h *restHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
-	roles, err := h.app.ListRoles(r.Context(), repo.ListRolesParams{})
+	params, err := parseListRolesParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	roles, next, err := h.app.ListRoles(r.Context(), params)
 	if err != nil {
 		if err.Error() == "not found" {
 			http.Error(w, "not found", http.StatusNotFound)
@@ -154,33 +295,64 @@ func (h *restHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
 
 		respondError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	respond(w, roles)
+	respond(w, ListRolesResponse{Roles: roles, NextCursor: next})
 }
 
-type CreateRoleParams struct {
-	Name        string            `json:"name"`
-	Permissions map[string]string `json:"permissions"`
+// parseListRolesParams parses the query of GET /roles, e.g. ?name_prefix=team-&org=<id>&sort=-name&limit=20.
+func parseListRolesParams(r *http.Request) (repo.ListRolesParams, error) {
+	query := r.URL.Query()
+	params := repo.ListRolesParams{
+		NamePrefix: query.Get("name_prefix"),
+		Cursor:     query.Get("cursor"),
+	}
+
+	// ?org= lists the global roles only
+	if query.Has("org") {
+		org := query.Get("org")
+		params.OrgID = &org
+	}
+
+	var err error
+	if params.Limit, err = parseLimitQuery(query); err != nil {
+		return repo.ListRolesParams{}, err
+	}
+
+	sort, descending := parseSortQuery(query)
+	switch repo.RoleSort(sort) {
+	case "", repo.RoleSortName:
+		params.Sort, params.Descending = repo.RoleSort(sort), descending
+	default:
+		return repo.ListRolesParams{}, fmt.Errorf("invalid sort, must be name")
+	}
+
+	return params, nil
 }
 
-func (h *restHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
-	createRoleParams, err := parse[CreateRoleParams](r)
+type CreateLocalUserParams struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *restHandler) CreateLocalUser(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[CreateLocalUserParams](r)
 	if err != nil {
 		slog.Error(err.Error())
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
-	var permissions []models.Permission
-	for k, v := range createRoleParams.Permissions {
-		permissions = append(permissions, models.Permission{Key: k, Val: v})
-	}
-
-	role, err := h.app.CreateRole(r.Context(), models.Role{Name: createRoleParams.Name}, permissions)
+	user, err := h.app.CreateLocalUser(r.Context(), models.User{Name: params.Name, Email: params.Email}, params.Username, params.Password)
 	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
@@ -195,23 +367,28 @@ func (h *restHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respond(w, role)
+	respond(w, user)
 }
 
-func (h *restHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+type SetPasswordParams struct {
+	Password string `json:"password"`
+}
+
+func (h *restHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 
-	role_id := r.PathValue("role_id")
-	if role_id == "" {
-		http.Error(w, "missing role_id", http.StatusBadRequest)
+	params, err := parse[SetPasswordParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
-	err := h.app.AssignRole(r.Context(), id, role_id)
+	err = h.app.SetPassword(r.Context(), id, params.Password)
 	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
@@ -229,20 +406,32 @@ func (h *restHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
 	respond(w, nil)
 }
 
-func (h *restHandler) RemoveRole(w http.ResponseWriter, r *http.Request) {
+// The fields that are left out are not changed
+type UpdateUserParams struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+func (h *restHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 
-	role_id := r.PathValue("role_id")
-	if role_id == "" {
-		http.Error(w, "missing role_id", http.StatusBadRequest)
+	params, err := parse[UpdateUserParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
-	err := h.app.RemoveRole(r.Context(), id, role_id)
+	if params.Email != nil && *params.Email == "" {
+		http.Error(w, "missing email", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.app.UpdateUser(r.Context(), id, params.Name, params.Email)
 	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
@@ -252,27 +441,69 @@ func (h *restHandler) RemoveRole(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
 
 		respondError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	respond(w, nil)
+	respond(w, user)
 }
 
-func (h *restHandler) GetRolesOfUser(w http.ResponseWriter, r *http.Request) {
+func (h *restHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.app.DisableUser)
+}
+
+func (h *restHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.app.EnableUser)
+}
+
+func (h *restHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.app.DeleteUser)
+}
+
+// changeUser handles the requests that disable, enable or delete the user of the path by calling change.
+func (h *restHandler) changeUser(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id string) error) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 
-	roles, err := h.app.GetRolesOfUser(r.Context(), id)
+	err := change(r.Context(), id)
 	if err != nil {
-		if err.Error() == "not found" {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	enrollment, err := h.app.EnrollMFA(r.Context(), id)
+	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
@@ -286,22 +517,58 @@ func (h *restHandler) GetRolesOfUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respond(w, roles)
+	respond(w, enrollment)
 }
 
-func (h *restHandler) GetPermissionsOfRole(w http.ResponseWriter, r *http.Request) {
+type ConfirmMFAParams struct {
+	Code string `json:"code"`
+}
+
+func (h *restHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 
-	permissions, err := h.app.GetPermissionsOfRole(r.Context(), id)
+	params, err := parse[ConfirmMFAParams](r)
 	if err != nil {
-		if err.Error() == "not found" {
-			http.Error(w, "not found", http.StatusNotFound)
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.app.ConfirmMFA(r.Context(), id, params.Code)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrEnrollmentNeeded) || errors.Is(err, mfa.ErrAlreadyEnrolled) {
+			respondError(w, err, http.StatusBadRequest)
 			return
 		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, map[string][]string{"recovery_codes": codes})
+}
+
+func (h *restHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.DisableMFA(r.Context(), id)
+	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
@@ -315,22 +582,103 @@ func (h *restHandler) GetPermissionsOfRole(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	respond(w, permissions)
+	respond(w, nil)
 }
 
-func (h *restHandler) GetPermissionsOfUser(w http.ResponseWriter, r *http.Request) {
+func (h *restHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 
-	permissions, err := h.app.GetPermissionsOfUser(r.Context(), id)
+	codes, err := h.app.RegenerateRecoveryCodes(r.Context(), id)
 	if err != nil {
-		if err.Error() == "not found" {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, map[string][]string{"recovery_codes": codes})
+}
+
+func (h *restHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	passkeys, err := h.app.ListPasskeys(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, passkeys)
+}
+
+func (h *restHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	passkeyID := r.PathValue("passkey_id")
+	if passkeyID == "" {
+		http.Error(w, "missing passkey id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.DeletePasskey(r.Context(), id, passkeyID)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) GetProviderToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.app.GetProviderToken(r.Context(), id, models.UserProviderType(r.PathValue("provider")), r.PathValue("name"))
+	if err != nil {
 		if err.Error() == "forbidden" {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
@@ -339,10 +687,1665 @@ func (h *restHandler) GetPermissionsOfUser(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, providertoken.ErrExpired) {
+			http.Error(w, "the token has expired and can not be refreshed", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, providertoken.ErrUserDisabled) {
+			http.Error(w, "the user is disabled", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, providertoken.ErrRefreshFailed) {
+			respondError(w, err, http.StatusBadGateway)
+			return
+		}
 
 		respondError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	respond(w, permissions)
+	respond(w, token)
+}
+
+type CreateRoleParams struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// The org the role belongs to, the role is global if it is empty
+	OrgID       string            `json:"org_id"`
+	Permissions map[string]string `json:"permissions"`
+}
+
+func (h *restHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	createRoleParams, err := parse[CreateRoleParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var permissions []models.Permission
+	for k, v := range createRoleParams.Permissions {
+		permissions = append(permissions, models.Permission{Key: k, Val: v})
+	}
+
+	created, err := h.app.CreateRole(r.Context(), models.Role{Name: createRoleParams.Name, Description: createRoleParams.Description, OrgID: createRoleParams.OrgID}, permissions)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "org not found", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, role.ErrInvalidPermission) {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, created)
+}
+
+// The fields that are left out are not changed
+type UpdateRoleParams struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+func (h *restHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[UpdateRoleParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Name != nil && *params.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.app.UpdateRole(r.Context(), id, params.Name, params.Description)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "a role with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, role)
+}
+
+type DeleteRoleResponse struct {
+	// The role was not deleted, the response shows what deleting it would do
+	DryRun bool `json:"dry_run"`
+	// The users that had the role
+	AffectedUsers []models.User `json:"affected_users"`
+}
+
+func (h *restHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseBoolQuery(r.URL.Query(), "dry_run")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.app.DeleteRole(r.Context(), id, dryRun)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, DeleteRoleResponse{DryRun: dryRun, AffectedUsers: users})
+}
+
+type SetRolePermissionsParams struct {
+	Permissions []models.Permission `json:"permissions"`
+}
+
+func (h *restHandler) SetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[SetRolePermissionsParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	h.respondPermissionsChange(w, r, id, h.app.SetRolePermissions(r.Context(), id, params.Permissions))
+}
+
+type UpdateRolePermissionsParams struct {
+	Add    []models.Permission `json:"add"`
+	Remove []models.Permission `json:"remove"`
+}
+
+func (h *restHandler) UpdateRolePermissions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[UpdateRolePermissionsParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	h.respondPermissionsChange(w, r, id, h.app.UpdateRolePermissions(r.Context(), id, params.Add, params.Remove))
+}
+
+// respondPermissionsChange responds with the permissions of the role after they were changed, or with the error of the change.
+func (h *restHandler) respondPermissionsChange(w http.ResponseWriter, r *http.Request, roleID string, err error) {
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "duplicate permissions", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, role.ErrInvalidPermission) {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	permissions, err := h.app.GetPermissionsOfRole(r.Context(), roleID)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, permissions)
+}
+
+func (h *restHandler) ListPermissionDefinitions(w http.ResponseWriter, r *http.Request) {
+	definitions, err := h.app.ListPermissionDefinitions(r.Context())
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, definitions)
+}
+
+func (h *restHandler) GetParentsOfRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	parents, err := h.app.GetParentsOfRole(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, parents)
+}
+
+type SetRoleParentsParams struct {
+	ParentIDs []string `json:"parent_ids"`
+}
+
+func (h *restHandler) SetRoleParents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[SetRoleParentsParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = h.app.SetRoleParents(r.Context(), id, params.ParentIDs)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrCycle) {
+			http.Error(w, repo.ErrCycle.Error(), http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	role_id := r.PathValue("role_id")
+	if role_id == "" {
+		http.Error(w, "missing role_id", http.StatusBadRequest)
+		return
+	}
+
+	// The role is assigned permanently unless ?expires_at= is given
+	var expiresAt *time.Time
+	if v := r.URL.Query().Get("expires_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !t.After(time.Now()) {
+			http.Error(w, "invalid expires_at, must be a future RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		expiresAt = &t
+	}
+
+	err := h.app.AssignRole(r.Context(), id, role_id, expiresAt)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, org.ErrNotMember) {
+			http.Error(w, org.ErrNotMember.Error(), http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) RemoveRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	role_id := r.PathValue("role_id")
+	if role_id == "" {
+		http.Error(w, "missing role_id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.RemoveRole(r.Context(), id, role_id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) GetRolesOfUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.app.GetRolesOfUser(r.Context(), id)
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, roles)
+}
+
+func (h *restHandler) GetPermissionsOfRole(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := h.app.GetPermissionsOfRole(r.Context(), id)
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, permissions)
+}
+
+type PermissionGrantsResponse struct {
+	Grants []models.PermissionGrant `json:"grants"`
+	// The keys the user has several values of, the grants tell which roles they came from
+	Conflicts []models.PermissionConflict `json:"conflicts"`
+}
+
+func (h *restHandler) GetPermissionGrantsOfUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	grants, err := h.app.GetPermissionGrantsOfUser(r.Context(), id, r.URL.Query().Get("org"))
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if errors.Is(err, org.ErrNotMember) {
+			http.Error(w, org.ErrNotMember.Error(), http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	permissions := make([]models.Permission, 0, len(grants))
+	for _, g := range grants {
+		permissions = append(permissions, g.Permission)
+	}
+
+	respond(w, PermissionGrantsResponse{Grants: grants, Conflicts: user.PermissionConflicts(permissions)})
+}
+
+// CheckPermission explains whether the user has the permission of ?key= and ?value= in the org of ?org=.
+func (h *restHandler) CheckPermission(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	permission := models.Permission{Key: query.Get("key"), Val: query.Get("value")}
+	if permission.Key == "" || permission.Val == "" {
+		http.Error(w, "missing key or value", http.StatusBadRequest)
+		return
+	}
+
+	checks, ok := h.checkPermissions(w, r, id, query.Get("org"), []models.Permission{permission})
+	if !ok {
+		return
+	}
+
+	respond(w, checks[0])
+}
+
+// The most permissions that can be checked at once
+const maxPermissionChecks = 100
+
+type CheckPermissionsParams struct {
+	// The org to check the permissions in, the global roles only if it is empty
+	OrgID       string              `json:"org_id"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// CheckPermissions explains whether the user has each of the permissions, in the order they were given.
+func (h *restHandler) CheckPermissions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[CheckPermissionsParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if len(params.Permissions) > maxPermissionChecks {
+		http.Error(w, fmt.Sprintf("at most %d permissions can be checked at once", maxPermissionChecks), http.StatusBadRequest)
+		return
+	}
+
+	checks, ok := h.checkPermissions(w, r, id, params.OrgID, params.Permissions)
+	if !ok {
+		return
+	}
+
+	respond(w, checks)
+}
+
+// checkPermissions checks the permissions of the user and responds with the error if it fails.
+func (h *restHandler) checkPermissions(w http.ResponseWriter, r *http.Request, userID string, orgID string, permissions []models.Permission) ([]models.PermissionCheck, bool) {
+	checks, err := h.app.CheckPermissions(r.Context(), userID, orgID, permissions)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return nil, false
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return nil, false
+		}
+
+		if errors.Is(err, org.ErrNotMember) {
+			http.Error(w, org.ErrNotMember.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return checks, true
+}
+
+type PermissionsResponse struct {
+	Permissions []models.Permission `json:"permissions"`
+	// The keys the user has several values of, from different roles. The token has all of the values.
+	Conflicts []models.PermissionConflict `json:"conflicts"`
+}
+
+func (h *restHandler) GetPermissionsOfUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := h.app.GetPermissionsOfUser(r.Context(), id, r.URL.Query().Get("org"))
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if errors.Is(err, org.ErrNotMember) {
+			http.Error(w, org.ErrNotMember.Error(), http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, PermissionsResponse{Permissions: permissions, Conflicts: user.PermissionConflicts(permissions)})
+}
+
+type CreateInvitationParams struct {
+	Email   string   `json:"email"`
+	RoleIDs []string `json:"role_ids"`
+}
+
+func (h *restHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[CreateInvitationParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.app.CreateInvitation(r.Context(), params.Email, params.RoleIDs)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "role not found", http.StatusBadRequest)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, invitation)
+}
+
+func (h *restHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.app.ListInvitations(r.Context())
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, invitations)
+}
+
+func (h *restHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.RevokeInvitation(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.app.ListGroups(r.Context())
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, groups)
+}
+
+func (h *restHandler) GetGroupByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.app.GetGroupByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, group)
+}
+
+type CreateGroupParams struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (h *restHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[CreateGroupParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.app.CreateGroup(r.Context(), models.Group{Name: params.Name, Description: params.Description})
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "a group with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, group)
+}
+
+// The fields that are left out are not changed
+type UpdateGroupParams struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+func (h *restHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[UpdateGroupParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Name != nil && *params.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.app.UpdateGroup(r.Context(), id, params.Name, params.Description)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "a group with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, group)
+}
+
+func (h *restHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.DeleteGroup(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) GetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.app.GetGroupMembers(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, users)
+}
+
+func (h *restHandler) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "user_id", h.app.AddGroupMember)
+}
+
+func (h *restHandler) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "user_id", h.app.RemoveGroupMember)
+}
+
+func (h *restHandler) GetRolesOfGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.app.GetRolesOfGroup(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, roles)
+}
+
+func (h *restHandler) AssignGroupRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "role_id", h.app.AssignGroupRole)
+}
+
+func (h *restHandler) RemoveGroupRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "role_id", h.app.RemoveGroupRole)
+}
+
+// changeRelation handles the requests that add or remove a member or role of the group or org of the path by calling
+// change with the id of the path and the path value with the name.
+func (h *restHandler) changeRelation(w http.ResponseWriter, r *http.Request, name string, change func(ctx context.Context, parentID, id string) error) {
+	parentID := r.PathValue("id")
+	if parentID == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue(name)
+	if id == "" {
+		http.Error(w, "missing "+name, http.StatusBadRequest)
+		return
+	}
+
+	err := change(r.Context(), parentID, id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) GetGroupsOfUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.app.GetGroupsOfUser(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, groups)
+}
+
+func (h *restHandler) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.app.ListOrgs(r.Context())
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, orgs)
+}
+
+func (h *restHandler) GetOrgByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	o, err := h.app.GetOrgByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, o)
+}
+
+type OrgParams struct {
+	Name string `json:"name"`
+}
+
+func (h *restHandler) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[OrgParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	o, err := h.app.CreateOrg(r.Context(), models.Org{Name: params.Name})
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "an org with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, o)
+}
+
+func (h *restHandler) RenameOrg(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[OrgParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	o, err := h.app.RenameOrg(r.Context(), id, params.Name)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "an org with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, o)
+}
+
+func (h *restHandler) DeleteOrg(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.DeleteOrg(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) GetOrgMembers(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.app.GetOrgMembers(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, users)
+}
+
+func (h *restHandler) AddOrgMember(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "user_id", h.app.AddOrgMember)
+}
+
+func (h *restHandler) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	h.changeRelation(w, r, "user_id", h.app.RemoveOrgMember)
+}
+
+func (h *restHandler) GetOrgsOfUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	orgs, err := h.app.GetOrgsOfUser(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, orgs)
+}
+
+type SwitchOrgParams struct {
+	// The org to switch to, no org is active if it is empty
+	OrgID string `json:"org_id"`
+}
+
+// SwitchOrg replaces the token cookie with a token for the org and responds with the token.
+func (h *restHandler) SwitchOrg(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[SwitchOrgParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.app.SwitchOrg(r.Context(), params.OrgID)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, org.ErrNotMember) {
+			http.Error(w, org.ErrNotMember.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Secure:   h.secureCookie,
+	})
+
+	respond(w, token)
+}
+
+type RequestElevationParams struct {
+	RoleID string `json:"role_id"`
+	Reason string `json:"reason"`
+	// How long the role is needed for, e.g. "2h"
+	Duration string `json:"duration"`
+}
+
+func (h *restHandler) RequestElevation(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[RequestElevationParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.RoleID == "" {
+		http.Error(w, "missing role_id", http.StatusBadRequest)
+		return
+	}
+
+	duration, err := time.ParseDuration(params.Duration)
+	if err != nil {
+		http.Error(w, "invalid duration", http.StatusBadRequest)
+		return
+	}
+
+	request, err := h.app.RequestElevation(r.Context(), params.RoleID, params.Reason, duration)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "role not found", http.StatusBadRequest)
+			return
+		}
+		for _, invalid := range []error{elevation.ErrMissingReason, elevation.ErrInvalidDuration, org.ErrNotMember} {
+			if errors.Is(err, invalid) {
+				http.Error(w, invalid.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, request)
+}
+
+// ListElevationRequests lists the requests, filtered by ?user_id= and ?status=.
+func (h *restHandler) ListElevationRequests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := repo.ListElevationRequestsParams{
+		UserID: query.Get("user_id"),
+		Status: models.ElevationStatus(query.Get("status")),
+	}
+
+	switch params.Status {
+	case "", models.ElevationPending, models.ElevationApproved, models.ElevationDenied:
+	default:
+		http.Error(w, "invalid status, must be pending, approved or denied", http.StatusBadRequest)
+		return
+	}
+
+	requests, err := h.app.ListElevationRequests(r.Context(), params)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, requests)
+}
+
+func (h *restHandler) GetElevationRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	request, err := h.app.GetElevationRequest(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, request)
+}
+
+func (h *restHandler) ApproveElevationRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideElevationRequest(w, r, h.app.ApproveElevationRequest)
+}
+
+func (h *restHandler) DenyElevationRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideElevationRequest(w, r, h.app.DenyElevationRequest)
+}
+
+// decideElevationRequest handles the requests that approve or deny the elevation request of the path by calling decide with its id.
+func (h *restHandler) decideElevationRequest(w http.ResponseWriter, r *http.Request, decide func(ctx context.Context, id string) error) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := decide(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, elevation.ErrOwnRequest) {
+			http.Error(w, elevation.ErrOwnRequest.Error(), http.StatusForbidden)
+			return
+		}
+		// Decided requests are not found either
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "no pending request with the id", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+func (h *restHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.app.ListPolicies(r.Context())
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, policies)
+}
+
+func (h *restHandler) GetPolicyByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.app.GetPolicyByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, p)
+}
+
+// PolicyParams are the fields of a policy, all of them are set when a policy is updated.
+type PolicyParams struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Effect      models.PolicyEffect `json:"effect"`
+	Actions     []string            `json:"actions"`
+	Condition   string              `json:"condition"`
+}
+
+func (params PolicyParams) policy(id string) models.Policy {
+	return models.Policy{
+		ID:          id,
+		Name:        params.Name,
+		Description: params.Description,
+		Effect:      params.Effect,
+		Actions:     params.Actions,
+		Condition:   params.Condition,
+	}
+}
+
+func (h *restHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[PolicyParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.app.CreatePolicy(r.Context(), params.policy(""))
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, policy.ErrInvalidPolicy) {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "a policy with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, p)
+}
+
+func (h *restHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parse[PolicyParams](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.app.UpdatePolicy(r.Context(), params.policy(id))
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, policy.ErrInvalidPolicy) {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			http.Error(w, "a policy with the name already exists", http.StatusConflict)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, p)
+}
+
+func (h *restHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := h.app.DeletePolicy(r.Context(), id)
+	if err != nil {
+		if err.Error() == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, nil)
+}
+
+// Authorize decides whether the user of the token may take the action on the resource of the request.
+// A denied request is still answered with 200, the decision tells whether it is allowed.
+func (h *restHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	params, err := parse[sdk.AuthorizeRequest](r)
+	if err != nil {
+		slog.Error(err.Error())
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if params.Action == "" {
+		http.Error(w, "missing action", http.StatusBadRequest)
+		return
+	}
+
+	decision, err := h.app.Authorize(r.Context(), *params)
+	if err != nil {
+		if err.Error() == "unauthorized" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, decision)
 }
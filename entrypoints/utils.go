@@ -2,7 +2,18 @@ package entrypoints
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The number of items of a page when no limit is given
+	defaultPageSize = 50
+	maxPageSize     = 500
 )
 
 func parse[T any](r *http.Request) (v *T, err error) {
@@ -20,3 +31,59 @@ func respond(w http.ResponseWriter, resp interface{}) {
 func respondError(w http.ResponseWriter, err error, status int) {
 	http.Error(w, err.Error(), status)
 }
+
+// parseLimitQuery parses the page size of a listing, which defaults to defaultPageSize.
+func parseLimitQuery(query url.Values) (int, error) {
+	if !query.Has("limit") {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("invalid limit, must be between 1 and %d", maxPageSize)
+	}
+
+	return limit, nil
+}
+
+// parseSortQuery parses the sort key of a listing, which is descending if prefixed by a minus.
+func parseSortQuery(query url.Values) (string, bool) {
+	sort := query.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		return sort[1:], true
+	}
+	return sort, false
+}
+
+// parseTimeQuery parses an RFC 3339 time of the query, nil if it is not given.
+func parseTimeQuery(query url.Values, name string) (*time.Time, error) {
+	if !query.Has(name) {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, query.Get(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, must be an RFC 3339 time", name)
+	}
+
+	return &t, nil
+}
+
+// parseBoolQuery parses a boolean flag of the query, false if it is not given.
+func parseBoolQuery(query url.Values, name string) (bool, error) {
+	if !query.Has(name) {
+		return false, nil
+	}
+
+	// A flag without a value, e.g. ?dry_run, is set
+	if query.Get(name) == "" {
+		return true, nil
+	}
+
+	b, err := strconv.ParseBool(query.Get(name))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s, must be true or false", name)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,101 @@
+package group
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+// Service manages the groups, the roles assigned to a group are granted to all of its members.
+type Service struct {
+	repo repo.Repo
+}
+
+func NewService(repo repo.Repo) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func (s *Service) Create(ctx context.Context, group models.Group) (models.Group, error) {
+	if group.Name == "" {
+		return models.Group{}, fmt.Errorf("missing group name")
+	}
+
+	group.ID = uuid.NewString()
+
+	if err := s.repo.CreateGroup(ctx, group); err != nil {
+		return models.Group{}, err
+	}
+
+	return group, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (models.Group, error) {
+	return s.repo.GetGroup(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context) ([]models.Group, error) {
+	return s.repo.ListGroups(ctx)
+}
+
+func (s *Service) Update(ctx context.Context, group models.Group) (models.Group, error) {
+	if group.ID == "" {
+		return models.Group{}, fmt.Errorf("missing group id")
+	}
+
+	if group.Name == "" {
+		return models.Group{}, fmt.Errorf("missing group name")
+	}
+
+	if err := s.repo.UpdateGroup(ctx, group); err != nil {
+		return models.Group{}, err
+	}
+
+	return group, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.DeleteGroup(ctx, id)
+}
+
+func (s *Service) AddMember(ctx context.Context, groupID, userID string) error {
+	return s.repo.AddGroupMember(ctx, groupID, userID)
+}
+
+func (s *Service) RemoveMember(ctx context.Context, groupID, userID string) error {
+	return s.repo.RemoveGroupMember(ctx, groupID, userID)
+}
+
+// GetMembers returns the members of the group, or ErrNotFound if the group does not exist.
+func (s *Service) GetMembers(ctx context.Context, groupID string) ([]models.User, error) {
+	if _, err := s.repo.GetGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetGroupMembers(ctx, groupID)
+}
+
+func (s *Service) GetGroupsOfUser(ctx context.Context, userID string) ([]models.Group, error) {
+	return s.repo.GetGroupsOfUser(ctx, userID)
+}
+
+func (s *Service) AssignRole(ctx context.Context, groupID, roleID string) error {
+	return s.repo.AssignGroupRole(ctx, groupID, roleID)
+}
+
+func (s *Service) RemoveRole(ctx context.Context, groupID, roleID string) error {
+	return s.repo.RemoveGroupRole(ctx, groupID, roleID)
+}
+
+// GetRoles returns the roles assigned to the group, or ErrNotFound if the group does not exist.
+func (s *Service) GetRoles(ctx context.Context, groupID string) ([]models.Role, error) {
+	if _, err := s.repo.GetGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetRolesOfGroup(ctx, groupID)
+}
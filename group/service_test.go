@@ -0,0 +1,120 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+func Test_Create(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repo.NewMemory())
+
+	if _, err := s.Create(ctx, models.Group{Name: "devs"}); err != nil {
+		t.Fatalf("Create() = %v; want nil", err)
+	}
+
+	testCases := []struct {
+		desc    string
+		group   models.Group
+		wantErr error
+	}{
+		{desc: "missing name", group: models.Group{}},
+		{desc: "name is taken", group: models.Group{Name: "devs"}, wantErr: repo.ErrAlreadyExists},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := s.Create(ctx, tC.group)
+			if err == nil || (tC.wantErr != nil && !errors.Is(err, tC.wantErr)) {
+				t.Errorf("Create() = %v; want error %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_MissingGroup(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	u := models.User{ID: "user", Name: "Leo", Email: "leo@example.com"}
+	if err := r.CreateUser(ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc string
+		call func() error
+	}{
+		{desc: "Get", call: func() error { _, err := s.Get(ctx, "missing"); return err }},
+		{desc: "Update", call: func() error {
+			_, err := s.Update(ctx, models.Group{ID: "missing", Name: "devs"})
+			return err
+		}},
+		{desc: "Delete", call: func() error { return s.Delete(ctx, "missing") }},
+		{desc: "AddMember", call: func() error { return s.AddMember(ctx, "missing", u.ID) }},
+		{desc: "RemoveMember", call: func() error { return s.RemoveMember(ctx, "missing", u.ID) }},
+		{desc: "GetMembers", call: func() error { _, err := s.GetMembers(ctx, "missing"); return err }},
+		{desc: "GetRoles", call: func() error { _, err := s.GetRoles(ctx, "missing"); return err }},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := tC.call(); !errors.Is(err, repo.ErrNotFound) {
+				t.Errorf("%s() of a missing group = %v; want %v", tC.desc, err, repo.ErrNotFound)
+			}
+		})
+	}
+}
+
+func Test_DeleteCascades(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	u := models.User{ID: "user", Name: "Leo", Email: "leo@example.com"}
+	if err := r.CreateUser(ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	role := models.Role{ID: "role", Name: "deployers"}
+	if err := r.CreateRole(ctx, role, []models.Permission{{Key: "deploy", Val: "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := s.Create(ctx, models.Group{Name: "devs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddMember(ctx, g.ID, u.ID); err != nil {
+		t.Fatalf("AddMember() = %v; want nil", err)
+	}
+	if err := s.AddMember(ctx, g.ID, u.ID); !errors.Is(err, repo.ErrAlreadyExists) {
+		t.Errorf("AddMember() of a member = %v; want %v", err, repo.ErrAlreadyExists)
+	}
+	if err := s.AssignRole(ctx, g.ID, role.ID); err != nil {
+		t.Fatalf("AssignRole() = %v; want nil", err)
+	}
+
+	permissions, err := r.GetPermissionsOfUser(ctx, u.ID, "")
+	if err != nil || len(permissions) != 1 {
+		t.Fatalf("GetPermissionsOfUser() = %v, %v; want the permission of the group", permissions, err)
+	}
+
+	if err := s.Delete(ctx, g.ID); err != nil {
+		t.Fatalf("Delete() = %v; want nil", err)
+	}
+
+	if groups, err := s.GetGroupsOfUser(ctx, u.ID); err != nil || len(groups) != 0 {
+		t.Errorf("GetGroupsOfUser() after Delete() = %v, %v; want none", groups, err)
+	}
+	if permissions, err := r.GetPermissionsOfUser(ctx, u.ID, ""); err != nil || len(permissions) != 0 {
+		t.Errorf("GetPermissionsOfUser() after Delete() = %v, %v; want none", permissions, err)
+	}
+
+	// The role itself is kept
+	if _, err := r.GetRole(ctx, role.ID); err != nil {
+		t.Errorf("GetRole() after Delete() = %v; want nil", err)
+	}
+}
@@ -0,0 +1,48 @@
+package invitation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/theleeeo/thor/signer"
+)
+
+func Test_Verify(t *testing.T) {
+	s := &Service{signer: signer.New([]byte("secret"))}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	token, err := s.signer.Sign(jwt.RegisteredClaims{
+		Subject:   "invitation-id",
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, exp, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() = %v; want nil", err)
+	}
+	if id != "invitation-id" {
+		t.Errorf("Verify() id = %s; want invitation-id", id)
+	}
+	if !exp.Equal(expiresAt) {
+		t.Errorf("Verify() expiresAt = %v; want %v", exp, expiresAt)
+	}
+
+	// A token for another purpose, e.g. a login link, must not be accepted as an invitation
+	other, err := s.signer.Sign(jwt.RegisteredClaims{
+		Subject:   "user-id",
+		Audience:  jwt.ClaimStrings{"email-login"},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Verify(other); err == nil {
+		t.Errorf("Verify() with another audience = nil; want error")
+	}
+}
@@ -0,0 +1,171 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/signer"
+)
+
+const (
+	audience = "invitation"
+
+	defaultTTL     = 7 * 24 * time.Hour
+	defaultSubject = "You have been invited"
+)
+
+var (
+	ErrExpired         = errors.New("the invitation has expired")
+	ErrAlreadyAccepted = errors.New("the invitation has already been accepted")
+)
+
+type Config struct {
+	// How long an invitation is valid. Defaults to 7 days.
+	TTL time.Duration `yaml:"ttl"`
+	// The subject of the invitation emails
+	Subject string `yaml:"subject"`
+}
+
+type Service struct {
+	repo   repo.Repo
+	signer *signer.Signer
+	mailer mail.Sender
+	appURL string
+
+	ttl     time.Duration
+	subject string
+}
+
+func NewService(cfg *Config, repo repo.Repo, signer *signer.Signer, mailer mail.Sender, appURL string) (*Service, error) {
+	if mailer == nil {
+		return nil, fmt.Errorf("invitations require a mail configuration")
+	}
+
+	s := &Service{
+		repo:    repo,
+		signer:  signer,
+		mailer:  mailer,
+		appURL:  appURL,
+		ttl:     cfg.TTL,
+		subject: cfg.Subject,
+	}
+
+	if s.ttl == 0 {
+		s.ttl = defaultTTL
+	}
+
+	if s.subject == "" {
+		s.subject = defaultSubject
+	}
+
+	return s, nil
+}
+
+// Create invites the email address and sends the invitation link to it.
+// The roles are assigned to the user that accepts the invitation.
+func (s *Service) Create(ctx context.Context, email string, roleIDs []string, invitedBy string) (models.Invitation, error) {
+	addr, err := netmail.ParseAddress(email)
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("invalid email address: %w", err)
+	}
+
+	for _, id := range roleIDs {
+		if _, err := s.repo.GetRole(ctx, id); err != nil {
+			return models.Invitation{}, fmt.Errorf("failed to get role %s: %w", id, err)
+		}
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        uuid.NewString(),
+		Email:     addr.Address,
+		RoleIDs:   roleIDs,
+		InvitedBy: invitedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+
+	if err := s.repo.CreateInvitation(ctx, invitation); err != nil {
+		return models.Invitation{}, err
+	}
+
+	token, err := s.signer.Sign(jwt.RegisteredClaims{
+		Subject:   invitation.ID,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+	})
+	if err != nil {
+		return models.Invitation{}, err
+	}
+
+	link := fmt.Sprintf("%s/oauth/invite/accept?token=%s", s.appURL, url.QueryEscape(token))
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      invitation.Email,
+		Subject: s.subject,
+		Body:    fmt.Sprintf("You have been invited. Use the link below and log in with any method to accept the invitation. The link expires at %s.\n\n%s\n", invitation.ExpiresAt.Format(time.RFC1123), link),
+	})
+	if err != nil {
+		return models.Invitation{}, fmt.Errorf("failed to send invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]models.Invitation, error) {
+	return s.repo.ListInvitations(ctx)
+}
+
+// Revoke deletes the invitation so that the link can no longer be used.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	return s.repo.DeleteInvitation(ctx, id)
+}
+
+// Verify checks the token of an invitation link and returns the id of the invitation.
+// It does not check that the invitation is still pending, that is done when it is accepted.
+func (s *Service) Verify(token string) (string, time.Time, error) {
+	var claims jwt.RegisteredClaims
+	if err := s.signer.Verify(token, audience, &claims); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid or expired invitation link: %w", err)
+	}
+
+	return claims.Subject, claims.ExpiresAt.Time, nil
+}
+
+// Accept assigns the roles of the invitation to the user.
+// An invitation can only be accepted once. Revoked invitations return repo.ErrNotFound.
+func (s *Service) Accept(ctx context.Context, id string, userID string) error {
+	invitation, err := s.repo.GetInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if invitation.AcceptedAt != nil {
+		return ErrAlreadyAccepted
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		return ErrExpired
+	}
+
+	err = s.repo.AcceptInvitation(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			// Accepted by someone else in the meantime
+			return ErrAlreadyAccepted
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package local
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // SHA-1 is what the breached password lists are published in
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// breachedList is a set of SHA-1 hashes of passwords known to have been leaked.
+type breachedList map[string]struct{}
+
+// loadBreachedList reads a file of uppercase or lowercase hex encoded SHA-1 hashes, one per line.
+// The "HASH:COUNT" format of the Have I Been Pwned downloads is also accepted, the count is ignored.
+func loadBreachedList(path string) (breachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	list := make(breachedList)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		list[strings.ToUpper(hash)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return list, nil
+}
+
+func (b breachedList) contains(password string) bool {
+	if b == nil {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // See the import
+	_, ok := b[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok
+}
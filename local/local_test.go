@@ -0,0 +1,181 @@
+package local
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/signer"
+	"github.com/theleeeo/thor/user"
+)
+
+func Test_HashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword() = %v; want nil", err)
+	}
+
+	ok, err := VerifyPassword("correct horse battery staple", hash)
+	if err != nil {
+		t.Fatalf("VerifyPassword() = %v; want nil", err)
+	}
+	if !ok {
+		t.Errorf("VerifyPassword() = false; want true")
+	}
+
+	ok, err = VerifyPassword("wrong horse battery staple", hash)
+	if err != nil {
+		t.Fatalf("VerifyPassword() = %v; want nil", err)
+	}
+	if ok {
+		t.Errorf("VerifyPassword() = true; want false")
+	}
+
+	if _, err := VerifyPassword("correct horse battery staple", "$bcrypt$abc"); err == nil {
+		t.Errorf("VerifyPassword() with invalid hash = nil; want error")
+	}
+}
+
+func Test_PasswordPolicy(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		policy   PasswordPolicy
+		password string
+		wantErr  bool
+	}{
+		{
+			desc:     "Default minimum length",
+			password: "short",
+			wantErr:  true,
+		},
+		{
+			desc:     "Long enough",
+			password: "long enough password",
+		},
+		{
+			desc:     "Missing uppercase",
+			policy:   PasswordPolicy{MinLength: 4, RequireUpper: true},
+			password: "lowercase",
+			wantErr:  true,
+		},
+		{
+			desc:     "Missing digit",
+			policy:   PasswordPolicy{MinLength: 4, RequireDigit: true},
+			password: "Password",
+			wantErr:  true,
+		},
+		{
+			desc:     "Missing symbol",
+			policy:   PasswordPolicy{MinLength: 4, RequireSymbol: true},
+			password: "Password1",
+			wantErr:  true,
+		},
+		{
+			desc:     "All requirements met",
+			policy:   PasswordPolicy{MinLength: 4, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+			password: "Password1!",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.policy.Validate(tC.password)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate() = %v; want error: %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_BreachedList(t *testing.T) {
+	// SHA-1 of "password"
+	list := breachedList{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8": {}}
+
+	if !list.contains("password") {
+		t.Errorf("contains() = false; want true")
+	}
+
+	if list.contains("not in the list") {
+		t.Errorf("contains() = true; want false")
+	}
+}
+
+func Test_UsernamesAreNamespaced(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	s, err := NewService(&Config{}, r, userService, signer.New([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	github, err := userService.Create(ctx, models.User{Name: "GitHub", Email: "github@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "12345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Authenticate(ctx, "12345", "correct horse battery staple"); err != ErrInvalidCredentials {
+		t.Errorf("Authenticate() of the id of another provider = %v; want %v", err, ErrInvalidCredentials)
+	}
+
+	local, err := s.CreateUser(ctx, models.User{Name: "Local", Email: "local@example.com"}, "12345", "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("CreateUser() with the id of another provider as username = %v; want nil", err)
+	}
+
+	u, err := s.Authenticate(ctx, "12345", "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Authenticate() = %v; want nil", err)
+	}
+	if u.ID != local.ID || u.ID == github.ID {
+		t.Errorf("Authenticate() = user %v; want the local user %v", u.ID, local.ID)
+	}
+}
+
+func Test_ConcurrentFailedLogins(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	s, err := NewService(&Config{MaxFailedAttempts: 3}, r, userService, signer.New([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreateUser(ctx, models.User{Name: "Local", Email: "local@example.com"}, "local", "correct horse battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 20)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Authenticate(ctx, "local", "wrong password")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var verified int
+	for err := range errs {
+		switch err {
+		case ErrInvalidCredentials:
+			verified++
+		case ErrLocked:
+		default:
+			t.Errorf("Authenticate() with a wrong password = %v; want %v or %v", err, ErrInvalidCredentials, ErrLocked)
+		}
+	}
+	if verified != 3 {
+		t.Errorf("verified %d of the concurrent guesses; want 3", verified)
+	}
+
+	if _, err := s.Authenticate(ctx, "local", "correct horse battery staple"); err != ErrLocked {
+		t.Errorf("Authenticate() after the guesses = %v; want %v", err, ErrLocked)
+	}
+}
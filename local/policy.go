@@ -0,0 +1,74 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultMinLength = 12
+	// Hashing is expensive, so very long passwords are refused to not let them be used to exhaust the server
+	maxPasswordLength = 1024
+)
+
+var ErrBreachedPassword = errors.New("the password has appeared in a data breach")
+
+type PasswordPolicy struct {
+	// Minimum number of characters. Defaults to 12.
+	MinLength     int  `yaml:"min-length"`
+	RequireUpper  bool `yaml:"require-upper"`
+	RequireLower  bool `yaml:"require-lower"`
+	RequireDigit  bool `yaml:"require-digit"`
+	RequireSymbol bool `yaml:"require-symbol"`
+}
+
+// Validate returns an error describing the first requirement that the password does not meet.
+func (p PasswordPolicy) Validate(password string) error {
+	minLength := p.MinLength
+	if minLength == 0 {
+		minLength = defaultMinLength
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		return fmt.Errorf("the password must be at least %d characters long", minLength)
+	}
+
+	if length > maxPasswordLength {
+		return fmt.Errorf("the password must be at most %d characters long", maxPasswordLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		return errors.New("the password must contain an uppercase letter")
+	}
+
+	if p.RequireLower && !hasLower {
+		return errors.New("the password must contain a lowercase letter")
+	}
+
+	if p.RequireDigit && !hasDigit {
+		return errors.New("the password must contain a digit")
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		return errors.New("the password must contain a symbol")
+	}
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/signer"
+	"github.com/theleeeo/thor/user"
+)
+
+const (
+	resetAudience = "password-reset"
+
+	defaultMaxFailedAttempts = 5
+	defaultLockoutDuration   = 15 * time.Minute
+	defaultResetTTL          = time.Hour
+
+	maxUsernameLength = 50
+	// The usernames are stored as the provider ID of the user behind the prefix,
+	// so that they are not mixed up with the ids of the other providers
+	providerIDPrefix = "local:"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLocked             = errors.New("the account is temporarily locked")
+)
+
+type Config struct {
+	PasswordPolicy PasswordPolicy `yaml:"password-policy"`
+	// Path to a file of SHA-1 hashes of breached passwords. Passwords in the list are refused.
+	BreachedList string `yaml:"breached-list"`
+	// Number of failed login attempts before the account is locked. Defaults to 5.
+	MaxFailedAttempts int `yaml:"max-failed-attempts"`
+	// How long an account is locked. Defaults to 15 minutes.
+	LockoutDuration time.Duration `yaml:"lockout-duration"`
+	// How long a password reset link is valid. Defaults to 1 hour.
+	ResetTTL time.Duration `yaml:"reset-ttl"`
+}
+
+type Service struct {
+	repo        repo.Repo
+	userService *user.Service
+	signer      *signer.Signer
+
+	policy            PasswordPolicy
+	breached          breachedList
+	maxFailedAttempts int
+	lockoutDuration   time.Duration
+	resetTTL          time.Duration
+
+	// Verified against when the user does not exist, so that failed logins take the same time regardless of the reason
+	dummyHash string
+}
+
+func NewService(cfg *Config, repo repo.Repo, userService *user.Service, signer *signer.Signer) (*Service, error) {
+	s := &Service{
+		repo:              repo,
+		userService:       userService,
+		signer:            signer,
+		policy:            cfg.PasswordPolicy,
+		maxFailedAttempts: cfg.MaxFailedAttempts,
+		lockoutDuration:   cfg.LockoutDuration,
+		resetTTL:          cfg.ResetTTL,
+	}
+
+	if s.maxFailedAttempts == 0 {
+		s.maxFailedAttempts = defaultMaxFailedAttempts
+	}
+
+	if s.lockoutDuration == 0 {
+		s.lockoutDuration = defaultLockoutDuration
+	}
+
+	if s.resetTTL == 0 {
+		s.resetTTL = defaultResetTTL
+	}
+
+	if cfg.BreachedList != "" {
+		breached, err := loadBreachedList(cfg.BreachedList)
+		if err != nil {
+			return nil, err
+		}
+		s.breached = breached
+	}
+
+	dummyHash, err := HashPassword("dummy-password")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dummy hash: %w", err)
+	}
+	s.dummyHash = dummyHash
+
+	return s, nil
+}
+
+// ValidatePassword checks the password against the password policy and the breached passwords.
+func (s *Service) ValidatePassword(password string) error {
+	if err := s.policy.Validate(password); err != nil {
+		return err
+	}
+
+	if s.breached.contains(password) {
+		return ErrBreachedPassword
+	}
+
+	return nil
+}
+
+// CreateUser creates a user with a local account that is logged in to with the username and password.
+func (s *Service) CreateUser(ctx context.Context, userModel models.User, username, password string) (user.User, error) {
+	if username == "" {
+		return user.User{}, fmt.Errorf("missing username")
+	}
+
+	if len(username) > maxUsernameLength {
+		return user.User{}, fmt.Errorf("the username must be at most %d characters long", maxUsernameLength)
+	}
+
+	if err := s.ValidatePassword(password); err != nil {
+		return user.User{}, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return s.userService.CreateWithPassword(ctx, userModel, models.UserProvider{
+		Type:   models.UserProviderTypeLocal,
+		UserID: providerID(username),
+	}, hash)
+}
+
+func providerID(username string) string {
+	return providerIDPrefix + username
+}
+
+// SetPassword replaces the password of the user.
+func (s *Service) SetPassword(ctx context.Context, userID, password string) error {
+	if err := s.ValidatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return s.repo.SetPasswordHash(ctx, userID, hash)
+}
+
+// Authenticate returns the user if the password is correct.
+// The account is locked after too many failed attempts in a row.
+func (s *Service) Authenticate(ctx context.Context, username, password string) (user.User, error) {
+	u, err := s.userService.GetByProviderID(ctx, providerID(username))
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return user.User{}, err
+	}
+
+	var cred models.LocalCredential
+	if err == nil {
+		cred, err = s.repo.GetLocalCredential(ctx, u.ID)
+		if err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return user.User{}, err
+		}
+	}
+
+	if err != nil {
+		// Spend the same time as a real verification
+		_, _ = VerifyPassword(password, s.dummyHash)
+		return user.User{}, ErrInvalidCredentials
+	}
+
+	if cred.LockedUntil != nil && time.Now().Before(*cred.LockedUntil) {
+		return user.User{}, ErrLocked
+	}
+
+	// The attempt is counted before the password is verified, so that concurrent guesses
+	// can not get past the limit by all reading the same count
+	now := time.Now().UTC()
+	cred, err = s.repo.IncrementLoginFailures(ctx, u.ID, now)
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to count login attempt: %w", err)
+	}
+
+	if cred.LockedUntil != nil {
+		return user.User{}, ErrLocked
+	}
+
+	if cred.FailedAttempts > s.maxFailedAttempts {
+		if err := s.lock(ctx, u.ID, cred.FailedAttempts, now); err != nil {
+			return user.User{}, err
+		}
+		return user.User{}, ErrLocked
+	}
+
+	ok, err := VerifyPassword(password, cred.PasswordHash)
+	if err != nil {
+		return user.User{}, fmt.Errorf("failed to verify password: %w", err)
+	}
+
+	if !ok {
+		if cred.FailedAttempts == s.maxFailedAttempts {
+			if err := s.lock(ctx, u.ID, cred.FailedAttempts, now); err != nil {
+				return user.User{}, err
+			}
+		}
+
+		return user.User{}, ErrInvalidCredentials
+	}
+
+	if err := s.repo.SetLoginFailures(ctx, u.ID, 0, nil); err != nil {
+		return user.User{}, fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	return u, nil
+}
+
+// lock locks the account for the lockout duration. The count is kept, it starts over once the lock has expired.
+func (s *Service) lock(ctx context.Context, userID string, failedAttempts int, now time.Time) error {
+	lockedUntil := now.Add(s.lockoutDuration)
+	if err := s.repo.SetLoginFailures(ctx, userID, failedAttempts, &lockedUntil); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+	return nil
+}
+
+type resetClaims struct {
+	jwt.RegisteredClaims
+	// Identifies the password the reset was requested for.
+	// Once the password is changed the fingerprint no longer matches, which makes the reset token single-use.
+	Fingerprint string `json:"fp"`
+}
+
+func fingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CreateResetToken creates a token that can be used once to reset the password of the user with the email.
+// It returns repo.ErrNotFound if there is no local account with the email.
+func (s *Service) CreateResetToken(ctx context.Context, email string) (string, user.User, time.Time, error) {
+	u, err := s.userService.Get(ctx, repo.GetUserParams{Email: &email})
+	if err != nil {
+		return "", user.User{}, time.Time{}, err
+	}
+
+	cred, err := s.repo.GetLocalCredential(ctx, u.ID)
+	if err != nil {
+		return "", user.User{}, time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.resetTTL)
+	token, err := s.signer.Sign(resetClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   u.ID,
+			Audience:  jwt.ClaimStrings{resetAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Fingerprint: fingerprint(cred.PasswordHash),
+	})
+	if err != nil {
+		return "", user.User{}, time.Time{}, err
+	}
+
+	return token, u, expiresAt, nil
+}
+
+// ResetPassword sets a new password for the user the reset token was created for.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	var claims resetClaims
+	if err := s.signer.Verify(token, resetAudience, &claims); err != nil {
+		return fmt.Errorf("invalid or expired reset token: %w", err)
+	}
+
+	cred, err := s.repo.GetLocalCredential(ctx, claims.Subject)
+	if err != nil {
+		return fmt.Errorf("failed to get credential: %w", err)
+	}
+
+	if fingerprint(cred.PasswordHash) != claims.Fingerprint {
+		return errors.New("the reset token has already been used")
+	}
+
+	return s.SetPassword(ctx, claims.Subject, password)
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type FileConfig struct {
+	// The file the emails are appended to.
+	// If empty the emails are written to the log instead.
+	Path string `yaml:"path"`
+}
+
+type fileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFile creates a sender that writes the emails to a file or to the log.
+// It is meant for local development and testing, no emails are actually delivered.
+func NewFile(cfg *FileConfig) *fileSender {
+	return &fileSender{
+		path: cfg.Path,
+	}
+}
+
+func (s *fileSender) Send(_ context.Context, msg Message) error {
+	if s.path == "" {
+		slog.Info("email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails to users, e.g. login links.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+	// The address the emails are sent from
+	From string      `yaml:"from"`
+	SMTP *SMTPConfig `yaml:"smtp"`
+	File *FileConfig `yaml:"file"`
+}
+
+func New(cfg *Config) (Sender, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("no mail configuration found")
+	}
+
+	if cfg.SMTP != nil {
+		return NewSMTP(cfg.From, cfg.SMTP), nil
+	}
+
+	if cfg.File != nil {
+		return NewFile(cfg.File), nil
+	}
+
+	return nil, fmt.Errorf("no mail configuration found")
+}
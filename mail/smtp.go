@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPConfig struct {
+	// The address of the SMTP server, including the port
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" json:"-"`
+}
+
+type smtpSender struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTP creates a sender that delivers the emails through an SMTP server.
+// If no username is configured the emails are sent unauthenticated.
+func NewSMTP(from string, cfg *SMTPConfig) *smtpSender {
+	s := &smtpSender{
+		from: from,
+		addr: cfg.Addr,
+	}
+
+	if cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	return s
+}
+
+func (s *smtpSender) Send(_ context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From: " + s.from + "\r\n")
+	sb.WriteString("To: " + msg.To + "\r\n")
+	sb.WriteString("Subject: " + msg.Subject + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(msg.Body)
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(sb.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// Characters that are easily confused with each other are left out
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+func generateRecoveryCodes() ([]string, error) {
+	alphabetLen := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		var sb strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			if j == recoveryCodeLength/2 {
+				sb.WriteByte('-')
+			}
+
+			n, err := rand.Int(rand.Reader, alphabetLen)
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		codes[i] = sb.String()
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes the code for storage.
+// The codes are random with high entropy so a fast hash is enough.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,268 @@
+package mfa
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+	"rsc.io/qr"
+)
+
+const (
+	defaultIssuer            = "Thor"
+	defaultMaxFailedAttempts = 5
+	defaultLockoutDuration   = 15 * time.Minute
+)
+
+var (
+	ErrInvalidCode      = errors.New("invalid code")
+	ErrAlreadyEnrolled  = errors.New("mfa is already enrolled")
+	ErrNotEnrolled      = errors.New("mfa is not enrolled")
+	ErrEnrollmentNeeded = errors.New("mfa has to be enrolled before it can be confirmed")
+	ErrLocked           = errors.New("too many invalid codes, mfa is temporarily locked")
+)
+
+type Config struct {
+	// The name shown in the authenticator apps. Defaults to "Thor".
+	Issuer string `yaml:"issuer"`
+	// Users with any of these roles, by name, have to use MFA when logging in
+	EnforcedRoles []string `yaml:"enforced-roles"`
+	// Number of invalid codes in a row before no codes are accepted for a while. Defaults to 5.
+	MaxFailedAttempts int `yaml:"max-failed-attempts"`
+	// How long no codes are accepted after too many invalid ones. Defaults to 15 minutes.
+	LockoutDuration time.Duration `yaml:"lockout-duration"`
+}
+
+type Enrollment struct {
+	Secret string `json:"secret"`
+	// The otpauth:// URI read by authenticator apps
+	URI string `json:"uri"`
+	// The URI as a QR code, a PNG image encoded as a data URI
+	QRCode string `json:"qr_code"`
+}
+
+type Service struct {
+	repo          repo.Repo
+	issuer        string
+	enforcedRoles map[string]struct{}
+
+	maxFailedAttempts int
+	lockoutDuration   time.Duration
+}
+
+func NewService(cfg *Config, repo repo.Repo) *Service {
+	s := &Service{
+		repo:              repo,
+		issuer:            cfg.Issuer,
+		enforcedRoles:     make(map[string]struct{}),
+		maxFailedAttempts: cfg.MaxFailedAttempts,
+		lockoutDuration:   cfg.LockoutDuration,
+	}
+
+	if s.issuer == "" {
+		s.issuer = defaultIssuer
+	}
+
+	if s.maxFailedAttempts == 0 {
+		s.maxFailedAttempts = defaultMaxFailedAttempts
+	}
+
+	if s.lockoutDuration == 0 {
+		s.lockoutDuration = defaultLockoutDuration
+	}
+
+	for _, r := range cfg.EnforcedRoles {
+		s.enforcedRoles[r] = struct{}{}
+	}
+
+	return s
+}
+
+// Enroll creates a new TOTP secret for the user.
+// The secret is not used until it is confirmed with a code from the authenticator app.
+func (s *Service) Enroll(ctx context.Context, u user.User) (Enrollment, error) {
+	current, err := s.repo.GetTOTP(ctx, u.ID)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return Enrollment{}, err
+	}
+	if err == nil && current.Enabled {
+		return Enrollment{}, ErrAlreadyEnrolled
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if err := s.repo.SetTOTP(ctx, models.TOTP{UserID: u.ID, Secret: secret}); err != nil {
+		return Enrollment{}, err
+	}
+
+	uri := otpauthURI(s.issuer, u.Email, secret)
+
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("failed to create qr code: %w", err)
+	}
+
+	return Enrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()),
+	}, nil
+}
+
+// Confirm enables the enrolled TOTP if the code is valid and returns a new set of recovery codes.
+// The recovery codes are only stored hashed and can not be retrieved again.
+func (s *Service) Confirm(ctx context.Context, userID, code string) ([]string, error) {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrEnrollmentNeeded
+		}
+		return nil, err
+	}
+
+	if totp.Enabled {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	step, ok := validateTOTP(totp.Secret, code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	totp.Enabled = true
+	totp.LastUsedStep = step
+	if err := s.repo.SetTOTP(ctx, totp); err != nil {
+		return nil, err
+	}
+
+	return s.RegenerateRecoveryCodes(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashRecoveryCode(c)
+	}
+
+	if err := s.repo.SetRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *Service) Disable(ctx context.Context, userID string) error {
+	return s.repo.DeleteTOTP(ctx, userID)
+}
+
+func (s *Service) IsEnrolled(ctx context.Context, userID string) (bool, error) {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return totp.Enabled, nil
+}
+
+// IsEnforced reports whether the user has a role that requires MFA.
+func (s *Service) IsEnforced(ctx context.Context, u user.User) (bool, error) {
+	if len(s.enforcedRoles) == 0 {
+		return false, nil
+	}
+
+	roles, err := u.Roles(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range roles {
+		if _, ok := s.enforcedRoles[r.Name]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Verify checks a code from the authenticator app or a recovery code.
+// A recovery code can only be used once.
+// The invalid codes are counted, after too many in a row ErrLocked is returned until the lock expires.
+func (s *Service) Verify(ctx context.Context, userID, code string) error {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrNotEnrolled
+		}
+		return err
+	}
+
+	if !totp.Enabled {
+		return ErrNotEnrolled
+	}
+
+	if totp.LockedUntil != nil && time.Now().Before(*totp.LockedUntil) {
+		return ErrLocked
+	}
+
+	// Counted before the code is checked, as the password is on login
+	now := time.Now().UTC()
+	totp, err = s.repo.IncrementMFAFailures(ctx, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to count invalid code: %w", err)
+	}
+
+	if totp.LockedUntil != nil {
+		return ErrLocked
+	}
+
+	if totp.FailedAttempts > s.maxFailedAttempts {
+		return s.lock(ctx, userID, totp.FailedAttempts, now)
+	}
+
+	if step, ok := validateTOTP(totp.Secret, code, now, totp.LastUsedStep); ok {
+		totp.LastUsedStep = step
+		totp.FailedAttempts = 0
+		totp.LockedUntil = nil
+		return s.repo.SetTOTP(ctx, totp)
+	}
+
+	err = s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		if !errors.Is(err, repo.ErrNotFound) {
+			return err
+		}
+
+		if totp.FailedAttempts == s.maxFailedAttempts {
+			return s.lock(ctx, userID, totp.FailedAttempts, now)
+		}
+		return ErrInvalidCode
+	}
+
+	return s.repo.SetMFAFailures(ctx, userID, 0, nil)
+}
+
+// lock locks the codes of the user for the lockout duration and returns ErrLocked.
+func (s *Service) lock(ctx context.Context, userID string, failedAttempts int, now time.Time) error {
+	lockedUntil := now.Add(s.lockoutDuration)
+	if err := s.repo.SetMFAFailures(ctx, userID, failedAttempts, &lockedUntil); err != nil {
+		return fmt.Errorf("failed to lock codes: %w", err)
+	}
+	return ErrLocked
+}
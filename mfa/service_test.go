@@ -0,0 +1,58 @@
+package mfa
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+func Test_ConcurrentInvalidCodes(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(&Config{MaxFailedAttempts: 3}, r)
+
+	u := models.User{ID: "user", Name: "Leo", Email: "leo@example.com"}
+	if err := r.CreateUser(ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("12345678901234567890")
+	if err := r.SetTOTP(ctx, models.TOTP{UserID: u.ID, Secret: base32NoPadding.EncodeToString(key), Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 20)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.Verify(ctx, u.ID, "not-a-code")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// The guess that reaches the limit locks the codes
+	var checked int
+	for err := range errs {
+		switch err {
+		case ErrInvalidCode:
+			checked++
+		case ErrLocked:
+		default:
+			t.Errorf("Verify() of an invalid code = %v; want %v or %v", err, ErrInvalidCode, ErrLocked)
+		}
+	}
+	if checked != 2 {
+		t.Errorf("%d of the concurrent codes were invalid; want 2", checked)
+	}
+
+	if err := s.Verify(ctx, u.ID, hotp(key, totpStep(time.Now()))); err != ErrLocked {
+		t.Errorf("Verify() of a valid code after the guesses = %v; want %v", err, ErrLocked)
+	}
+}
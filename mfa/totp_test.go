@@ -0,0 +1,51 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// The test vectors from RFC 6238 appendix B, truncated to 6 digits
+func Test_HOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	testCases := []struct {
+		time int64
+		want string
+	}{
+		{time: 59, want: "287082"},
+		{time: 1111111109, want: "081804"},
+		{time: 1111111111, want: "050471"},
+		{time: 1234567890, want: "005924"},
+		{time: 2000000000, want: "279037"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.want, func(t *testing.T) {
+			if got := hotp(key, totpStep(time.Unix(tC.time, 0))); got != tC.want {
+				t.Errorf("hotp() = %v; want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_ValidateTOTP(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+
+	step, ok := validateTOTP(secret, "287082", now, 0)
+	if !ok {
+		t.Fatalf("validateTOTP() = false; want true")
+	}
+
+	if _, ok := validateTOTP(secret, "287082", now, step); ok {
+		t.Errorf("validateTOTP() with a used code = true; want false")
+	}
+
+	if _, ok := validateTOTP(secret, "287082", now.Add(2*totpPeriod), 0); ok {
+		t.Errorf("validateTOTP() with an old code = true; want false")
+	}
+
+	if _, ok := validateTOTP(secret, "000000", now, 0); ok {
+		t.Errorf("validateTOTP() with an invalid code = true; want false")
+	}
+}
@@ -58,6 +58,30 @@ func ClaimsExtractor(publicKey []byte, cookieName string) Middleware {
 	}
 }
 
+// PolicyInjector adds the policies to the context of the requests for sdk.Authorize.
+// The policies are got for every request so that they can be replaced while running.
+func PolicyInjector(policies func() *sdk.PolicySet) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(sdk.WithPolicies(r.Context(), policies()))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RemoteAuthorizer makes sdk.Authorize ask Thor for the decisions, with the token of the request.
+// Use it instead of PolicyInjector when the service can not load the policies.
+func RemoteAuthorizer(remote *sdk.Remote) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, err := r.Cookie(remote.CookieName); err == nil {
+				r = r.WithContext(sdk.WithRemote(r.Context(), remote, token.Value))
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
 // ErrorPageDirector is a middleware that will serve error pages based on the response status code.
 // It will look for specific error pages based on the status code and if it does not find one, it will use the catchall error page.
 // The error pages provided should be in a directory called "errorpages" and the paths provided should be relative to that directory.
@@ -0,0 +1,11 @@
+// Package migrations holds the schema migrations of the SQL repos, one directory per database.
+//
+// The migrations are named <version>_<name>.up.sql and <version>_<name>.down.sql, where the down migration reverts the up migration.
+// A migration may contain several statements, each ending with a semicolon at the end of a line.
+// Applied migrations must never be changed, changes to the schema are made by adding a new migration.
+package migrations
+
+import "embed"
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var FS embed.FS
@@ -9,4 +9,4 @@ CREATE TABLE IF NOT EXISTS user_providers (
 -- Otherwise, it will be the time the provider was added
 `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
-);
\ No newline at end of file
+);
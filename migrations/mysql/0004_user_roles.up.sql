@@ -5,4 +5,4 @@ CREATE TABLE IF NOT EXISTS user_roles (
 PRIMARY KEY (user_id, role_id),
 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
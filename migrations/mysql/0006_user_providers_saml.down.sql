@@ -0,0 +1 @@
+ALTER TABLE user_providers MODIFY `provider_id` VARCHAR(50) NOT NULL;
@@ -0,0 +1,2 @@
+-- The SAML provider ids are the name of the identity provider followed by the name id, which can be long
+ALTER TABLE user_providers MODIFY `provider_id` VARCHAR(255) NOT NULL;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+-- The credential ID chosen by the authenticator
+`id` VARBINARY(1023) NOT NULL PRIMARY KEY,
+`user_id` VARCHAR(36) NOT NULL,
+`name` VARCHAR(100) NOT NULL,
+`public_key` BLOB NOT NULL,
+`attestation_type` VARCHAR(32) NOT NULL,
+-- Comma separated list of transports, e.g. "usb,nfc"
+`transports` VARCHAR(255) NOT NULL,
+`aaguid` VARBINARY(16) NOT NULL,
+`sign_count` INT UNSIGNED NOT NULL DEFAULT 0,
+`backup_eligible` BOOLEAN NOT NULL DEFAULT FALSE,
+`backup_state` BOOLEAN NOT NULL DEFAULT FALSE,
+`created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+`last_used_at` TIMESTAMP NULL,
+INDEX (`user_id`),
+FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
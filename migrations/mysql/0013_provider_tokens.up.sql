@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS provider_tokens (
+-- The id of the user at the provider
+`provider_id` VARCHAR(255) NOT NULL PRIMARY KEY,
+`user_id` VARCHAR(36) NOT NULL,
+`provider` VARCHAR(10) NOT NULL,
+-- The name of the configured provider that issued the token
+`provider_name` VARCHAR(255) NOT NULL,
+-- The tokens are encrypted with AES-256-GCM
+`access_token` VARBINARY(4096) NOT NULL,
+`refresh_token` VARBINARY(4096) NULL,
+`token_type` VARCHAR(32) NOT NULL,
+`scope` VARCHAR(1024) NOT NULL,
+`expires_at` TIMESTAMP NULL DEFAULT NULL,
+`updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE,
+FOREIGN KEY (`provider_id`) REFERENCES `user_providers`(`provider_id`) ON DELETE CASCADE
+);
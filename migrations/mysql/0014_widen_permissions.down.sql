@@ -0,0 +1,3 @@
+ALTER TABLE role_permissions
+MODIFY `p_key` VARCHAR(16) NOT NULL,
+MODIFY `p_val` VARCHAR(16) NOT NULL;
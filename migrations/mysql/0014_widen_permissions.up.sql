@@ -0,0 +1,3 @@
+ALTER TABLE role_permissions
+MODIFY `p_key` VARCHAR(255) NOT NULL,
+MODIFY `p_val` VARCHAR(255) NOT NULL;
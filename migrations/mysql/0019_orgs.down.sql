@@ -0,0 +1,4 @@
+ALTER TABLE roles DROP FOREIGN KEY fk_roles_org;
+ALTER TABLE roles DROP COLUMN org_id;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
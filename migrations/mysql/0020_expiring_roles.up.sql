@@ -0,0 +1,21 @@
+-- Assignments with an expiry are removed once it has passed, roles are assigned permanently when it is NULL
+ALTER TABLE user_roles ADD COLUMN `expires_at` TIMESTAMP NULL DEFAULT NULL;
+
+-- Requests by users to be assigned a role for a while, the role is assigned when an approver approves it
+CREATE TABLE IF NOT EXISTS elevation_requests (
+`id` VARCHAR(36) PRIMARY KEY,
+`user_id` VARCHAR(36) NOT NULL,
+`role_id` VARCHAR(36) NOT NULL,
+`reason` TEXT NOT NULL,
+`duration_seconds` BIGINT NOT NULL,
+-- pending, approved or denied
+`status` VARCHAR(16) NOT NULL,
+`requested_at` TIMESTAMP NOT NULL,
+`decided_by` VARCHAR(36) NULL,
+`decided_at` TIMESTAMP NULL,
+-- When the assignment of an approved request expires
+`expires_at` TIMESTAMP NULL,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+FOREIGN KEY (decided_by) REFERENCES users(id) ON DELETE SET NULL
+);
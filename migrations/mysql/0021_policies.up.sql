@@ -0,0 +1,12 @@
+-- Policies allow or deny actions when the expression of their condition holds, see sdk.ParseCondition for the language
+CREATE TABLE IF NOT EXISTS policies (
+`id` VARCHAR(36) PRIMARY KEY,
+`name` VARCHAR(255) UNIQUE NOT NULL,
+`description` TEXT NOT NULL,
+-- allow or deny
+`effect` VARCHAR(16) NOT NULL,
+-- The action patterns separated by commas
+`actions` TEXT NOT NULL,
+`expression` TEXT NOT NULL,
+`created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
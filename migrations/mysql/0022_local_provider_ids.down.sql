@@ -0,0 +1 @@
+UPDATE user_providers SET `provider_id` = SUBSTRING(`provider_id`, 7) WHERE `provider` = 'local' AND `provider_id` LIKE 'local:%';
@@ -0,0 +1,4 @@
+-- Invalid codes are counted per user, like the failed logins of the local accounts, so that they can not be reset by the client
+ALTER TABLE mfa_totp
+ADD `failed_attempts` INT NOT NULL DEFAULT 0,
+ADD `locked_until` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+id VARCHAR(36) NOT NULL PRIMARY KEY,
+email VARCHAR(40) NOT NULL,
+name VARCHAR(40) NOT NULL,
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+-- Set by the queries, there is no ON UPDATE in postgres
+updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_providers (
+user_id VARCHAR(36) NOT NULL,
+-- What provider the user used to sign up
+provider VARCHAR(10) NOT NULL,
+-- The id of the user with the provider
+-- The SAML provider ids are the name of the identity provider followed by the name id, which can be long
+provider_id VARCHAR(255) NOT NULL UNIQUE,
+-- When was the provider added to the user
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
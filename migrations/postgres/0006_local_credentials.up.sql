@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS local_credentials (
+user_id VARCHAR(36) NOT NULL PRIMARY KEY,
+-- The Argon2id hash in the PHC string format
+password_hash VARCHAR(255) NOT NULL,
+-- Failed login attempts since the last successful login
+failed_attempts INT NOT NULL DEFAULT 0,
+-- The account is locked until this time after too many failed attempts
+locked_until TIMESTAMPTZ NULL DEFAULT NULL,
+updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
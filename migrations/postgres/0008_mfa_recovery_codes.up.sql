@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+user_id VARCHAR(36) NOT NULL,
+-- SHA-256 of the normalized code
+code_hash CHAR(64) NOT NULL,
+used_at TIMESTAMPTZ NULL DEFAULT NULL,
+PRIMARY KEY (user_id, code_hash),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
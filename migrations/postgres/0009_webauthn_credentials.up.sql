@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+-- The credential ID chosen by the authenticator
+id BYTEA NOT NULL PRIMARY KEY,
+user_id VARCHAR(36) NOT NULL,
+name VARCHAR(100) NOT NULL,
+public_key BYTEA NOT NULL,
+attestation_type VARCHAR(32) NOT NULL,
+-- Comma separated list of transports, e.g. "usb,nfc"
+transports VARCHAR(255) NOT NULL,
+aaguid BYTEA NOT NULL,
+-- An unsigned 32 bit counter, which does not fit in an INT
+sign_count BIGINT NOT NULL DEFAULT 0,
+backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+last_used_at TIMESTAMPTZ NULL,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id ON webauthn_credentials (user_id);
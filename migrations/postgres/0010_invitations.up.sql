@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS invitations (
+id VARCHAR(36) NOT NULL PRIMARY KEY,
+-- The address the invitation was sent to
+email VARCHAR(255) NOT NULL,
+-- The admin that created the invitation
+invited_by VARCHAR(36) NOT NULL,
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+expires_at TIMESTAMPTZ NOT NULL,
+accepted_at TIMESTAMPTZ NULL,
+-- The user that accepted the invitation, not necessarily with the same email
+accepted_by VARCHAR(36) NULL,
+FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS invitation_roles (
+invitation_id VARCHAR(36) NOT NULL,
+role_id VARCHAR(36) NOT NULL,
+PRIMARY KEY (invitation_id, role_id),
+FOREIGN KEY (invitation_id) REFERENCES invitations(id) ON DELETE CASCADE,
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE role_permissions
+ALTER COLUMN p_key TYPE VARCHAR(16),
+ALTER COLUMN p_val TYPE VARCHAR(16);
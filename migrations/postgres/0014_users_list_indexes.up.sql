@@ -0,0 +1,4 @@
+-- The users are listed ordered by one of the columns and then by id
+CREATE INDEX users_created_at_idx ON users (created_at, id);
+CREATE INDEX users_email_idx ON users (email, id);
+CREATE INDEX users_name_idx ON users (name, id);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+DROP COLUMN disabled,
+DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE,
+-- Deleted users are kept until the retention period has passed
+ADD COLUMN deleted_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- A role inherits the permissions of its parent roles
+CREATE TABLE IF NOT EXISTS role_parents (
+role_id VARCHAR(36) NOT NULL,
+parent_id VARCHAR(36) NOT NULL,
+PRIMARY KEY (role_id, parent_id),
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+FOREIGN KEY (parent_id) REFERENCES roles(id) ON DELETE CASCADE
+);
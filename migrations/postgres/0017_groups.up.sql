@@ -0,0 +1,25 @@
+-- Users are managed in groups, the roles of a group apply to all of its members
+CREATE TABLE IF NOT EXISTS groups (
+id VARCHAR(36) PRIMARY KEY,
+name VARCHAR(255) UNIQUE NOT NULL,
+description TEXT,
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+group_id VARCHAR(36) NOT NULL,
+user_id VARCHAR(36) NOT NULL,
+added_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (group_id, user_id),
+FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+group_id VARCHAR(36) NOT NULL,
+role_id VARCHAR(36) NOT NULL,
+assigned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (group_id, role_id),
+FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE roles DROP COLUMN org_id;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS elevation_requests;
+ALTER TABLE user_roles DROP COLUMN expires_at;
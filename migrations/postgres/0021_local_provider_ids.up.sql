@@ -0,0 +1,2 @@
+-- The usernames of the local accounts are prefixed so that they can not be taken for the ids of other providers
+UPDATE user_providers SET provider_id = 'local:' || provider_id WHERE provider = 'local';
@@ -0,0 +1,3 @@
+ALTER TABLE mfa_totp
+DROP COLUMN failed_attempts,
+DROP COLUMN locked_until;
@@ -0,0 +1,8 @@
+-- The timestamps are declared as TIMESTAMP for the driver to scan them as times
+CREATE TABLE IF NOT EXISTS users (
+id TEXT NOT NULL PRIMARY KEY,
+email TEXT NOT NULL,
+name TEXT NOT NULL,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
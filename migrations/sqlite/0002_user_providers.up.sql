@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_providers (
+user_id TEXT NOT NULL,
+-- What provider the user used to sign up
+provider TEXT NOT NULL,
+-- The id of the user with the provider
+provider_id TEXT NOT NULL UNIQUE,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
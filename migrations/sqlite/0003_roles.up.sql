@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS roles (
+id TEXT PRIMARY KEY,
+name TEXT UNIQUE NOT NULL,
+description TEXT,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
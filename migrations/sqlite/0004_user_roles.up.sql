@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+user_id TEXT NOT NULL,
+role_id TEXT NOT NULL,
+assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (user_id, role_id),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS role_permissions (
+role_id TEXT NOT NULL,
+p_key TEXT NOT NULL,
+p_val TEXT NOT NULL,
+PRIMARY KEY (role_id, p_key, p_val),
+FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
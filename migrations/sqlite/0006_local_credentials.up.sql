@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS local_credentials (
+user_id TEXT NOT NULL PRIMARY KEY,
+-- The Argon2id hash in the PHC string format
+password_hash TEXT NOT NULL,
+-- Failed login attempts since the last successful login
+failed_attempts INTEGER NOT NULL DEFAULT 0,
+-- The account is locked until this time after too many failed attempts
+locked_until TIMESTAMP NULL DEFAULT NULL,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS mfa_totp (
+user_id TEXT NOT NULL PRIMARY KEY,
+-- Base32 encoded secret shared with the authenticator app
+secret TEXT NOT NULL,
+-- The secret is enabled once it has been confirmed with a valid code
+enabled BOOLEAN NOT NULL DEFAULT FALSE,
+-- The time step of the last accepted code, used to prevent codes from being reused
+last_used_step INTEGER NOT NULL DEFAULT 0,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
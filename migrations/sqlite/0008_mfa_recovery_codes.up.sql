@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+user_id TEXT NOT NULL,
+-- SHA-256 of the normalized code
+code_hash TEXT NOT NULL,
+used_at TIMESTAMP NULL DEFAULT NULL,
+PRIMARY KEY (user_id, code_hash),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+-- The credential ID chosen by the authenticator
+id BLOB NOT NULL PRIMARY KEY,
+user_id TEXT NOT NULL,
+name TEXT NOT NULL,
+public_key BLOB NOT NULL,
+attestation_type TEXT NOT NULL,
+-- Comma separated list of transports, e.g. "usb,nfc"
+transports TEXT NOT NULL,
+aaguid BLOB NOT NULL,
+sign_count INTEGER NOT NULL DEFAULT 0,
+backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+last_used_at TIMESTAMP NULL,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id ON webauthn_credentials (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS invitations (
+id TEXT NOT NULL PRIMARY KEY,
+-- The address the invitation was sent to
+email TEXT NOT NULL,
+-- The admin that created the invitation
+invited_by TEXT NOT NULL,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+expires_at TIMESTAMP NOT NULL,
+accepted_at TIMESTAMP NULL,
+-- The user that accepted the invitation, not necessarily with the same email
+accepted_by TEXT NULL,
+FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS provider_tokens (
+-- The id of the user at the provider
+provider_id TEXT NOT NULL PRIMARY KEY,
+user_id TEXT NOT NULL,
+provider TEXT NOT NULL,
+-- The name of the configured provider that issued the token
+provider_name TEXT NOT NULL,
+-- The tokens are encrypted with AES-256-GCM
+access_token BLOB NOT NULL,
+refresh_token BLOB NULL,
+token_type TEXT NOT NULL,
+scope TEXT NOT NULL,
+expires_at TIMESTAMP NULL DEFAULT NULL,
+updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (provider_id) REFERENCES user_providers(provider_id) ON DELETE CASCADE
+);
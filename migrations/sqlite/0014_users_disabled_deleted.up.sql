@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+-- Deleted users are kept until the retention period has passed
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
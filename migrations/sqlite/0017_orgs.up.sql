@@ -0,0 +1,18 @@
+-- Organizations are the tenants, roles that belong to an org only apply while it is the active org of the user
+CREATE TABLE IF NOT EXISTS orgs (
+id TEXT PRIMARY KEY,
+name TEXT UNIQUE NOT NULL,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+org_id TEXT NOT NULL,
+user_id TEXT NOT NULL,
+added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (org_id, user_id),
+FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Roles without an org are global
+ALTER TABLE roles ADD COLUMN org_id TEXT REFERENCES orgs(id) ON DELETE CASCADE;
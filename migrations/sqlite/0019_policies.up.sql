@@ -0,0 +1,12 @@
+-- Policies allow or deny actions when the expression of their condition holds, see sdk.ParseCondition for the language
+CREATE TABLE IF NOT EXISTS policies (
+id TEXT PRIMARY KEY,
+name TEXT UNIQUE NOT NULL,
+description TEXT NOT NULL,
+-- allow or deny
+effect TEXT NOT NULL,
+-- The action patterns separated by commas
+actions TEXT NOT NULL,
+expression TEXT NOT NULL,
+created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
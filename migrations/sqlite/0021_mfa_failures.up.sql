@@ -0,0 +1,3 @@
+-- Invalid codes are counted per user, like the failed logins of the local accounts, so that they can not be reset by the client
+ALTER TABLE mfa_totp ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE mfa_totp ADD COLUMN locked_until TIMESTAMP NULL DEFAULT NULL;
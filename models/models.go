@@ -1,11 +1,15 @@
 package models
 
+import "time"
+
 type User struct {
 	// The user's ID in the system
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	// The user's email
 	Email string `json:"email"`
+	// Disabled users can not log in or get tokens
+	Disabled bool `json:"disabled"`
 }
 
 type UserProviderType string
@@ -13,6 +17,11 @@ type UserProviderType string
 const (
 	UserProviderTypeGithub UserProviderType = "github"
 	UserProviderTypeGoogle UserProviderType = "google"
+	UserProviderTypeEmail  UserProviderType = "email"
+	UserProviderTypeLocal  UserProviderType = "local"
+	UserProviderTypeSAML   UserProviderType = "saml"
+	// Users provisioned by a SCIM client, the provider id is the external id given by the client
+	UserProviderTypeSCIM UserProviderType = "scim"
 )
 
 type UserProvider struct {
@@ -23,11 +32,180 @@ type UserProvider struct {
 }
 
 type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// The org the role belongs to, empty for a global role. The role is only granted while the org is active.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// Org is an organization that users are members of, with roles of its own.
+type Org struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 }
 
+// Group is a set of users, the roles of the group are granted to all of its members.
+type Group struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 type Permission struct {
 	Key string
 	Val string
 }
+
+// PermissionGrant is an effective permission of a user and the roles it was granted through.
+type PermissionGrant struct {
+	Permission
+	// The ids of the roles from the one assigned to the user to the one that has the permission,
+	// each role being a parent of the one before. A permission of an assigned role has only that role.
+	RolePath []string `json:"role_path"`
+	// The id of the group the first role of the path is assigned to, empty if it is assigned to the user directly
+	GroupID string `json:"group_id,omitempty"`
+	// When the assignment of the first role of the path expires, nil if it does not
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// PermissionConflict is a permission key that a user is granted several values of, by different roles.
+// The user has all of the values.
+type PermissionConflict struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// PermissionCheck tells whether a user is granted a permission and why.
+type PermissionCheck struct {
+	Permission
+	Allowed bool `json:"allowed"`
+	// The grants of the permission to the user, with the roles and groups it came through
+	Grants []PermissionGrant `json:"grants"`
+	// The roles that have or inherit the permission when it is not granted, assigning any of them would grant it
+	GrantingRoles []Role `json:"granting_roles,omitempty"`
+}
+
+// LocalCredential is the password of a user with a local account.
+type LocalCredential struct {
+	UserID string
+	// The Argon2id hash of the password
+	PasswordHash string
+	// Number of failed login attempts since the last successful login
+	FailedAttempts int
+	// The account can not be logged in to until this time, nil if not locked
+	LockedUntil *time.Time
+}
+
+// TOTP is the time-based one-time password secret of a user.
+type TOTP struct {
+	UserID string
+	// Base32 encoded secret shared with the authenticator app
+	Secret string
+	// The secret is enabled once the user has confirmed it with a valid code
+	Enabled bool
+	// The time step of the last accepted code, codes can not be reused
+	LastUsedStep int64
+	// Invalid codes since the last valid one
+	FailedAttempts int
+	// No codes are accepted until this time, nil if not locked
+	LockedUntil *time.Time
+}
+
+type WebAuthnCredential struct {
+	// The credential ID chosen by the authenticator
+	ID     []byte
+	UserID string
+	// A name given by the user to tell the credentials apart
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	// How the browser can reach the authenticator, e.g. "usb" or "internal"
+	Transports []string
+	// Identifies the model of the authenticator
+	AAGUID    []byte
+	SignCount uint32
+	// Whether the credential can be synced between devices, and whether it currently is
+	BackupEligible bool
+	BackupState    bool
+	CreatedAt      time.Time
+	LastUsedAt     *time.Time
+}
+
+// Invitation invites someone by email. The roles are assigned to whoever accepts the invitation.
+type Invitation struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	RoleIDs   []string  `json:"role_ids"`
+	InvitedBy string    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Set once the invitation is accepted
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy *string    `json:"accepted_by,omitempty"`
+}
+
+// ProviderToken is a token issued by the provider the user logged in with, kept for calling the provider on behalf of the user.
+type ProviderToken struct {
+	// The id of the user at the provider
+	ProviderID   string
+	UserID       string
+	ProviderType UserProviderType
+	// The name of the configured provider that issued the token
+	ProviderName string
+	// The tokens are encrypted
+	AccessToken  []byte
+	RefreshToken []byte
+	TokenType    string
+	Scope        string
+	// When the access token expires, nil if it does not
+	ExpiresAt *time.Time
+	UpdatedAt time.Time
+}
+
+type ElevationStatus string
+
+const (
+	ElevationPending  ElevationStatus = "pending"
+	ElevationApproved ElevationStatus = "approved"
+	ElevationDenied   ElevationStatus = "denied"
+)
+
+// ElevationRequest is a request by a user to be assigned a role for a while, which someone else has to approve.
+type ElevationRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	RoleID string `json:"role_id"`
+	// Why the user needs the role
+	Reason string `json:"reason"`
+	// How long the role is assigned for once approved
+	DurationSeconds int64           `json:"duration_seconds"`
+	Status          ElevationStatus `json:"status"`
+	RequestedAt     time.Time       `json:"requested_at"`
+	// Set once the request is approved or denied
+	DecidedBy *string    `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	// When the role assigned by the approval expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// Policy allows or denies actions while its condition holds. A deny overrides any allow,
+// and the actions that no policy allows are denied.
+type Policy struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Effect      PolicyEffect `json:"effect"`
+	// The actions the policy applies to, matched like the keys of permissions, e.g. "projects:*"
+	Actions []string `json:"actions"`
+	// An expression over the subject, action, resource and context, see sdk.ParseCondition.
+	// The policy always applies to its actions if it is empty.
+	Condition string `json:"condition"`
+}
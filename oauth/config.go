@@ -1,13 +1,18 @@
 package oauth
 
+import "time"
+
 type Config struct {
 	// The URL of the app, used for redirecting after OAuth login
 	AppURL         string           `yaml:"app-url"`
 	CookieName     string           `yaml:"cookie-name"`
 	SessionName    string           `yaml:"session-name"`
-	CookieSecret   string           `yaml:"cookie-secret"`
+	CookieSecret   string           `yaml:"cookie-secret" json:"-"`
 	AllowedReturns []string         `yaml:"allowed-returns"`
 	Providers      []ProviderConfig `yaml:"providers"`
+	Device         DeviceConfig     `yaml:"device"`
+	// Email login is disabled if not configured
+	Email *EmailConfig `yaml:"email"`
 }
 
 type ProviderType string
@@ -15,11 +20,53 @@ type ProviderType string
 const (
 	GithubProviderType ProviderType = "github"
 	GoogleProviderType ProviderType = "google"
+	SAMLProviderType   ProviderType = "saml"
 )
 
 type ProviderConfig struct {
 	Type         ProviderType `yaml:"type"`
 	Name         string       `yaml:"name"`
 	ClientID     string       `yaml:"client-id"`
-	ClientSecret string       `yaml:"client-secret"`
+	ClientSecret string       `yaml:"client-secret" json:"-"`
+
+	// OAuth providers
+	// Scopes to request in addition to the ones needed for the login, e.g. to call the API of the provider
+	Scopes []string `yaml:"scopes"`
+	// Store the tokens from the provider so that services can call the provider on behalf of the user.
+	// Requires the provider-tokens configuration.
+	StoreTokens bool `yaml:"store-tokens"`
+
+	// SAML providers
+	// Path to the metadata XML of the identity provider
+	IDPMetadata string `yaml:"idp-metadata"`
+	// Paths to the PEM encoded certificate and RSA key of the service provider.
+	// Optional, they are used to sign the authentication requests and to decrypt encrypted assertions.
+	SPCertificate string `yaml:"sp-certificate"`
+	SPKey         string `yaml:"sp-key" json:"-"`
+	// The requested format of the name id. Defaults to persistent.
+	NameIDFormat string `yaml:"name-id-format"`
+	// The attributes with the email and name of the user. Common attribute names are tried if not set.
+	EmailAttribute string `yaml:"email-attribute"`
+	NameAttribute  string `yaml:"name-attribute"`
+	// The email domains that the identity provider is trusted with. An existing user with an email in one of them is linked
+	// to the identity provider on the first login, other existing emails are refused so that the identity provider can not take over their users.
+	AllowedDomains []string `yaml:"allowed-domains"`
+}
+
+// DeviceConfig configures the device authorization grant (RFC 8628).
+type DeviceConfig struct {
+	// How long a device code is valid before the client has to request a new one.
+	// Defaults to 10 minutes.
+	ExpiresIn time.Duration `yaml:"expires-in"`
+	// The minimum time a client has to wait between polling requests.
+	// Defaults to 5 seconds.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// EmailConfig configures the passwordless login by links sent by email.
+type EmailConfig struct {
+	// How long a login link is valid. Defaults to 15 minutes.
+	LinkTTL time.Duration `yaml:"link-ttl"`
+	// The subject of the emails containing the login links
+	Subject string `yaml:"subject"`
 }
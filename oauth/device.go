@@ -0,0 +1,350 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/repo"
+)
+
+const (
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	defaultDeviceExpiresIn = 10 * time.Minute
+	defaultDeviceInterval  = 5 * time.Second
+	// How much the polling interval is increased when a client polls too fast
+	deviceSlowDownStep = 5 * time.Second
+
+	// Vowels are left out to avoid forming words, as recommended by RFC 8628 section 6.1
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var (
+	errAuthorizationPending = errors.New("authorization_pending")
+	errSlowDown             = errors.New("slow_down")
+	errAccessDenied         = errors.New("access_denied")
+	errExpiredToken         = errors.New("expired_token")
+	errInvalidGrant         = errors.New("invalid_grant")
+)
+
+type deviceAuthorization struct {
+	deviceCode string
+	userCode   string
+	clientID   string
+	// The org the token is requested for, the token has no active org if it is empty
+	orgID     string
+	expiresAt time.Time
+	interval  time.Duration
+	lastPoll  time.Time
+
+	// The user that approved the device, empty until approved
+	userID string
+	// How the user that approved the device authenticated
+	authMethods []string
+	denied      bool
+}
+
+// deviceStore keeps track of the pending device authorizations.
+// The authorizations are short-lived and are therefore only kept in memory.
+type deviceStore struct {
+	mu           sync.Mutex
+	byDeviceCode map[string]*deviceAuthorization
+	byUserCode   map[string]*deviceAuthorization
+}
+
+func newDeviceStore() *deviceStore {
+	return &deviceStore{
+		byDeviceCode: make(map[string]*deviceAuthorization),
+		byUserCode:   make(map[string]*deviceAuthorization),
+	}
+}
+
+func (s *deviceStore) add(d *deviceAuthorization) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+
+	s.byDeviceCode[d.deviceCode] = d
+	s.byUserCode[d.userCode] = d
+}
+
+// removeExpired must be called with the lock held.
+func (s *deviceStore) removeExpired() {
+	now := time.Now()
+	for code, d := range s.byDeviceCode {
+		if now.After(d.expiresAt) {
+			delete(s.byDeviceCode, code)
+			delete(s.byUserCode, d.userCode)
+		}
+	}
+}
+
+func (s *deviceStore) remove(d *deviceAuthorization) {
+	delete(s.byDeviceCode, d.deviceCode)
+	delete(s.byUserCode, d.userCode)
+}
+
+// resolve sets the outcome of the authorization with the given user code.
+// An empty userID means the user denied the device.
+func (s *deviceStore) resolve(userCode, userID string, authMethods []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.byUserCode[userCode]
+	if !ok || time.Now().After(d.expiresAt) {
+		return repo.ErrNotFound
+	}
+
+	if d.userID != "" || d.denied {
+		return errors.New("the code has already been used")
+	}
+
+	if userID == "" {
+		d.denied = true
+	} else {
+		d.userID = userID
+		d.authMethods = authMethods
+	}
+
+	return nil
+}
+
+// poll returns the authorization once the device has been approved.
+// The returned errors are the error codes defined in RFC 8628 section 3.5.
+func (s *deviceStore) poll(deviceCode, clientID string) (deviceAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.byDeviceCode[deviceCode]
+	if !ok || d.clientID != clientID {
+		return deviceAuthorization{}, errInvalidGrant
+	}
+
+	now := time.Now()
+	if now.After(d.expiresAt) {
+		s.remove(d)
+		return deviceAuthorization{}, errExpiredToken
+	}
+
+	if d.denied {
+		s.remove(d)
+		return deviceAuthorization{}, errAccessDenied
+	}
+
+	if d.userID != "" {
+		// The device code can only be exchanged once
+		s.remove(d)
+		return *d, nil
+	}
+
+	if now.Sub(d.lastPoll) < d.interval {
+		d.interval += deviceSlowDownStep
+		d.lastPoll = now
+		return deviceAuthorization{}, errSlowDown
+	}
+
+	d.lastPoll = now
+	return deviceAuthorization{}, errAuthorizationPending
+}
+
+func generateUserCode() (string, error) {
+	var sb strings.Builder
+	alphabetLen := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			sb.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, alphabetLen)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// normalizeUserCode makes the user code comparable regardless of how the user typed it.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func respondJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeDeviceCode is the device authorization endpoint (RFC 8628 section 3.1).
+// The client receives a device code to poll the token endpoint with and a user code that the user enters at the verification page.
+// The client can request a token for an org with the org form value, the user that approves the device has to be a member of it.
+func (h *OAuthHandler) ServeDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: "invalid_request", Description: "failed to parse form"})
+		return
+	}
+
+	clientID := r.FormValue("client_id")
+	if clientID == "" {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: "invalid_request", Description: "client_id is missing"})
+		return
+	}
+
+	deviceCode, err := GenerateState()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate device code: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate user code: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.devices.add(&deviceAuthorization{
+		deviceCode: deviceCode,
+		userCode:   userCode,
+		clientID:   clientID,
+		orgID:      r.FormValue("org"),
+		expiresAt:  time.Now().Add(h.deviceExpiresIn),
+		interval:   h.deviceInterval,
+	})
+
+	verificationURI := fmt.Sprintf("%s/device", h.appUrl.String())
+
+	respondJSON(w, http.StatusOK, struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: fmt.Sprintf("%s?user_code=%s", verificationURI, userCode),
+		ExpiresIn:               int(h.deviceExpiresIn.Seconds()),
+		Interval:                int(h.deviceInterval.Seconds()),
+	})
+}
+
+// ServeToken is the token endpoint. Only the device code grant is supported.
+func (h *OAuthHandler) ServeToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: "invalid_request", Description: "failed to parse form"})
+		return
+	}
+
+	if r.FormValue("grant_type") != deviceCodeGrantType {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: "unsupported_grant_type"})
+		return
+	}
+
+	d, err := h.devices.poll(r.FormValue("device_code"), r.FormValue("client_id"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: err.Error()})
+		return
+	}
+
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &d.userID})
+	if errors.Is(err, repo.ErrNotFound) || err == nil && u.Disabled {
+		// The user was disabled or deleted after approving the device
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: errAccessDenied.Error(), Description: "the user is disabled"})
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get user: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The device gets the same authentication strength as the session it was approved from
+	token, err := h.auth.CreateToken(r.Context(), u, authorizer.TokenParams{AuthMethods: d.authMethods, OrgID: d.orgID})
+	if errors.Is(err, repo.ErrNotMember) {
+		respondJSON(w, http.StatusBadRequest, tokenError{Error: errAccessDenied.Error(), Description: "the user is not a member of the org"})
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(h.auth.ValidDuration().Seconds()),
+	})
+}
+
+// serveDeviceVerify is where the user approves or denies a device after entering the user code.
+// The user has to be logged in.
+func (h *OAuthHandler) serveDeviceVerify(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	cookie, err := r.Cookie(h.cookieName)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	claims, err := h.auth.Decode(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return lerror.Wrap(err, "failed to parse form", http.StatusBadRequest)
+	}
+
+	userCode := normalizeUserCode(r.FormValue("user_code"))
+	if userCode == "" {
+		return lerror.New("user code not found", http.StatusBadRequest)
+	}
+
+	var userID string
+	result := "denied"
+	if r.FormValue("action") == "approve" {
+		userID = claims.UserID
+		result = "approved"
+	}
+
+	if err := h.devices.resolve(userCode, userID, claims.AuthMethods); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return lerror.New("invalid or expired code", http.StatusBadRequest)
+		}
+		return lerror.Wrap(err, "failed to verify the device", http.StatusBadRequest)
+	}
+
+	http.Redirect(w, r, "/device?result="+result, http.StatusFound)
+	return nil
+}
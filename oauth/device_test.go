@@ -0,0 +1,212 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+func Test_NormalizeUserCode(t *testing.T) {
+	testCases := []struct {
+		code string
+		want string
+	}{
+		{code: "BCDF-GHJK", want: "BCDF-GHJK"},
+		{code: "bcdfghjk", want: "BCDF-GHJK"},
+		{code: " bcdf ghjk ", want: "BCDF-GHJK"},
+		{code: "bcd", want: "BCD"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.code, func(t *testing.T) {
+			if got := normalizeUserCode(tC.code); got != tC.want {
+				t.Errorf("normalizeUserCode() = %v; want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_DeviceStorePoll(t *testing.T) {
+	s := newDeviceStore()
+	s.add(&deviceAuthorization{
+		deviceCode: "device",
+		userCode:   "BCDF-GHJK",
+		clientID:   "cli",
+		expiresAt:  time.Now().Add(time.Minute),
+	})
+
+	if _, err := s.poll("device", "other-cli"); err != errInvalidGrant {
+		t.Errorf("poll() with wrong client = %v; want %v", err, errInvalidGrant)
+	}
+
+	if _, err := s.poll("device", "cli"); err != errAuthorizationPending {
+		t.Errorf("poll() before approval = %v; want %v", err, errAuthorizationPending)
+	}
+
+	if err := s.resolve("BCDF-GHJK", "user-id", nil); err != nil {
+		t.Fatalf("resolve() = %v; want nil", err)
+	}
+
+	d, err := s.poll("device", "cli")
+	if err != nil {
+		t.Fatalf("poll() after approval = %v; want nil", err)
+	}
+	if d.userID != "user-id" {
+		t.Errorf("poll() = %v; want %v", d.userID, "user-id")
+	}
+
+	if _, err := s.poll("device", "cli"); err != errInvalidGrant {
+		t.Errorf("poll() after exchange = %v; want %v", err, errInvalidGrant)
+	}
+}
+
+func Test_DeviceStorePollDenied(t *testing.T) {
+	s := newDeviceStore()
+	s.add(&deviceAuthorization{
+		deviceCode: "device",
+		userCode:   "BCDF-GHJK",
+		clientID:   "cli",
+		expiresAt:  time.Now().Add(time.Minute),
+		interval:   time.Minute,
+	})
+
+	if _, err := s.poll("device", "cli"); err != errAuthorizationPending {
+		t.Errorf("poll() = %v; want %v", err, errAuthorizationPending)
+	}
+
+	if _, err := s.poll("device", "cli"); err != errSlowDown {
+		t.Errorf("poll() too fast = %v; want %v", err, errSlowDown)
+	}
+
+	if err := s.resolve("BCDF-GHJK", "", nil); err != nil {
+		t.Fatalf("resolve() = %v; want nil", err)
+	}
+
+	if _, err := s.poll("device", "cli"); err != errAccessDenied {
+		t.Errorf("poll() after denial = %v; want %v", err, errAccessDenied)
+	}
+}
+
+func newTestAuthorizer(t *testing.T) *authorizer.Authorizer {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := authorizer.New(&authorizer.Config{
+		AppUrl:        "https://auth.example.com",
+		PrivateKey:    pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawPriv}),
+		PublicKey:     pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rawPub}),
+		ValidDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auth
+}
+
+func Test_DeviceTokenOfOrg(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	u, err := userService.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	org, other := models.Org{ID: "org", Name: "Org"}, models.Org{ID: "other", Name: "Other"}
+	for _, o := range []models.Org{org, other} {
+		if err := r.CreateOrg(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.AddOrgMember(ctx, org.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	role := models.Role{ID: "role", Name: "team-a", OrgID: org.ID}
+	if err := r.CreateRole(ctx, role, []models.Permission{{Key: "team", Val: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignRole(ctx, u.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := newTestAuthorizer(t)
+	h, err := NewOAuthHandler(&Config{AppURL: "https://auth.example.com", CookieSecret: "secret", SessionName: "thor"}, &Services{Users: userService, Auth: auth})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requestToken approves a device that requested a token for the org and exchanges its device code
+	requestToken := func(orgID string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/oauth/device/code", strings.NewReader(url.Values{"client_id": {"cli"}, "org": {orgID}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeDeviceCode(rec, req)
+
+		var codes struct {
+			DeviceCode string `json:"device_code"`
+			UserCode   string `json:"user_code"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&codes); err != nil {
+			t.Fatalf("ServeDeviceCode() response = %v; want the codes", err)
+		}
+		if err := h.devices.resolve(codes.UserCode, u.ID, nil); err != nil {
+			t.Fatalf("resolve() = %v; want nil", err)
+		}
+
+		rec = httptest.NewRecorder()
+		form := url.Values{"grant_type": {deviceCodeGrantType}, "device_code": {codes.DeviceCode}, "client_id": {"cli"}}
+		req = httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeToken(rec, req)
+		return rec
+	}
+
+	rec := requestToken(org.ID)
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("ServeToken() = %d, %v; want a token", rec.Code, err)
+	}
+	claims, err := auth.Decode(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("Decode() = %v; want nil", err)
+	}
+	if claims.OrgID != org.ID || !slices.Equal(claims.Permissions["team"], authorizer.PermissionValues{"a"}) {
+		t.Errorf("claims = %s, %v; want the org and its permissions", claims.OrgID, claims.Permissions)
+	}
+
+	rec = requestToken(other.ID)
+	var tokenErr tokenError
+	if err := json.NewDecoder(rec.Body).Decode(&tokenErr); err != nil || rec.Code != http.StatusBadRequest || tokenErr.Error != errAccessDenied.Error() {
+		t.Errorf("ServeToken() of an org the user is not a member of = %d, %+v; want %s", rec.Code, tokenErr, errAccessDenied)
+	}
+}
@@ -0,0 +1,180 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/lerror"
+	thormail "github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/models"
+)
+
+const (
+	emailLinkAudience       = "email-login"
+	defaultEmailLinkTTL     = 15 * time.Minute
+	defaultEmailLinkSubject = "Your login link"
+)
+
+type emailLogin struct {
+	linkTTL time.Duration
+	subject string
+}
+
+type emailLinkClaims struct {
+	jwt.RegisteredClaims
+	Email  string `json:"email"`
+	Return string `json:"ret,omitempty"`
+}
+
+// usedLinks keeps track of the login links that have been used so that each link can only be used once.
+// A link only has to be remembered until it expires, after that it is rejected anyways.
+type usedLinks struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newUsedLinks() *usedLinks {
+	return &usedLinks{
+		used: make(map[string]time.Time),
+	}
+}
+
+// use marks the link as used. It returns false if the link was already used.
+func (u *usedLinks) use(id string, expiresAt time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range u.used {
+		if now.After(exp) {
+			delete(u.used, k)
+		}
+	}
+
+	if _, ok := u.used[id]; ok {
+		return false
+	}
+
+	u.used[id] = expiresAt
+	return true
+}
+
+// wasUsed reports whether the link has been used and not yet expired.
+func (u *usedLinks) wasUsed(id string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	exp, ok := u.used[id]
+	return ok && time.Now().Before(exp)
+}
+
+// serveEmailSend sends a login link to the email address in the form.
+// The response is the same whether or not the address belongs to a user, to not reveal which addresses are registered.
+func (h *OAuthHandler) serveEmailSend(w http.ResponseWriter, r *http.Request) error {
+	if h.email == nil {
+		return lerror.New("email login is not enabled", http.StatusNotFound)
+	}
+
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return lerror.Wrap(err, "failed to parse form", http.StatusBadRequest)
+	}
+
+	addr, err := mail.ParseAddress(r.FormValue("email"))
+	if err != nil {
+		return lerror.Wrap(err, "invalid email address", http.StatusBadRequest)
+	}
+
+	returnTo, err := parseReturnTo(h.allowedReturns, r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(h.email.linkTTL)
+	token, err := h.signer.Sign(emailLinkClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{emailLinkAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Email:  addr.Address,
+		Return: returnTo,
+	})
+	if err != nil {
+		return lerror.Wrap(err, "failed to create login link", http.StatusInternalServerError)
+	}
+
+	link := fmt.Sprintf("%s/oauth/email/verify?token=%s", h.appUrl.String(), url.QueryEscape(token))
+
+	err = h.mailer.Send(r.Context(), thormail.Message{
+		To:      addr.Address,
+		Subject: h.email.subject,
+		Body:    fmt.Sprintf("Use the link below to log in. The link can only be used once and expires at %s.\n\n%s\n", expiresAt.Format(time.RFC1123), link),
+	})
+	if err != nil {
+		return lerror.Wrap(err, "failed to send login link", http.StatusInternalServerError)
+	}
+
+	http.Redirect(w, r, "/login?sent=1", http.StatusFound)
+	return nil
+}
+
+// useEmailLink verifies the token of a login link and marks the link as used, a link is only accepted once.
+func (h *OAuthHandler) useEmailLink(token string) (emailLinkClaims, error) {
+	if token == "" {
+		return emailLinkClaims{}, lerror.New("token not found", http.StatusBadRequest)
+	}
+
+	var claims emailLinkClaims
+	if err := h.signer.Verify(token, emailLinkAudience, &claims); err != nil {
+		return emailLinkClaims{}, lerror.Wrap(err, "invalid or expired login link", http.StatusBadRequest)
+	}
+
+	if !h.usedLinks.use(claims.ID, claims.ExpiresAt.Time) {
+		return emailLinkClaims{}, lerror.New("the login link has already been used", http.StatusBadRequest)
+	}
+
+	return claims, nil
+}
+
+// serveEmailVerify logs in the user that the clicked link was sent to.
+func (h *OAuthHandler) serveEmailVerify(w http.ResponseWriter, r *http.Request) error {
+	if h.email == nil {
+		return lerror.New("email login is not enabled", http.StatusNotFound)
+	}
+
+	claims, err := h.useEmailLink(r.FormValue("token"))
+	if err != nil {
+		return err
+	}
+
+	// The part before the @ is the best guess of a name, it can be changed later
+	name, _, _ := strings.Cut(claims.Email, "@")
+
+	// Receiving the link proves that the email belongs to the user, so an existing user with the email is linked
+	u, err := h.constructUser(r.Context(), models.User{
+		Name:  name,
+		Email: claims.Email,
+	}, models.UserProvider{
+		Type:   models.UserProviderTypeEmail,
+		UserID: claims.Email,
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	return h.completeLogin(w, r, u, claims.Return, []string{authorizer.AuthMethodEmail})
+}
@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/signer"
+)
+
+// recordingSender keeps the sent emails instead of delivering them.
+type recordingSender struct {
+	sent []mail.Message
+}
+
+func (s *recordingSender) Send(_ context.Context, msg mail.Message) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`/oauth/email/verify\?token=(\S+)`)
+
+func Test_EmailLinkSingleUse(t *testing.T) {
+	sender := &recordingSender{}
+	h, err := NewOAuthHandler(&Config{AppURL: "https://auth.example.com", Email: &EmailConfig{}}, &Services{Mailer: sender, LinkSigner: signer.New([]byte("secret"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/email/send", strings.NewReader(url.Values{"email": {"leo@example.com"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := h.serveEmailSend(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("serveEmailSend() = %v; want nil", err)
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0].To != "leo@example.com" {
+		t.Fatalf("sent = %v; want one email to leo@example.com", sender.sent)
+	}
+
+	m := linkToken.FindStringSubmatch(sender.sent[0].Body)
+	if m == nil {
+		t.Fatalf("no login link in %q", sender.sent[0].Body)
+	}
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := h.useEmailLink(token)
+	if err != nil {
+		t.Fatalf("useEmailLink() = %v; want nil", err)
+	}
+	if claims.Email != "leo@example.com" {
+		t.Errorf("email = %v; want %v", claims.Email, "leo@example.com")
+	}
+
+	if _, err := h.useEmailLink(token); err == nil {
+		t.Error("useEmailLink() of a used link = nil; want error")
+	}
+}
+
+func Test_EmailLinkExpired(t *testing.T) {
+	h, err := NewOAuthHandler(&Config{AppURL: "https://auth.example.com", Email: &EmailConfig{}}, &Services{Mailer: &recordingSender{}, LinkSigner: signer.New([]byte("secret"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuedAt := time.Now().Add(-time.Hour)
+	token, err := h.signer.Sign(emailLinkClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "expired",
+			Audience:  jwt.ClaimStrings{emailLinkAudience},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(defaultEmailLinkTTL)),
+		},
+		Email: "leo@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.useEmailLink(token); err == nil {
+		t.Error("useEmailLink() of an expired link = nil; want error")
+	}
+}
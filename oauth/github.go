@@ -4,18 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/providertoken"
 )
 
 const (
 	githubLoginEndpoint = "https://github.com/login/oauth/authorize"
+	githubTokenEndpoint = "https://github.com/login/oauth/access_token"
 )
 
 type githubHandler struct {
 	clientID     string
 	clientSecret string
 	name         string
+	scopes       []string
+	storeTokens  bool
 }
 
 func newGithub(cfg ProviderConfig) *githubHandler {
@@ -23,11 +29,14 @@ func newGithub(cfg ProviderConfig) *githubHandler {
 		clientID:     cfg.ClientID,
 		clientSecret: cfg.ClientSecret,
 		name:         cfg.Name,
+		scopes:       append([]string{"user:email", "read:user"}, cfg.Scopes...),
+		storeTokens:  cfg.StoreTokens,
 	}
 }
 
 func (g *githubHandler) BuildLoginUrl(state, redirectURL string) string {
-	scopes := "user:email%20read:user"
+	// The scopes are separated by spaces, encoded as %20
+	scopes := url.PathEscape(strings.Join(g.scopes, " "))
 	return fmt.Sprintf("%s?client_id=%s&state=%s&redirect_uri=%s&scope=%s", githubLoginEndpoint, g.clientID, state, redirectURL, scopes)
 }
 
@@ -39,19 +48,28 @@ func (g *githubHandler) Type() string {
 	return string(GithubProviderType)
 }
 
+func (g *githubHandler) storesTokens() bool {
+	return g.storeTokens
+}
+
 func (g *githubHandler) GetUser(code string) (models.User, models.UserProvider, error) {
+	u, p, _, err := g.getUserAndToken(code)
+	return u, p, err
+}
+
+func (g *githubHandler) getUserAndToken(code string) (models.User, models.UserProvider, providertoken.Token, error) {
 	token, err := g.getAccessToken(code)
 	if err != nil {
-		return models.User{}, models.UserProvider{}, err
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, err
 	}
 
 	req, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", token))
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", token.AccessToken))
 	req.Header.Add("Accept", "application/vnd.github.v3+json")
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return models.User{}, models.UserProvider{}, err
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, err
 	}
 	defer res.Body.Close()
 
@@ -63,7 +81,7 @@ func (g *githubHandler) GetUser(code string) (models.User, models.UserProvider,
 	}{}
 
 	if err := json.NewDecoder(res.Body).Decode(&user); err != nil {
-		return models.User{}, models.UserProvider{}, err
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, err
 	}
 
 	return models.User{
@@ -72,35 +90,28 @@ func (g *githubHandler) GetUser(code string) (models.User, models.UserProvider,
 		}, models.UserProvider{
 			UserID: fmt.Sprintf("%d", user.ID),
 			Type:   models.UserProviderTypeGithub,
-		}, nil
+		}, token.token(), nil
 }
 
-func (g *githubHandler) getAccessToken(code string) (string, error) {
-	reqURL := fmt.Sprintf("https://github.com/login/oauth/access_token?client_id=%s&client_secret=%s&code=%s", g.clientID, g.clientSecret, code)
-	req, err := http.NewRequest(http.MethodPost, reqURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("could not create HTTP request: %v", err)
-	}
-	req.Header.Set("Accept", "application/json")
+func (g *githubHandler) getAccessToken(code string) (tokenResponse, error) {
+	return requestToken(githubTokenEndpoint, url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"code":          {code},
+	})
+}
 
-	res, err := http.DefaultClient.Do(req)
+// Refresh gets a new access token, GitHub only issues refresh tokens for apps with expiring user tokens.
+func (g *githubHandler) Refresh(refreshToken string) (providertoken.Token, error) {
+	token, err := requestToken(githubTokenEndpoint, url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
 	if err != nil {
-		return "", fmt.Errorf("could not send HTTP request: %v", err)
-	}
-	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("non-ok status code: %d", res.StatusCode)
-	}
-
-	defer res.Body.Close()
-
-	// Parse the request body
-	var respBody = struct {
-		AccessToken string `json:"access_token"`
-	}{}
-
-	if err := json.NewDecoder(res.Body).Decode(&respBody); err != nil {
-		return "", fmt.Errorf("could not parse JSON response: %v", err)
+		return providertoken.Token{}, err
 	}
 
-	return respBody.AccessToken, nil
+	return token.token(), nil
 }
@@ -1,13 +1,13 @@
 package oauth
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/providertoken"
 )
 
 const (
@@ -20,6 +20,8 @@ type googleHandler struct {
 	clientSecret string
 	name         string
 	appBaseURL   string
+	scopes       []string
+	storeTokens  bool
 }
 
 func newGoogle(cfg ProviderConfig, appBaseURL string) *googleHandler {
@@ -28,14 +30,22 @@ func newGoogle(cfg ProviderConfig, appBaseURL string) *googleHandler {
 		clientSecret: cfg.ClientSecret,
 		name:         cfg.Name,
 		appBaseURL:   appBaseURL,
+		scopes:       append([]string{"openid", "email", "profile"}, cfg.Scopes...),
+		storeTokens:  cfg.StoreTokens,
 	}
 }
 
 func (g *googleHandler) BuildLoginUrl(state, redirectURL string) string {
 	// %20 is encoded as a space in the URL
-	scope := "openid%20email%20profile"
+	scope := url.PathEscape(strings.Join(g.scopes, " "))
 
-	return fmt.Sprintf("%s?response_type=code&scope=%s&client_id=%s&state=%s&redirect_uri=%s", googleLoginEndpoint, scope, g.clientID, state, redirectURL)
+	loginURL := fmt.Sprintf("%s?response_type=code&scope=%s&client_id=%s&state=%s&redirect_uri=%s", googleLoginEndpoint, scope, g.clientID, state, redirectURL)
+	if g.storeTokens {
+		// Google only issues a refresh token when asked for offline access, and only at the first consent unless prompted again
+		loginURL += "&access_type=offline&prompt=consent"
+	}
+
+	return loginURL
 }
 
 func (g *googleHandler) Name() string {
@@ -46,25 +56,34 @@ func (g *googleHandler) Type() string {
 	return string(GoogleProviderType)
 }
 
+func (g *googleHandler) storesTokens() bool {
+	return g.storeTokens
+}
+
 func (g *googleHandler) GetUser(code string) (models.User, models.UserProvider, error) {
-	token, err := g.getIdToken(code)
+	u, p, _, err := g.getUserAndToken(code)
+	return u, p, err
+}
+
+func (g *googleHandler) getUserAndToken(code string) (models.User, models.UserProvider, providertoken.Token, error) {
+	token, err := g.getTokens(code)
 	if err != nil {
-		return models.User{}, models.UserProvider{}, err
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, err
 	}
 
 	// It is safe to do this unverified because we know that the token is directly from google
-	t, _, err := jwt.NewParser().ParseUnverified(token, &googleClaims{})
+	t, _, err := jwt.NewParser().ParseUnverified(token.IDToken, &googleClaims{})
 	if err != nil {
-		return models.User{}, models.UserProvider{}, fmt.Errorf("could not parse JWT token: %v", err)
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, fmt.Errorf("could not parse JWT token: %v", err)
 	}
 
 	claims, ok := t.Claims.(*googleClaims)
 	if !ok {
-		return models.User{}, models.UserProvider{}, fmt.Errorf("could not parse JWT claims")
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, fmt.Errorf("could not parse JWT claims")
 	}
 
 	if !claims.EmailVerified {
-		return models.User{}, models.UserProvider{}, fmt.Errorf("email not verified")
+		return models.User{}, models.UserProvider{}, providertoken.Token{}, fmt.Errorf("email not verified")
 	}
 
 	return models.User{
@@ -74,38 +93,29 @@ func (g *googleHandler) GetUser(code string) (models.User, models.UserProvider,
 		models.UserProvider{
 			UserID: claims.Subject,
 			Type:   models.UserProviderTypeGoogle,
-		}, nil
+		}, token.token(), nil
 }
 
-func (g *googleHandler) getIdToken(code string) (string, error) {
-	redirectURL := fmt.Sprintf("%s/oauth/callback/google/%s", g.appBaseURL, g.name)
-	reqURL := fmt.Sprintf("%s?grant_type=authorization_code&client_id=%s&client_secret=%s&code=%s&redirect_uri=%s", googleTokenEndpoint, g.clientID, g.clientSecret, code, redirectURL)
-	req, err := http.NewRequest(http.MethodPost, reqURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("could not create HTTP request: %v", err)
-	}
-	req.Header.Set("Accept", "application/json")
+func (g *googleHandler) getTokens(code string) (tokenResponse, error) {
+	return requestToken(googleTokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {fmt.Sprintf("%s/oauth/callback/google/%s", g.appBaseURL, g.name)},
+	})
+}
 
-	res, err := http.DefaultClient.Do(req)
+func (g *googleHandler) Refresh(refreshToken string) (providertoken.Token, error) {
+	token, err := requestToken(googleTokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"refresh_token": {refreshToken},
+	})
 	if err != nil {
-		return "", fmt.Errorf("could not send HTTP request: %v", err)
-	}
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		return "", fmt.Errorf("non-ok status code: %d, %s", res.StatusCode, body)
-	}
-
-	defer res.Body.Close()
-
-	var respBody = struct {
-		// AccessToken string `json:"access_token"`
-		IdToken string `json:"id_token"`
-		// GrantType   string `json:"grant_type"`
-	}{}
-
-	if err := json.NewDecoder(res.Body).Decode(&respBody); err != nil {
-		return "", fmt.Errorf("could not parse JSON response: %v", err)
+		return providertoken.Token{}, err
 	}
 
-	return respBody.IdToken, nil
+	return token.token(), nil
 }
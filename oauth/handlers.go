@@ -9,13 +9,19 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 
+	"github.com/theleeeo/thor/authorizer"
 	"github.com/theleeeo/thor/lerror"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/providertoken"
 	"github.com/theleeeo/thor/repo"
 	"github.com/theleeeo/thor/user"
 )
 
+// errUserDisabled refuses the login of a disabled user
+var errUserDisabled = lerror.New("the user is disabled", http.StatusForbidden)
+
 func GenerateState() (string, error) {
 	b := make([]byte, 32) // Adjust size as needed.
 	if _, err := rand.Read(b); err != nil {
@@ -42,6 +48,13 @@ func (h *OAuthHandler) serveLogin(w http.ResponseWriter, r *http.Request, provid
 	}
 
 	session.Values["state"] = state
+
+	// The SAML assertion is posted back from the identity provider, which browsers only send the session cookie with if it allows cross-site requests
+	if _, ok := provider.(*samlProvider); ok {
+		session.Options.SameSite = http.SameSiteNoneMode
+		session.Options.Secure = true
+	}
+
 	if err := session.Save(r, w); err != nil {
 		return lerror.Wrap(err, "failed to save the state", http.StatusInternalServerError)
 	}
@@ -110,6 +123,10 @@ func (h *OAuthHandler) serveCallback(w http.ResponseWriter, r *http.Request, pro
 	}
 
 	state := r.FormValue("state")
+	if state == "" {
+		// SAML returns the state as the relay state
+		state = r.FormValue("RelayState")
+	}
 	if state == "" {
 		return lerror.New("state not found", http.StatusBadRequest)
 	}
@@ -123,24 +140,41 @@ func (h *OAuthHandler) serveCallback(w http.ResponseWriter, r *http.Request, pro
 		return lerror.New("state mismatch", http.StatusBadRequest)
 	}
 
-	code := r.FormValue("code")
-	if code == "" {
-		return lerror.New("code not found", http.StatusBadRequest)
-	}
+	var u models.User
+	var pr models.UserProvider
+	var token *providertoken.Token
+	linkByEmail := true
+	if sp, ok := provider.(*samlProvider); ok {
+		u, pr, err = sp.getUserFromResponse(r, state)
+		if err != nil {
+			return lerror.Wrap(err, "failed to get user from saml response", http.StatusBadRequest)
+		}
+		linkByEmail = sp.linksEmail(u.Email)
+	} else {
+		code := r.FormValue("code")
+		if code == "" {
+			return lerror.New("code not found", http.StatusBadRequest)
+		}
 
-	u, pr, err := provider.GetUser(code)
-	if err != nil {
-		return lerror.Wrap(err, "failed to get user from provider", http.StatusInternalServerError)
+		if tp, ok := provider.(tokenProvider); ok && tp.storesTokens() {
+			var t providertoken.Token
+			u, pr, t, err = tp.getUserAndToken(code)
+			token = &t
+		} else {
+			u, pr, err = provider.GetUser(code)
+		}
+		if err != nil {
+			return lerror.Wrap(err, "failed to get user from provider", http.StatusInternalServerError)
+		}
 	}
 
-	user, err := h.constructUser(r.Context(), u, pr)
+	user, err := h.constructUser(r.Context(), u, pr, linkByEmail)
 	if err != nil {
 		return err
 	}
 
-	token, err := h.auth.CreateToken(r.Context(), user)
-	if err != nil {
-		return lerror.Wrap(err, "failed to create token", http.StatusInternalServerError)
+	if token != nil {
+		h.storeProviderToken(r.Context(), user.ID, provider, pr, *token)
 	}
 
 	var returnTo string
@@ -152,6 +186,100 @@ func (h *OAuthHandler) serveCallback(w http.ResponseWriter, r *http.Request, pro
 		}
 	}
 
+	return h.completeLogin(w, r, user, returnTo, []string{authorizer.AuthMethodFederated})
+}
+
+// completeLogin finishes a successful login with the given authentication methods.
+// Any accepted invitation is redeemed. If the user has to use MFA the login continues at the MFA page, otherwise the token is issued directly.
+func (h *OAuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user user.User, returnTo string, authMethods []string) error {
+	// Redeemed first since the roles of the invitation can make MFA required
+	if err := h.redeemInvitation(w, r, user); err != nil {
+		return err
+	}
+
+	mfaPage, err := h.startMFAIfRequired(w, r, user, returnTo, authMethods)
+	if err != nil {
+		return err
+	}
+
+	if mfaPage != "" {
+		http.Redirect(w, r, mfaPage, http.StatusFound)
+		return nil
+	}
+
+	return h.issueToken(w, r, user, returnTo, authMethods)
+}
+
+// startMFAIfRequired starts the MFA step if the user has a second factor or is required to enroll one.
+// It returns the MFA page to continue the login at, or an empty string if no MFA step is needed.
+func (h *OAuthHandler) startMFAIfRequired(w http.ResponseWriter, r *http.Request, user user.User, returnTo string, authMethods []string) (string, error) {
+	// The login was already multi-factor, e.g. by a passkey that verified the user
+	if slices.Contains(authMethods, authorizer.AuthMethodMFA) {
+		return "", nil
+	}
+
+	var enrolled, enforced bool
+	if h.mfaService != nil {
+		var err error
+		enrolled, err = h.mfaService.IsEnrolled(r.Context(), user.ID)
+		if err != nil {
+			return "", lerror.Wrap(err, "failed to check mfa enrollment", http.StatusInternalServerError)
+		}
+
+		enforced, err = h.mfaService.IsEnforced(r.Context(), user)
+		if err != nil {
+			return "", lerror.Wrap(err, "failed to check mfa enforcement", http.StatusInternalServerError)
+		}
+	}
+
+	if h.passkeyService != nil && !enrolled {
+		var err error
+		enrolled, err = h.passkeyService.HasCredentials(r.Context(), user.ID)
+		if err != nil {
+			return "", lerror.Wrap(err, "failed to check passkeys", http.StatusInternalServerError)
+		}
+	}
+
+	if !enrolled && !enforced {
+		return "", nil
+	}
+
+	if err := h.startMFA(w, r, user.ID, returnTo, authMethods, enforced && !enrolled); err != nil {
+		return "", err
+	}
+
+	if enrolled {
+		return "/mfa", nil
+	}
+	return "/mfa?enroll=1", nil
+}
+
+// issueToken creates a token for the user and hands it over through the cookie.
+func (h *OAuthHandler) issueToken(w http.ResponseWriter, r *http.Request, user user.User, returnTo string, authMethods []string) error {
+	if err := h.setTokenCookie(w, r, user, returnTo, authMethods); err != nil {
+		return err
+	}
+
+	if returnTo == "" {
+		returnTo = "/"
+	}
+
+	w.Header().Set("Location", returnTo)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+func (h *OAuthHandler) setTokenCookie(w http.ResponseWriter, r *http.Request, user user.User, returnTo string, authMethods []string) error {
+	// Every login method ends up here, so this refuses disabled users whichever way they logged in
+	if user.Disabled {
+		return errUserDisabled
+	}
+
+	token, err := h.auth.CreateToken(r.Context(), user, authorizer.TokenParams{AuthMethods: authMethods})
+	if err != nil {
+		return lerror.Wrap(err, "failed to create token", http.StatusInternalServerError)
+	}
+
 	cookie := &http.Cookie{
 		Name:     h.cookieName,
 		Domain:   returnTo,
@@ -162,21 +290,19 @@ func (h *OAuthHandler) serveCallback(w http.ResponseWriter, r *http.Request, pro
 		Secure:   !(h.appUrl.Scheme == "http"), // If the app url is http, then the cookie is not secure. Default to secure in all other cases.
 	}
 
-	if returnTo == "" {
-		returnTo = "/"
-	}
-
 	http.SetCookie(w, cookie)
-	w.Header().Set("Location", returnTo)
-	w.WriteHeader(http.StatusFound)
 	return nil
 }
 
 // Try to get the user. If the user does not exist, create it.
-func (h *OAuthHandler) constructUser(ctx context.Context, userModel models.User, provider models.UserProvider) (user.User, error) {
+// A user with the same email that has not used the provider before is only linked to it if linkByEmail is set, it is refused otherwise.
+func (h *OAuthHandler) constructUser(ctx context.Context, userModel models.User, provider models.UserProvider, linkByEmail bool) (user.User, error) {
 	// Try to get the u by the provider id
 	u, err := h.userService.GetByProviderID(ctx, provider.UserID)
 	if err == nil {
+		if u.Disabled {
+			return user.User{}, errUserDisabled
+		}
 		return u, nil
 	}
 	if !errors.Is(err, repo.ErrNotFound) {
@@ -186,6 +312,12 @@ func (h *OAuthHandler) constructUser(ctx context.Context, userModel models.User,
 	// User was not found, check if it exist through another provider
 	u, err = h.userService.Get(ctx, repo.GetUserParams{Email: &userModel.Email})
 	if err == nil {
+		if u.Disabled {
+			return user.User{}, errUserDisabled
+		}
+		if !linkByEmail {
+			return user.User{}, lerror.New("a user with the email already exists and can not log in with this provider", http.StatusConflict)
+		}
 		err = u.AddProvider(ctx, provider)
 		if err != nil {
 			return user.User{}, lerror.Wrap(err, "failed to add user provider", http.StatusInternalServerError)
@@ -198,6 +330,10 @@ func (h *OAuthHandler) constructUser(ctx context.Context, userModel models.User,
 
 	// User does not exist. Create the user
 	u, err = h.userService.Create(ctx, userModel, provider)
+	if errors.Is(err, repo.ErrAlreadyExists) {
+		// The provider still belongs to a user that is deleted but not yet purged
+		return user.User{}, errUserDisabled
+	}
 	if err != nil {
 		return user.User{}, lerror.Wrap(err, "failed to create user", http.StatusInternalServerError)
 	}
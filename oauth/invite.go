@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/theleeeo/thor/invitation"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+// The accepted invitation is kept in its own session until the invitee has logged in.
+func (h *OAuthHandler) inviteSessionName() string {
+	return h.sessionName + "-invite"
+}
+
+// serveInviteAccept is the target of the invitation links.
+// The invitation is remembered and the invitee is sent to log in with any method, the invitation is redeemed when the login completes.
+func (h *OAuthHandler) serveInviteAccept(w http.ResponseWriter, r *http.Request) error {
+	if h.invitationService == nil {
+		return lerror.New("invitations are not enabled", http.StatusNotFound)
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		return lerror.New("token not found", http.StatusBadRequest)
+	}
+
+	invitationID, expiresAt, err := h.invitationService.Verify(token)
+	if err != nil {
+		return lerror.Wrap(err, "invalid or expired invitation link", http.StatusBadRequest)
+	}
+
+	session, _ := h.store.New(r, h.inviteSessionName())
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = int(time.Until(expiresAt).Seconds())
+	session.Values["invitation"] = invitationID
+
+	if err := session.Save(r, w); err != nil {
+		return lerror.Wrap(err, "failed to save the invitation", http.StatusInternalServerError)
+	}
+
+	http.Redirect(w, r, "/login?invited=1", http.StatusFound)
+	return nil
+}
+
+// redeemInvitation assigns the roles of the invitation the user accepted before logging in, if any.
+// A login is not failed because of an expired, revoked or already accepted invitation, it is only logged and forgotten.
+func (h *OAuthHandler) redeemInvitation(w http.ResponseWriter, r *http.Request, u user.User) error {
+	if h.invitationService == nil {
+		return nil
+	}
+
+	session, err := h.store.Get(r, h.inviteSessionName())
+	if err != nil {
+		return nil
+	}
+
+	invitationID, _ := session.Values["invitation"].(string)
+	if invitationID == "" {
+		return nil
+	}
+
+	if err := h.invitationService.Accept(r.Context(), invitationID, u.ID); err != nil {
+		if !errors.Is(err, invitation.ErrExpired) && !errors.Is(err, invitation.ErrAlreadyAccepted) && !errors.Is(err, repo.ErrNotFound) {
+			return lerror.Wrap(err, "failed to redeem the invitation", http.StatusInternalServerError)
+		}
+		slog.Warn("failed to redeem invitation", "invitation", invitationID, "user", u.ID, "error", err)
+	}
+
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		return lerror.Wrap(err, "failed to clear the invitation", http.StatusInternalServerError)
+	}
+
+	return nil
+}
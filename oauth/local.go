@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/local"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/repo"
+)
+
+// serveLocalLogin logs in a user with a local account by username and password.
+// Failed logins are sent back to the login page with the reason.
+func (h *OAuthHandler) serveLocalLogin(w http.ResponseWriter, r *http.Request) error {
+	if h.localService == nil {
+		return lerror.New("local accounts are not enabled", http.StatusNotFound)
+	}
+
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return lerror.Wrap(err, "failed to parse form", http.StatusBadRequest)
+	}
+
+	returnTo, err := parseReturnTo(h.allowedReturns, r)
+	if err != nil {
+		return err
+	}
+
+	u, err := h.localService.Authenticate(r.Context(), r.FormValue("username"), r.FormValue("password"))
+	if err != nil {
+		if errors.Is(err, local.ErrInvalidCredentials) {
+			http.Redirect(w, r, "/login?error=invalid-credentials", http.StatusFound)
+			return nil
+		}
+		if errors.Is(err, local.ErrLocked) {
+			http.Redirect(w, r, "/login?error=locked", http.StatusFound)
+			return nil
+		}
+		return lerror.Wrap(err, "failed to authenticate", http.StatusInternalServerError)
+	}
+
+	return h.completeLogin(w, r, u, returnTo, []string{authorizer.AuthMethodPassword})
+}
+
+// serveLocalResetRequest sends a password reset link to the email of a local account.
+// The response is the same whether or not the account exists, to not reveal which addresses are registered.
+func (h *OAuthHandler) serveLocalResetRequest(w http.ResponseWriter, r *http.Request) error {
+	if h.localService == nil {
+		return lerror.New("local accounts are not enabled", http.StatusNotFound)
+	}
+
+	if h.mailer == nil {
+		return lerror.New("password reset requires a mail configuration", http.StatusNotFound)
+	}
+
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return lerror.Wrap(err, "failed to parse form", http.StatusBadRequest)
+	}
+
+	token, u, expiresAt, err := h.localService.CreateResetToken(r.Context(), r.FormValue("email"))
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			http.Redirect(w, r, "/login?reset-sent=1", http.StatusFound)
+			return nil
+		}
+		return lerror.Wrap(err, "failed to create reset token", http.StatusInternalServerError)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.appUrl.String(), url.QueryEscape(token))
+
+	err = h.mailer.Send(r.Context(), mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use the link below to choose a new password. The link can only be used once and expires at %s.\n\n%s\n\nIf you did not request a password reset you can ignore this email.\n", expiresAt.Format(time.RFC1123), link),
+	})
+	if err != nil {
+		return lerror.Wrap(err, "failed to send reset link", http.StatusInternalServerError)
+	}
+
+	http.Redirect(w, r, "/login?reset-sent=1", http.StatusFound)
+	return nil
+}
+
+// serveLocalReset sets the new password chosen on the reset page.
+func (h *OAuthHandler) serveLocalReset(w http.ResponseWriter, r *http.Request) error {
+	if h.localService == nil {
+		return lerror.New("local accounts are not enabled", http.StatusNotFound)
+	}
+
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return lerror.Wrap(err, "failed to parse form", http.StatusBadRequest)
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		return lerror.New("token not found", http.StatusBadRequest)
+	}
+
+	if err := h.localService.ResetPassword(r.Context(), token, r.FormValue("password")); err != nil {
+		return lerror.Wrap(err, "failed to reset password", http.StatusBadRequest)
+	}
+
+	http.Redirect(w, r, "/login?reset=1", http.StatusFound)
+	return nil
+}
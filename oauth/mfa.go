@@ -0,0 +1,256 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/mfa"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+// How long the user has to complete the MFA step after the first factor
+const mfaPendingDuration = 5 * time.Minute
+
+// The login is pending between the first factor and the MFA step.
+// The pending login is kept in its own session so that it is not affected by the state of other login flows.
+func (h *OAuthHandler) mfaSessionName() string {
+	return h.sessionName + "-mfa"
+}
+
+// allowEnroll is whether the user may enroll a TOTP secret during the MFA step, which only a user that has to use MFA
+// but has no second factor yet may do. Anyone else would get past their own second factor by enrolling a new one.
+func (h *OAuthHandler) startMFA(w http.ResponseWriter, r *http.Request, userID, returnTo string, authMethods []string, allowEnroll bool) error {
+	session, _ := h.store.New(r, h.mfaSessionName())
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = int(mfaPendingDuration.Seconds())
+
+	session.Values["user"] = userID
+	session.Values["return"] = returnTo
+	session.Values["amr"] = strings.Join(authMethods, " ")
+	session.Values["enroll"] = allowEnroll
+	session.Values["expires"] = time.Now().Add(mfaPendingDuration).Unix()
+	// The session is a cookie that could be sent again, the nonce makes sure the login is only completed once
+	session.Values["nonce"] = uuid.NewString()
+
+	if err := session.Save(r, w); err != nil {
+		return lerror.Wrap(err, "failed to save the mfa session", http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+type pendingMFA struct {
+	session     *sessions.Session
+	nonce       string
+	expires     time.Time
+	user        user.User
+	returnTo    string
+	authMethods []string
+	allowEnroll bool
+}
+
+// completedWith returns the authentication methods of the login once the MFA step is completed with the method.
+func (p *pendingMFA) completedWith(method string) []string {
+	return append(slices.Clone(p.authMethods), method, authorizer.AuthMethodMFA)
+}
+
+func (h *OAuthHandler) getPendingMFA(r *http.Request) (*pendingMFA, error) {
+	session, err := h.store.Get(r, h.mfaSessionName())
+	if err != nil {
+		return nil, lerror.Wrap(err, "failed to get the mfa session", http.StatusBadRequest)
+	}
+
+	userID, _ := session.Values["user"].(string)
+	expires, _ := session.Values["expires"].(int64)
+	nonce, _ := session.Values["nonce"].(string)
+	if userID == "" || nonce == "" || time.Now().Unix() > expires || h.usedLinks.wasUsed(mfaNonceID(nonce)) {
+		return nil, lerror.New("no pending login, log in again", http.StatusBadRequest)
+	}
+
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &userID})
+	if err != nil {
+		return nil, lerror.Wrap(err, "failed to get user", http.StatusInternalServerError)
+	}
+
+	returnTo, _ := session.Values["return"].(string)
+	amr, _ := session.Values["amr"].(string)
+	allowEnroll, _ := session.Values["enroll"].(bool)
+
+	return &pendingMFA{
+		session:     session,
+		nonce:       nonce,
+		expires:     time.Unix(expires, 0),
+		user:        u,
+		returnTo:    returnTo,
+		authMethods: strings.Fields(amr),
+		allowEnroll: allowEnroll,
+	}, nil
+}
+
+// checkEnrollAllowed refuses to enroll MFA during a login unless the user had no second factor when it started.
+// The passkeys are checked again since one could have been added after that.
+func (h *OAuthHandler) checkEnrollAllowed(r *http.Request, pending *pendingMFA) error {
+	if !pending.allowEnroll {
+		return lerror.New("mfa can not be enrolled during this login", http.StatusForbidden)
+	}
+
+	if h.passkeyService != nil {
+		hasPasskeys, err := h.passkeyService.HasCredentials(r.Context(), pending.user.ID)
+		if err != nil {
+			return lerror.Wrap(err, "failed to check passkeys", http.StatusInternalServerError)
+		}
+		if hasPasskeys {
+			return lerror.New("mfa can not be enrolled during this login", http.StatusForbidden)
+		}
+	}
+
+	return nil
+}
+
+func mfaNonceID(nonce string) string {
+	return "mfa:" + nonce
+}
+
+// endMFA clears the pending login and marks it as ended, so that it is not accepted again even if the cookie is.
+func (h *OAuthHandler) endMFA(w http.ResponseWriter, r *http.Request, pending *pendingMFA) error {
+	if !h.usedLinks.use(mfaNonceID(pending.nonce), pending.expires) {
+		return lerror.New("no pending login, log in again", http.StatusBadRequest)
+	}
+
+	pending.session.Options.MaxAge = -1
+	if err := pending.session.Save(r, w); err != nil {
+		return lerror.Wrap(err, "failed to clear the mfa session", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// serveMFAVerify completes a pending login with a code from the authenticator app or a recovery code.
+func (h *OAuthHandler) serveMFAVerify(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if h.mfaService == nil {
+		return lerror.New("mfa is not enabled", http.StatusNotFound)
+	}
+
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	// The invalid codes are counted by the mfa service, per user, since the session can be replayed
+	err = h.mfaService.Verify(r.Context(), pending.user.ID, strings.TrimSpace(r.FormValue("code")))
+	if err != nil {
+		if errors.Is(err, mfa.ErrLocked) {
+			if err := h.endMFA(w, r, pending); err != nil {
+				return err
+			}
+			http.Redirect(w, r, "/login?error=mfa-locked", http.StatusFound)
+			return nil
+		}
+
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			http.Redirect(w, r, "/mfa?error=invalid-code", http.StatusFound)
+			return nil
+		}
+
+		return lerror.Wrap(err, "failed to verify code", http.StatusInternalServerError)
+	}
+
+	if err := h.endMFA(w, r, pending); err != nil {
+		return err
+	}
+
+	return h.issueToken(w, r, pending.user, pending.returnTo, pending.completedWith(authorizer.AuthMethodOTP))
+}
+
+// serveMFAEnroll creates a TOTP secret for a user that has to use MFA but has not enrolled yet.
+func (h *OAuthHandler) serveMFAEnroll(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if h.mfaService == nil {
+		return lerror.New("mfa is not enabled", http.StatusNotFound)
+	}
+
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.checkEnrollAllowed(r, pending); err != nil {
+		return err
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), pending.user)
+	if err != nil {
+		if errors.Is(err, mfa.ErrAlreadyEnrolled) {
+			return lerror.Wrap(err, "failed to enroll", http.StatusBadRequest)
+		}
+		return lerror.Wrap(err, "failed to enroll", http.StatusInternalServerError)
+	}
+
+	respondJSON(w, http.StatusOK, enrollment)
+	return nil
+}
+
+// serveMFAConfirm confirms the enrollment started by serveMFAEnroll and completes the pending login.
+// The recovery codes are returned so that the user can save them before continuing.
+func (h *OAuthHandler) serveMFAConfirm(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return lerror.New("method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	if h.mfaService == nil {
+		return lerror.New("mfa is not enabled", http.StatusNotFound)
+	}
+
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.checkEnrollAllowed(r, pending); err != nil {
+		return err
+	}
+
+	codes, err := h.mfaService.Confirm(r.Context(), pending.user.ID, strings.TrimSpace(r.FormValue("code")))
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrEnrollmentNeeded) || errors.Is(err, mfa.ErrAlreadyEnrolled) {
+			return lerror.Wrap(err, "failed to confirm", http.StatusBadRequest)
+		}
+		return lerror.Wrap(err, "failed to confirm", http.StatusInternalServerError)
+	}
+
+	if err := h.endMFA(w, r, pending); err != nil {
+		return err
+	}
+
+	if err := h.setTokenCookie(w, r, pending.user, pending.returnTo, pending.completedWith(authorizer.AuthMethodOTP)); err != nil {
+		return err
+	}
+
+	returnTo := pending.returnTo
+	if returnTo == "" {
+		returnTo = "/"
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+		Return        string   `json:"return"`
+	}{
+		RecoveryCodes: codes,
+		Return:        returnTo,
+	})
+	return nil
+}
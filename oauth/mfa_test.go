@@ -0,0 +1,162 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/mfa"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+func Test_MFAVerifyReplayedSession(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	u, err := userService.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetTOTP(ctx, models.TOTP{UserID: u.ID, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewOAuthHandler(&Config{AppURL: "https://auth.example.com", CookieSecret: "secret", SessionName: "thor"}, &Services{Users: userService, MFA: mfa.NewService(&mfa.Config{}, r)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := h.startMFA(rec, httptest.NewRequest(http.MethodPost, "/oauth/login/local", nil), u.ID, "", []string{"pwd"}, false); err != nil {
+		t.Fatalf("startMFA() = %v; want nil", err)
+	}
+	// The cookie of the pending login before any code has been tried
+	saved := rec.Result().Cookies()
+
+	verify := func() (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/mfa/verify", strings.NewReader(url.Values{"code": {"abcdef"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range saved {
+			req.AddCookie(c)
+		}
+
+		rec := httptest.NewRecorder()
+		return rec, h.serveMFAVerify(rec, req)
+	}
+
+	for i := 1; i < 5; i++ {
+		rec, err := verify()
+		if err != nil {
+			t.Fatalf("serveMFAVerify() attempt %d = %v; want nil", i, err)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/mfa?error=invalid-code" {
+			t.Fatalf("serveMFAVerify() attempt %d redirected to %q; want the invalid code page", i, loc)
+		}
+	}
+
+	rec, err = verify()
+	if err != nil {
+		t.Fatalf("serveMFAVerify() attempt 5 = %v; want nil", err)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/login?error=mfa-locked" {
+		t.Errorf("serveMFAVerify() attempt 5 redirected to %q; want the lockout", loc)
+	}
+
+	totp, err := r.GetTOTP(ctx, u.ID)
+	if err != nil || totp.LockedUntil == nil {
+		t.Errorf("GetTOTP() = %+v, %v; want the codes locked", totp, err)
+	}
+
+	if _, err := verify(); err == nil {
+		t.Error("serveMFAVerify() with the cookie of an ended login = nil; want error")
+	}
+}
+
+func Test_MFAEnrollOnlyWithoutSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	passkeyService, err := passkey.NewService(&passkey.Config{}, "https://auth.example.com", r, userService)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewOAuthHandler(&Config{AppURL: "https://auth.example.com", CookieSecret: "secret", SessionName: "thor"}, &Services{Users: userService, MFA: mfa.NewService(&mfa.Config{}, r), Passkeys: passkeyService})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newUser := func(t *testing.T, hasPasskey bool) user.User {
+		t.Helper()
+
+		u, err := userService.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: uuid.NewString()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hasPasskey {
+			if err := r.CreateWebAuthnCredential(ctx, models.WebAuthnCredential{ID: []byte(u.ID), UserID: u.ID, Name: "key", PublicKey: []byte{1}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return u
+	}
+
+	testCases := []struct {
+		desc        string
+		allowEnroll bool
+		hasPasskey  bool
+		want        bool
+	}{
+		{desc: "required without a second factor", allowEnroll: true, want: true},
+		{desc: "with a second factor", allowEnroll: false},
+		{desc: "passkey added after the login started", allowEnroll: true, hasPasskey: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			u := newUser(t, tC.hasPasskey)
+
+			rec := httptest.NewRecorder()
+			if err := h.startMFA(rec, httptest.NewRequest(http.MethodPost, "/oauth/login/local", nil), u.ID, "", []string{"pwd"}, tC.allowEnroll); err != nil {
+				t.Fatalf("startMFA() = %v; want nil", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/mfa/enroll", nil)
+			for _, c := range rec.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			wantStatus := http.StatusForbidden
+			if tC.want {
+				wantStatus = http.StatusOK
+			}
+			if err := h.serveMFAEnroll(httptest.NewRecorder(), req); lerror.Status(err) != wantStatus {
+				t.Errorf("serveMFAEnroll() = %v; want status %d", err, wantStatus)
+			}
+
+			req = httptest.NewRequest(http.MethodPost, "/oauth/mfa/confirm", strings.NewReader(url.Values{"code": {"000000"}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for _, c := range rec.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			// An allowed confirmation only fails on the invalid code
+			if tC.want {
+				wantStatus = http.StatusBadRequest
+			}
+			if err := h.serveMFAConfirm(httptest.NewRecorder(), req); lerror.Status(err) != wantStatus {
+				t.Errorf("serveMFAConfirm() = %v; want status %d", err, wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+	ceremonyMFA      = "mfa"
+)
+
+// The state of a started passkey ceremony is kept in its own session until it is finished.
+func (h *OAuthHandler) passkeySessionName() string {
+	return h.sessionName + "-passkey"
+}
+
+func (h *OAuthHandler) saveCeremony(w http.ResponseWriter, r *http.Request, kind string, data *webauthn.SessionData, returnTo string) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return lerror.Wrap(err, "failed to encode the passkey session", http.StatusInternalServerError)
+	}
+
+	session, _ := h.store.New(r, h.passkeySessionName())
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = int(time.Until(data.Expires).Seconds())
+
+	session.Values["kind"] = kind
+	session.Values["data"] = string(b)
+	session.Values["return"] = returnTo
+
+	if err := session.Save(r, w); err != nil {
+		return lerror.Wrap(err, "failed to save the passkey session", http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// takeCeremony returns the state of the started ceremony of the kind and clears it, so that each ceremony can only be finished once.
+func (h *OAuthHandler) takeCeremony(w http.ResponseWriter, r *http.Request, kind string) (webauthn.SessionData, string, error) {
+	session, err := h.store.Get(r, h.passkeySessionName())
+	if err != nil {
+		return webauthn.SessionData{}, "", lerror.Wrap(err, "failed to get the passkey session", http.StatusBadRequest)
+	}
+
+	k, _ := session.Values["kind"].(string)
+	data, _ := session.Values["data"].(string)
+	returnTo, _ := session.Values["return"].(string)
+	if k != kind || data == "" {
+		return webauthn.SessionData{}, "", lerror.New("no passkey ceremony has been started", http.StatusBadRequest)
+	}
+
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		return webauthn.SessionData{}, "", lerror.Wrap(err, "failed to clear the passkey session", http.StatusInternalServerError)
+	}
+
+	var sd webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &sd); err != nil {
+		return webauthn.SessionData{}, "", lerror.Wrap(err, "failed to decode the passkey session", http.StatusBadRequest)
+	}
+
+	// The session is a cookie that could be sent again, the challenge makes sure it is only accepted once
+	if !h.usedLinks.use("passkey:"+sd.Challenge, sd.Expires) {
+		return webauthn.SessionData{}, "", lerror.New("the passkey ceremony has already been finished", http.StatusBadRequest)
+	}
+
+	return sd, returnTo, nil
+}
+
+// loggedInUser returns the user of the token cookie.
+func (h *OAuthHandler) loggedInUser(r *http.Request) (user.User, error) {
+	cookie, err := r.Cookie(h.cookieName)
+	if err != nil {
+		return user.User{}, lerror.New("unauthorized", http.StatusUnauthorized)
+	}
+
+	claims, err := h.auth.Decode(cookie.Value)
+	if err != nil {
+		return user.User{}, lerror.Wrap(err, "unauthorized", http.StatusUnauthorized)
+	}
+
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &claims.UserID})
+	if err != nil {
+		return user.User{}, lerror.Wrap(err, "failed to get user", http.StatusInternalServerError)
+	}
+
+	return u, nil
+}
+
+func passkeyError(err error, msg string) error {
+	if errors.Is(err, passkey.ErrVerificationFailed) || errors.Is(err, passkey.ErrNoCredentials) {
+		return lerror.Wrap(err, msg, http.StatusBadRequest)
+	}
+	if errors.Is(err, passkey.ErrClonedAuthenticator) {
+		return lerror.Wrap(err, msg, http.StatusForbidden)
+	}
+	return lerror.Wrap(err, msg, http.StatusInternalServerError)
+}
+
+// respondLogin finishes a login started from javascript.
+// The browser is told where to go next instead of being redirected, since the redirect would be followed by fetch.
+func (h *OAuthHandler) respondLogin(w http.ResponseWriter, r *http.Request, u user.User, returnTo string, authMethods []string) error {
+	if err := h.redeemInvitation(w, r, u); err != nil {
+		return err
+	}
+
+	next, err := h.startMFAIfRequired(w, r, u, returnTo, authMethods)
+	if err != nil {
+		return err
+	}
+
+	if next == "" {
+		if err := h.setTokenCookie(w, r, u, returnTo, authMethods); err != nil {
+			return err
+		}
+
+		next = returnTo
+		if next == "" {
+			next = "/"
+		}
+	}
+
+	respondJSON(w, http.StatusOK, struct {
+		Redirect string `json:"redirect"`
+	}{
+		Redirect: next,
+	})
+	return nil
+}
+
+// servePasskeyRegisterBegin returns the options to create a new passkey for the logged in user with.
+func (h *OAuthHandler) servePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.loggedInUser(r)
+	if err != nil {
+		return err
+	}
+
+	options, data, err := h.passkeyService.BeginRegistration(r.Context(), u)
+	if err != nil {
+		return passkeyError(err, "failed to begin passkey registration")
+	}
+
+	if err := h.saveCeremony(w, r, ceremonyRegister, data, ""); err != nil {
+		return err
+	}
+
+	respondJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// servePasskeyRegisterFinish stores the passkey created by the browser.
+// The body is the created credential and the name of the passkey is given in the query.
+func (h *OAuthHandler) servePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.loggedInUser(r)
+	if err != nil {
+		return err
+	}
+
+	data, _, err := h.takeCeremony(w, r, ceremonyRegister)
+	if err != nil {
+		return err
+	}
+
+	cred, err := h.passkeyService.FinishRegistration(r.Context(), u, r.URL.Query().Get("name"), data, r)
+	if err != nil {
+		return passkeyError(err, "failed to register passkey")
+	}
+
+	respondJSON(w, http.StatusOK, cred)
+	return nil
+}
+
+// servePasskeyLoginBegin starts a passwordless login with any passkey of the site.
+func (h *OAuthHandler) servePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) error {
+	returnTo, err := parseReturnTo(h.allowedReturns, r)
+	if err != nil {
+		return err
+	}
+
+	options, data, err := h.passkeyService.BeginLogin()
+	if err != nil {
+		return passkeyError(err, "failed to begin passkey login")
+	}
+
+	if err := h.saveCeremony(w, r, ceremonyLogin, data, returnTo); err != nil {
+		return err
+	}
+
+	respondJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// servePasskeyLoginFinish logs in the user the passkey belongs to.
+// A passkey that verified the user counts as multi-factor, otherwise the login continues with MFA as usual.
+func (h *OAuthHandler) servePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) error {
+	data, returnTo, err := h.takeCeremony(w, r, ceremonyLogin)
+	if err != nil {
+		return err
+	}
+
+	u, userVerified, err := h.passkeyService.FinishLogin(r.Context(), data, r)
+	if err != nil {
+		return passkeyError(err, "failed to log in with passkey")
+	}
+
+	authMethods := []string{authorizer.AuthMethodHardwareKey}
+	if userVerified {
+		authMethods = append(authMethods, authorizer.AuthMethodMFA)
+	}
+
+	return h.respondLogin(w, r, u, returnTo, authMethods)
+}
+
+// serveMFAPasskeyBegin starts the verification of a passkey as the second factor of a pending login.
+func (h *OAuthHandler) serveMFAPasskeyBegin(w http.ResponseWriter, r *http.Request) error {
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	options, data, err := h.passkeyService.BeginVerify(r.Context(), pending.user)
+	if err != nil {
+		return passkeyError(err, "failed to begin passkey verification")
+	}
+
+	if err := h.saveCeremony(w, r, ceremonyMFA, data, ""); err != nil {
+		return err
+	}
+
+	respondJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// serveMFAPasskeyFinish completes a pending login with a passkey of the user.
+func (h *OAuthHandler) serveMFAPasskeyFinish(w http.ResponseWriter, r *http.Request) error {
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	data, _, err := h.takeCeremony(w, r, ceremonyMFA)
+	if err != nil {
+		return err
+	}
+
+	if err := h.passkeyService.FinishVerify(r.Context(), pending.user, data, r); err != nil {
+		return passkeyError(err, "failed to verify passkey")
+	}
+
+	if err := h.endMFA(w, r, pending); err != nil {
+		return err
+	}
+
+	return h.respondLogin(w, r, pending.user, pending.returnTo, pending.completedWith(authorizer.AuthMethodHardwareKey))
+}
+
+// serveMFAMethods tells the MFA page which second factors the user of the pending login can use.
+func (h *OAuthHandler) serveMFAMethods(w http.ResponseWriter, r *http.Request) error {
+	pending, err := h.getPendingMFA(r)
+	if err != nil {
+		return err
+	}
+
+	var methods struct {
+		TOTP    bool `json:"totp"`
+		Passkey bool `json:"passkey"`
+	}
+
+	if h.mfaService != nil {
+		methods.TOTP, err = h.mfaService.IsEnrolled(r.Context(), pending.user.ID)
+		if err != nil {
+			return lerror.Wrap(err, "failed to check mfa enrollment", http.StatusInternalServerError)
+		}
+	}
+
+	if h.passkeyService != nil {
+		methods.Passkey, err = h.passkeyService.HasCredentials(r.Context(), pending.user.ID)
+		if err != nil {
+			return lerror.Wrap(err, "failed to check passkeys", http.StatusInternalServerError)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, methods)
+	return nil
+}
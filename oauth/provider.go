@@ -5,11 +5,19 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/invitation"
 	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/local"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/mfa"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/providertoken"
+	"github.com/theleeeo/thor/signer"
 	"github.com/theleeeo/thor/user"
 )
 
@@ -21,12 +29,26 @@ type Provider interface {
 }
 
 type OAuthHandler struct {
-	userService *user.Service
-	auth        *authorizer.Authorizer
-	store       *sessions.CookieStore
+	userService       *user.Service
+	localService      *local.Service
+	mfaService        *mfa.Service
+	passkeyService    *passkey.Service
+	invitationService *invitation.Service
+	tokenService      *providertoken.Service
+	auth              *authorizer.Authorizer
+	store             *sessions.CookieStore
+	mailer            mail.Sender
+	signer            *signer.Signer
 
 	providers []Provider
 
+	devices         *deviceStore
+	deviceExpiresIn time.Duration
+	deviceInterval  time.Duration
+
+	email     *emailLogin
+	usedLinks *usedLinks
+
 	appUrl      *url.URL
 	cookieName  string
 	sessionName string
@@ -34,7 +56,24 @@ type OAuthHandler struct {
 	allowedReturns []*url.URL
 }
 
-func NewOAuthHandler(cfg *Config, userService *user.Service, auth *authorizer.Authorizer) (*OAuthHandler, error) {
+// Services are what the login flows use.
+// Local, MFA, Passkeys, Invitations and ProviderTokens are optional, the features are disabled if they are nil.
+type Services struct {
+	Users          *user.Service
+	Local          *local.Service
+	MFA            *mfa.Service
+	Passkeys       *passkey.Service
+	Invitations    *invitation.Service
+	ProviderTokens *providertoken.Service
+	Auth           *authorizer.Authorizer
+	// Sends the login links, required for the email login
+	Mailer mail.Sender
+	// Signs the login links
+	LinkSigner *signer.Signer
+}
+
+// NewOAuthHandler creates the handler of the login flows.
+func NewOAuthHandler(cfg *Config, services *Services) (*OAuthHandler, error) {
 	appUrl, err := url.Parse(cfg.AppURL)
 	if err != nil {
 		return nil, err
@@ -49,13 +88,51 @@ func NewOAuthHandler(cfg *Config, userService *user.Service, auth *authorizer.Au
 	}
 
 	h := &OAuthHandler{
-		userService:    userService,
-		auth:           auth,
-		store:          sessions.NewCookieStore([]byte(cfg.CookieSecret)),
-		appUrl:         appUrl,
-		cookieName:     cfg.CookieName,
-		sessionName:    cfg.SessionName,
-		allowedReturns: allowedReturns,
+		userService:       services.Users,
+		localService:      services.Local,
+		mfaService:        services.MFA,
+		passkeyService:    services.Passkeys,
+		invitationService: services.Invitations,
+		tokenService:      services.ProviderTokens,
+		auth:              services.Auth,
+		mailer:            services.Mailer,
+		signer:            services.LinkSigner,
+		store:             sessions.NewCookieStore([]byte(cfg.CookieSecret)),
+		appUrl:            appUrl,
+		cookieName:        cfg.CookieName,
+		sessionName:       cfg.SessionName,
+		allowedReturns:    allowedReturns,
+		devices:           newDeviceStore(),
+		deviceExpiresIn:   cfg.Device.ExpiresIn,
+		deviceInterval:    cfg.Device.Interval,
+		usedLinks:         newUsedLinks(),
+	}
+
+	if h.deviceExpiresIn == 0 {
+		h.deviceExpiresIn = defaultDeviceExpiresIn
+	}
+
+	if h.deviceInterval == 0 {
+		h.deviceInterval = defaultDeviceInterval
+	}
+
+	if cfg.Email != nil {
+		if h.mailer == nil {
+			return nil, fmt.Errorf("email login requires a mail configuration")
+		}
+
+		h.email = &emailLogin{
+			linkTTL: cfg.Email.LinkTTL,
+			subject: cfg.Email.Subject,
+		}
+
+		if h.email.linkTTL == 0 {
+			h.email.linkTTL = defaultEmailLinkTTL
+		}
+
+		if h.email.subject == "" {
+			h.email.subject = defaultEmailLinkSubject
+		}
 	}
 
 	for _, providerCfg := range cfg.Providers {
@@ -64,9 +141,30 @@ func NewOAuthHandler(cfg *Config, userService *user.Service, auth *authorizer.Au
 			h.providers = append(h.providers, newGithub(providerCfg))
 		case GoogleProviderType:
 			h.providers = append(h.providers, newGoogle(providerCfg, cfg.AppURL))
+		case SAMLProviderType:
+			p, err := newSAML(providerCfg, cfg.AppURL)
+			if err != nil {
+				return nil, err
+			}
+			h.providers = append(h.providers, p)
 		default:
 			return nil, fmt.Errorf("unknown provider type: %s", providerCfg.Type)
 		}
+
+		if !providerCfg.StoreTokens {
+			continue
+		}
+
+		p, ok := h.providers[len(h.providers)-1].(tokenProvider)
+		if !ok {
+			return nil, fmt.Errorf("provider %s/%s can not store tokens", providerCfg.Type, providerCfg.Name)
+		}
+
+		if h.tokenService == nil {
+			return nil, fmt.Errorf("provider %s/%s: storing tokens requires the provider-tokens configuration", providerCfg.Type, providerCfg.Name)
+		}
+
+		h.tokenService.RegisterRefresher(models.UserProviderType(p.Type()), p.Name(), p)
 	}
 
 	return h, nil
@@ -93,9 +191,95 @@ func (h *OAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var err error
 	switch action {
 	case "login":
+		if providerPath == "local" {
+			err = h.serveLocalLogin(w, r)
+			break
+		}
 		err = h.serveLogin(w, r, providerPath)
 	case "callback":
 		err = h.serveCallback(w, r, providerPath)
+	case "invite":
+		if providerPath != "accept" {
+			http.NotFound(w, r)
+			return
+		}
+		err = h.serveInviteAccept(w, r)
+	case "saml":
+		name, ok := strings.CutSuffix(providerPath, "/metadata")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		err = h.serveSAMLMetadata(w, r, name)
+	case "device":
+		if providerPath != "verify" {
+			http.NotFound(w, r)
+			return
+		}
+		err = h.serveDeviceVerify(w, r)
+	case "mfa":
+		switch providerPath {
+		case "verify":
+			err = h.serveMFAVerify(w, r)
+		case "enroll":
+			err = h.serveMFAEnroll(w, r)
+		case "confirm":
+			err = h.serveMFAConfirm(w, r)
+		case "methods":
+			err = h.serveMFAMethods(w, r)
+		case "passkey/begin", "passkey/finish":
+			if h.passkeyService == nil || r.Method != http.MethodPost {
+				http.NotFound(w, r)
+				return
+			}
+			if providerPath == "passkey/begin" {
+				err = h.serveMFAPasskeyBegin(w, r)
+			} else {
+				err = h.serveMFAPasskeyFinish(w, r)
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	case "local":
+		switch providerPath {
+		case "reset-request":
+			err = h.serveLocalResetRequest(w, r)
+		case "reset":
+			err = h.serveLocalReset(w, r)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	case "passkey":
+		if h.passkeyService == nil || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch providerPath {
+		case "register/begin":
+			err = h.servePasskeyRegisterBegin(w, r)
+		case "register/finish":
+			err = h.servePasskeyRegisterFinish(w, r)
+		case "login/begin":
+			err = h.servePasskeyLoginBegin(w, r)
+		case "login/finish":
+			err = h.servePasskeyLoginFinish(w, r)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	case "email":
+		switch providerPath {
+		case "send":
+			err = h.serveEmailSend(w, r)
+		case "verify":
+			err = h.serveEmailVerify(w, r)
+		default:
+			http.NotFound(w, r)
+			return
+		}
 	default:
 		http.NotFound(w, r)
 		return
@@ -0,0 +1,270 @@
+package oauth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/theleeeo/thor/lerror"
+	"github.com/theleeeo/thor/models"
+)
+
+// Attributes commonly used by identity providers for the email and name of the user
+var (
+	samlEmailAttributes = []string{
+		"email",
+		"mail",
+		"emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"displayName",
+		"name",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+// samlProvider logs in through a SAML 2.0 identity provider.
+// The user is sent to the identity provider with the HTTP-Redirect binding and the assertion is posted back to the callback (HTTP-POST binding).
+type samlProvider struct {
+	name           string
+	sp             *saml.ServiceProvider
+	emailAttribute string
+	nameAttribute  string
+	allowedDomains []string
+}
+
+func newSAML(cfg ProviderConfig, appURL string) (*samlProvider, error) {
+	if cfg.IDPMetadata == "" {
+		return nil, fmt.Errorf("saml provider %s: missing idp metadata", cfg.Name)
+	}
+
+	metadataXML, err := os.ReadFile(cfg.IDPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("saml provider %s: failed to read idp metadata: %w", cfg.Name, err)
+	}
+
+	var idpMetadata saml.EntityDescriptor
+	if err := xml.Unmarshal(metadataXML, &idpMetadata); err != nil {
+		return nil, fmt.Errorf("saml provider %s: failed to parse idp metadata: %w", cfg.Name, err)
+	}
+
+	metadataURL, err := url.Parse(fmt.Sprintf("%s/oauth/saml/%s/metadata", appURL, cfg.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	acsURL, err := url.Parse(fmt.Sprintf("%s/oauth/callback/%s/%s", appURL, SAMLProviderType, cfg.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	nameIDFormat := saml.PersistentNameIDFormat
+	if cfg.NameIDFormat != "" {
+		nameIDFormat = saml.NameIDFormat(cfg.NameIDFormat)
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       &idpMetadata,
+		AuthnNameIDFormat: nameIDFormat,
+	}
+
+	if cfg.SPCertificate != "" || cfg.SPKey != "" {
+		keyPair, err := tls.LoadX509KeyPair(cfg.SPCertificate, cfg.SPKey)
+		if err != nil {
+			return nil, fmt.Errorf("saml provider %s: failed to load sp key pair: %w", cfg.Name, err)
+		}
+
+		key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("saml provider %s: the sp key must be an RSA key", cfg.Name)
+		}
+
+		cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("saml provider %s: failed to parse sp certificate: %w", cfg.Name, err)
+		}
+
+		sp.Key = key
+		sp.Certificate = cert
+		sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+
+	return &samlProvider{
+		name:           cfg.Name,
+		sp:             sp,
+		emailAttribute: cfg.EmailAttribute,
+		nameAttribute:  cfg.NameAttribute,
+		allowedDomains: cfg.AllowedDomains,
+	}, nil
+}
+
+// linksEmail reports whether an existing user with the email may be logged in to through the identity provider.
+// Any identity provider can assert any email, so it is only trusted with the domains it is configured for.
+func (s *samlProvider) linksEmail(email string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+
+	return slices.ContainsFunc(s.allowedDomains, func(d string) bool {
+		return strings.EqualFold(d, domain)
+	})
+}
+
+func (s *samlProvider) Name() string {
+	return s.name
+}
+
+func (s *samlProvider) Type() string {
+	return string(SAMLProviderType)
+}
+
+// samlRequestID derives the ID of the authentication request from the state.
+// The assertion has to be in response to the request, so this ties it to the session that started the login.
+func samlRequestID(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return "id-" + hex.EncodeToString(sum[:20])
+}
+
+// BuildLoginUrl creates an authentication request with the state as the relay state.
+// The assertion is always posted to the callback in the service provider metadata, so the redirect url is not used.
+func (s *samlProvider) BuildLoginUrl(state, _ string) string {
+	req, err := s.sp.MakeAuthenticationRequest(s.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		slog.Error("failed to create saml authentication request", "provider", s.name, "error", err)
+		return "/login"
+	}
+
+	req.ID = samlRequestID(state)
+
+	u, err := req.Redirect(url.QueryEscape(state), s.sp)
+	if err != nil {
+		slog.Error("failed to create saml authentication request", "provider", s.name, "error", err)
+		return "/login"
+	}
+
+	return u.String()
+}
+
+// GetUser is not used for SAML, the assertion is posted to the callback instead of a code. See getUserFromResponse.
+func (s *samlProvider) GetUser(code string) (models.User, models.UserProvider, error) {
+	return models.User{}, models.UserProvider{}, errors.New("saml providers do not use codes")
+}
+
+// getUserFromResponse validates the posted assertion, including its signature, and maps it to a user.
+func (s *samlProvider) getUserFromResponse(r *http.Request, state string) (models.User, models.UserProvider, error) {
+	assertion, err := s.sp.ParseResponse(r, []string{samlRequestID(state)})
+	if err != nil {
+		var invalidErr *saml.InvalidResponseError
+		if errors.As(err, &invalidErr) {
+			// The error message is kept generic by the library, the reason is only logged
+			slog.Error("invalid saml response", "provider", s.name, "error", invalidErr.PrivateErr)
+		}
+		return models.User{}, models.UserProvider{}, err
+	}
+
+	return s.userFromAssertion(assertion)
+}
+
+func (s *samlProvider) userFromAssertion(assertion *saml.Assertion) (models.User, models.UserProvider, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return models.User{}, models.UserProvider{}, errors.New("the assertion has no name id")
+	}
+	nameID := assertion.Subject.NameID
+
+	emailAttributes := samlEmailAttributes
+	if s.emailAttribute != "" {
+		emailAttributes = []string{s.emailAttribute}
+	}
+
+	email := samlAttribute(assertion, emailAttributes)
+	if email == "" && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		email = nameID.Value
+	}
+	if email == "" {
+		return models.User{}, models.UserProvider{}, errors.New("the assertion has no email")
+	}
+
+	nameAttributes := samlNameAttributes
+	if s.nameAttribute != "" {
+		nameAttributes = []string{s.nameAttribute}
+	}
+
+	name := samlAttribute(assertion, nameAttributes)
+	if name == "" {
+		// The part before the @ is the best guess of a name, it can be changed later
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	return models.User{
+			Name:  name,
+			Email: email,
+		},
+		models.UserProvider{
+			// The name ids are only unique within the identity provider
+			UserID: s.name + ":" + nameID.Value,
+			Type:   models.UserProviderTypeSAML,
+		}, nil
+}
+
+// samlAttribute returns the first value of the first of the attributes that is in the assertion.
+func samlAttribute(assertion *saml.Assertion, names []string) string {
+	for _, name := range names {
+		for _, stmt := range assertion.AttributeStatements {
+			for _, attr := range stmt.Attributes {
+				if !strings.EqualFold(attr.Name, name) && !strings.EqualFold(attr.FriendlyName, name) {
+					continue
+				}
+
+				for _, v := range attr.Values {
+					if v := strings.TrimSpace(v.Value); v != "" {
+						return v
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// serveSAMLMetadata serves the service provider metadata that is registered at the identity provider.
+func (h *OAuthHandler) serveSAMLMetadata(w http.ResponseWriter, r *http.Request, name string) error {
+	provider, err := h.getProvider(fmt.Sprintf("%s/%s", SAMLProviderType, name))
+	if err != nil {
+		return lerror.Wrap(err, "failed to get provider", http.StatusNotFound)
+	}
+
+	s, ok := provider.(*samlProvider)
+	if !ok {
+		return lerror.New("not a saml provider", http.StatusNotFound)
+	}
+
+	metadata, err := xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+	if err != nil {
+		return lerror.Wrap(err, "failed to create metadata", http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+	return nil
+}
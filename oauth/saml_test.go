@@ -0,0 +1,133 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+func samlAssertion(nameID saml.NameID, attrs map[string]string) *saml.Assertion {
+	stmt := saml.AttributeStatement{}
+	for name, val := range attrs {
+		stmt.Attributes = append(stmt.Attributes, saml.Attribute{
+			Name:   name,
+			Values: []saml.AttributeValue{{Value: val}},
+		})
+	}
+
+	return &saml.Assertion{
+		Subject:             &saml.Subject{NameID: &nameID},
+		AttributeStatements: []saml.AttributeStatement{stmt},
+	}
+}
+
+func Test_SAMLUserFromAssertion(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		provider  samlProvider
+		assertion *saml.Assertion
+		wantUser  models.User
+		wantID    string
+		wantErr   bool
+	}{
+		{
+			desc:     "Common attributes",
+			provider: samlProvider{name: "corp"},
+			assertion: samlAssertion(saml.NameID{Value: "abc123"}, map[string]string{
+				"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "leo@example.com",
+				"displayName": "Leo",
+			}),
+			wantUser: models.User{Name: "Leo", Email: "leo@example.com"},
+			wantID:   "corp:abc123",
+		},
+		{
+			desc:     "Configured attributes",
+			provider: samlProvider{name: "corp", emailAttribute: "work-mail", nameAttribute: "full-name"},
+			assertion: samlAssertion(saml.NameID{Value: "abc123"}, map[string]string{
+				"email":     "private@example.com",
+				"work-mail": "leo@example.com",
+				"full-name": "Leo T",
+			}),
+			wantUser: models.User{Name: "Leo T", Email: "leo@example.com"},
+			wantID:   "corp:abc123",
+		},
+		{
+			desc:      "Email name id",
+			provider:  samlProvider{name: "corp"},
+			assertion: samlAssertion(saml.NameID{Value: "leo@example.com", Format: string(saml.EmailAddressNameIDFormat)}, nil),
+			wantUser:  models.User{Name: "leo", Email: "leo@example.com"},
+			wantID:    "corp:leo@example.com",
+		},
+		{
+			desc:      "Missing email",
+			provider:  samlProvider{name: "corp"},
+			assertion: samlAssertion(saml.NameID{Value: "abc123"}, nil),
+			wantErr:   true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			u, pr, err := tC.provider.userFromAssertion(tC.assertion)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("userFromAssertion() error = %v; wantErr %v", err, tC.wantErr)
+			}
+			if tC.wantErr {
+				return
+			}
+
+			if u != tC.wantUser {
+				t.Errorf("user = %+v; want %+v", u, tC.wantUser)
+			}
+
+			if pr.UserID != tC.wantID || pr.Type != models.UserProviderTypeSAML {
+				t.Errorf("provider = %+v; want id %v", pr, tC.wantID)
+			}
+		})
+	}
+}
+
+func Test_SAMLDoesNotTakeOverUsers(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	existing, err := userService.Create(ctx, models.User{Name: "Admin", Email: "admin@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &OAuthHandler{userService: userService}
+	assertion := samlAssertion(saml.NameID{Value: "admin@example.com", Format: string(saml.EmailAddressNameIDFormat)}, nil)
+
+	untrusted := samlProvider{name: "other", allowedDomains: []string{"other.com"}}
+	u, pr, err := untrusted.userFromAssertion(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := h.constructUser(ctx, u, pr, untrusted.linksEmail(u.Email)); err == nil {
+		t.Fatalf("constructUser() = user %v; want the existing email to be refused", got.ID)
+	}
+
+	if _, err := userService.GetByProviderID(ctx, pr.UserID); err == nil {
+		t.Error("the identity provider was linked to the existing user")
+	}
+
+	trusted := samlProvider{name: "corp", allowedDomains: []string{"Example.com"}}
+	u, pr, err = trusted.userFromAssertion(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := h.constructUser(ctx, u, pr, trusted.linksEmail(u.Email))
+	if err != nil {
+		t.Fatalf("constructUser() with an allowed domain = %v; want nil", err)
+	}
+	if got.ID != existing.ID {
+		t.Errorf("constructUser() = user %v; want the existing user %v", got.ID, existing.ID)
+	}
+}
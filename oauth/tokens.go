@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/providertoken"
+)
+
+// tokenProvider is implemented by the providers whose tokens can be stored for calling the provider on behalf of the user.
+type tokenProvider interface {
+	Provider
+	providertoken.Refresher
+	// Whether the tokens should be stored, it is opt-in per provider
+	storesTokens() bool
+	getUserAndToken(code string) (models.User, models.UserProvider, providertoken.Token, error)
+}
+
+// tokenResponse is the response of the token endpoint of a provider (RFC 6749 section 5.1).
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	// GitHub responds with 200 OK and an error
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (t tokenResponse) token() providertoken.Token {
+	token := providertoken.Token{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
+		Scope:        t.Scope,
+	}
+
+	if t.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+
+	return token
+}
+
+func requestToken(endpoint string, params url.Values) (tokenResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("could not create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("could not send HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return tokenResponse{}, fmt.Errorf("non-ok status code: %d, %s", res.StatusCode, body)
+	}
+
+	var respBody tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&respBody); err != nil {
+		return tokenResponse{}, fmt.Errorf("could not parse JSON response: %v", err)
+	}
+
+	if respBody.Error != "" {
+		return tokenResponse{}, fmt.Errorf("token error: %s: %s", respBody.Error, respBody.ErrorDescription)
+	}
+
+	return respBody, nil
+}
+
+// storeProviderToken keeps the token the provider issued at the login.
+// A token that can not be stored does not fail the login, the user can still use Thor.
+func (h *OAuthHandler) storeProviderToken(ctx context.Context, userID string, provider Provider, userProvider models.UserProvider, token providertoken.Token) {
+	if err := h.tokenService.Store(ctx, userID, userProvider, provider.Name(), token); err != nil {
+		slog.Error("failed to store provider token", "user", userID, "provider", provider.Type()+"/"+provider.Name(), "error", err)
+	}
+}
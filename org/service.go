@@ -0,0 +1,105 @@
+package org
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+// ErrNotMember is returned when a user is not a member of the org it acts in.
+// It is the error of the repo, so that it is also matched when the repo resolves the permissions in the org.
+var ErrNotMember = repo.ErrNotMember
+
+// Service manages the orgs, each org has its own roles which only apply to its members in it.
+type Service struct {
+	repo repo.Repo
+}
+
+func NewService(repo repo.Repo) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func (s *Service) Create(ctx context.Context, org models.Org) (models.Org, error) {
+	if org.Name == "" {
+		return models.Org{}, fmt.Errorf("missing org name")
+	}
+
+	org.ID = uuid.NewString()
+
+	if err := s.repo.CreateOrg(ctx, org); err != nil {
+		return models.Org{}, err
+	}
+
+	return org, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (models.Org, error) {
+	return s.repo.GetOrg(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context) ([]models.Org, error) {
+	return s.repo.ListOrgs(ctx)
+}
+
+func (s *Service) Update(ctx context.Context, org models.Org) (models.Org, error) {
+	if org.ID == "" {
+		return models.Org{}, fmt.Errorf("missing org id")
+	}
+
+	if org.Name == "" {
+		return models.Org{}, fmt.Errorf("missing org name")
+	}
+
+	if err := s.repo.UpdateOrg(ctx, org); err != nil {
+		return models.Org{}, err
+	}
+
+	return org, nil
+}
+
+// Delete deletes the org together with its roles.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.DeleteOrg(ctx, id)
+}
+
+func (s *Service) AddMember(ctx context.Context, orgID, userID string) error {
+	return s.repo.AddOrgMember(ctx, orgID, userID)
+}
+
+// RemoveMember removes the user from the org, and the roles of the org from the user.
+func (s *Service) RemoveMember(ctx context.Context, orgID, userID string) error {
+	return s.repo.RemoveOrgMember(ctx, orgID, userID)
+}
+
+// GetMembers returns the members of the org, or ErrNotFound if the org does not exist.
+func (s *Service) GetMembers(ctx context.Context, orgID string) ([]models.User, error) {
+	if _, err := s.repo.GetOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetOrgMembers(ctx, orgID)
+}
+
+func (s *Service) GetOrgsOfUser(ctx context.Context, userID string) ([]models.Org, error) {
+	return s.repo.GetOrgsOfUser(ctx, userID)
+}
+
+// CheckMember returns ErrNotMember if the user is not a member of the org.
+func (s *Service) CheckMember(ctx context.Context, orgID, userID string) error {
+	orgs, err := s.repo.GetOrgsOfUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(orgs, func(o models.Org) bool { return o.ID == orgID }) {
+		return ErrNotMember
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package org
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+func createUser(t *testing.T, r repo.Repo, id string) models.User {
+	t.Helper()
+
+	u := models.User{ID: id, Name: id, Email: id + "@example.com"}
+	if err := r.CreateUser(context.Background(), u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: id}); err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func Test_CheckMember(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	member := createUser(t, r, "member")
+	other := createUser(t, r, "other")
+
+	acme, err := s.Create(ctx, models.Org{Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	globex, err := s.Create(ctx, models.Org{Name: "globex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddMember(ctx, acme.ID, member.ID); err != nil {
+		t.Fatalf("AddMember() = %v; want nil", err)
+	}
+
+	testCases := []struct {
+		desc    string
+		orgID   string
+		userID  string
+		wantErr error
+	}{
+		{desc: "member", orgID: acme.ID, userID: member.ID},
+		{desc: "member of another org", orgID: globex.ID, userID: member.ID, wantErr: ErrNotMember},
+		{desc: "not a member of any org", orgID: acme.ID, userID: other.ID, wantErr: ErrNotMember},
+		{desc: "missing org", orgID: "missing", userID: member.ID, wantErr: ErrNotMember},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := s.CheckMember(ctx, tC.orgID, tC.userID); !errors.Is(err, tC.wantErr) {
+				t.Errorf("CheckMember() = %v; want %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Members(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	u := createUser(t, r, "user")
+	acme, err := s.Create(ctx, models.Org{Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc    string
+		call    func() error
+		wantErr error
+	}{
+		{desc: "add a member", call: func() error { return s.AddMember(ctx, acme.ID, u.ID) }},
+		{desc: "add a member again", call: func() error { return s.AddMember(ctx, acme.ID, u.ID) }, wantErr: repo.ErrAlreadyExists},
+		{desc: "add a missing user", call: func() error { return s.AddMember(ctx, acme.ID, "missing") }, wantErr: repo.ErrNotFound},
+		{desc: "add to a missing org", call: func() error { return s.AddMember(ctx, "missing", u.ID) }, wantErr: repo.ErrNotFound},
+		{desc: "members of a missing org", call: func() error { _, err := s.GetMembers(ctx, "missing"); return err }, wantErr: repo.ErrNotFound},
+		{desc: "remove a member", call: func() error { return s.RemoveMember(ctx, acme.ID, u.ID) }},
+		{desc: "remove a member again", call: func() error { return s.RemoveMember(ctx, acme.ID, u.ID) }, wantErr: repo.ErrNotFound},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := tC.call(); !errors.Is(err, tC.wantErr) {
+				t.Errorf("%s = %v; want %v", tC.desc, err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_RemoveMemberRemovesOrgRoles(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	u := createUser(t, r, "user")
+	acme, err := s.Create(ctx, models.Org{Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddMember(ctx, acme.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	orgRole := models.Role{ID: "org-role", Name: "acme-deployers", OrgID: acme.ID}
+	if err := r.CreateRole(ctx, orgRole, []models.Permission{{Key: "deploy", Val: "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	global := models.Role{ID: "global", Name: "readers"}
+	if err := r.CreateRole(ctx, global, []models.Permission{{Key: "read", Val: "*"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, roleID := range []string{orgRole.ID, global.ID} {
+		if err := r.AssignRole(ctx, u.ID, roleID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if permissions, err := r.GetPermissionsOfUser(ctx, u.ID, acme.ID); err != nil || len(permissions) != 2 {
+		t.Fatalf("GetPermissionsOfUser() in the org = %v, %v; want the permissions of both roles", permissions, err)
+	}
+
+	if err := s.RemoveMember(ctx, acme.ID, u.ID); err != nil {
+		t.Fatalf("RemoveMember() = %v; want nil", err)
+	}
+
+	if err := s.CheckMember(ctx, acme.ID, u.ID); !errors.Is(err, ErrNotMember) {
+		t.Errorf("CheckMember() after RemoveMember() = %v; want %v", err, ErrNotMember)
+	}
+	if _, err := r.GetPermissionsOfUser(ctx, u.ID, acme.ID); !errors.Is(err, ErrNotMember) {
+		t.Errorf("GetPermissionsOfUser() in the org after RemoveMember() = %v; want %v", err, ErrNotMember)
+	}
+
+	// Joining again does not bring back the roles of the org
+	if err := s.AddMember(ctx, acme.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	permissions, err := r.GetPermissionsOfUser(ctx, u.ID, acme.ID)
+	if err != nil || len(permissions) != 1 || permissions[0].Key != "read" {
+		t.Errorf("GetPermissionsOfUser() in the org after joining again = %v, %v; want only the global permission", permissions, err)
+	}
+}
+
+func Test_DeleteRemovesRoles(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(r)
+
+	acme, err := s.Create(ctx, models.Org{Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgRole := models.Role{ID: "org-role", Name: "acme-deployers", OrgID: acme.ID}
+	if err := r.CreateRole(ctx, orgRole, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(ctx, acme.ID); err != nil {
+		t.Fatalf("Delete() = %v; want nil", err)
+	}
+	if _, err := r.GetRole(ctx, orgRole.ID); !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("GetRole() of a role of the deleted org = %v; want %v", err, repo.ErrNotFound)
+	}
+	if err := s.Delete(ctx, acme.ID); !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("Delete() of a deleted org = %v; want %v", err, repo.ErrNotFound)
+	}
+}
@@ -0,0 +1,123 @@
+package passkey
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/user"
+)
+
+// webauthnUser adapts a user to the user expected by the webauthn library.
+type webauthnUser struct {
+	user  user.User
+	creds []webauthn.Credential
+}
+
+func newWebauthnUser(u user.User, creds []models.WebAuthnCredential) *webauthnUser {
+	wu := &webauthnUser{
+		user:  u,
+		creds: make([]webauthn.Credential, len(creds)),
+	}
+
+	for i, c := range creds {
+		wu.creds[i] = toWebauthnCredential(c)
+	}
+
+	return wu
+}
+
+// The user handle stored in the authenticator, it is what identifies the user in a passwordless login
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.creds
+}
+
+func (u *webauthnUser) descriptors() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, len(u.creds))
+	for i, c := range u.creds {
+		descriptors[i] = c.Descriptor()
+	}
+	return descriptors
+}
+
+func toWebauthnCredential(c models.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+	for i, t := range c.Transports {
+		transports[i] = protocol.AuthenticatorTransport(t)
+	}
+
+	return webauthn.Credential{
+		ID:              c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    c.AAGUID,
+			SignCount: c.SignCount,
+		},
+	}
+}
+
+func fromWebauthnCredential(userID, name string, c *webauthn.Credential) models.WebAuthnCredential {
+	transports := make([]string, len(c.Transport))
+	for i, t := range c.Transport {
+		transports[i] = string(t)
+	}
+
+	return models.WebAuthnCredential{
+		ID:              c.ID,
+		UserID:          userID,
+		Name:            name,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transports:      transports,
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       c.Authenticator.SignCount,
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+}
+
+// Credential is the public information about a passkey, without the key itself.
+type Credential struct {
+	// The credential ID, base64url encoded
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newCredential(c models.WebAuthnCredential) Credential {
+	return Credential{
+		ID:         base64.RawURLEncoding.EncodeToString(c.ID),
+		Name:       c.Name,
+		Transports: c.Transports,
+		Synced:     c.BackupState,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
@@ -0,0 +1,87 @@
+package passkey
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+func Test_NewService_Defaults(t *testing.T) {
+	s, err := NewService(&Config{}, "https://auth.example.com:8443/base", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.webauthn.Config.RPID; got != "auth.example.com" {
+		t.Errorf("RPID = %v; want auth.example.com", got)
+	}
+
+	if got := s.webauthn.Config.RPOrigins; !reflect.DeepEqual(got, []string{"https://auth.example.com:8443"}) {
+		t.Errorf("RPOrigins = %v; want [https://auth.example.com:8443]", got)
+	}
+
+	if got := s.webauthn.Config.RPDisplayName; got != defaultDisplayName {
+		t.Errorf("RPDisplayName = %v; want %v", got, defaultDisplayName)
+	}
+}
+
+func Test_CredentialConversion(t *testing.T) {
+	cred := models.WebAuthnCredential{
+		ID:              []byte{1, 2, 3},
+		UserID:          "user",
+		Name:            "laptop",
+		PublicKey:       []byte{4, 5, 6},
+		AttestationType: "none",
+		Transports:      []string{"usb", "nfc"},
+		AAGUID:          []byte{7, 8},
+		SignCount:       42,
+		BackupEligible:  true,
+		BackupState:     true,
+	}
+
+	wc := toWebauthnCredential(cred)
+	if got := fromWebauthnCredential(cred.UserID, cred.Name, &wc); !reflect.DeepEqual(got, cred) {
+		t.Errorf("round trip = %+v; want %+v", got, cred)
+	}
+
+	if got := newCredential(cred).ID; got != "AQID" {
+		t.Errorf("ID = %v; want AQID", got)
+	}
+}
+
+// A passkey used as the second factor has to verify the user, it may be the one the user logged in with
+func Test_BeginVerifyRequiresUserVerification(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+
+	s, err := NewService(&Config{}, "https://auth.example.com", r, userService)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := userService.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateWebAuthnCredential(ctx, models.WebAuthnCredential{ID: []byte{1, 2, 3}, UserID: u.ID, Name: "key", PublicKey: []byte{4}}); err != nil {
+		t.Fatal(err)
+	}
+
+	options, session, err := s.BeginVerify(ctx, u)
+	if err != nil {
+		t.Fatalf("BeginVerify() = %v; want nil", err)
+	}
+
+	if got := options.Response.UserVerification; got != protocol.VerificationRequired {
+		t.Errorf("UserVerification of the options = %v; want %v", got, protocol.VerificationRequired)
+	}
+	if got := session.UserVerification; got != protocol.VerificationRequired {
+		t.Errorf("UserVerification of the session = %v; want %v", got, protocol.VerificationRequired)
+	}
+}
@@ -0,0 +1,264 @@
+package passkey
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/user"
+)
+
+const (
+	defaultDisplayName = "Thor"
+	defaultName        = "Passkey"
+	maxNameLength      = 100
+
+	// How long the user has to complete a ceremony after it is started
+	ceremonyTimeout = 5 * time.Minute
+)
+
+var (
+	ErrNoCredentials = errors.New("the user has no passkeys")
+	// The assertion or attestation from the browser was not valid
+	ErrVerificationFailed = errors.New("passkey verification failed")
+	// The signature counter went backwards, the credential may have been copied
+	ErrClonedAuthenticator = errors.New("the passkey may have been cloned")
+)
+
+type Config struct {
+	// The domain the passkeys are bound to. Defaults to the host of the app url.
+	RPID string `yaml:"rp-id"`
+	// The name shown by the browser when using a passkey. Defaults to "Thor".
+	RPDisplayName string `yaml:"rp-display-name"`
+	// The origins the passkeys can be used from. Defaults to the app url.
+	Origins []string `yaml:"origins"`
+}
+
+type Service struct {
+	repo        repo.Repo
+	userService *user.Service
+	webauthn    *webauthn.WebAuthn
+}
+
+func NewService(cfg *Config, appURL string, repo repo.Repo, userService *user.Service) (*Service, error) {
+	u, err := url.Parse(appURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app url: %w", err)
+	}
+
+	wcfg := &webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.Origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login: webauthn.TimeoutConfig{
+				Enforce:    true,
+				Timeout:    ceremonyTimeout,
+				TimeoutUVD: ceremonyTimeout,
+			},
+			Registration: webauthn.TimeoutConfig{
+				Enforce:    true,
+				Timeout:    ceremonyTimeout,
+				TimeoutUVD: ceremonyTimeout,
+			},
+		},
+	}
+
+	if wcfg.RPID == "" {
+		wcfg.RPID = u.Hostname()
+	}
+
+	if wcfg.RPDisplayName == "" {
+		wcfg.RPDisplayName = defaultDisplayName
+	}
+
+	if len(wcfg.RPOrigins) == 0 {
+		wcfg.RPOrigins = []string{u.Scheme + "://" + u.Host}
+	}
+
+	w, err := webauthn.New(wcfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webauthn: %w", err)
+	}
+
+	return &Service{
+		repo:        repo,
+		userService: userService,
+		webauthn:    w,
+	}, nil
+}
+
+func (s *Service) loadUser(ctx context.Context, u user.User) (*webauthnUser, error) {
+	creds, err := s.repo.GetWebAuthnCredentialsOfUser(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+
+	return newWebauthnUser(u, creds), nil
+}
+
+// BeginRegistration starts the registration of a new passkey for the user.
+// The options are passed to navigator.credentials.create in the browser and the session is needed to finish the registration.
+func (s *Service) BeginRegistration(ctx context.Context, u user.User) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	wu, err := s.loadUser(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A resident key is needed to log in without first entering who you are
+	return s.webauthn.BeginRegistration(wu,
+		webauthn.WithExclusions(wu.descriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+}
+
+// FinishRegistration verifies the response of the browser and stores the new passkey.
+func (s *Service) FinishRegistration(ctx context.Context, u user.User, name string, session webauthn.SessionData, r *http.Request) (Credential, error) {
+	if name == "" {
+		name = defaultName
+	}
+
+	if len(name) > maxNameLength {
+		return Credential{}, fmt.Errorf("the name must be at most %d characters long", maxNameLength)
+	}
+
+	wu, err := s.loadUser(ctx, u)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	c, err := s.webauthn.FinishRegistration(wu, session, r)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+
+	cred := fromWebauthnCredential(u.ID, name, c)
+	cred.CreatedAt = time.Now()
+	if err := s.repo.CreateWebAuthnCredential(ctx, cred); err != nil {
+		return Credential{}, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	return newCredential(cred), nil
+}
+
+// BeginLogin starts a passwordless login where the browser lets the user pick any passkey for the site.
+func (s *Service) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+}
+
+// FinishLogin verifies the passkey picked by the user and returns who it belongs to.
+// It also reports whether the authenticator verified the user, e.g. by a PIN or biometrics, in which case the login is multi-factor.
+func (s *Service) FinishLogin(ctx context.Context, session webauthn.SessionData, r *http.Request) (user.User, bool, error) {
+	var wu *webauthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID := string(userHandle)
+		u, err := s.userService.Get(ctx, repo.GetUserParams{ID: &userID})
+		if err != nil {
+			return nil, err
+		}
+
+		wu, err = s.loadUser(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+
+		return wu, nil
+	}
+
+	c, err := s.webauthn.FinishDiscoverableLogin(handler, session, r)
+	if err != nil {
+		return user.User{}, false, fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+
+	if err := s.recordUsage(ctx, c); err != nil {
+		return user.User{}, false, err
+	}
+
+	return wu.user, c.Flags.UserVerified, nil
+}
+
+// BeginVerify starts the verification of a passkey as the second factor of the user.
+// The user has to be verified by the passkey, otherwise a passkey that was just used to log in without it
+// would be both factors.
+func (s *Service) BeginVerify(ctx context.Context, u user.User) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	wu, err := s.loadUser(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(wu.creds) == 0 {
+		return nil, nil, ErrNoCredentials
+	}
+
+	return s.webauthn.BeginLogin(wu, webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishVerify verifies that the user used one of their passkeys.
+func (s *Service) FinishVerify(ctx context.Context, u user.User, session webauthn.SessionData, r *http.Request) error {
+	wu, err := s.loadUser(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.webauthn.FinishLogin(wu, session, r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+
+	return s.recordUsage(ctx, c)
+}
+
+func (s *Service) recordUsage(ctx context.Context, c *webauthn.Credential) error {
+	if c.Authenticator.CloneWarning {
+		return ErrClonedAuthenticator
+	}
+
+	if err := s.repo.UpdateWebAuthnCredentialUsage(ctx, c.ID, c.Authenticator.SignCount, c.Flags.BackupState); err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) HasCredentials(ctx context.Context, userID string) (bool, error) {
+	creds, err := s.repo.GetWebAuthnCredentialsOfUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(creds) > 0, nil
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]Credential, error) {
+	creds, err := s.repo.GetWebAuthnCredentialsOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Credential, len(creds))
+	for i, c := range creds {
+		list[i] = newCredential(c)
+	}
+
+	return list, nil
+}
+
+// Delete removes the passkey of the user with the base64url encoded credential ID.
+func (s *Service) Delete(ctx context.Context, userID string, id string) error {
+	rawID, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return fmt.Errorf("invalid passkey id: %w", err)
+	}
+
+	return s.repo.DeleteWebAuthnCredential(ctx, userID, rawID)
+}
@@ -0,0 +1,198 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/sdk"
+)
+
+// The longest keys and values that the role_permissions table can store
+const MaxLength = 255
+
+var (
+	ErrUnknownKey   = errors.New("unknown permission key")
+	ErrInvalidValue = errors.New("invalid permission value")
+	ErrTooLong      = errors.New("permission key or value is too long")
+)
+
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeBool   Type = "bool"
+	TypeNumber Type = "number"
+)
+
+// Definition describes a permission that roles can be given.
+type Definition struct {
+	// The key of the permission, or a pattern of keys in the syntax of sdk.KeyMatches, e.g. "projects:*"
+	Key         string `yaml:"key" json:"key"`
+	Description string `yaml:"description" json:"description"`
+	// The service that checks the permission
+	Service string `yaml:"service" json:"service,omitempty"`
+	// The type of the values, string if not set
+	Type Type `yaml:"type" json:"type"`
+	// The only values that are allowed, any value of the type is allowed if empty
+	Values []string `yaml:"values" json:"values,omitempty"`
+}
+
+type Config struct {
+	// Roles can only be given the permissions that are defined if set, any key is allowed otherwise
+	Strict bool `yaml:"strict"`
+
+	Definitions []Definition `yaml:"definitions"`
+}
+
+// The permissions that Thor itself checks, they can be redefined in the configuration
+var builtin = []Definition{
+	{
+		Key:         "admin",
+		Description: "Administers Thor and all of its users, roles and orgs",
+		Service:     "thor",
+		Type:        TypeBool,
+	},
+}
+
+// Catalog is the registry of the known permissions.
+type Catalog struct {
+	strict      bool
+	definitions []Definition
+}
+
+// NewCatalog creates a catalog of the configured and built-in permissions.
+// A nil config gives a catalog of only the built-in permissions that allows any other key.
+func NewCatalog(cfg *Config) (*Catalog, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	c := &Catalog{
+		strict: cfg.Strict,
+	}
+
+	seen := make(map[string]bool)
+	for i, d := range cfg.Definitions {
+		if d.Key == "" {
+			return nil, fmt.Errorf("missing key on permission definition %d", i+1)
+		}
+
+		if seen[d.Key] {
+			return nil, fmt.Errorf("permission %q is defined more than once", d.Key)
+		}
+		seen[d.Key] = true
+
+		if d.Type == "" {
+			d.Type = TypeString
+		}
+
+		if d.Type != TypeString && d.Type != TypeBool && d.Type != TypeNumber {
+			return nil, fmt.Errorf("permission %q: unknown type %q", d.Key, d.Type)
+		}
+
+		for _, v := range d.Values {
+			if err := checkType(d.Type, v); err != nil {
+				return nil, fmt.Errorf("permission %q: %w", d.Key, err)
+			}
+		}
+
+		c.definitions = append(c.definitions, d)
+	}
+
+	for _, d := range builtin {
+		if !seen[d.Key] {
+			c.definitions = append(c.definitions, d)
+		}
+	}
+
+	return c, nil
+}
+
+func checkType(t Type, value string) error {
+	switch t {
+	case TypeString:
+		return nil
+	case TypeBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%w: %q is not true or false", ErrInvalidValue, value)
+		}
+		return nil
+	case TypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%w: %q is not a number", ErrInvalidValue, value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown permission type %q", t)
+	}
+}
+
+// isComparison reports whether the value is a number with one of the comparison operators of the sdk, e.g. ">=3".
+func isComparison(value string) bool {
+	r, err := sdk.ParseRequirement("n" + value)
+	return err == nil && r.Op != "="
+}
+
+// Definitions returns the known permissions sorted by key.
+func (c *Catalog) Definitions() []Definition {
+	definitions := slices.Clone(c.definitions)
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Key < definitions[j].Key
+	})
+	return definitions
+}
+
+// Lookup returns the definition of the key. An exact definition is preferred over a matching pattern.
+func (c *Catalog) Lookup(key string) (Definition, bool) {
+	for _, d := range c.definitions {
+		if d.Key == key {
+			return d, true
+		}
+	}
+
+	for _, d := range c.definitions {
+		if sdk.KeyMatches(d.Key, key) {
+			return d, true
+		}
+	}
+
+	return Definition{}, false
+}
+
+// Validate checks that a role can be given the permission.
+func (c *Catalog) Validate(p models.Permission) error {
+	if utf8.RuneCountInString(p.Key) > MaxLength || utf8.RuneCountInString(p.Val) > MaxLength {
+		return fmt.Errorf("%w: at most %d characters are allowed", ErrTooLong, MaxLength)
+	}
+
+	d, ok := c.Lookup(p.Key)
+	if !ok {
+		if c.strict {
+			return fmt.Errorf("%w: %q", ErrUnknownKey, p.Key)
+		}
+		return nil
+	}
+
+	// The wildcard grants every value of the key, whatever its type
+	if p.Val == "*" {
+		return nil
+	}
+
+	if d.Type == TypeNumber && isComparison(p.Val) {
+		return nil
+	}
+
+	if len(d.Values) > 0 {
+		if !slices.Contains(d.Values, p.Val) {
+			return fmt.Errorf("%w: %q is not one of the values of %q", ErrInvalidValue, p.Val, d.Key)
+		}
+		return nil
+	}
+
+	return checkType(d.Type, p.Val)
+}
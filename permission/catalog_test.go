@@ -0,0 +1,116 @@
+package permission
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+)
+
+func Test_Validate(t *testing.T) {
+	catalog, err := NewCatalog(&Config{
+		Strict: true,
+		Definitions: []Definition{
+			{Key: "projects:*", Description: "Access to a project", Service: "projects", Values: []string{"read", "write"}},
+			{Key: "projects:limit", Description: "How many projects can be created", Service: "projects", Type: TypeNumber},
+			{Key: "billing", Description: "Manages the billing", Service: "billing", Type: TypeBool},
+			{Key: "team", Description: "The team of the user"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		key     string
+		val     string
+		wantErr error
+	}{
+		{key: "admin", val: "true"},
+		{key: "admin", val: "yes", wantErr: ErrInvalidValue},
+		{key: "admn", val: "true", wantErr: ErrUnknownKey},
+		{key: "projects:web", val: "read"},
+		{key: "projects:*", val: "write"},
+		{key: "projects:web", val: "delete", wantErr: ErrInvalidValue},
+		{key: "projects:limit", val: "10"},
+		{key: "projects:limit", val: "ten", wantErr: ErrInvalidValue},
+		{key: "projects:limit", val: "*"},
+		{key: "projects:limit", val: ">=3"},
+		{key: "projects:limit", val: "<2.5"},
+		{key: "projects:limit", val: ">=ten", wantErr: ErrInvalidValue},
+		{key: "projects:limit", val: "=3", wantErr: ErrInvalidValue},
+		{key: "projects:web", val: "*"},
+		{key: "projects:web", val: ">=3", wantErr: ErrInvalidValue},
+		{key: "billing", val: "false"},
+		{key: "billing", val: "*"},
+		{key: "billing", val: ">1", wantErr: ErrInvalidValue},
+		{key: "team", val: "web"},
+		{key: "team", val: strings.Repeat("a", MaxLength+1), wantErr: ErrTooLong},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key+"="+tC.val, func(t *testing.T) {
+			err := catalog.Validate(models.Permission{Key: tC.key, Val: tC.val})
+			if !errors.Is(err, tC.wantErr) {
+				t.Errorf("Validate() = %v; want %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ValidateNotStrict(t *testing.T) {
+	catalog, err := NewCatalog(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := catalog.Validate(models.Permission{Key: "anything", Val: "goes"}); err != nil {
+		t.Errorf("unknown keys should be allowed, got %v", err)
+	}
+
+	if err := catalog.Validate(models.Permission{Key: "admin", Val: "yes"}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("the built-in permissions should still be validated, got %v", err)
+	}
+}
+
+func Test_NewCatalog(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		definitions []Definition
+		wantErr     bool
+	}{
+		{desc: "missing key", definitions: []Definition{{Description: "nothing"}}, wantErr: true},
+		{desc: "duplicate key", definitions: []Definition{{Key: "team"}, {Key: "team"}}, wantErr: true},
+		{desc: "unknown type", definitions: []Definition{{Key: "team", Type: "color"}, {Key: "other", Type: "color", Values: []string{"red"}}}, wantErr: true},
+		{desc: "value of the wrong type", definitions: []Definition{{Key: "limit", Type: TypeNumber, Values: []string{"many"}}}, wantErr: true},
+		{desc: "redefined built-in", definitions: []Definition{{Key: "admin", Type: TypeString}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := NewCatalog(&Config{Definitions: tC.definitions})
+			if (err != nil) != tC.wantErr {
+				t.Errorf("NewCatalog() error = %v; want error %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func Test_Definitions(t *testing.T) {
+	catalog, err := NewCatalog(&Config{Definitions: []Definition{{Key: "team"}, {Key: "billing", Type: TypeBool}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, d := range catalog.Definitions() {
+		keys = append(keys, d.Key)
+	}
+
+	if got := strings.Join(keys, ","); got != "admin,billing,team" {
+		t.Errorf("Definitions() keys = %s; want admin,billing,team", got)
+	}
+
+	if d, _ := catalog.Lookup("team"); d.Type != TypeString {
+		t.Errorf("the type should default to string, got %q", d.Type)
+	}
+}
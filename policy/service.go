@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/sdk"
+)
+
+// ErrInvalidPolicy is returned together with what is wrong when a policy can not be saved.
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Service manages the policies that requests for actions on resources are authorized by.
+type Service struct {
+	repo repo.Repo
+}
+
+func NewService(repo repo.Repo) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func validate(policy models.Policy) error {
+	if policy.Name == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidPolicy)
+	}
+
+	if err := sdk.ValidatePolicy(policy); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	return nil
+}
+
+func (s *Service) Create(ctx context.Context, policy models.Policy) (models.Policy, error) {
+	if err := validate(policy); err != nil {
+		return models.Policy{}, err
+	}
+
+	policy.ID = uuid.NewString()
+
+	if err := s.repo.CreatePolicy(ctx, policy); err != nil {
+		return models.Policy{}, err
+	}
+
+	return policy, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (models.Policy, error) {
+	return s.repo.GetPolicy(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context) ([]models.Policy, error) {
+	return s.repo.ListPolicies(ctx)
+}
+
+func (s *Service) Update(ctx context.Context, policy models.Policy) (models.Policy, error) {
+	if policy.ID == "" {
+		return models.Policy{}, fmt.Errorf("missing policy id")
+	}
+
+	if err := validate(policy); err != nil {
+		return models.Policy{}, err
+	}
+
+	if err := s.repo.UpdatePolicy(ctx, policy); err != nil {
+		return models.Policy{}, err
+	}
+
+	return policy, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.DeletePolicy(ctx, id)
+}
+
+// Decide evaluates the policies on the request by the subject of the claims.
+func (s *Service) Decide(ctx context.Context, claims *authorizer.Claims, req sdk.AuthorizeRequest) (sdk.Decision, error) {
+	policies, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		return sdk.Decision{}, err
+	}
+
+	set, err := sdk.NewPolicySet(policies)
+	if err != nil {
+		return sdk.Decision{}, err
+	}
+
+	return set.Decide(claims, req), nil
+}
@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/sdk"
+)
+
+func newTestService(t *testing.T, policies ...models.Policy) *Service {
+	t.Helper()
+
+	r := repo.NewMemory()
+	for _, p := range policies {
+		if err := r.CreatePolicy(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewService(r)
+}
+
+func Test_Decide(t *testing.T) {
+	s := newTestService(t,
+		models.Policy{ID: "owners", Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id"},
+		models.Policy{ID: "readers", Name: "readers", Effect: models.PolicyAllow, Actions: []string{"projects:read"}},
+		models.Policy{ID: "archived", Name: "archived", Effect: models.PolicyDeny, Actions: []string{"projects:*"}, Condition: "resource.archived == true"},
+	)
+	claims := &authorizer.Claims{UserID: "leo"}
+
+	testCases := []struct {
+		desc     string
+		req      sdk.AuthorizeRequest
+		want     bool
+		policyID string
+	}{
+		{
+			desc:     "allowed by the condition",
+			req:      sdk.AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "leo"}},
+			want:     true,
+			policyID: "owners",
+		},
+		{
+			desc: "the condition does not hold",
+			req:  sdk.AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "someone-else"}},
+		},
+		{
+			desc:     "allowed without a condition",
+			req:      sdk.AuthorizeRequest{Action: "projects:read", Resource: map[string]any{"owner": "someone-else"}},
+			want:     true,
+			policyID: "readers",
+		},
+		{
+			desc: "no policy applies to the action",
+			req:  sdk.AuthorizeRequest{Action: "billing:read", Resource: map[string]any{"owner": "leo"}},
+		},
+		{
+			desc:     "denied over an allowing policy",
+			req:      sdk.AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "leo", "archived": true}},
+			policyID: "archived",
+		},
+		{
+			desc:     "denied over every allowing policy",
+			req:      sdk.AuthorizeRequest{Action: "projects:read", Resource: map[string]any{"owner": "leo", "archived": true}},
+			policyID: "archived",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := s.Decide(context.Background(), claims, tC.req)
+			if err != nil {
+				t.Fatalf("Decide() = %v; want nil", err)
+			}
+
+			if got.Allowed != tC.want || got.PolicyID != tC.policyID {
+				t.Errorf("Decide() = %+v; want allowed %v by policy %q", got, tC.want, tC.policyID)
+			}
+		})
+	}
+}
+
+func Test_DecideInvalidPolicy(t *testing.T) {
+	// Written past the validation of the service, e.g. by an older version
+	s := newTestService(t, models.Policy{ID: "broken", Name: "broken", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner =="})
+
+	if _, err := s.Decide(context.Background(), &authorizer.Claims{UserID: "leo"}, sdk.AuthorizeRequest{Action: "projects:read"}); err == nil {
+		t.Error("Decide() with an invalid policy = nil; want error")
+	}
+}
+
+func Test_Create(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		policy  models.Policy
+		wantErr error
+	}{
+		{
+			desc:   "valid",
+			policy: models.Policy{Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id"},
+		},
+		{
+			desc:    "missing name",
+			policy:  models.Policy{Effect: models.PolicyAllow, Actions: []string{"projects:*"}},
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			desc:    "unknown effect",
+			policy:  models.Policy{Name: "maybe", Effect: "maybe", Actions: []string{"projects:*"}},
+			wantErr: ErrInvalidPolicy,
+		},
+		{
+			desc:    "invalid condition",
+			policy:  models.Policy{Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner =="},
+			wantErr: ErrInvalidPolicy,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := newTestService(t)
+
+			got, err := s.Create(context.Background(), tC.policy)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("Create() = %v; want %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr == nil {
+				if got.ID == "" {
+					t.Error("Create() gave no id")
+				}
+				if _, err := s.Get(context.Background(), got.ID); err != nil {
+					t.Errorf("Get() of the created policy = %v; want nil", err)
+				}
+			}
+		})
+	}
+}
+
+// Test_AuthorizeAsksThor checks that sdk.Authorize falls back to the decisions of the service when the caller
+// has no policies of its own, and that the local policies are used when it has.
+func Test_AuthorizeAsksThor(t *testing.T) {
+	s := newTestService(t,
+		models.Policy{ID: "owners", Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id"},
+		models.Policy{ID: "archived", Name: "archived", Effect: models.PolicyDeny, Actions: []string{"projects:*"}, Condition: "resource.archived == true"},
+	)
+	claims := &authorizer.Claims{UserID: "leo"}
+
+	// Stands in for POST /api/authorize, with the token being the id of the user
+	var asked int
+	thor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked++
+
+		cookie, err := r.Cookie("thor")
+		if err != nil || cookie.Value != claims.UserID {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req sdk.AuthorizeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		decision, err := s.Decide(r.Context(), claims, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(decision)
+	}))
+	defer thor.Close()
+
+	remote := sdk.NewRemote(thor.URL, "thor")
+	ctx := sdk.WithClaims(context.Background(), claims)
+
+	testCases := []struct {
+		desc     string
+		ctx      context.Context
+		resource map[string]any
+		want     bool
+		wantAsk  bool
+	}{
+		{
+			desc:     "own project",
+			ctx:      sdk.WithRemote(ctx, remote, claims.UserID),
+			resource: map[string]any{"owner": "leo"},
+			want:     true,
+			wantAsk:  true,
+		},
+		{
+			desc:     "project of someone else",
+			ctx:      sdk.WithRemote(ctx, remote, claims.UserID),
+			resource: map[string]any{"owner": "someone-else"},
+			wantAsk:  true,
+		},
+		{
+			desc:     "denied over allowed",
+			ctx:      sdk.WithRemote(ctx, remote, claims.UserID),
+			resource: map[string]any{"owner": "leo", "archived": true},
+			wantAsk:  true,
+		},
+		{
+			desc:     "token that Thor refuses",
+			ctx:      sdk.WithRemote(ctx, remote, "someone-else"),
+			resource: map[string]any{"owner": "leo"},
+			wantAsk:  true,
+		},
+		{
+			desc:     "local policies",
+			ctx:      sdk.WithPolicies(sdk.WithRemote(ctx, remote, claims.UserID), &sdk.PolicySet{}),
+			resource: map[string]any{"owner": "leo"},
+		},
+		{
+			desc:     "neither policies nor Thor",
+			ctx:      ctx,
+			resource: map[string]any{"owner": "leo"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			asked = 0
+
+			if got := sdk.Authorize(tC.ctx, "projects:delete", tC.resource); got != tC.want {
+				t.Errorf("Authorize() = %v; want %v", got, tC.want)
+			}
+			if (asked > 0) != tC.wantAsk {
+				t.Errorf("Authorize() asked Thor %d times; want asked %v", asked, tC.wantAsk)
+			}
+		})
+	}
+}
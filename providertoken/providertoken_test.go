@@ -0,0 +1,166 @@
+package providertoken
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+// tokenRepo only implements the provider token methods of the repo.
+type tokenRepo struct {
+	repo.Repo
+	token        *models.ProviderToken
+	userDisabled bool
+}
+
+func (r *tokenRepo) GetUser(_ context.Context, params repo.GetUserParams) (models.User, error) {
+	return models.User{ID: *params.ID, Disabled: r.userDisabled}, nil
+}
+
+func (r *tokenRepo) SetProviderToken(_ context.Context, token models.ProviderToken) error {
+	r.token = &token
+	return nil
+}
+
+func (r *tokenRepo) GetProviderToken(_ context.Context, userID string, providerType models.UserProviderType, providerName string) (models.ProviderToken, error) {
+	if r.token == nil || r.token.UserID != userID || r.token.ProviderType != providerType || r.token.ProviderName != providerName {
+		return models.ProviderToken{}, repo.ErrNotFound
+	}
+	return *r.token, nil
+}
+
+type refresherFunc func(refreshToken string) (Token, error)
+
+func (f refresherFunc) Refresh(refreshToken string) (Token, error) {
+	return f(refreshToken)
+}
+
+func Test_NewService_Key(t *testing.T) {
+	if _, err := NewService(&Config{EncryptionKey: testKey}, nil); err != nil {
+		t.Errorf("NewService() = %v; want nil", err)
+	}
+
+	short := base64.StdEncoding.EncodeToString([]byte("too short"))
+	if _, err := NewService(&Config{EncryptionKey: short}, nil); err == nil {
+		t.Errorf("NewService() with a short key = nil; want error")
+	}
+}
+
+func Test_Store_Encrypts(t *testing.T) {
+	r := &tokenRepo{}
+	s, err := NewService(&Config{EncryptionKey: testKey}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1234"}
+	err = s.Store(context.Background(), "user", provider, "app", Token{AccessToken: "gho_secret", RefreshToken: "ghr_secret"})
+	if err != nil {
+		t.Fatalf("Store() = %v; want nil", err)
+	}
+
+	if strings.Contains(string(r.token.AccessToken), "gho_secret") || strings.Contains(string(r.token.RefreshToken), "ghr_secret") {
+		t.Errorf("the tokens are stored in plaintext")
+	}
+
+	token, err := s.Get(context.Background(), "user", models.UserProviderTypeGithub, "app")
+	if err != nil {
+		t.Fatalf("Get() = %v; want nil", err)
+	}
+	if token.AccessToken != "gho_secret" {
+		t.Errorf("Get() = %s; want gho_secret", token.AccessToken)
+	}
+
+	// The ciphertext is bound to the provider id
+	r.token.ProviderID = "5678"
+	if _, err := s.Get(context.Background(), "user", models.UserProviderTypeGithub, "app"); err == nil {
+		t.Errorf("Get() of a token moved to another provider id = nil; want error")
+	}
+}
+
+func Test_Get_Refreshes(t *testing.T) {
+	r := &tokenRepo{}
+	s, err := NewService(&Config{EncryptionKey: testKey}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refreshedWith string
+	s.RegisterRefresher(models.UserProviderTypeGoogle, "app", refresherFunc(func(refreshToken string) (Token, error) {
+		refreshedWith = refreshToken
+		expiresAt := time.Now().Add(time.Hour)
+		return Token{AccessToken: "new", ExpiresAt: &expiresAt}, nil
+	}))
+
+	provider := models.UserProvider{Type: models.UserProviderTypeGoogle, UserID: "sub"}
+	expiresAt := time.Now().Add(10 * time.Second)
+	err = s.Store(context.Background(), "user", provider, "app", Token{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.Get(context.Background(), "user", models.UserProviderTypeGoogle, "app")
+	if err != nil {
+		t.Fatalf("Get() = %v; want nil", err)
+	}
+
+	if refreshedWith != "refresh" {
+		t.Errorf("refreshed with %q; want refresh", refreshedWith)
+	}
+	if token.AccessToken != "new" {
+		t.Errorf("Get() = %s; want new", token.AccessToken)
+	}
+
+	// The refresh token is kept since the provider did not rotate it
+	stored, err := s.Get(context.Background(), "user", models.UserProviderTypeGoogle, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RefreshToken != "refresh" {
+		t.Errorf("stored refresh token = %q; want refresh", stored.RefreshToken)
+	}
+}
+
+func Test_Get_Expired(t *testing.T) {
+	r := &tokenRepo{}
+	s, err := NewService(&Config{EncryptionKey: testKey}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1234"}
+	expiresAt := time.Now().Add(-time.Minute)
+	err = s.Store(context.Background(), "user", provider, "app", Token{AccessToken: "old", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(context.Background(), "user", models.UserProviderTypeGithub, "app"); err != ErrExpired {
+		t.Errorf("Get() = %v; want %v", err, ErrExpired)
+	}
+}
+
+func Test_Get_DisabledUser(t *testing.T) {
+	r := &tokenRepo{}
+	s, err := NewService(&Config{EncryptionKey: testKey}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1234"}
+	if err := s.Store(context.Background(), "user", provider, "app", Token{AccessToken: "gho_secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.userDisabled = true
+	if _, err := s.Get(context.Background(), "user", models.UserProviderTypeGithub, "app"); err != ErrUserDisabled {
+		t.Errorf("Get() = %v; want %v", err, ErrUserDisabled)
+	}
+}
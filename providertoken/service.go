@@ -0,0 +1,221 @@
+package providertoken
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+// Access tokens that expire within this margin are refreshed before they are handed out,
+// so that the caller has time to use them.
+const refreshMargin = time.Minute
+
+var (
+	// ErrExpired is returned when the access token has expired and can not be refreshed.
+	ErrExpired = errors.New("the provider token has expired")
+	// ErrRefreshFailed is returned when the provider did not issue a new access token.
+	ErrRefreshFailed = errors.New("failed to refresh the provider token")
+	// ErrUserDisabled is returned when the user is disabled, the tokens are kept but not handed out.
+	ErrUserDisabled = errors.New("the user is disabled")
+)
+
+type Config struct {
+	// Base64 encoded 32 byte key that the tokens are encrypted with
+	EncryptionKey string `yaml:"encryption-key" json:"-"`
+}
+
+// Token is a token issued by a provider.
+type Token struct {
+	AccessToken string
+	// Empty if the provider does not issue refresh tokens
+	RefreshToken string
+	TokenType    string
+	Scope        string
+	// Nil if the access token does not expire
+	ExpiresAt *time.Time
+}
+
+// AccessToken is the part of a token that is handed out to services, the refresh token never leaves Thor.
+type AccessToken struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	Scope       string     `json:"scope,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+func (t Token) Access() AccessToken {
+	return AccessToken{
+		AccessToken: t.AccessToken,
+		TokenType:   t.TokenType,
+		Scope:       t.Scope,
+		ExpiresAt:   t.ExpiresAt,
+	}
+}
+
+// Refresher gets a new access token from the provider.
+type Refresher interface {
+	Refresh(refreshToken string) (Token, error)
+}
+
+// Service keeps the tokens that the providers issued when the users logged in, encrypted at rest.
+type Service struct {
+	repo repo.Repo
+	aead cipher.AEAD
+
+	// The providers that can refresh their tokens, by type and name
+	refreshers map[string]Refresher
+	// Held while refreshing, providers that rotate the refresh tokens only accept each of them once
+	refreshMu sync.Mutex
+}
+
+func NewService(cfg *Config, repo repo.Repo) (*Service, error) {
+	aead, err := newAEAD(cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		repo:       repo,
+		aead:       aead,
+		refreshers: make(map[string]Refresher),
+	}, nil
+}
+
+// RegisterRefresher registers the provider that refreshes the tokens it has issued.
+// It must be called before the service is used.
+func (s *Service) RegisterRefresher(providerType models.UserProviderType, providerName string, r Refresher) {
+	s.refreshers[refresherKey(providerType, providerName)] = r
+}
+
+func refresherKey(providerType models.UserProviderType, providerName string) string {
+	return fmt.Sprintf("%s/%s", providerType, providerName)
+}
+
+// Store encrypts and stores the token issued to the user by the provider, replacing any previous token.
+func (s *Service) Store(ctx context.Context, userID string, provider models.UserProvider, providerName string, token Token) error {
+	accessToken, err := seal(s.aead, token.AccessToken, []byte(provider.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the access token: %w", err)
+	}
+
+	var refreshToken []byte
+	if token.RefreshToken != "" {
+		refreshToken, err = seal(s.aead, token.RefreshToken, []byte(provider.UserID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt the refresh token: %w", err)
+		}
+	}
+
+	return s.repo.SetProviderToken(ctx, models.ProviderToken{
+		ProviderID:   provider.UserID,
+		UserID:       userID,
+		ProviderType: provider.Type,
+		ProviderName: providerName,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    token.TokenType,
+		Scope:        token.Scope,
+		ExpiresAt:    token.ExpiresAt,
+	})
+}
+
+// Get returns a valid access token issued to the user by the provider.
+// Tokens that are about to expire are refreshed first.
+// Returns repo.ErrNotFound if no token is stored.
+func (s *Service) Get(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (Token, error) {
+	u, err := s.repo.GetUser(ctx, repo.GetUserParams{ID: &userID})
+	if err != nil {
+		return Token{}, err
+	}
+	if u.Disabled {
+		return Token{}, ErrUserDisabled
+	}
+
+	token, provider, err := s.get(ctx, userID, providerType, providerName)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if !expiresSoon(token) {
+		return token, nil
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	// It might have been refreshed while waiting for the lock
+	token, provider, err = s.get(ctx, userID, providerType, providerName)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if !expiresSoon(token) {
+		return token, nil
+	}
+
+	refresher, ok := s.refreshers[refresherKey(providerType, providerName)]
+	if !ok || token.RefreshToken == "" {
+		if time.Now().Before(*token.ExpiresAt) {
+			// Still usable for a little while
+			return token, nil
+		}
+		return Token{}, ErrExpired
+	}
+
+	refreshed, err := refresher.Refresh(token.RefreshToken)
+	if err != nil {
+		return Token{}, errors.Join(ErrRefreshFailed, err)
+	}
+
+	// Providers that do not rotate the refresh tokens do not return them when refreshing
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	if err := s.Store(ctx, userID, provider, providerName, refreshed); err != nil {
+		return Token{}, fmt.Errorf("failed to store the refreshed token: %w", err)
+	}
+
+	return refreshed, nil
+}
+
+func (s *Service) get(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (Token, models.UserProvider, error) {
+	stored, err := s.repo.GetProviderToken(ctx, userID, providerType, providerName)
+	if err != nil {
+		return Token{}, models.UserProvider{}, err
+	}
+
+	accessToken, err := open(s.aead, stored.AccessToken, []byte(stored.ProviderID))
+	if err != nil {
+		return Token{}, models.UserProvider{}, fmt.Errorf("failed to decrypt the access token: %w", err)
+	}
+
+	var refreshToken string
+	if len(stored.RefreshToken) > 0 {
+		refreshToken, err = open(s.aead, stored.RefreshToken, []byte(stored.ProviderID))
+		if err != nil {
+			return Token{}, models.UserProvider{}, fmt.Errorf("failed to decrypt the refresh token: %w", err)
+		}
+	}
+
+	return Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    stored.TokenType,
+		Scope:        stored.Scope,
+		ExpiresAt:    stored.ExpiresAt,
+	}, models.UserProvider{
+		Type:   stored.ProviderType,
+		UserID: stored.ProviderID,
+	}, nil
+}
+
+func expiresSoon(token Token) bool {
+	return token.ExpiresAt != nil && time.Until(*token.ExpiresAt) < refreshMargin
+}
@@ -0,0 +1,76 @@
+// Helpers for the passkey ceremonies.
+// The server sends and expects the binary values as base64url encoded strings, the browser API uses ArrayBuffers.
+
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    const binary = atob(base64 + "=".repeat((4 - (base64.length % 4)) % 4));
+    return Uint8Array.from(binary, (c) => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+async function postJSON(url, body) {
+    const res = await fetch(url, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!res.ok) {
+        throw new Error(await res.text());
+    }
+    return res.json();
+}
+
+// Registers a new passkey for the logged in user.
+async function createPasskey(name) {
+    const { publicKey } = await postJSON("/oauth/passkey/register/begin");
+
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    publicKey.user.id = base64urlToBuffer(publicKey.user.id);
+    for (const c of publicKey.excludeCredentials || []) {
+        c.id = base64urlToBuffer(c.id);
+    }
+
+    const cred = await navigator.credentials.create({ publicKey });
+
+    return postJSON("/oauth/passkey/register/finish?name=" + encodeURIComponent(name), {
+        id: cred.id,
+        rawId: bufferToBase64url(cred.rawId),
+        type: cred.type,
+        response: {
+            attestationObject: bufferToBase64url(cred.response.attestationObject),
+            clientDataJSON: bufferToBase64url(cred.response.clientDataJSON),
+            transports: cred.response.getTransports ? cred.response.getTransports() : [],
+        },
+    });
+}
+
+// Asks the browser for a passkey and sends the assertion to the server.
+// The server responds with where to go next.
+async function usePasskey(beginURL, finishURL) {
+    const { publicKey } = await postJSON(beginURL);
+
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    for (const c of publicKey.allowCredentials || []) {
+        c.id = base64urlToBuffer(c.id);
+    }
+
+    const cred = await navigator.credentials.get({ publicKey });
+
+    const res = await postJSON(finishURL, {
+        id: cred.id,
+        rawId: bufferToBase64url(cred.rawId),
+        type: cred.type,
+        response: {
+            authenticatorData: bufferToBase64url(cred.response.authenticatorData),
+            clientDataJSON: bufferToBase64url(cred.response.clientDataJSON),
+            signature: bufferToBase64url(cred.response.signature),
+            userHandle: cred.response.userHandle ? bufferToBase64url(cred.response.userHandle) : undefined,
+        },
+    });
+
+    window.location.href = res.redirect;
+}
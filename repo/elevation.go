@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+)
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// extendRoleAssignment changes the expiry of an existing assignment of the role in the SQL repos and reports if there was
+// one to change. A nil expiresAt makes an expiring assignment permanent, otherwise an assignment that expires
+// earlier is extended until expiresAt.
+func extendRoleAssignment(ctx context.Context, e execer, dialect string, userID string, roleID string, expiresAt *time.Time) (bool, error) {
+	q := &listQuery{dialect: dialect}
+	var query string
+	if expiresAt == nil {
+		query = "UPDATE user_roles SET expires_at = NULL WHERE user_id = " + q.arg(userID) + " AND role_id = " + q.arg(roleID) + " AND expires_at IS NOT NULL;"
+	} else {
+		query = "UPDATE user_roles SET expires_at = " + q.arg(expiresAt.UTC()) + " WHERE user_id = " + q.arg(userID) + " AND role_id = " + q.arg(roleID) + " AND expires_at < " + q.arg(expiresAt.UTC()) + ";"
+	}
+
+	res, err := e.ExecContext(ctx, query, q.args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// deleteExpiredRoleAssignments removes the role assignments that expired before the time in the SQL repos.
+func deleteExpiredRoleAssignments(ctx context.Context, db *sql.DB, dialect string, before time.Time) (int, error) {
+	q := &listQuery{dialect: dialect}
+	res, err := db.ExecContext(ctx, "DELETE FROM user_roles WHERE expires_at < "+q.arg(before.UTC())+";", q.args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const elevationRequestColumns = "id, user_id, role_id, reason, duration_seconds, status, requested_at, decided_by, decided_at, expires_at"
+
+func scanElevationRequest(row scanner) (models.ElevationRequest, error) {
+	var request models.ElevationRequest
+	var decidedBy sql.NullString
+	var decidedAt, expiresAt sql.NullTime
+	err := row.Scan(&request.ID, &request.UserID, &request.RoleID, &request.Reason, &request.DurationSeconds, &request.Status, &request.RequestedAt, &decidedBy, &decidedAt, &expiresAt)
+	if err != nil {
+		return models.ElevationRequest{}, err
+	}
+
+	if decidedBy.Valid {
+		request.DecidedBy = &decidedBy.String
+	}
+	if decidedAt.Valid {
+		request.DecidedAt = &decidedAt.Time
+	}
+	if expiresAt.Valid {
+		request.ExpiresAt = &expiresAt.Time
+	}
+
+	return request, nil
+}
+
+// createElevationRequest inserts the request in the SQL repos, the errors of the database are returned as they are.
+func createElevationRequest(ctx context.Context, db *sql.DB, dialect string, request models.ElevationRequest) error {
+	q := &listQuery{dialect: dialect}
+	query := "INSERT INTO elevation_requests (id, user_id, role_id, reason, duration_seconds, status, requested_at) VALUES(" +
+		strings.Join([]string{
+			q.arg(request.ID), q.arg(request.UserID), q.arg(request.RoleID), q.arg(request.Reason),
+			q.arg(request.DurationSeconds), q.arg(string(request.Status)), q.arg(request.RequestedAt.UTC()),
+		}, ", ") + ");"
+	_, err := db.ExecContext(ctx, query, q.args...)
+	return err
+}
+
+func getElevationRequest(ctx context.Context, db *sql.DB, dialect string, id string) (models.ElevationRequest, error) {
+	q := &listQuery{dialect: dialect}
+	row := db.QueryRowContext(ctx, "SELECT "+elevationRequestColumns+" FROM elevation_requests WHERE id = "+q.arg(id)+";", q.args...)
+
+	request, err := scanElevationRequest(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ElevationRequest{}, ErrNotFound
+		}
+		return models.ElevationRequest{}, err
+	}
+
+	return request, nil
+}
+
+func listElevationRequests(ctx context.Context, db *sql.DB, dialect string, params ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	q := &listQuery{dialect: dialect}
+	if params.UserID != "" {
+		q.where("user_id = " + q.arg(params.UserID))
+	}
+	if params.Status != "" {
+		q.where("status = " + q.arg(string(params.Status)))
+	}
+
+	query := "SELECT " + elevationRequestColumns + " FROM elevation_requests"
+	if len(q.conditions) > 0 {
+		query += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	query += " ORDER BY requested_at, id;"
+
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]models.ElevationRequest, 0)
+	for rows.Next() {
+		request, err := scanElevationRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// decideElevationRequest marks the pending request as approved or denied within the transaction in the SQL repos.
+// An approved request gets the expiry of its assignment, which is returned together with the user and role.
+func decideElevationRequest(ctx context.Context, tx *sql.Tx, dialect string, id string, status models.ElevationStatus, approverID string, at time.Time) (models.ElevationRequest, error) {
+	q := &listQuery{dialect: dialect}
+	row := tx.QueryRowContext(ctx, "SELECT "+elevationRequestColumns+" FROM elevation_requests WHERE id = "+q.arg(id)+" AND status = "+q.arg(string(models.ElevationPending))+";", q.args...)
+	request, err := scanElevationRequest(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ElevationRequest{}, ErrNotFound
+		}
+		return models.ElevationRequest{}, err
+	}
+
+	var expiresAt sql.NullTime
+	if status == models.ElevationApproved {
+		expiresAt = sql.NullTime{Time: at.Add(time.Duration(request.DurationSeconds) * time.Second).UTC(), Valid: true}
+	}
+
+	// The status is checked again in case the request was decided since it was selected
+	q = &listQuery{dialect: dialect}
+	query := "UPDATE elevation_requests SET status = " + q.arg(string(status)) + ", decided_by = " + q.arg(approverID) + ", decided_at = " + q.arg(at.UTC()) +
+		", expires_at = " + q.arg(expiresAt) + " WHERE id = " + q.arg(id) + " AND status = " + q.arg(string(models.ElevationPending)) + ";"
+	res, err := tx.ExecContext(ctx, query, q.args...)
+	if err != nil {
+		return models.ElevationRequest{}, err
+	}
+	if err := expectAffected(res); err != nil {
+		return models.ElevationRequest{}, err
+	}
+
+	if expiresAt.Valid {
+		request.ExpiresAt = &expiresAt.Time
+	}
+	return request, nil
+}
@@ -7,4 +7,6 @@ var (
 	ErrNotFound = errors.New("not found")
 	// ErrAlreadyExists is returned when the requested resource already exists.
 	ErrAlreadyExists = errors.New("already exists")
+	// ErrNotMember is returned when the permissions of a user are resolved in an org the user is not a member of.
+	ErrNotMember = errors.New("the user is not a member of the org")
 )
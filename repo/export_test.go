@@ -0,0 +1,11 @@
+package repo
+
+// NewPostgresDSN connects to the postgres database of the connection string.
+func NewPostgresDSN(dsn string) Repo {
+	return newPostgres(dsn)
+}
+
+// NewMySqlDSN connects to the MySQL database of the connection string.
+func NewMySqlDSN(dsn string) Repo {
+	return newMySql(dsn)
+}
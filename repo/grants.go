@@ -0,0 +1,502 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/sdk/pattern"
+)
+
+// ErrCycle is returned when a change would make a role inherit from itself.
+var ErrCycle = errors.New("the role would inherit from itself")
+
+// roleGraph is what the effective permissions of a user are resolved from.
+type roleGraph struct {
+	// The roles assigned to the user, directly or through its groups
+	assigned []roleAssignment
+	// The parent role ids by role id
+	parents map[string][]string
+	// The permissions of the roles themselves by role id
+	permissions map[string][]models.Permission
+}
+
+// roleAssignment is a role assigned to a user, groupID is set if it is assigned to a group of the user.
+type roleAssignment struct {
+	roleID    string
+	groupID   string
+	expiresAt *time.Time
+}
+
+// grants walks from each assigned role through the parents and grants the permissions of every role it reaches.
+// The roles are walked breadth first so the path to each role is the shortest one. A role is only visited once
+// per assigned role, so a cycle can not make it loop.
+func (g roleGraph) grants() []models.PermissionGrant {
+	grants := make([]models.PermissionGrant, 0)
+	for _, assigned := range g.assigned {
+		paths := map[string][]string{assigned.roleID: {assigned.roleID}}
+		queue := []string{assigned.roleID}
+		for len(queue) > 0 {
+			roleID := queue[0]
+			queue = queue[1:]
+
+			for _, p := range g.permissions[roleID] {
+				grants = append(grants, models.PermissionGrant{Permission: p, RolePath: paths[roleID], GroupID: assigned.groupID, ExpiresAt: assigned.expiresAt})
+			}
+
+			for _, parentID := range g.parents[roleID] {
+				if _, ok := paths[parentID]; ok {
+					continue
+				}
+				paths[parentID] = append(slices.Clone(paths[roleID]), parentID)
+				queue = append(queue, parentID)
+			}
+		}
+	}
+
+	return grants
+}
+
+// reachable returns the ids of the roles that are assigned or inherited from the assigned roles.
+func (g roleGraph) reachable() []string {
+	var reached []string
+	var queue []string
+	for _, assigned := range g.assigned {
+		queue = append(queue, assigned.roleID)
+	}
+	for len(queue) > 0 {
+		roleID := queue[0]
+		queue = queue[1:]
+		if slices.Contains(reached, roleID) {
+			continue
+		}
+		reached = append(reached, roleID)
+		queue = append(queue, g.parents[roleID]...)
+	}
+
+	return reached
+}
+
+// grantedPermissions returns the permissions of the grants, every permission once.
+func grantedPermissions(grants []models.PermissionGrant) []models.Permission {
+	permissions := make([]models.Permission, 0)
+	for _, g := range grants {
+		if !slices.Contains(permissions, g.Permission) {
+			permissions = append(permissions, g.Permission)
+		}
+	}
+
+	return permissions
+}
+
+// createsCycle reports whether giving the role the parents would make it inherit from itself.
+// The current parents of the role do not matter, since they are replaced.
+func createsCycle(parents map[string][]string, roleID string, newParents []string) bool {
+	visited := make(map[string]bool)
+	stack := slices.Clone(newParents)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if id == roleID {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, parents[id]...)
+	}
+
+	return false
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryRoleParents returns the parent role ids by role id of every role in the SQL repos.
+// The query selects the role_id and parent_id of role_parents.
+func queryRoleParents(ctx context.Context, q querier, query string, args ...any) (map[string][]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[string][]string)
+	for rows.Next() {
+		var roleID, parentID string
+		if err := rows.Scan(&roleID, &parentID); err != nil {
+			return nil, err
+		}
+		parents[roleID] = append(parents[roleID], parentID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return parents, nil
+}
+
+// loadRoleGraph loads the role graph of the user in the org in the SQL repos.
+// Only the global roles and those of the org are included. Returns ErrNotMember if the user is not a member of the org.
+func loadRoleGraph(ctx context.Context, db *sql.DB, dialect string, userID string, orgID string) (roleGraph, error) {
+	if orgID != "" {
+		q := &listQuery{dialect: dialect}
+		query := "SELECT 1 FROM org_members WHERE org_id = " + q.arg(orgID) + " AND user_id = " + q.arg(userID) + ";"
+		var one int
+		if err := db.QueryRowContext(ctx, query, q.args...).Scan(&one); err != nil {
+			if err == sql.ErrNoRows {
+				return roleGraph{}, ErrNotMember
+			}
+			return roleGraph{}, err
+		}
+	}
+
+	// The expired assignments may not be deleted yet
+	q := &listQuery{dialect: dialect}
+	query := `SELECT ur.role_id, '', ur.expires_at
+			  FROM user_roles ur
+			  JOIN roles r ON ur.role_id = r.id
+			  WHERE ur.user_id = ` + q.arg(userID) + ` AND (r.org_id IS NULL OR r.org_id = ` + q.arg(orgID) + `)
+			  AND (ur.expires_at IS NULL OR ur.expires_at > ` + q.arg(time.Now().UTC()) + `)
+			  UNION ALL
+			  SELECT gr.role_id, gr.group_id, NULL
+			  FROM group_members gm
+			  JOIN group_roles gr ON gm.group_id = gr.group_id
+			  JOIN roles r ON gr.role_id = r.id
+			  WHERE gm.user_id = ` + q.arg(userID) + ` AND (r.org_id IS NULL OR r.org_id = ` + q.arg(orgID) + `);`
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return roleGraph{}, err
+	}
+	defer rows.Close()
+
+	var g roleGraph
+	for rows.Next() {
+		var a roleAssignment
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&a.roleID, &a.groupID, &expiresAt); err != nil {
+			return roleGraph{}, err
+		}
+		if expiresAt.Valid {
+			a.expiresAt = &expiresAt.Time
+		}
+		g.assigned = append(g.assigned, a)
+	}
+	if err := rows.Err(); err != nil {
+		return roleGraph{}, err
+	}
+
+	if len(g.assigned) == 0 {
+		return g, nil
+	}
+
+	// The hierarchy is small enough to load at once, without the parents of other orgs
+	q = &listQuery{dialect: dialect}
+	query = `SELECT rp.role_id, rp.parent_id
+			 FROM role_parents rp
+			 JOIN roles r ON rp.parent_id = r.id
+			 WHERE r.org_id IS NULL OR r.org_id = ` + q.arg(orgID) + `;`
+	if g.parents, err = queryRoleParents(ctx, db, query, q.args...); err != nil {
+		return roleGraph{}, err
+	}
+
+	q = &listQuery{dialect: dialect}
+	var placeholders []string
+	for _, roleID := range g.reachable() {
+		placeholders = append(placeholders, q.arg(roleID))
+	}
+
+	query = "SELECT role_id, p_key, p_val FROM role_permissions WHERE role_id IN (" + strings.Join(placeholders, ", ") + ");"
+	permissionRows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return roleGraph{}, err
+	}
+	defer permissionRows.Close()
+
+	g.permissions = make(map[string][]models.Permission)
+	for permissionRows.Next() {
+		var roleID string
+		var p models.Permission
+		if err := permissionRows.Scan(&roleID, &p.Key, &p.Val); err != nil {
+			return roleGraph{}, err
+		}
+		g.permissions[roleID] = append(g.permissions[roleID], p)
+	}
+	if err := permissionRows.Err(); err != nil {
+		return roleGraph{}, err
+	}
+
+	return g, nil
+}
+
+// getPermissionGrantsOfUser resolves the effective permissions of the user in the org in the SQL repos.
+func getPermissionGrantsOfUser(ctx context.Context, db *sql.DB, dialect string, userID string, orgID string) ([]models.PermissionGrant, error) {
+	g, err := loadRoleGraph(ctx, db, dialect, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.grants(), nil
+}
+
+// setRoleParents replaces the parents of the role within the transaction in the SQL repos.
+// parentsQuery selects the role_id and parent_id of all of role_parents, locking them if the database needs it.
+func setRoleParents(ctx context.Context, tx *sql.Tx, dialect string, parentsQuery string, roleID string, parentIDs []string) error {
+	for _, id := range append([]string{roleID}, parentIDs...) {
+		q := &listQuery{dialect: dialect}
+		var one int
+		if err := tx.QueryRowContext(ctx, "SELECT 1 FROM roles WHERE id = "+q.arg(id)+";", q.args...).Scan(&one); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+
+	parents, err := queryRoleParents(ctx, tx, parentsQuery)
+	if err != nil {
+		return err
+	}
+
+	if createsCycle(parents, roleID, parentIDs) {
+		return ErrCycle
+	}
+
+	q := &listQuery{dialect: dialect}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM role_parents WHERE role_id = "+q.arg(roleID)+";", q.args...); err != nil {
+		return err
+	}
+
+	for i, parentID := range parentIDs {
+		if slices.Contains(parentIDs[:i], parentID) {
+			continue
+		}
+
+		q := &listQuery{dialect: dialect}
+		query := "INSERT INTO role_parents (role_id, parent_id) VALUES(" + q.arg(roleID) + ", " + q.arg(parentID) + ");"
+		if _, err := tx.ExecContext(ctx, query, q.args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getParentsOfRole returns the parent roles of the role in the SQL repos.
+func getParentsOfRole(ctx context.Context, db *sql.DB, dialect string, roleID string) ([]models.Role, error) {
+	q := &listQuery{dialect: dialect}
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
+			  FROM role_parents rp
+			  JOIN roles r ON rp.parent_id = r.id
+			  WHERE rp.role_id = ` + q.arg(roleID) + `
+			  ORDER BY r.name;`
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// inheritingRoles returns the ids of the roles and of every role that inherits from them, directly or not.
+func inheritingRoles(parents map[string][]string, roleIDs []string) []string {
+	children := make(map[string][]string)
+	for roleID, parentIDs := range parents {
+		for _, parentID := range parentIDs {
+			children[parentID] = append(children[parentID], roleID)
+		}
+	}
+
+	var reached []string
+	queue := slices.Clone(roleIDs)
+	for len(queue) > 0 {
+		roleID := queue[0]
+		queue = queue[1:]
+		if slices.Contains(reached, roleID) {
+			continue
+		}
+		reached = append(reached, roleID)
+		queue = append(queue, children[roleID]...)
+	}
+
+	return reached
+}
+
+// getRolesWithPermissions returns, for each of the permissions, the global roles and those of the org that have or
+// inherit it in the SQL repos. The grants, parents and roles are loaded once for all of the permissions.
+func getRolesWithPermissions(ctx context.Context, db *sql.DB, dialect string, permissions []models.Permission, orgID string) ([][]models.Role, error) {
+	roles := make([][]models.Role, len(permissions))
+	for i := range roles {
+		roles[i] = make([]models.Role, 0)
+	}
+	if len(permissions) == 0 {
+		return roles, nil
+	}
+
+	// The granted permissions are patterns, so they are matched here instead of in the query
+	q := &listQuery{dialect: dialect}
+	query := `SELECT rp.role_id, rp.p_key, rp.p_val
+			  FROM role_permissions rp
+			  JOIN roles r ON rp.role_id = r.id
+			  WHERE r.org_id IS NULL OR r.org_id = ` + q.arg(orgID) + `;`
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rolePermissions := make(map[string][]models.Permission)
+	for rows.Next() {
+		var roleID string
+		var granted models.Permission
+		if err := rows.Scan(&roleID, &granted.Key, &granted.Val); err != nil {
+			return nil, err
+		}
+		rolePermissions[roleID] = append(rolePermissions[roleID], granted)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The same parents as when the permissions of a user in the org are resolved
+	q = &listQuery{dialect: dialect}
+	query = `SELECT rp.role_id, rp.parent_id
+			 FROM role_parents rp
+			 JOIN roles r ON rp.parent_id = r.id
+			 WHERE r.org_id IS NULL OR r.org_id = ` + q.arg(orgID) + `;`
+	parents, err := queryRoleParents(ctx, db, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	q = &listQuery{dialect: dialect}
+	query = `SELECT id, name, COALESCE(description, ''), COALESCE(org_id, '')
+			 FROM roles
+			 WHERE org_id IS NULL OR org_id = ` + q.arg(orgID) + `
+			 ORDER BY name;`
+	roleRows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer roleRows.Close()
+
+	var inOrg []models.Role
+	for roleRows.Next() {
+		var role models.Role
+		if err := roleRows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
+			return nil, err
+		}
+		inOrg = append(inOrg, role)
+	}
+	if err := roleRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, p := range permissions {
+		roles[i] = rolesGranting(rolePermissions, parents, inOrg, p)
+	}
+
+	return roles, nil
+}
+
+// rolesGranting returns the roles, in their order, that have a permission matching the permission or inherit one.
+// The permissions and parents are those of the roles that are considered.
+func rolesGranting(rolePermissions map[string][]models.Permission, parents map[string][]string, roles []models.Role, permission models.Permission) []models.Role {
+	var having []string
+	for roleID, granted := range rolePermissions {
+		if slices.ContainsFunc(granted, func(g models.Permission) bool { return pattern.Matches(g, permission) }) {
+			having = append(having, roleID)
+		}
+	}
+
+	granting := make([]models.Role, 0)
+	if len(having) == 0 {
+		return granting
+	}
+
+	reached := inheritingRoles(parents, having)
+	for _, role := range roles {
+		if slices.Contains(reached, role.ID) {
+			granting = append(granting, role)
+		}
+	}
+
+	return granting
+}
+
+func getUsersAffectedByRole(ctx context.Context, db *sql.DB, dialect string, roleID string) ([]models.User, error) {
+	parents, err := queryRoleParents(ctx, db, "SELECT role_id, parent_id FROM role_parents;")
+	if err != nil {
+		return nil, err
+	}
+
+	// The placeholders of MySQL and SQLite can not be repeated, so the ids are added for each use
+	roleIDs := inheritingRoles(parents, []string{roleID})
+	q := &listQuery{dialect: dialect}
+	in := func() string {
+		var placeholders []string
+		for _, id := range roleIDs {
+			placeholders = append(placeholders, q.arg(id))
+		}
+		return strings.Join(placeholders, ", ")
+	}
+
+	// Like the roles of a user, the expired assignments may not be deleted yet
+	query := `SELECT id, name, email, disabled
+			  FROM users
+			  WHERE deleted_at IS NULL AND (id IN (
+				  SELECT user_id FROM user_roles
+				  WHERE role_id IN (` + in() + `) AND (expires_at IS NULL OR expires_at > ` + q.arg(time.Now().UTC()) + `)
+			  ) OR id IN (
+				  SELECT gm.user_id
+				  FROM group_members gm
+				  JOIN group_roles gr ON gm.group_id = gr.group_id
+				  WHERE gr.role_id IN (` + in() + `)
+			  ))
+			  ORDER BY name, id;`
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// nullString is NULL for an empty string, for the optional references.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,388 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+)
+
+// ErrInvalidCursor is returned when a listing is given a cursor that was not returned by the same kind of listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type UserSort string
+
+const (
+	// The order the users were created in, the default
+	UserSortCreatedAt UserSort = "created_at"
+	UserSortEmail     UserSort = "email"
+	UserSortName      UserSort = "name"
+)
+
+type RoleSort string
+
+const (
+	// The default
+	RoleSortName RoleSort = "name"
+)
+
+type ListUsersParams struct {
+	// Only users whose email starts with the prefix, ignoring case
+	EmailPrefix string
+	// Only users whose name starts with the prefix, ignoring case
+	NamePrefix string
+	// Only users with a provider of the type
+	ProviderType models.UserProviderType
+	// Only users that are assigned the role
+	RoleID string
+	// Only users created at or after the time
+	CreatedAfter *time.Time
+	// Only users created before the time
+	CreatedBefore *time.Time
+
+	Sort       UserSort
+	Descending bool
+
+	// The maximum number of users to return, all users are returned if zero
+	Limit int
+	// Continue after the last user of a previous page, as returned by ListUsers with the same sorting
+	Cursor string
+}
+
+type ListRolesParams struct {
+	// Only roles whose name starts with the prefix, ignoring case
+	NamePrefix string
+	// Only the roles of the org, or only the global roles if it is empty. All roles are listed if it is nil.
+	OrgID *string
+
+	Sort       RoleSort
+	Descending bool
+
+	// The maximum number of roles to return, all roles are returned if zero
+	Limit int
+	// Continue after the last role of a previous page, as returned by ListRoles with the same sorting
+	Cursor string
+}
+
+// cursor is the position of the last row of a page, which the next page continues after.
+type cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	// The sort value of the row, times are formatted as RFC 3339
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes the cursor, which must have been created for the same sorting.
+// Returns nil if the cursor is empty.
+func decodeCursor(s string, sort string, descending bool) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.Descending != descending || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func (p ListUsersParams) sort() UserSort {
+	if p.Sort == "" {
+		return UserSortCreatedAt
+	}
+	return p.Sort
+}
+
+func (p ListRolesParams) sort() RoleSort {
+	if p.Sort == "" {
+		return RoleSortName
+	}
+	return p.Sort
+}
+
+// userCursor returns the cursor continuing after the user, which was created at the given time.
+func (p ListUsersParams) userCursor(user models.User, createdAt time.Time) string {
+	c := cursor{Sort: string(p.sort()), Descending: p.Descending, ID: user.ID}
+	switch p.sort() {
+	case UserSortEmail:
+		c.Value = user.Email
+	case UserSortName:
+		c.Value = user.Name
+	default:
+		c.Value = createdAt.UTC().Format(time.RFC3339Nano)
+	}
+	return c.encode()
+}
+
+func (p ListRolesParams) roleCursor(role models.Role) string {
+	return cursor{Sort: string(p.sort()), Descending: p.Descending, Value: role.Name, ID: role.ID}.encode()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, using ! as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// listQuery builds the query of a listing in the SQL repos.
+type listQuery struct {
+	dialect    string
+	conditions []string
+	args       []any
+}
+
+// arg adds an argument to the query and returns its placeholder.
+func (q *listQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	if q.dialect == "postgres" {
+		return fmt.Sprintf("$%d", len(q.args))
+	}
+	return "?"
+}
+
+// timeValue returns the time as it is compared to the timestamps of the database.
+// SQLite stores the default timestamps as text in UTC which is compared as strings.
+func (q *listQuery) timeValue(t time.Time) any {
+	if q.dialect == "sqlite" {
+		return t.UTC().Format(time.DateTime)
+	}
+	return t
+}
+
+func (q *listQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *listQuery) prefix(column string, prefix string) {
+	if prefix == "" {
+		return
+	}
+
+	// LIKE ignores the case in MySQL and SQLite
+	like := "LIKE"
+	if q.dialect == "postgres" {
+		like = "ILIKE"
+	}
+	q.where(fmt.Sprintf("%s %s %s ESCAPE '!'", column, like, q.arg(escapeLike(prefix)+"%")))
+}
+
+// after continues after the cursor, the rows are ordered by the column and then by id.
+func (q *listQuery) after(column string, c *cursor, value any) {
+	op := ">"
+	if c.Descending {
+		op = "<"
+	}
+	q.where(fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))", column, op, q.arg(value), column, q.arg(value), op, q.arg(c.ID)))
+}
+
+// build returns the query and its arguments. One more row than the limit is selected to know if there is a next page.
+func (q *listQuery) build(selectFrom string, column string, descending bool, limit int) (string, []any) {
+	query := selectFrom
+	if len(q.conditions) > 0 {
+		query += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+
+	if limit > 0 {
+		query += " LIMIT " + q.arg(limit+1)
+	}
+
+	return query + ";", q.args
+}
+
+// listUsersQuery builds the query of ListUsers in the SQL repos, it selects the id, name, email, disabled and created_at of the users.
+func listUsersQuery(dialect string, params ListUsersParams) (string, []any, error) {
+	c, err := decodeCursor(params.Cursor, string(params.sort()), params.Descending)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := &listQuery{dialect: dialect}
+	q.where("deleted_at IS NULL")
+	q.prefix("email", params.EmailPrefix)
+	q.prefix("name", params.NamePrefix)
+
+	if params.ProviderType != "" {
+		q.where("EXISTS (SELECT 1 FROM user_providers up WHERE up.user_id = users.id AND up.provider = " + q.arg(params.ProviderType) + ")")
+	}
+
+	if params.RoleID != "" {
+		q.where("EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = users.id AND ur.role_id = " + q.arg(params.RoleID) + ")")
+	}
+
+	if params.CreatedAfter != nil {
+		q.where("created_at >= " + q.arg(q.timeValue(*params.CreatedAfter)))
+	}
+
+	if params.CreatedBefore != nil {
+		q.where("created_at < " + q.arg(q.timeValue(*params.CreatedBefore)))
+	}
+
+	var column string
+	switch params.sort() {
+	case UserSortCreatedAt:
+		column = "created_at"
+		if c != nil {
+			createdAt, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return "", nil, ErrInvalidCursor
+			}
+			q.after(column, c, q.timeValue(createdAt))
+		}
+	case UserSortEmail, UserSortName:
+		column = string(params.sort())
+		if c != nil {
+			q.after(column, c, c.Value)
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown sort: %s", params.Sort)
+	}
+
+	query, args := q.build("SELECT id, name, email, disabled, created_at FROM users", column, params.Descending, params.Limit)
+	return query, args, nil
+}
+
+// listRolesQuery builds the query of ListRoles in the SQL repos, it selects the id, name, description and org id of the roles.
+func listRolesQuery(dialect string, params ListRolesParams) (string, []any, error) {
+	if params.sort() != RoleSortName {
+		return "", nil, fmt.Errorf("unknown sort: %s", params.Sort)
+	}
+
+	c, err := decodeCursor(params.Cursor, string(params.sort()), params.Descending)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := &listQuery{dialect: dialect}
+	q.prefix("name", params.NamePrefix)
+	if params.OrgID != nil {
+		if *params.OrgID == "" {
+			q.where("org_id IS NULL")
+		} else {
+			q.where("org_id = " + q.arg(*params.OrgID))
+		}
+	}
+	if c != nil {
+		q.after("name", c, c.Value)
+	}
+
+	query, args := q.build("SELECT id, name, COALESCE(description, ''), COALESCE(org_id, '') FROM roles", "name", params.Descending, params.Limit)
+	return query, args, nil
+}
+
+// listedUser is a user selected by listUsersQuery.
+type listedUser struct {
+	user      models.User
+	createdAt time.Time
+}
+
+// usersPage returns the users of the page and the cursor of the next page, which is empty if it is the last page.
+func usersPage(params ListUsersParams, listed []listedUser) ([]models.User, string) {
+	var next string
+	if params.Limit > 0 && len(listed) > params.Limit {
+		listed = listed[:params.Limit]
+		last := listed[len(listed)-1]
+		next = params.userCursor(last.user, last.createdAt)
+	}
+
+	users := make([]models.User, len(listed))
+	for i, l := range listed {
+		users[i] = l.user
+	}
+
+	return users, next
+}
+
+// rolesPage returns the roles of the page and the cursor of the next page, which is empty if it is the last page.
+func rolesPage(params ListRolesParams, roles []models.Role) ([]models.Role, string) {
+	if params.Limit > 0 && len(roles) > params.Limit {
+		roles = roles[:params.Limit]
+		return roles, params.roleCursor(roles[len(roles)-1])
+	}
+
+	return roles, ""
+}
+
+// listUsers lists the users in the SQL repos.
+func listUsers(ctx context.Context, db *sql.DB, dialect string, params ListUsersParams) ([]models.User, string, error) {
+	query, args, err := listUsersQuery(dialect, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	listed := make([]listedUser, 0)
+	for rows.Next() {
+		var l listedUser
+		if err := rows.Scan(&l.user.ID, &l.user.Name, &l.user.Email, &l.user.Disabled, &l.createdAt); err != nil {
+			return nil, "", err
+		}
+		listed = append(listed, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	users, next := usersPage(params, listed)
+	return users, next, nil
+}
+
+// listRoles lists the roles in the SQL repos.
+func listRoles(ctx context.Context, db *sql.DB, dialect string, params ListRolesParams) ([]models.Role, string, error) {
+	query, args, err := listRolesQuery(dialect, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
+			return nil, "", err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	roles, next := rolesPage(params, roles)
+	return roles, next, nil
+}
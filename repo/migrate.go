@@ -0,0 +1,387 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/migrations"
+)
+
+const (
+	// The name of the MySQL lock that is held while migrating
+	migrationLockName = "thor_schema_migrations"
+	// The id of the postgres advisory lock that is held while migrating, an arbitrary number
+	migrationLockID = 7_368_757
+	// How long to wait for another process to finish migrating
+	migrationLockTimeout = time.Minute
+)
+
+// Migration is a versioned change of the schema of the database.
+type Migration struct {
+	Version int
+	Name    string
+
+	up   string
+	down string
+}
+
+type MigrationStatus struct {
+	Migration
+	// Nil if the migration is not applied
+	AppliedAt *time.Time
+}
+
+// Migrator is implemented by the repos whose schema is managed by migrations.
+type Migrator interface {
+	// Apply the migrations that are not applied yet, in the order of their versions.
+	// Returns the applied migrations.
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	// Revert the given number of the most recently applied migrations.
+	// Returns the reverted migrations.
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	// The status of all migrations, ordered by their versions
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+// execQuerier is implemented by both *sql.Conn and *sql.Tx.
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// migrator migrates the database of a repo with the migrations of its dialect.
+type migrator struct {
+	db *sql.DB
+	// One of mysql, postgres and sqlite, which is also the directory of the migrations
+	dialect string
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadMigrations reads the migrations of the dialect, ordered by their versions.
+func loadMigrations(dialect string) ([]Migration, error) {
+	files, err := fs.Glob(migrations.FS, dialect+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFileRegexp.FindStringSubmatch(path.Base(file))
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", file)
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", file)
+		}
+
+		content, err := fs.ReadFile(migrations.FS, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	var list []Migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+
+	slices.SortFunc(list, func(a, b Migration) int { return a.Version - b.Version })
+	return list, nil
+}
+
+// splitStatements splits the migration into its statements, which end with a semicolon at the end of a line.
+// Not all drivers can execute several statements at once.
+func splitStatements(migration string) []string {
+	var statements []string
+	var current strings.Builder
+	onlyComments := true
+
+	for _, line := range strings.Split(migration, "\n") {
+		trimmed := strings.TrimSpace(line)
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			onlyComments = false
+		}
+
+		if strings.HasSuffix(trimmed, ";") && !strings.HasPrefix(trimmed, "--") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+			onlyComments = true
+		}
+	}
+
+	if !onlyComments {
+		statements = append(statements, strings.TrimSpace(current.String()))
+	}
+
+	return statements
+}
+
+// placeholder returns the placeholder of the nth argument of a query.
+func (m migrator) placeholder(n int) string {
+	if m.dialect == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// locked runs fn while holding the migration lock, so that only one process migrates the database at a time.
+// Postgres and SQLite run fn in a transaction, so that a failing migration leaves the schema as it was.
+// MySQL can not roll back changes of the schema, the migrations that were applied before the failing one are kept.
+func (m migrator) locked(ctx context.Context, fn func(db execQuerier) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect == "mysql" {
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?);", migrationLockName, int(migrationLockTimeout.Seconds())).Scan(&locked)
+		if err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		if locked.Int64 != 1 {
+			return fmt.Errorf("timed out waiting for another process to finish migrating")
+		}
+		defer conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?);", migrationLockName)
+
+		return fn(conn)
+	}
+
+	// SQLite takes the write lock of the database when the transaction begins
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if m.dialect == "postgres" {
+		// Released when the transaction ends
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1);", migrationLockID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m migrator) createVersionTable(ctx context.Context, db execQuerier) error {
+	timestamp := "TIMESTAMP"
+	if m.dialect == "postgres" {
+		timestamp = "TIMESTAMPTZ"
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at %s DEFAULT CURRENT_TIMESTAMP
+	);`, timestamp)
+
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
+
+// applied returns the applied migrations, ordered by their versions.
+// Only the version and name are set since the migration might not be known by this version of Thor.
+func (m migrator) applied(ctx context.Context, db execQuerier) ([]MigrationStatus, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []MigrationStatus
+	for rows.Next() {
+		var s MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		applied = append(applied, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func execStatements(ctx context.Context, db execQuerier, migration string) error {
+	for _, statement := range splitStatements(migration) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m migrator) MigrateUp(ctx context.Context) ([]Migration, error) {
+	all, err := loadMigrations(m.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = m.locked(ctx, func(db execQuerier) error {
+		if err := m.createVersionTable(ctx, db); err != nil {
+			return fmt.Errorf("failed to create the version table: %w", err)
+		}
+
+		applied, err := m.applied(ctx, db)
+		if err != nil {
+			return fmt.Errorf("failed to get the applied migrations: %w", err)
+		}
+
+		for _, migration := range all {
+			if slices.ContainsFunc(applied, func(s MigrationStatus) bool { return s.Version == migration.Version }) {
+				continue
+			}
+
+			if err := execStatements(ctx, db, migration.up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			query := fmt.Sprintf("INSERT INTO schema_migrations (version, name) VALUES(%s, %s);", m.placeholder(1), m.placeholder(2))
+			if _, err := db.ExecContext(ctx, query, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+func (m migrator) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	all, err := loadMigrations(m.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = m.locked(ctx, func(db execQuerier) error {
+		if err := m.createVersionTable(ctx, db); err != nil {
+			return fmt.Errorf("failed to create the version table: %w", err)
+		}
+
+		applied, err := m.applied(ctx, db)
+		if err != nil {
+			return fmt.Errorf("failed to get the applied migrations: %w", err)
+		}
+
+		slices.Reverse(applied)
+		for _, s := range applied[:min(steps, len(applied))] {
+			i := slices.IndexFunc(all, func(m Migration) bool { return m.Version == s.Version })
+			if i == -1 {
+				return fmt.Errorf("migration %d_%s is not known by this version of Thor and can not be reverted", s.Version, s.Name)
+			}
+			migration := all[i]
+
+			if err := execStatements(ctx, db, migration.down); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			query := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %s;", m.placeholder(1))
+			if _, err := db.ExecContext(ctx, query, migration.Version); err != nil {
+				return fmt.Errorf("failed to record the revert of migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+func (m migrator) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	all, err := loadMigrations(m.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = m.locked(ctx, func(db execQuerier) error {
+		if err := m.createVersionTable(ctx, db); err != nil {
+			return fmt.Errorf("failed to create the version table: %w", err)
+		}
+
+		applied, err := m.applied(ctx, db)
+		if err != nil {
+			return fmt.Errorf("failed to get the applied migrations: %w", err)
+		}
+
+		for _, migration := range all {
+			s := MigrationStatus{Migration: migration}
+			if i := slices.IndexFunc(applied, func(a MigrationStatus) bool { return a.Version == migration.Version }); i != -1 {
+				s.AppliedAt = applied[i].AppliedAt
+			}
+			statuses = append(statuses, s)
+		}
+
+		// Migrations applied by a newer version of Thor
+		for _, a := range applied {
+			if !slices.ContainsFunc(all, func(m Migration) bool { return m.Version == a.Version }) {
+				statuses = append(statuses, a)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return statuses, nil
+}
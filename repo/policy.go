@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/theleeeo/thor/models"
+)
+
+const policyColumns = "id, name, description, effect, actions, expression"
+
+func scanPolicy(row scanner) (models.Policy, error) {
+	var policy models.Policy
+	var actions string
+	if err := row.Scan(&policy.ID, &policy.Name, &policy.Description, &policy.Effect, &actions, &policy.Condition); err != nil {
+		return models.Policy{}, err
+	}
+
+	if actions != "" {
+		policy.Actions = strings.Split(actions, ",")
+	}
+
+	return policy, nil
+}
+
+// createPolicy inserts the policy in the SQL repos, the errors of the database are returned as they are.
+func createPolicy(ctx context.Context, db *sql.DB, dialect string, policy models.Policy) error {
+	q := &listQuery{dialect: dialect}
+	query := "INSERT INTO policies (" + policyColumns + ") VALUES(" +
+		strings.Join([]string{
+			q.arg(policy.ID), q.arg(policy.Name), q.arg(policy.Description), q.arg(string(policy.Effect)),
+			q.arg(strings.Join(policy.Actions, ",")), q.arg(policy.Condition),
+		}, ", ") + ");"
+	_, err := db.ExecContext(ctx, query, q.args...)
+	return err
+}
+
+func getPolicy(ctx context.Context, db *sql.DB, dialect string, id string) (models.Policy, error) {
+	q := &listQuery{dialect: dialect}
+	row := db.QueryRowContext(ctx, "SELECT "+policyColumns+" FROM policies WHERE id = "+q.arg(id)+";", q.args...)
+
+	policy, err := scanPolicy(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Policy{}, ErrNotFound
+		}
+		return models.Policy{}, err
+	}
+
+	return policy, nil
+}
+
+func listPolicies(ctx context.Context, db *sql.DB) ([]models.Policy, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+policyColumns+" FROM policies ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]models.Policy, 0)
+	for rows.Next() {
+		policy, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// updatePolicy updates the policy in the SQL repos, the errors of the database are returned as they are.
+// What the result counts as affected differs between the databases, it is left to the caller.
+func updatePolicy(ctx context.Context, db *sql.DB, dialect string, policy models.Policy) (sql.Result, error) {
+	q := &listQuery{dialect: dialect}
+	query := "UPDATE policies SET name = " + q.arg(policy.Name) + ", description = " + q.arg(policy.Description) +
+		", effect = " + q.arg(string(policy.Effect)) + ", actions = " + q.arg(strings.Join(policy.Actions, ",")) +
+		", expression = " + q.arg(policy.Condition) + " WHERE id = " + q.arg(policy.ID) + ";"
+	return db.ExecContext(ctx, query, q.args...)
+}
+
+func deletePolicy(ctx context.Context, db *sql.DB, dialect string, id string) error {
+	q := &listQuery{dialect: dialect}
+	res, err := db.ExecContext(ctx, "DELETE FROM policies WHERE id = "+q.arg(id)+";", q.args...)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/theleeeo/thor/models"
 )
@@ -12,40 +13,219 @@ type Repo interface {
 	// Perform the necessary clean up before the repo is discarded.
 	Close() error
 	Ping() error
-	// Migrate() error
 
 	// User
 	CreateUser(ctx context.Context, user models.User, provider models.UserProvider) error
+	// Create the user with a local credential of the password hash, either all of it is saved or nothing.
+	CreateUserWithPassword(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) error
 	GetUser(ctx context.Context, params GetUserParams) (models.User, error)
-	ListUsers(ctx context.Context, params ListUsersParams) ([]models.User, error)
+	// List the users matching the params and the cursor of the next page, which is empty on the last page.
+	// Returns ErrInvalidCursor if the cursor was not returned by a listing with the same sorting.
+	ListUsers(ctx context.Context, params ListUsersParams) ([]models.User, string, error)
 	GetUserByProviderID(ctx context.Context, providerID string) (models.User, error)
+	// Add a provider to the user. Returns ErrNotFound if the user does not exist and ErrAlreadyExists if the provider id is taken.
 	AddProvider(ctx context.Context, userID string, provider models.UserProvider) error
+	// Assign the role to the user. An assignment of the role that expires is made permanent.
+	// Returns ErrNotFound if the user or role does not exist and ErrAlreadyExists if it is already assigned permanently.
 	AssignRole(ctx context.Context, userID string, roleID string) error
+	// Assign the role to the user until expiresAt, an assignment of the role that expires earlier is extended.
+	// Returns ErrNotFound if the user or role does not exist and ErrAlreadyExists if it is assigned permanently
+	// or until later.
+	AssignRoleUntil(ctx context.Context, userID string, roleID string, expiresAt time.Time) error
+	// Remove the role assignments that expired before the given time. Returns the number of removed assignments.
+	DeleteExpiredRoleAssignments(ctx context.Context, before time.Time) (int, error)
 	RemoveRole(ctx context.Context, userID string, roleID string) error
 	GetProvidersOfUser(ctx context.Context, userID string) ([]models.UserProvider, error)
-	GetPermissionsOfUser(ctx context.Context, userID string) ([]models.Permission, error)
+	// The effective permissions of the user, those of its roles, of the roles of its groups and of the roles they inherit from.
+	// Expired role assignments do not count even if they are not deleted yet. Every permission is returned once. Only the global roles count unless orgID is an org the user is a member of,
+	// in which case the roles of that org count as well.
+	GetPermissionsOfUser(ctx context.Context, userID string, orgID string) ([]models.Permission, error)
+	// The effective permissions of the user in the org together with the roles they were granted through.
+	// A permission that is granted through several assigned roles is returned once for each of them.
+	GetPermissionGrantsOfUser(ctx context.Context, userID string, orgID string) ([]models.PermissionGrant, error)
+	// Update the name and email of the user. Returns ErrNotFound if the user does not exist.
+	UpdateUser(ctx context.Context, user models.User) error
+	// Returns ErrNotFound if the user does not exist.
+	SetUserDisabled(ctx context.Context, id string, disabled bool) error
+	// Disable the user and mark it as deleted at the given time. Deleted users are not returned by any method
+	// but are kept until they are purged. Returns ErrNotFound if the user does not exist.
+	SoftDeleteUser(ctx context.Context, id string, at time.Time) error
+	// Delete the users that were soft deleted before the given time, like DeleteUser. Returns the number of purged users.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error)
+	// Delete the user together with everything belonging to it. Returns ErrNotFound if the user does not exist.
+	DeleteUser(ctx context.Context, id string) error
 
 	// Role
+	// Returns ErrAlreadyExists if the name is taken, by a role of any org, and ErrNotFound if the org of the role does not exist.
 	CreateRole(ctx context.Context, role models.Role, permissions []models.Permission) error
 	GetRole(ctx context.Context, id string) (models.Role, error)
-	ListRoles(ctx context.Context, params ListRolesParams) ([]models.Role, error)
+	// List the roles matching the params and the cursor of the next page, which is empty on the last page.
+	ListRoles(ctx context.Context, params ListRolesParams) ([]models.Role, string, error)
 	GetRolesOfUser(ctx context.Context, userID string) ([]models.Role, error)
+	// The permissions of the role itself, without those it inherits.
 	GetPermissionsOfRole(ctx context.Context, roleID string) ([]models.Permission, error)
-}
+	// The roles that the role inherits the permissions of, ordered by name.
+	GetParentsOfRole(ctx context.Context, roleID string) ([]models.Role, error)
+	// Replace the parents of the role. Returns ErrNotFound if the role or a parent does not exist
+	// and ErrCycle if the role would end up inheriting from itself.
+	SetRoleParents(ctx context.Context, roleID string, parentIDs []string) error
+	// Update the name and description of the role. Returns ErrNotFound if the role does not exist.
+	UpdateRole(ctx context.Context, role models.Role) error
+	// Replace the permissions of the role. Returns ErrNotFound if the role does not exist.
+	SetRolePermissions(ctx context.Context, roleID string, permissions []models.Permission) error
+	// Remove and then add permissions of the role in one transaction. Adding a permission the role already has,
+	// or removing one it does not have, is not an error. Returns ErrNotFound if the role does not exist.
+	UpdateRolePermissions(ctx context.Context, roleID string, add, remove []models.Permission) error
+	// Delete the role, it is removed from all users. Returns ErrNotFound if the role does not exist.
+	DeleteRole(ctx context.Context, id string) error
+	// The users the role is assigned to directly, not through a group.
+	GetUsersWithRole(ctx context.Context, roleID string) ([]models.User, error)
+	// The users that get permissions from the role, directly, through their groups or through the roles
+	// inheriting it, ordered by name.
+	GetUsersAffectedByRole(ctx context.Context, roleID string) ([]models.User, error)
+	// The roles that grant each of the permissions, in the same order as the permissions.
+	// A role grants a permission by having a permission that matches it as a pattern or by inheriting one.
+	// The roles of each permission are ordered by name, and only the global roles and those of the org are included.
+	GetRolesWithPermissions(ctx context.Context, permissions []models.Permission, orgID string) ([][]models.Role, error)
 
-type GetUserParams struct {
-	ID    *string
-	Email *string
+	// Group
+	// Returns ErrAlreadyExists if the name is taken.
+	CreateGroup(ctx context.Context, group models.Group) error
+	GetGroup(ctx context.Context, id string) (models.Group, error)
+	// All groups ordered by name.
+	ListGroups(ctx context.Context) ([]models.Group, error)
+	// Update the name and description of the group. Returns ErrNotFound if the group does not exist
+	// and ErrAlreadyExists if the name is taken.
+	UpdateGroup(ctx context.Context, group models.Group) error
+	// Delete the group, its members lose the roles of the group. Returns ErrNotFound if the group does not exist.
+	DeleteGroup(ctx context.Context, id string) error
+	// Returns ErrNotFound if the group or user does not exist and ErrAlreadyExists if the user is already a member.
+	AddGroupMember(ctx context.Context, groupID string, userID string) error
+	// Returns ErrNotFound if the user is not a member of the group.
+	RemoveGroupMember(ctx context.Context, groupID string, userID string) error
+	GetGroupMembers(ctx context.Context, groupID string) ([]models.User, error)
+	// The groups the user is a member of, ordered by name.
+	GetGroupsOfUser(ctx context.Context, userID string) ([]models.Group, error)
+	// Assign the role to the group, granting it to all members. Returns ErrNotFound if the group or role
+	// does not exist and ErrAlreadyExists if it is already assigned.
+	AssignGroupRole(ctx context.Context, groupID string, roleID string) error
+	// Returns ErrNotFound if the role is not assigned to the group.
+	RemoveGroupRole(ctx context.Context, groupID string, roleID string) error
+	GetRolesOfGroup(ctx context.Context, groupID string) ([]models.Role, error)
+
+	// Org
+	// Returns ErrAlreadyExists if the name is taken.
+	CreateOrg(ctx context.Context, org models.Org) error
+	GetOrg(ctx context.Context, id string) (models.Org, error)
+	// All orgs ordered by name.
+	ListOrgs(ctx context.Context) ([]models.Org, error)
+	// Rename the org. Returns ErrNotFound if the org does not exist and ErrAlreadyExists if the name is taken.
+	UpdateOrg(ctx context.Context, org models.Org) error
+	// Delete the org together with its roles. Returns ErrNotFound if the org does not exist.
+	DeleteOrg(ctx context.Context, id string) error
+	// Returns ErrNotFound if the org or user does not exist and ErrAlreadyExists if the user is already a member.
+	AddOrgMember(ctx context.Context, orgID string, userID string) error
+	// Remove the user from the org and the roles of the org from the user.
+	// Returns ErrNotFound if the user is not a member of the org.
+	RemoveOrgMember(ctx context.Context, orgID string, userID string) error
+	GetOrgMembers(ctx context.Context, orgID string) ([]models.User, error)
+	// The orgs the user is a member of, ordered by name.
+	GetOrgsOfUser(ctx context.Context, userID string) ([]models.Org, error)
+
+	// Local credentials
+	GetLocalCredential(ctx context.Context, userID string) (models.LocalCredential, error)
+	// Set the password hash of the user, creating the credential if it does not exist.
+	// Any failed login attempts and locks are cleared.
+	SetPasswordHash(ctx context.Context, userID string, hash string) error
+	SetLoginFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error
+	// Add one to the failed login attempts of the user in one statement and return the credential after it.
+	// A lock that has expired at now is cleared and the count starts over from one.
+	// Returns ErrNotFound if the user has no local credential.
+	IncrementLoginFailures(ctx context.Context, userID string, now time.Time) (models.LocalCredential, error)
+
+	// Multi-factor authentication
+	GetTOTP(ctx context.Context, userID string) (models.TOTP, error)
+	// Set the TOTP of the user, replacing any existing one
+	SetTOTP(ctx context.Context, totp models.TOTP) error
+	// Set the invalid codes and the lock of the TOTP of the user, leaving the secret as is
+	SetMFAFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error
+	// Add one to the invalid codes of the user in one statement and return the TOTP after it.
+	// As for the login failures, a lock that has expired at now is cleared and the count starts over from one.
+	// Returns ErrNotFound if the user has no TOTP.
+	IncrementMFAFailures(ctx context.Context, userID string, now time.Time) (models.TOTP, error)
+	// Delete the TOTP and the recovery codes of the user
+	DeleteTOTP(ctx context.Context, userID string) error
+	// Replace the recovery codes of the user
+	SetRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	// Mark the recovery code as used. Returns ErrNotFound if the user has no unused code with the hash.
+	UseRecoveryCode(ctx context.Context, userID string, codeHash string) error
+
+	// WebAuthn
+	CreateWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error
+	GetWebAuthnCredentialsOfUser(ctx context.Context, userID string) ([]models.WebAuthnCredential, error)
+	// Record that the credential was used to log in, with the new signature counter and backup state
+	UpdateWebAuthnCredentialUsage(ctx context.Context, id []byte, signCount uint32, backupState bool) error
+	// Delete the credential of the user. Returns ErrNotFound if the user has no credential with the id.
+	DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error
+
+	// Provider tokens
+	// Set the token of the provider, replacing any existing one
+	SetProviderToken(ctx context.Context, token models.ProviderToken) error
+	// Get the most recently updated token of the user from the provider. Returns ErrNotFound if there is none.
+	GetProviderToken(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (models.ProviderToken, error)
+
+	// Invitations
+	// Create the invitation. Returns ErrNotFound if any of its roles does not exist.
+	CreateInvitation(ctx context.Context, invitation models.Invitation) error
+	GetInvitation(ctx context.Context, id string) (models.Invitation, error)
+	ListInvitations(ctx context.Context) ([]models.Invitation, error)
+	DeleteInvitation(ctx context.Context, id string) error
+	// Mark the invitation as accepted by the user and assign the roles of the invitation to the user.
+	// Returns ErrNotFound if there is no unaccepted invitation with the id.
+	AcceptInvitation(ctx context.Context, id string, userID string) error
+
+	// Elevation requests
+	// Create the request. Returns ErrNotFound if the user or role does not exist.
+	CreateElevationRequest(ctx context.Context, request models.ElevationRequest) error
+	GetElevationRequest(ctx context.Context, id string) (models.ElevationRequest, error)
+	// List the requests matching the params, the oldest first.
+	ListElevationRequests(ctx context.Context, params ListElevationRequestsParams) ([]models.ElevationRequest, error)
+	// Mark the request as approved and assign the role to the user until at plus the duration of the request,
+	// unless the user already has it for longer. Returns ErrNotFound if there is no pending request with the id.
+	ApproveElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error
+	// Returns ErrNotFound if there is no pending request with the id.
+	DenyElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error
+
+	// Policies
+	// Returns ErrAlreadyExists if the name is taken.
+	CreatePolicy(ctx context.Context, policy models.Policy) error
+	GetPolicy(ctx context.Context, id string) (models.Policy, error)
+	// All policies ordered by name.
+	ListPolicies(ctx context.Context) ([]models.Policy, error)
+	// Returns ErrNotFound if the policy does not exist and ErrAlreadyExists if the name is taken.
+	UpdatePolicy(ctx context.Context, policy models.Policy) error
+	// Returns ErrNotFound if the policy does not exist.
+	DeletePolicy(ctx context.Context, id string) error
 }
 
-type ListRolesParams struct {
+// ListElevationRequestsParams filters the elevation requests, the empty fields match all requests.
+type ListElevationRequestsParams struct {
+	UserID string
+	Status models.ElevationStatus
 }
 
-type ListUsersParams struct {
+type GetUserParams struct {
+	ID    *string
+	Email *string
 }
 
 type Config struct {
-	MySql *MySqlConfig `yaml:"mysql"`
+	MySql    *MySqlConfig    `yaml:"mysql"`
+	Postgres *PostgresConfig `yaml:"postgres"`
+	SQLite   *SQLiteConfig   `yaml:"sqlite"`
+
+	// Apply the migrations that are not applied yet when the repo is created
+	AutoMigrate bool `yaml:"auto-migrate"`
 }
 
 func New(cfg *Config) (Repo, error) {
@@ -54,14 +234,22 @@ func New(cfg *Config) (Repo, error) {
 		return nil, fmt.Errorf("create repo failed: %w", err)
 	}
 
-	// if err := repo.Migrate(); err != nil {
-	// 	return err
-	// }
-
 	if err := repo.Ping(); err != nil {
 		return nil, fmt.Errorf("repo ping failed: %w", err)
 	}
 
+	if m, ok := repo.(Migrator); ok && cfg.AutoMigrate {
+		applied, err := m.MigrateUp(context.Background())
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("migrate failed: %w", err)
+		}
+
+		for _, migration := range applied {
+			log.Printf("applied migration %d_%s", migration.Version, migration.Name)
+		}
+	}
+
 	return repo, nil
 }
 
@@ -75,5 +263,19 @@ func createRepo(cfg *Config) (Repo, error) {
 		return NewMySql(cfg.MySql), nil
 	}
 
+	if cfg.Postgres != nil {
+		log.Println("using postgres as repo")
+		return NewPostgres(cfg.Postgres), nil
+	}
+
+	if cfg.SQLite != nil {
+		log.Println("using sqlite as repo")
+		r, err := NewSQLite(cfg.SQLite)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
 	return nil, fmt.Errorf("no repo configuration found")
 }
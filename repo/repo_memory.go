@@ -0,0 +1,1734 @@
+package repo
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+)
+
+type memoryProvider struct {
+	userID   string
+	provider models.UserProvider
+}
+
+type memoryRecoveryCode struct {
+	hash string
+	used bool
+}
+
+type memoryRepo struct {
+	mu sync.RWMutex
+
+	// The slices are kept in the order the rows were created
+	users     []models.User
+	providers []memoryProvider
+	// When the users were created by user id
+	userCreatedAt map[string]time.Time
+	// When the soft deleted users were deleted by user id
+	userDeletedAt map[string]time.Time
+	roles         []models.Role
+	// Role ids by user id
+	userRoles map[string][]string
+	// When the role assignments that expire do so, the entries of removed assignments may be left
+	userRoleExpiry map[userRole]time.Time
+	// Permissions by role id
+	rolePermissions map[string][]models.Permission
+	// Parent role ids by role id
+	roleParents map[string][]string
+	groups      []models.Group
+	orgs        []models.Org
+	// Member user ids by org id
+	orgMembers map[string][]string
+	// Member user ids by group id
+	groupMembers map[string][]string
+	// Role ids by group id
+	groupRoles map[string][]string
+
+	localCredentials map[string]models.LocalCredential
+	totps            map[string]models.TOTP
+	recoveryCodes    map[string][]memoryRecoveryCode
+	webAuthn         []models.WebAuthnCredential
+	// Tokens by provider id
+	providerTokens map[string]models.ProviderToken
+	invitations    []models.Invitation
+	elevations     []models.ElevationRequest
+	policies       []models.Policy
+}
+
+type userRole struct {
+	userID string
+	roleID string
+}
+
+// NewMemory creates a repo implementation that keeps everything in memory.
+// It is meant for tests and trying Thor out, the data is lost when the process exits.
+func NewMemory() *memoryRepo {
+	return &memoryRepo{
+		userCreatedAt:    make(map[string]time.Time),
+		userDeletedAt:    make(map[string]time.Time),
+		userRoles:        make(map[string][]string),
+		userRoleExpiry:   make(map[userRole]time.Time),
+		rolePermissions:  make(map[string][]models.Permission),
+		roleParents:      make(map[string][]string),
+		groupMembers:     make(map[string][]string),
+		groupRoles:       make(map[string][]string),
+		orgMembers:       make(map[string][]string),
+		localCredentials: make(map[string]models.LocalCredential),
+		totps:            make(map[string]models.TOTP),
+		recoveryCodes:    make(map[string][]memoryRecoveryCode),
+		providerTokens:   make(map[string]models.ProviderToken),
+	}
+}
+
+func (r *memoryRepo) Close() error {
+	return nil
+}
+
+func (r *memoryRepo) Ping() error {
+	return nil
+}
+
+func (r *memoryRepo) userIndex(id string) int {
+	return slices.IndexFunc(r.users, func(u models.User) bool { return u.ID == id })
+}
+
+// activeUserIndex is the index of the user if it is not soft deleted.
+func (r *memoryRepo) activeUserIndex(id string) int {
+	if _, ok := r.userDeletedAt[id]; ok {
+		return -1
+	}
+	return r.userIndex(id)
+}
+
+func (r *memoryRepo) isDeleted(u models.User) bool {
+	_, ok := r.userDeletedAt[u.ID]
+	return ok
+}
+
+func (r *memoryRepo) roleIndex(id string) int {
+	return slices.IndexFunc(r.roles, func(role models.Role) bool { return role.ID == id })
+}
+
+func (r *memoryRepo) groupIndex(id string) int {
+	return slices.IndexFunc(r.groups, func(g models.Group) bool { return g.ID == id })
+}
+
+func (r *memoryRepo) orgIndex(id string) int {
+	return slices.IndexFunc(r.orgs, func(o models.Org) bool { return o.ID == id })
+}
+
+func (r *memoryRepo) providerIndex(providerID string) int {
+	return slices.IndexFunc(r.providers, func(p memoryProvider) bool { return p.provider.UserID == providerID })
+}
+
+func (r *memoryRepo) elevationIndex(id string) int {
+	return slices.IndexFunc(r.elevations, func(e models.ElevationRequest) bool { return e.ID == id })
+}
+
+func (r *memoryRepo) policyIndex(id string) int {
+	return slices.IndexFunc(r.policies, func(p models.Policy) bool { return p.ID == id })
+}
+
+func (r *memoryRepo) invitationIndex(id string) int {
+	return slices.IndexFunc(r.invitations, func(i models.Invitation) bool { return i.ID == id })
+}
+
+func (r *memoryRepo) CreateUser(_ context.Context, user models.User, provider models.UserProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(user.ID) != -1 || r.providerIndex(provider.UserID) != -1 {
+		return ErrAlreadyExists
+	}
+
+	r.users = append(r.users, user)
+	r.userCreatedAt[user.ID] = time.Now().UTC()
+	r.providers = append(r.providers, memoryProvider{userID: user.ID, provider: provider})
+	return nil
+}
+
+func (r *memoryRepo) CreateUserWithPassword(_ context.Context, user models.User, provider models.UserProvider, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(user.ID) != -1 || r.providerIndex(provider.UserID) != -1 {
+		return ErrAlreadyExists
+	}
+
+	r.users = append(r.users, user)
+	r.userCreatedAt[user.ID] = time.Now().UTC()
+	r.providers = append(r.providers, memoryProvider{userID: user.ID, provider: provider})
+	r.localCredentials[user.ID] = models.LocalCredential{UserID: user.ID, PasswordHash: passwordHash}
+	return nil
+}
+
+func (r *memoryRepo) GetUser(_ context.Context, params GetUserParams) (models.User, error) {
+	if params.ID == nil && params.Email == nil {
+		return models.User{}, fmt.Errorf("no id or email given")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if r.isDeleted(u) {
+			continue
+		}
+		if (params.ID == nil || u.ID == *params.ID) && (params.Email == nil || u.Email == *params.Email) {
+			return u, nil
+		}
+	}
+
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryRepo) ListUsers(_ context.Context, params ListUsersParams) ([]models.User, string, error) {
+	// Orders the users like the SQL repos, by the sort value and then by id
+	var compare func(a, b listedUser) int
+	switch params.sort() {
+	case UserSortCreatedAt:
+		compare = func(a, b listedUser) int { return a.createdAt.Compare(b.createdAt) }
+	case UserSortEmail:
+		compare = func(a, b listedUser) int { return strings.Compare(a.user.Email, b.user.Email) }
+	case UserSortName:
+		compare = func(a, b listedUser) int { return strings.Compare(a.user.Name, b.user.Name) }
+	default:
+		return nil, "", fmt.Errorf("unknown sort: %s", params.Sort)
+	}
+	order := func(a, b listedUser) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.user.ID, b.user.ID)
+		}
+		if params.Descending {
+			return -c
+		}
+		return c
+	}
+
+	c, err := decodeCursor(params.Cursor, string(params.sort()), params.Descending)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var after *listedUser
+	if c != nil {
+		after = &listedUser{user: models.User{ID: c.ID, Email: c.Value, Name: c.Value}}
+		if params.sort() == UserSortCreatedAt {
+			if after.createdAt, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+				return nil, "", ErrInvalidCursor
+			}
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	listed := make([]listedUser, 0)
+	for _, u := range r.users {
+		l := listedUser{user: u, createdAt: r.userCreatedAt[u.ID]}
+		if r.isDeleted(u) {
+			continue
+		}
+		if !hasPrefixFold(u.Email, params.EmailPrefix) || !hasPrefixFold(u.Name, params.NamePrefix) {
+			continue
+		}
+		if params.ProviderType != "" && !slices.ContainsFunc(r.providers, func(p memoryProvider) bool {
+			return p.userID == u.ID && p.provider.Type == params.ProviderType
+		}) {
+			continue
+		}
+		if params.RoleID != "" && !slices.Contains(r.userRoles[u.ID], params.RoleID) {
+			continue
+		}
+		if params.CreatedAfter != nil && l.createdAt.Before(*params.CreatedAfter) {
+			continue
+		}
+		if params.CreatedBefore != nil && !l.createdAt.Before(*params.CreatedBefore) {
+			continue
+		}
+		if after != nil && order(l, *after) <= 0 {
+			continue
+		}
+		listed = append(listed, l)
+	}
+
+	slices.SortFunc(listed, order)
+
+	users, next := usersPage(params, listed)
+	return users, next, nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
+
+func (r *memoryRepo) GetUserByProviderID(_ context.Context, providerID string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.providerIndex(providerID)
+	if i == -1 {
+		return models.User{}, ErrNotFound
+	}
+
+	j := r.activeUserIndex(r.providers[i].userID)
+	if j == -1 {
+		return models.User{}, ErrNotFound
+	}
+
+	return r.users[j], nil
+}
+
+func (r *memoryRepo) AddProvider(_ context.Context, userID string, provider models.UserProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	if r.providerIndex(provider.UserID) != -1 {
+		return ErrAlreadyExists
+	}
+
+	r.providers = append(r.providers, memoryProvider{userID: userID, provider: provider})
+	return nil
+}
+
+func (r *memoryRepo) AssignRole(_ context.Context, userID string, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(userID) == -1 || r.roleIndex(roleID) == -1 {
+		return ErrNotFound
+	}
+
+	if slices.Contains(r.userRoles[userID], roleID) {
+		if _, ok := r.userRoleExpiry[userRole{userID, roleID}]; !ok {
+			return ErrAlreadyExists
+		}
+		delete(r.userRoleExpiry, userRole{userID, roleID})
+		return nil
+	}
+
+	delete(r.userRoleExpiry, userRole{userID, roleID})
+	r.userRoles[userID] = append(r.userRoles[userID], roleID)
+	return nil
+}
+
+func (r *memoryRepo) AssignRoleUntil(_ context.Context, userID string, roleID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(userID) == -1 || r.roleIndex(roleID) == -1 {
+		return ErrNotFound
+	}
+
+	return r.assignRoleUntil(userID, roleID, expiresAt)
+}
+
+func (r *memoryRepo) assignRoleUntil(userID string, roleID string, expiresAt time.Time) error {
+	key := userRole{userID, roleID}
+	if slices.Contains(r.userRoles[userID], roleID) {
+		current, ok := r.userRoleExpiry[key]
+		if !ok || !current.Before(expiresAt) {
+			return ErrAlreadyExists
+		}
+	} else {
+		r.userRoles[userID] = append(r.userRoles[userID], roleID)
+	}
+
+	r.userRoleExpiry[key] = expiresAt
+	return nil
+}
+
+func (r *memoryRepo) DeleteExpiredRoleAssignments(_ context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for key, expiresAt := range r.userRoleExpiry {
+		if !expiresAt.Before(before) {
+			continue
+		}
+
+		delete(r.userRoleExpiry, key)
+		if slices.Contains(r.userRoles[key.userID], key.roleID) {
+			r.userRoles[key.userID] = slices.DeleteFunc(r.userRoles[key.userID], func(id string) bool { return id == key.roleID })
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryRepo) RemoveRole(_ context.Context, userID string, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.userRoles[userID] = slices.DeleteFunc(r.userRoles[userID], func(id string) bool { return id == roleID })
+	delete(r.userRoleExpiry, userRole{userID, roleID})
+	return nil
+}
+
+func (r *memoryRepo) GetProvidersOfUser(_ context.Context, userID string) ([]models.UserProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	providers := make([]models.UserProvider, 0)
+	for _, p := range r.providers {
+		if p.userID == userID {
+			providers = append(providers, p.provider)
+		}
+	}
+
+	return providers, nil
+}
+
+func (r *memoryRepo) GetPermissionsOfUser(_ context.Context, userID string, orgID string) ([]models.Permission, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, err := r.roleGraph(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedPermissions(g.grants()), nil
+}
+
+func (r *memoryRepo) GetPermissionGrantsOfUser(_ context.Context, userID string, orgID string) ([]models.PermissionGrant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, err := r.roleGraph(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.grants(), nil
+}
+
+func (r *memoryRepo) GetRolesWithPermissions(_ context.Context, permissions []models.Permission, orgID string) ([][]models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inOrg := func(roleID string) bool {
+		i := r.roleIndex(roleID)
+		return i != -1 && (r.roles[i].OrgID == "" || r.roles[i].OrgID == orgID)
+	}
+
+	var roles []models.Role
+	rolePermissions := make(map[string][]models.Permission)
+	for _, role := range r.roles {
+		if inOrg(role.ID) {
+			roles = append(roles, role)
+			rolePermissions[role.ID] = r.rolePermissions[role.ID]
+		}
+	}
+	slices.SortFunc(roles, func(a, b models.Role) int { return strings.Compare(a.Name, b.Name) })
+
+	parents := make(map[string][]string)
+	for roleID, parentIDs := range r.roleParents {
+		parents[roleID] = slices.DeleteFunc(slices.Clone(parentIDs), func(id string) bool { return !inOrg(id) })
+	}
+
+	granting := make([][]models.Role, len(permissions))
+	for i, p := range permissions {
+		granting[i] = rolesGranting(rolePermissions, parents, roles, p)
+	}
+
+	return granting, nil
+}
+
+// roleGraph is the graph of the global roles and those of the org.
+// Returns ErrNotMember if the user is not a member of the org.
+func (r *memoryRepo) roleGraph(userID string, orgID string) (roleGraph, error) {
+	if orgID != "" && !slices.Contains(r.orgMembers[orgID], userID) {
+		return roleGraph{}, ErrNotMember
+	}
+	inOrg := func(roleID string) bool {
+		i := r.roleIndex(roleID)
+		return i != -1 && (r.roles[i].OrgID == "" || r.roles[i].OrgID == orgID)
+	}
+
+	g := roleGraph{
+		parents:     make(map[string][]string),
+		permissions: r.rolePermissions,
+	}
+
+	for roleID, parentIDs := range r.roleParents {
+		g.parents[roleID] = slices.DeleteFunc(slices.Clone(parentIDs), func(id string) bool { return !inOrg(id) })
+	}
+
+	now := time.Now()
+	for _, roleID := range r.userRoles[userID] {
+		if !inOrg(roleID) {
+			continue
+		}
+
+		a := roleAssignment{roleID: roleID}
+		if expiresAt, ok := r.userRoleExpiry[userRole{userID, roleID}]; ok {
+			if !expiresAt.After(now) {
+				continue
+			}
+			a.expiresAt = &expiresAt
+		}
+		g.assigned = append(g.assigned, a)
+	}
+	for _, group := range r.groups {
+		if !slices.Contains(r.groupMembers[group.ID], userID) {
+			continue
+		}
+		for _, roleID := range r.groupRoles[group.ID] {
+			if inOrg(roleID) {
+				g.assigned = append(g.assigned, roleAssignment{roleID: roleID, groupID: group.ID})
+			}
+		}
+	}
+
+	return g, nil
+}
+
+func (r *memoryRepo) UpdateUser(_ context.Context, user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.activeUserIndex(user.ID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.users[i].Name = user.Name
+	r.users[i].Email = user.Email
+	return nil
+}
+
+func (r *memoryRepo) SetUserDisabled(_ context.Context, id string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.activeUserIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.users[i].Disabled = disabled
+	return nil
+}
+
+func (r *memoryRepo) SoftDeleteUser(_ context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.activeUserIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.users[i].Disabled = true
+	r.userDeletedAt[id] = at
+	return nil
+}
+
+func (r *memoryRepo) PurgeDeletedUsers(_ context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, deletedAt := range r.userDeletedAt {
+		if deletedAt.Before(before) {
+			r.deleteUser(r.userIndex(id))
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (r *memoryRepo) DeleteUser(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.userIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.deleteUser(i)
+	return nil
+}
+
+// deleteUser deletes the user at the index together with everything belonging to it.
+func (r *memoryRepo) deleteUser(i int) {
+	id := r.users[i].ID
+	r.users = slices.Delete(r.users, i, i+1)
+	delete(r.userCreatedAt, id)
+	delete(r.userDeletedAt, id)
+	r.providers = slices.DeleteFunc(r.providers, func(p memoryProvider) bool { return p.userID == id })
+	delete(r.userRoles, id)
+	isUser := func(userID string) bool { return userID == id }
+	for groupID, userIDs := range r.groupMembers {
+		r.groupMembers[groupID] = slices.DeleteFunc(userIDs, isUser)
+	}
+	for orgID, userIDs := range r.orgMembers {
+		r.orgMembers[orgID] = slices.DeleteFunc(userIDs, isUser)
+	}
+	delete(r.localCredentials, id)
+	delete(r.totps, id)
+	delete(r.recoveryCodes, id)
+	r.webAuthn = slices.DeleteFunc(r.webAuthn, func(c models.WebAuthnCredential) bool { return c.UserID == id })
+	for providerID, token := range r.providerTokens {
+		if token.UserID == id {
+			delete(r.providerTokens, providerID)
+		}
+	}
+
+	// The invitations the user accepted are kept
+	for i := range r.invitations {
+		if by := r.invitations[i].AcceptedBy; by != nil && *by == id {
+			r.invitations[i].AcceptedBy = nil
+		}
+	}
+}
+
+func (r *memoryRepo) CreateRole(_ context.Context, role models.Role, permissions []models.Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.roles, func(existing models.Role) bool { return existing.ID == role.ID || existing.Name == role.Name }) {
+		return ErrAlreadyExists
+	}
+
+	if role.OrgID != "" && r.orgIndex(role.OrgID) == -1 {
+		return ErrNotFound
+	}
+
+	for i, p := range permissions {
+		if slices.Contains(permissions[:i], p) {
+			return ErrAlreadyExists
+		}
+	}
+
+	r.roles = append(r.roles, role)
+	if len(permissions) > 0 {
+		r.rolePermissions[role.ID] = slices.Clone(permissions)
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetRole(_ context.Context, id string) (models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.roleIndex(id)
+	if i == -1 {
+		return models.Role{}, ErrNotFound
+	}
+
+	return r.roles[i], nil
+}
+
+func (r *memoryRepo) ListRoles(_ context.Context, params ListRolesParams) ([]models.Role, string, error) {
+	if params.sort() != RoleSortName {
+		return nil, "", fmt.Errorf("unknown sort: %s", params.Sort)
+	}
+
+	order := func(a, b models.Role) int {
+		c := strings.Compare(a.Name, b.Name)
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if params.Descending {
+			return -c
+		}
+		return c
+	}
+
+	c, err := decodeCursor(params.Cursor, string(params.sort()), params.Descending)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make([]models.Role, 0)
+	for _, role := range r.roles {
+		if !hasPrefixFold(role.Name, params.NamePrefix) {
+			continue
+		}
+		if params.OrgID != nil && role.OrgID != *params.OrgID {
+			continue
+		}
+		if c != nil && order(role, models.Role{ID: c.ID, Name: c.Value}) <= 0 {
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	slices.SortFunc(roles, order)
+
+	roles, next := rolesPage(params, roles)
+	return roles, next, nil
+}
+
+func (r *memoryRepo) GetRolesOfUser(_ context.Context, userID string) ([]models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make([]models.Role, 0)
+	for _, roleID := range r.userRoles[userID] {
+		roles = append(roles, r.roles[r.roleIndex(roleID)])
+	}
+
+	return roles, nil
+}
+
+func (r *memoryRepo) GetPermissionsOfRole(_ context.Context, roleID string) ([]models.Permission, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	permissions := make([]models.Permission, 0)
+	return append(permissions, r.rolePermissions[roleID]...), nil
+}
+
+func (r *memoryRepo) GetParentsOfRole(_ context.Context, roleID string) ([]models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make([]models.Role, 0)
+	for _, parentID := range r.roleParents[roleID] {
+		roles = append(roles, r.roles[r.roleIndex(parentID)])
+	}
+	slices.SortFunc(roles, func(a, b models.Role) int { return strings.Compare(a.Name, b.Name) })
+
+	return roles, nil
+}
+
+func (r *memoryRepo) SetRoleParents(_ context.Context, roleID string, parentIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roleIndex(roleID) == -1 || slices.ContainsFunc(parentIDs, func(id string) bool { return r.roleIndex(id) == -1 }) {
+		return ErrNotFound
+	}
+
+	if createsCycle(r.roleParents, roleID, parentIDs) {
+		return ErrCycle
+	}
+
+	parents := make([]string, 0, len(parentIDs))
+	for _, id := range parentIDs {
+		if !slices.Contains(parents, id) {
+			parents = append(parents, id)
+		}
+	}
+
+	if len(parents) == 0 {
+		delete(r.roleParents, roleID)
+	} else {
+		r.roleParents[roleID] = parents
+	}
+	return nil
+}
+
+func (r *memoryRepo) UpdateRole(_ context.Context, role models.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.roleIndex(role.ID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	if slices.ContainsFunc(r.roles, func(existing models.Role) bool { return existing.ID != role.ID && existing.Name == role.Name }) {
+		return ErrAlreadyExists
+	}
+
+	r.roles[i].Name = role.Name
+	r.roles[i].Description = role.Description
+	return nil
+}
+
+func (r *memoryRepo) SetRolePermissions(_ context.Context, roleID string, permissions []models.Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roleIndex(roleID) == -1 {
+		return ErrNotFound
+	}
+
+	for i, p := range permissions {
+		if slices.Contains(permissions[:i], p) {
+			return ErrAlreadyExists
+		}
+	}
+
+	r.rolePermissions[roleID] = slices.Clone(permissions)
+	return nil
+}
+
+func (r *memoryRepo) UpdateRolePermissions(_ context.Context, roleID string, add, remove []models.Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roleIndex(roleID) == -1 {
+		return ErrNotFound
+	}
+
+	permissions := slices.DeleteFunc(slices.Clone(r.rolePermissions[roleID]), func(p models.Permission) bool {
+		return slices.Contains(remove, p)
+	})
+	for _, p := range add {
+		if !slices.Contains(permissions, p) {
+			permissions = append(permissions, p)
+		}
+	}
+
+	r.rolePermissions[roleID] = permissions
+	return nil
+}
+
+func (r *memoryRepo) DeleteRole(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.roleIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.deleteRole(i)
+	return nil
+}
+
+// deleteRole deletes the role at the index and removes it from everything it is assigned to.
+func (r *memoryRepo) deleteRole(i int) {
+	id := r.roles[i].ID
+	r.roles = slices.Delete(r.roles, i, i+1)
+	delete(r.rolePermissions, id)
+	delete(r.roleParents, id)
+
+	isRole := func(roleID string) bool { return roleID == id }
+	for userID, roleIDs := range r.userRoles {
+		r.userRoles[userID] = slices.DeleteFunc(roleIDs, isRole)
+	}
+	for roleID, parentIDs := range r.roleParents {
+		r.roleParents[roleID] = slices.DeleteFunc(parentIDs, isRole)
+	}
+	for groupID, roleIDs := range r.groupRoles {
+		r.groupRoles[groupID] = slices.DeleteFunc(roleIDs, isRole)
+	}
+	for i := range r.invitations {
+		r.invitations[i].RoleIDs = slices.DeleteFunc(r.invitations[i].RoleIDs, isRole)
+	}
+}
+
+func (r *memoryRepo) GetUsersWithRole(_ context.Context, roleID string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0)
+	for _, u := range r.users {
+		if !r.isDeleted(u) && slices.Contains(r.userRoles[u.ID], roleID) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *memoryRepo) GetUsersAffectedByRole(_ context.Context, roleID string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roleIDs := inheritingRoles(r.roleParents, []string{roleID})
+	fromRole := func(id string) bool { return slices.Contains(roleIDs, id) }
+
+	now := time.Now()
+	users := make([]models.User, 0)
+	for _, u := range r.users {
+		if r.isDeleted(u) {
+			continue
+		}
+
+		affected := slices.ContainsFunc(r.userRoles[u.ID], func(id string) bool {
+			expiresAt, ok := r.userRoleExpiry[userRole{u.ID, id}]
+			return fromRole(id) && (!ok || expiresAt.After(now))
+		})
+		for groupID, memberIDs := range r.groupMembers {
+			affected = affected || (slices.Contains(memberIDs, u.ID) && slices.ContainsFunc(r.groupRoles[groupID], fromRole))
+		}
+		if affected {
+			users = append(users, u)
+		}
+	}
+	slices.SortFunc(users, func(a, b models.User) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+
+	return users, nil
+}
+
+func (r *memoryRepo) CreateGroup(_ context.Context, group models.Group) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.groups, func(existing models.Group) bool { return existing.ID == group.ID || existing.Name == group.Name }) {
+		return ErrAlreadyExists
+	}
+
+	r.groups = append(r.groups, group)
+	return nil
+}
+
+func (r *memoryRepo) GetGroup(_ context.Context, id string) (models.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.groupIndex(id)
+	if i == -1 {
+		return models.Group{}, ErrNotFound
+	}
+
+	return r.groups[i], nil
+}
+
+func (r *memoryRepo) ListGroups(_ context.Context) ([]models.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := slices.Clone(r.groups)
+	if groups == nil {
+		groups = make([]models.Group, 0)
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func sortGroups(groups []models.Group) {
+	slices.SortFunc(groups, func(a, b models.Group) int { return strings.Compare(a.Name, b.Name) })
+}
+
+func (r *memoryRepo) UpdateGroup(_ context.Context, group models.Group) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.groupIndex(group.ID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	if slices.ContainsFunc(r.groups, func(existing models.Group) bool { return existing.ID != group.ID && existing.Name == group.Name }) {
+		return ErrAlreadyExists
+	}
+
+	r.groups[i] = group
+	return nil
+}
+
+func (r *memoryRepo) DeleteGroup(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.groupIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.groups = slices.Delete(r.groups, i, i+1)
+	delete(r.groupMembers, id)
+	delete(r.groupRoles, id)
+	return nil
+}
+
+func (r *memoryRepo) AddGroupMember(_ context.Context, groupID string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.groupIndex(groupID) == -1 || r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	if slices.Contains(r.groupMembers[groupID], userID) {
+		return ErrAlreadyExists
+	}
+
+	r.groupMembers[groupID] = append(r.groupMembers[groupID], userID)
+	return nil
+}
+
+func (r *memoryRepo) RemoveGroupMember(_ context.Context, groupID string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.Index(r.groupMembers[groupID], userID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.groupMembers[groupID] = slices.Delete(r.groupMembers[groupID], i, i+1)
+	return nil
+}
+
+func (r *memoryRepo) GetGroupMembers(_ context.Context, groupID string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0)
+	for _, u := range r.users {
+		if !r.isDeleted(u) && slices.Contains(r.groupMembers[groupID], u.ID) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *memoryRepo) GetGroupsOfUser(_ context.Context, userID string) ([]models.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]models.Group, 0)
+	for _, g := range r.groups {
+		if slices.Contains(r.groupMembers[g.ID], userID) {
+			groups = append(groups, g)
+		}
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func (r *memoryRepo) AssignGroupRole(_ context.Context, groupID string, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.groupIndex(groupID) == -1 || r.roleIndex(roleID) == -1 {
+		return ErrNotFound
+	}
+
+	if slices.Contains(r.groupRoles[groupID], roleID) {
+		return ErrAlreadyExists
+	}
+
+	r.groupRoles[groupID] = append(r.groupRoles[groupID], roleID)
+	return nil
+}
+
+func (r *memoryRepo) RemoveGroupRole(_ context.Context, groupID string, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.Index(r.groupRoles[groupID], roleID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.groupRoles[groupID] = slices.Delete(r.groupRoles[groupID], i, i+1)
+	return nil
+}
+
+func (r *memoryRepo) GetRolesOfGroup(_ context.Context, groupID string) ([]models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make([]models.Role, 0)
+	for _, roleID := range r.groupRoles[groupID] {
+		roles = append(roles, r.roles[r.roleIndex(roleID)])
+	}
+
+	return roles, nil
+}
+
+func (r *memoryRepo) CreateOrg(_ context.Context, org models.Org) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.orgs, func(existing models.Org) bool { return existing.ID == org.ID || existing.Name == org.Name }) {
+		return ErrAlreadyExists
+	}
+
+	r.orgs = append(r.orgs, org)
+	return nil
+}
+
+func (r *memoryRepo) GetOrg(_ context.Context, id string) (models.Org, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.orgIndex(id)
+	if i == -1 {
+		return models.Org{}, ErrNotFound
+	}
+
+	return r.orgs[i], nil
+}
+
+func (r *memoryRepo) ListOrgs(_ context.Context) ([]models.Org, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orgs := append(make([]models.Org, 0), r.orgs...)
+	sortOrgs(orgs)
+
+	return orgs, nil
+}
+
+func sortOrgs(orgs []models.Org) {
+	slices.SortFunc(orgs, func(a, b models.Org) int { return strings.Compare(a.Name, b.Name) })
+}
+
+func (r *memoryRepo) UpdateOrg(_ context.Context, org models.Org) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.orgIndex(org.ID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	if slices.ContainsFunc(r.orgs, func(existing models.Org) bool { return existing.ID != org.ID && existing.Name == org.Name }) {
+		return ErrAlreadyExists
+	}
+
+	r.orgs[i] = org
+	return nil
+}
+
+func (r *memoryRepo) DeleteOrg(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.orgIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.orgs = slices.Delete(r.orgs, i, i+1)
+	delete(r.orgMembers, id)
+	for i := len(r.roles) - 1; i >= 0; i-- {
+		if r.roles[i].OrgID == id {
+			r.deleteRole(i)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) AddOrgMember(_ context.Context, orgID string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.orgIndex(orgID) == -1 || r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	if slices.Contains(r.orgMembers[orgID], userID) {
+		return ErrAlreadyExists
+	}
+
+	r.orgMembers[orgID] = append(r.orgMembers[orgID], userID)
+	return nil
+}
+
+func (r *memoryRepo) RemoveOrgMember(_ context.Context, orgID string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.Index(r.orgMembers[orgID], userID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.orgMembers[orgID] = slices.Delete(r.orgMembers[orgID], i, i+1)
+	r.userRoles[userID] = slices.DeleteFunc(r.userRoles[userID], func(roleID string) bool {
+		return r.roles[r.roleIndex(roleID)].OrgID == orgID
+	})
+	return nil
+}
+
+func (r *memoryRepo) GetOrgMembers(_ context.Context, orgID string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0)
+	for _, u := range r.users {
+		if !r.isDeleted(u) && slices.Contains(r.orgMembers[orgID], u.ID) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *memoryRepo) GetOrgsOfUser(_ context.Context, userID string) ([]models.Org, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orgs := make([]models.Org, 0)
+	for _, o := range r.orgs {
+		if slices.Contains(r.orgMembers[o.ID], userID) {
+			orgs = append(orgs, o)
+		}
+	}
+	sortOrgs(orgs)
+
+	return orgs, nil
+}
+
+func (r *memoryRepo) GetLocalCredential(_ context.Context, userID string) (models.LocalCredential, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cred, ok := r.localCredentials[userID]
+	if !ok {
+		return models.LocalCredential{}, ErrNotFound
+	}
+
+	return cred, nil
+}
+
+func (r *memoryRepo) SetPasswordHash(_ context.Context, userID string, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	r.localCredentials[userID] = models.LocalCredential{UserID: userID, PasswordHash: hash}
+	return nil
+}
+
+func (r *memoryRepo) SetLoginFailures(_ context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cred, ok := r.localCredentials[userID]
+	if !ok {
+		return nil
+	}
+
+	cred.FailedAttempts = failedAttempts
+	cred.LockedUntil = nil
+	if lockedUntil != nil {
+		t := *lockedUntil
+		cred.LockedUntil = &t
+	}
+	r.localCredentials[userID] = cred
+	return nil
+}
+
+func (r *memoryRepo) IncrementLoginFailures(_ context.Context, userID string, now time.Time) (models.LocalCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cred, ok := r.localCredentials[userID]
+	if !ok {
+		return models.LocalCredential{}, ErrNotFound
+	}
+
+	if cred.LockedUntil != nil && !cred.LockedUntil.After(now) {
+		cred.FailedAttempts = 0
+		cred.LockedUntil = nil
+	}
+	cred.FailedAttempts++
+	r.localCredentials[userID] = cred
+
+	return cred, nil
+}
+
+func (r *memoryRepo) GetTOTP(_ context.Context, userID string) (models.TOTP, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	totp, ok := r.totps[userID]
+	if !ok {
+		return models.TOTP{}, ErrNotFound
+	}
+
+	return totp, nil
+}
+
+func (r *memoryRepo) SetTOTP(_ context.Context, totp models.TOTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(totp.UserID) == -1 {
+		return ErrNotFound
+	}
+
+	r.totps[totp.UserID] = totp
+	return nil
+}
+
+func (r *memoryRepo) SetMFAFailures(_ context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totps[userID]
+	if !ok {
+		return nil
+	}
+
+	totp.FailedAttempts = failedAttempts
+	totp.LockedUntil = nil
+	if lockedUntil != nil {
+		t := *lockedUntil
+		totp.LockedUntil = &t
+	}
+	r.totps[userID] = totp
+	return nil
+}
+
+func (r *memoryRepo) IncrementMFAFailures(_ context.Context, userID string, now time.Time) (models.TOTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totps[userID]
+	if !ok {
+		return models.TOTP{}, ErrNotFound
+	}
+
+	if totp.LockedUntil != nil && !totp.LockedUntil.After(now) {
+		totp.FailedAttempts = 0
+		totp.LockedUntil = nil
+	}
+	totp.FailedAttempts++
+	r.totps[userID] = totp
+
+	return totp, nil
+}
+
+func (r *memoryRepo) DeleteTOTP(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.totps, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *memoryRepo) SetRecoveryCodes(_ context.Context, userID string, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	codes := make([]memoryRecoveryCode, 0, len(codeHashes))
+	for _, h := range codeHashes {
+		codes = append(codes, memoryRecoveryCode{hash: h})
+	}
+	r.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *memoryRepo) UseRecoveryCode(_ context.Context, userID string, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := r.recoveryCodes[userID]
+	i := slices.IndexFunc(codes, func(c memoryRecoveryCode) bool { return c.hash == codeHash && !c.used })
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	codes[i].used = true
+	return nil
+}
+
+func (r *memoryRepo) CreateWebAuthnCredential(_ context.Context, cred models.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(cred.UserID) == -1 {
+		return ErrNotFound
+	}
+
+	if slices.ContainsFunc(r.webAuthn, func(c models.WebAuthnCredential) bool { return bytes.Equal(c.ID, cred.ID) }) {
+		return ErrAlreadyExists
+	}
+
+	cred.ID = bytes.Clone(cred.ID)
+	cred.PublicKey = bytes.Clone(cred.PublicKey)
+	cred.AAGUID = bytes.Clone(cred.AAGUID)
+	cred.Transports = slices.Clone(cred.Transports)
+	cred.CreatedAt = time.Now()
+	cred.LastUsedAt = nil
+	r.webAuthn = append(r.webAuthn, cred)
+	return nil
+}
+
+func (r *memoryRepo) GetWebAuthnCredentialsOfUser(_ context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var creds []models.WebAuthnCredential
+	for _, c := range r.webAuthn {
+		if c.UserID == userID {
+			c.Transports = slices.Clone(c.Transports)
+			creds = append(creds, c)
+		}
+	}
+
+	return creds, nil
+}
+
+func (r *memoryRepo) UpdateWebAuthnCredentialUsage(_ context.Context, id []byte, signCount uint32, backupState bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.webAuthn, func(c models.WebAuthnCredential) bool { return bytes.Equal(c.ID, id) })
+	if i == -1 {
+		return nil
+	}
+
+	now := time.Now()
+	r.webAuthn[i].SignCount = signCount
+	r.webAuthn[i].BackupState = backupState
+	r.webAuthn[i].LastUsedAt = &now
+	return nil
+}
+
+func (r *memoryRepo) DeleteWebAuthnCredential(_ context.Context, userID string, id []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.webAuthn, func(c models.WebAuthnCredential) bool { return c.UserID == userID && bytes.Equal(c.ID, id) })
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.webAuthn = slices.Delete(r.webAuthn, i, i+1)
+	return nil
+}
+
+func (r *memoryRepo) SetProviderToken(_ context.Context, token models.ProviderToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.userIndex(token.UserID) == -1 || r.providerIndex(token.ProviderID) == -1 {
+		return ErrNotFound
+	}
+
+	token.AccessToken = bytes.Clone(token.AccessToken)
+	token.RefreshToken = bytes.Clone(token.RefreshToken)
+	if token.ExpiresAt != nil {
+		t := *token.ExpiresAt
+		token.ExpiresAt = &t
+	}
+	token.UpdatedAt = time.Now()
+	r.providerTokens[token.ProviderID] = token
+	return nil
+}
+
+func (r *memoryRepo) GetProviderToken(_ context.Context, userID string, providerType models.UserProviderType, providerName string) (models.ProviderToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *models.ProviderToken
+	for _, token := range r.providerTokens {
+		if token.UserID != userID || token.ProviderType != providerType || token.ProviderName != providerName {
+			continue
+		}
+		if latest == nil || token.UpdatedAt.After(latest.UpdatedAt) {
+			latest = &token
+		}
+	}
+
+	if latest == nil {
+		return models.ProviderToken{}, ErrNotFound
+	}
+
+	return *latest, nil
+}
+
+func (r *memoryRepo) CreateInvitation(_ context.Context, invitation models.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.invitationIndex(invitation.ID) != -1 {
+		return ErrAlreadyExists
+	}
+
+	for _, roleID := range invitation.RoleIDs {
+		if r.roleIndex(roleID) == -1 {
+			return ErrNotFound
+		}
+	}
+
+	invitation.RoleIDs = slices.Clone(invitation.RoleIDs)
+	invitation.CreatedAt = time.Now()
+	invitation.AcceptedAt = nil
+	invitation.AcceptedBy = nil
+	r.invitations = append(r.invitations, invitation)
+	return nil
+}
+
+func (r *memoryRepo) GetInvitation(_ context.Context, id string) (models.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.invitationIndex(id)
+	if i == -1 {
+		return models.Invitation{}, ErrNotFound
+	}
+
+	return copyInvitation(r.invitations[i]), nil
+}
+
+func (r *memoryRepo) ListInvitations(_ context.Context) ([]models.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var invitations []models.Invitation
+	for _, invitation := range r.invitations {
+		invitations = append(invitations, copyInvitation(invitation))
+	}
+
+	return invitations, nil
+}
+
+// copyInvitation copies the invitation so that it does not share memory with the stored one.
+func copyInvitation(invitation models.Invitation) models.Invitation {
+	invitation.RoleIDs = slices.Clone(invitation.RoleIDs)
+	if invitation.AcceptedAt != nil {
+		t := *invitation.AcceptedAt
+		invitation.AcceptedAt = &t
+	}
+	if invitation.AcceptedBy != nil {
+		by := *invitation.AcceptedBy
+		invitation.AcceptedBy = &by
+	}
+	return invitation
+}
+
+func (r *memoryRepo) DeleteInvitation(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.invitationIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.invitations = slices.Delete(r.invitations, i, i+1)
+	return nil
+}
+
+func (r *memoryRepo) AcceptInvitation(_ context.Context, id string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.invitationIndex(id)
+	if i == -1 || r.invitations[i].AcceptedAt != nil {
+		return ErrNotFound
+	}
+
+	if r.userIndex(userID) == -1 {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	r.invitations[i].AcceptedAt = &now
+	r.invitations[i].AcceptedBy = &userID
+
+	// Roles the user already has are skipped
+	for _, roleID := range r.invitations[i].RoleIDs {
+		if !slices.Contains(r.userRoles[userID], roleID) {
+			delete(r.userRoleExpiry, userRole{userID, roleID})
+			r.userRoles[userID] = append(r.userRoles[userID], roleID)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) CreateElevationRequest(_ context.Context, request models.ElevationRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.elevationIndex(request.ID) != -1 {
+		return ErrAlreadyExists
+	}
+
+	if r.userIndex(request.UserID) == -1 || r.roleIndex(request.RoleID) == -1 {
+		return ErrNotFound
+	}
+
+	r.elevations = append(r.elevations, copyElevationRequest(request))
+	return nil
+}
+
+func (r *memoryRepo) GetElevationRequest(_ context.Context, id string) (models.ElevationRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.elevationIndex(id)
+	if i == -1 {
+		return models.ElevationRequest{}, ErrNotFound
+	}
+
+	return copyElevationRequest(r.elevations[i]), nil
+}
+
+func (r *memoryRepo) ListElevationRequests(_ context.Context, params ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	requests := make([]models.ElevationRequest, 0)
+	for _, request := range r.elevations {
+		if params.UserID != "" && request.UserID != params.UserID {
+			continue
+		}
+		if params.Status != "" && request.Status != params.Status {
+			continue
+		}
+		requests = append(requests, copyElevationRequest(request))
+	}
+
+	slices.SortStableFunc(requests, func(a, b models.ElevationRequest) int { return a.RequestedAt.Compare(b.RequestedAt) })
+	return requests, nil
+}
+
+func (r *memoryRepo) ApproveElevationRequest(_ context.Context, id string, approverID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.elevationIndex(id)
+	if i == -1 || r.elevations[i].Status != models.ElevationPending {
+		return ErrNotFound
+	}
+
+	request := &r.elevations[i]
+	expiresAt := at.Add(time.Duration(request.DurationSeconds) * time.Second)
+	request.Status = models.ElevationApproved
+	request.DecidedBy = &approverID
+	request.DecidedAt = &at
+	request.ExpiresAt = &expiresAt
+
+	// The user may already have the role for longer
+	if err := r.assignRoleUntil(request.UserID, request.RoleID, expiresAt); err != nil && err != ErrAlreadyExists {
+		return err
+	}
+
+	return nil
+}
+
+func (r *memoryRepo) DenyElevationRequest(_ context.Context, id string, approverID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.elevationIndex(id)
+	if i == -1 || r.elevations[i].Status != models.ElevationPending {
+		return ErrNotFound
+	}
+
+	r.elevations[i].Status = models.ElevationDenied
+	r.elevations[i].DecidedBy = &approverID
+	r.elevations[i].DecidedAt = &at
+	return nil
+}
+
+// copyElevationRequest copies the request so that it does not share memory with the stored one.
+func copyElevationRequest(request models.ElevationRequest) models.ElevationRequest {
+	if request.DecidedBy != nil {
+		by := *request.DecidedBy
+		request.DecidedBy = &by
+	}
+	if request.DecidedAt != nil {
+		t := *request.DecidedAt
+		request.DecidedAt = &t
+	}
+	if request.ExpiresAt != nil {
+		t := *request.ExpiresAt
+		request.ExpiresAt = &t
+	}
+
+	return request
+}
+
+func (r *memoryRepo) CreatePolicy(_ context.Context, policy models.Policy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.policies, func(existing models.Policy) bool { return existing.ID == policy.ID || existing.Name == policy.Name }) {
+		return ErrAlreadyExists
+	}
+
+	policy.Actions = slices.Clone(policy.Actions)
+	r.policies = append(r.policies, policy)
+	return nil
+}
+
+func (r *memoryRepo) GetPolicy(_ context.Context, id string) (models.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.policyIndex(id)
+	if i == -1 {
+		return models.Policy{}, ErrNotFound
+	}
+
+	policy := r.policies[i]
+	policy.Actions = slices.Clone(policy.Actions)
+	return policy, nil
+}
+
+func (r *memoryRepo) ListPolicies(_ context.Context) ([]models.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policies := make([]models.Policy, 0, len(r.policies))
+	for _, policy := range r.policies {
+		policy.Actions = slices.Clone(policy.Actions)
+		policies = append(policies, policy)
+	}
+
+	slices.SortFunc(policies, func(a, b models.Policy) int { return strings.Compare(a.Name, b.Name) })
+	return policies, nil
+}
+
+func (r *memoryRepo) UpdatePolicy(_ context.Context, policy models.Policy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.policyIndex(policy.ID)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	if slices.ContainsFunc(r.policies, func(existing models.Policy) bool { return existing.ID != policy.ID && existing.Name == policy.Name }) {
+		return ErrAlreadyExists
+	}
+
+	policy.Actions = slices.Clone(policy.Actions)
+	r.policies[i] = policy
+	return nil
+}
+
+func (r *memoryRepo) DeletePolicy(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.policyIndex(id)
+	if i == -1 {
+		return ErrNotFound
+	}
+
+	r.policies = slices.Delete(r.policies, i, i+1)
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/theleeeo/thor/models"
@@ -13,29 +15,37 @@ import (
 const (
 	mysqlErrDuplicateEntry = 1062
 	mysqlErrDuplicateKey   = 1169
+	// A foreign key references a row that does not exist
+	mysqlErrNoReferencedRow = 1452
 )
 
 type MySqlConfig struct {
 	Addr     string `yaml:"addr"`
 	User     string `yaml:"user"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" json:"-"`
 	Database string `yaml:"database"`
 }
 
 type mySqlRepo struct {
 	db *sql.DB
+	migrator
 }
 
 // NewMySql creates a repo implementation for MariaDB.
 // The repo must be closed after use.
 func NewMySql(cfg *MySqlConfig) *mySqlRepo {
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s", cfg.User, cfg.Password, cfg.Addr, cfg.Database))
+	return newMySql(fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", cfg.User, cfg.Password, cfg.Addr, cfg.Database))
+}
+
+func newMySql(dsn string) *mySqlRepo {
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		panic(err.Error())
 	}
 
 	return &mySqlRepo{
-		db: db,
+		db:       db,
+		migrator: migrator{db: db, dialect: "mysql"},
 	}
 }
 
@@ -49,6 +59,15 @@ func (r *mySqlRepo) Ping() error {
 
 // CreateUser implements Repo.
 func (r *mySqlRepo) CreateUser(ctx context.Context, user models.User, provider models.UserProvider) error {
+	return r.createUser(ctx, user, provider, "")
+}
+
+func (r *mySqlRepo) CreateUserWithPassword(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) error {
+	return r.createUser(ctx, user, provider, passwordHash)
+}
+
+// createUser creates the user and its provider, and the local credential if there is a password hash, in one transaction.
+func (r *mySqlRepo) createUser(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -74,6 +93,14 @@ func (r *mySqlRepo) CreateUser(ctx context.Context, user models.User, provider m
 		return err
 	}
 
+	if passwordHash != "" {
+		_, err = tx.ExecContext(ctx, "INSERT INTO local_credentials (user_id, password_hash) VALUES(?, ?);", user.ID, passwordHash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		rollbackErr := tx.Rollback()
@@ -112,14 +139,14 @@ func (r *mySqlRepo) GetProvidersOfUser(ctx context.Context, userID string) ([]mo
 }
 
 func (r *mySqlRepo) GetUserByProviderID(ctx context.Context, providerID string) (models.User, error) {
-	query := `SELECT u.id, u.name, u.email
+	query := `SELECT u.id, u.name, u.email, u.disabled
               FROM users u 
               JOIN user_providers up ON u.id = up.user_id 
-              WHERE up.provider_id = ?;`
+              WHERE up.provider_id = ? AND u.deleted_at IS NULL;`
 	row := r.db.QueryRowContext(ctx, query, providerID)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, ErrNotFound
@@ -149,23 +176,31 @@ func (r *mySqlRepo) GetUserByProviderID(ctx context.Context, providerID string)
 }
 
 func (r *mySqlRepo) GetUser(ctx context.Context, params GetUserParams) (models.User, error) {
-	query := "SELECT id, name, email FROM users WHERE"
+	var conditions []string
 	var args []interface{}
 
 	if params.ID != nil {
-		query += " id = ?"
+		conditions = append(conditions, "id = ?")
 		args = append(args, *params.ID)
 	}
 
 	if params.Email != nil {
-		query += " email = ?"
+		conditions = append(conditions, "email = ?")
 		args = append(args, *params.Email)
 	}
 
+	if len(conditions) == 0 {
+		return models.User{}, fmt.Errorf("no id or email given")
+	}
+
+	// Deleted users are kept until they are purged but are otherwise gone
+	conditions = append(conditions, "deleted_at IS NULL")
+
+	query := "SELECT id, name, email, disabled FROM users WHERE " + strings.Join(conditions, " AND ") + ";"
 	row := r.db.QueryRowContext(ctx, query, args...)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, ErrNotFound
@@ -201,6 +236,9 @@ func (r *mySqlRepo) AddProvider(ctx context.Context, userID string, provider mod
 		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
 			return ErrAlreadyExists
 		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
 		return err
 	}
 
@@ -209,7 +247,7 @@ func (r *mySqlRepo) AddProvider(ctx context.Context, userID string, provider mod
 
 func (r *mySqlRepo) GetUserRoles(ctx context.Context, userID string) ([]models.Role, error) {
 	query := `
-		SELECT r.id, r.name
+		SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
 		FROM user_roles ur
 		JOIN roles r ON ur.role_id = r.id
 		WHERE ur.user_id = ?;
@@ -223,7 +261,7 @@ func (r *mySqlRepo) GetUserRoles(ctx context.Context, userID string) ([]models.R
 	roles := make([]models.Role, 0)
 	for rows.Next() {
 		var role models.Role
-		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
 			return nil, err
 		}
 
@@ -242,75 +280,122 @@ func (r *mySqlRepo) GetUserRoles(ctx context.Context, userID string) ([]models.R
 	return roles, nil
 }
 
-func (r *mySqlRepo) ListUsers(ctx context.Context, _ ListUsersParams) ([]models.User, error) {
-	query := "SELECT id, name, email FROM users;"
-	rows, err := r.db.QueryContext(ctx, query)
+func (r *mySqlRepo) ListUsers(ctx context.Context, params ListUsersParams) ([]models.User, string, error) {
+	return listUsers(ctx, r.db, "mysql", params)
+}
+
+func (r *mySqlRepo) GetPermissionsOfUser(ctx context.Context, userID string, orgID string) ([]models.Permission, error) {
+	grants, err := getPermissionGrantsOfUser(ctx, r.db, "mysql", userID, orgID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	users := make([]models.User, 0)
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
-			return nil, err
-		}
+	return grantedPermissions(grants), nil
+}
 
-		// p, err := r.getProvidersOfUser(ctx, user.ID)
-		// if err != nil {
-		// 	return nil, err
-		// }
-		// user.Providers = p
+func (r *mySqlRepo) GetPermissionGrantsOfUser(ctx context.Context, userID string, orgID string) ([]models.PermissionGrant, error) {
+	return getPermissionGrantsOfUser(ctx, r.db, "mysql", userID, orgID)
+}
 
-		// roles, err := r.GetUserRoles(ctx, user.ID)
-		// if err != nil {
-		// 	return nil, err
-		// }
-		// user.Roles = roles
+func (r *mySqlRepo) UpdateUser(ctx context.Context, user models.User) error {
+	query := "UPDATE users SET name = ?, email = ? WHERE id = ? AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.ID)
+	if err != nil {
+		return err
+	}
 
-		// permissions, err := r.GetUserPermissions(ctx, user.ID)
-		// if err != nil {
-		// 	return nil, err
-		// }
-		// user.Permissions = permissions
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
 
-		users = append(users, user)
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL;", user.ID)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+
+	return nil
+}
+
+func (r *mySqlRepo) SetUserDisabled(ctx context.Context, id string, disabled bool) error {
+	query := "UPDATE users SET disabled = ? WHERE id = ? AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, disabled, id)
+	if err != nil {
+		return err
 	}
 
-	return users, nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL;", id)
+	}
+
+	return nil
 }
 
-func (r *mySqlRepo) GetPermissionsOfUser(ctx context.Context, userID string) ([]models.Permission, error) {
-	query := `
-			SELECT p_key, p_val FROM user_roles ur
-			JOIN role_permissions rk ON ur.role_id = rk.role_id
-			WHERE ur.user_id = ?;
-			`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+func (r *mySqlRepo) SoftDeleteUser(ctx context.Context, id string, at time.Time) error {
+	query := "UPDATE users SET disabled = TRUE, deleted_at = ? WHERE id = ? AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, at, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	permissions := make([]models.Permission, 0)
-	for rows.Next() {
-		var k, v string
-		err = rows.Scan(&k, &v)
-		if err != nil {
-			return nil, err
-		}
-		permissions = append(permissions, models.Permission{Key: k, Val: v})
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if n == 0 {
+		return ErrNotFound
 	}
 
-	return permissions, nil
+	return nil
+}
+
+func (r *mySqlRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at < ?;", before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *mySqlRepo) DeleteUser(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// exists returns ErrNotFound if the query returns no rows.
+func (r *mySqlRepo) exists(ctx context.Context, query string, args ...any) error {
+	var one int
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&one)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
 }
 
 func (r *mySqlRepo) CreateRole(ctx context.Context, role models.Role, permissions []models.Permission) error {
@@ -319,13 +404,16 @@ func (r *mySqlRepo) CreateRole(ctx context.Context, role models.Role, permission
 		return err
 	}
 
-	roleQuery := "INSERT INTO roles (id, name) VALUES(?, ?);"
-	_, err = tx.ExecContext(ctx, roleQuery, role.ID, role.Name)
+	roleQuery := "INSERT INTO roles (id, name, description, org_id) VALUES(?, ?, ?, ?);"
+	_, err = tx.ExecContext(ctx, roleQuery, role.ID, role.Name, role.Description, nullString(role.OrgID))
 	if err != nil {
 		tx.Rollback()
 		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
 			return ErrAlreadyExists
 		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
 		return err
 	}
 
@@ -354,18 +442,51 @@ func (r *mySqlRepo) CreateRole(ctx context.Context, role models.Role, permission
 }
 
 func (r *mySqlRepo) AssignRole(ctx context.Context, userID string, roleID string) error {
+	extended, err := extendRoleAssignment(ctx, r.db, "mysql", userID, roleID, nil)
+	if err != nil || extended {
+		return err
+	}
+
 	query := "INSERT INTO user_roles (user_id, role_id) VALUES(?, ?);"
-	_, err := r.db.ExecContext(ctx, query, userID, roleID)
+	_, err = r.db.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) AssignRoleUntil(ctx context.Context, userID string, roleID string, expiresAt time.Time) error {
+	extended, err := extendRoleAssignment(ctx, r.db, "mysql", userID, roleID, &expiresAt)
+	if err != nil || extended {
+		return err
+	}
+
+	query := "INSERT INTO user_roles (user_id, role_id, expires_at) VALUES(?, ?, ?);"
+	_, err = r.db.ExecContext(ctx, query, userID, roleID, expiresAt.UTC())
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
 			return ErrAlreadyExists
 		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
 		return err
 	}
 
 	return nil
 }
 
+func (r *mySqlRepo) DeleteExpiredRoleAssignments(ctx context.Context, before time.Time) (int, error) {
+	return deleteExpiredRoleAssignments(ctx, r.db, "mysql", before)
+}
+
 func (r *mySqlRepo) RemoveRole(ctx context.Context, userID string, roleID string) error {
 	query := "DELETE FROM user_roles WHERE user_id = ? AND role_id = ?;"
 	_, err := r.db.ExecContext(ctx, query, userID, roleID)
@@ -377,11 +498,11 @@ func (r *mySqlRepo) RemoveRole(ctx context.Context, userID string, roleID string
 }
 
 func (r *mySqlRepo) GetRole(ctx context.Context, roleID string) (models.Role, error) {
-	query := "SELECT id, name FROM roles WHERE id = ?;"
+	query := "SELECT id, name, COALESCE(description, ''), COALESCE(org_id, '') FROM roles WHERE id = ?;"
 	row := r.db.QueryRowContext(ctx, query, roleID)
 
 	var role models.Role
-	err := row.Scan(&role.ID, &role.Name)
+	err := row.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Role{}, ErrNotFound
@@ -398,6 +519,146 @@ func (r *mySqlRepo) GetRole(ctx context.Context, roleID string) (models.Role, er
 	return role, nil
 }
 
+func (r *mySqlRepo) UpdateRole(ctx context.Context, role models.Role) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE roles SET name = ?, description = ? WHERE id = ?;", role.Name, role.Description, role.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM roles WHERE id = ?;", role.ID)
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) SetRolePermissions(ctx context.Context, roleID string, permissions []models.Permission) error {
+	return r.changeRolePermissions(ctx, roleID, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = ?;", roleID); err != nil {
+			return err
+		}
+
+		for _, p := range permissions {
+			query := "INSERT INTO role_permissions (role_id, p_key, p_val) VALUES(?, ?, ?);"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+					return ErrAlreadyExists
+				}
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *mySqlRepo) UpdateRolePermissions(ctx context.Context, roleID string, add, remove []models.Permission) error {
+	return r.changeRolePermissions(ctx, roleID, func(tx *sql.Tx) error {
+		for _, p := range remove {
+			query := "DELETE FROM role_permissions WHERE role_id = ? AND p_key = ? AND p_val = ?;"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range add {
+			// INSERT IGNORE would also hide values that are too long
+			query := "INSERT INTO role_permissions (role_id, p_key, p_val) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE p_val = p_val;"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// changeRolePermissions runs change in a transaction after locking the role.
+func (r *mySqlRepo) changeRolePermissions(ctx context.Context, roleID string, change func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var one int
+	if err := tx.QueryRowContext(ctx, "SELECT 1 FROM roles WHERE id = ? FOR UPDATE;", roleID).Scan(&one); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *mySqlRepo) DeleteRole(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM roles WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetUsersWithRole(ctx context.Context, roleID string) ([]models.User, error) {
+	query := `
+		SELECT u.id, u.name, u.email, u.disabled
+		FROM user_roles ur
+		JOIN users u ON ur.user_id = u.id
+		WHERE ur.role_id = ? AND u.deleted_at IS NULL;
+	`
+	return r.queryUsers(ctx, query, roleID)
+}
+
+func (r *mySqlRepo) GetUsersAffectedByRole(ctx context.Context, roleID string) ([]models.User, error) {
+	return getUsersAffectedByRole(ctx, r.db, "mysql", roleID)
+}
+
+func (r *mySqlRepo) queryUsers(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (r *mySqlRepo) GetPermissionsOfRole(ctx context.Context, roleID string) ([]models.Permission, error) {
 	query := "SELECT p_key, p_val FROM role_permissions WHERE role_id = ?;"
 	rows, err := r.db.QueryContext(ctx, query, roleID)
@@ -423,14 +684,37 @@ func (r *mySqlRepo) GetPermissionsOfRole(ctx context.Context, roleID string) ([]
 	return permissions, nil
 }
 
+func (r *mySqlRepo) GetParentsOfRole(ctx context.Context, roleID string) ([]models.Role, error) {
+	return getParentsOfRole(ctx, r.db, "mysql", roleID)
+}
+
+func (r *mySqlRepo) SetRoleParents(ctx context.Context, roleID string, parentIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the rows that are read keeps concurrent changes from creating a cycle together
+	if err := setRoleParents(ctx, tx, "mysql", "SELECT role_id, parent_id FROM role_parents FOR UPDATE;", roleID, parentIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *mySqlRepo) GetRolesOfUser(ctx context.Context, userID string) ([]models.Role, error) {
 	query := `
-		SELECT r.id, r.name
+		SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
 		FROM user_roles ur
 		JOIN roles r ON ur.role_id = r.id
 		WHERE ur.user_id = ?;
 	`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	return r.queryRoles(ctx, query, userID)
+}
+
+func (r *mySqlRepo) queryRoles(ctx context.Context, query string, args ...any) ([]models.Role, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -439,7 +723,7 @@ func (r *mySqlRepo) GetRolesOfUser(ctx context.Context, userID string) ([]models
 	roles := make([]models.Role, 0)
 	for rows.Next() {
 		var role models.Role
-		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
 			return nil, err
 		}
 
@@ -458,32 +742,1020 @@ func (r *mySqlRepo) GetRolesOfUser(ctx context.Context, userID string) ([]models
 	return roles, nil
 }
 
-func (r *mySqlRepo) ListRoles(ctx context.Context, _ ListRolesParams) ([]models.Role, error) {
-	query := "SELECT id, name FROM roles;"
-	rows, err := r.db.QueryContext(ctx, query)
+func (r *mySqlRepo) ListRoles(ctx context.Context, params ListRolesParams) ([]models.Role, string, error) {
+	return listRoles(ctx, r.db, "mysql", params)
+}
+
+func (r *mySqlRepo) CreateGroup(ctx context.Context, group models.Group) error {
+	query := "INSERT INTO `groups` (id, name, description) VALUES(?, ?, ?);"
+	if _, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.Description); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetGroup(ctx context.Context, id string) (models.Group, error) {
+	query := "SELECT id, name, COALESCE(description, '') FROM `groups` WHERE id = ?;"
+	row := r.db.QueryRowContext(ctx, query, id)
+
+	var group models.Group
+	if err := row.Scan(&group.ID, &group.Name, &group.Description); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Group{}, ErrNotFound
+		}
+		return models.Group{}, err
+	}
+
+	return group, nil
+}
+
+func (r *mySqlRepo) ListGroups(ctx context.Context) ([]models.Group, error) {
+	return r.queryGroups(ctx, "SELECT id, name, COALESCE(description, '') FROM `groups` ORDER BY name;")
+}
+
+func (r *mySqlRepo) queryGroups(ctx context.Context, query string, args ...any) ([]models.Group, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	roles := make([]models.Role, 0)
+	groups := make([]models.Group, 0)
 	for rows.Next() {
-		var role models.Role
-		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+		var group models.Group
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description); err != nil {
 			return nil, err
 		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		// permissions, err := r.getRolePermissions(ctx, role.ID)
-		// if err != nil {
-		// 	return nil, err
-		// }
-		// role.Permissions = permissions
+	return groups, nil
+}
+
+func (r *mySqlRepo) UpdateGroup(ctx context.Context, group models.Group) error {
+	query := "UPDATE `groups` SET name = ?, description = ? WHERE id = ?;"
+	res, err := r.db.ExecContext(ctx, query, group.Name, group.Description, group.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM `groups` WHERE id = ?;", group.ID)
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) DeleteGroup(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM `groups` WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) AddGroupMember(ctx context.Context, groupID string, userID string) error {
+	query := "INSERT INTO group_members (group_id, user_id) VALUES(?, ?);"
+	if _, err := r.db.ExecContext(ctx, query, groupID, userID); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) RemoveGroupMember(ctx context.Context, groupID string, userID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = ? AND user_id = ?;", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetGroupMembers(ctx context.Context, groupID string) ([]models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM group_members gm
+			  JOIN users u ON gm.user_id = u.id
+			  WHERE gm.group_id = ? AND u.deleted_at IS NULL;`
+	return r.queryUsers(ctx, query, groupID)
+}
+
+func (r *mySqlRepo) GetGroupsOfUser(ctx context.Context, userID string) ([]models.Group, error) {
+	// groups is a reserved word in MySQL
+	query := "SELECT g.id, g.name, COALESCE(g.description, '') " +
+		"FROM group_members gm " +
+		"JOIN `groups` g ON gm.group_id = g.id " +
+		"WHERE gm.user_id = ? " +
+		"ORDER BY g.name;"
+	return r.queryGroups(ctx, query, userID)
+}
+
+func (r *mySqlRepo) AssignGroupRole(ctx context.Context, groupID string, roleID string) error {
+	query := "INSERT INTO group_roles (group_id, role_id) VALUES(?, ?);"
+	if _, err := r.db.ExecContext(ctx, query, groupID, roleID); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) RemoveGroupRole(ctx context.Context, groupID string, roleID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM group_roles WHERE group_id = ? AND role_id = ?;", groupID, roleID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetRolesOfGroup(ctx context.Context, groupID string) ([]models.Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
+			  FROM group_roles gr
+			  JOIN roles r ON gr.role_id = r.id
+			  WHERE gr.group_id = ?;`
+	return r.queryRoles(ctx, query, groupID)
+}
+
+func (r *mySqlRepo) CreateOrg(ctx context.Context, org models.Org) error {
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO orgs (id, name) VALUES(?, ?);", org.ID, org.Name); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetOrg(ctx context.Context, id string) (models.Org, error) {
+	var org models.Org
+	if err := r.db.QueryRowContext(ctx, "SELECT id, name FROM orgs WHERE id = ?;", id).Scan(&org.ID, &org.Name); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Org{}, ErrNotFound
+		}
+		return models.Org{}, err
+	}
+
+	return org, nil
+}
+
+func (r *mySqlRepo) ListOrgs(ctx context.Context) ([]models.Org, error) {
+	return r.queryOrgs(ctx, "SELECT id, name FROM orgs ORDER BY name;")
+}
+
+func (r *mySqlRepo) queryOrgs(ctx context.Context, query string, args ...any) ([]models.Org, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Org, 0)
+	for rows.Next() {
+		var org models.Org
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (r *mySqlRepo) UpdateOrg(ctx context.Context, org models.Org) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE orgs SET name = ? WHERE id = ?;", org.Name, org.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM orgs WHERE id = ?;", org.ID)
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) DeleteOrg(ctx context.Context, id string) error {
+	// The roles of the org are deleted by the foreign key
+	res, err := r.db.ExecContext(ctx, "DELETE FROM orgs WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) AddOrgMember(ctx context.Context, orgID string, userID string) error {
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO org_members (org_id, user_id) VALUES(?, ?);", orgID, userID); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) RemoveOrgMember(ctx context.Context, orgID string, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM org_members WHERE org_id = ? AND user_id = ?;", orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	query := "DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE org_id = ?);"
+	if _, err := tx.ExecContext(ctx, query, userID, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *mySqlRepo) GetOrgMembers(ctx context.Context, orgID string) ([]models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM org_members om
+			  JOIN users u ON om.user_id = u.id
+			  WHERE om.org_id = ? AND u.deleted_at IS NULL;`
+	return r.queryUsers(ctx, query, orgID)
+}
+
+func (r *mySqlRepo) GetOrgsOfUser(ctx context.Context, userID string) ([]models.Org, error) {
+	query := `SELECT o.id, o.name
+			  FROM org_members om
+			  JOIN orgs o ON om.org_id = o.id
+			  WHERE om.user_id = ?
+			  ORDER BY o.name;`
+	return r.queryOrgs(ctx, query, userID)
+}
+
+func (r *mySqlRepo) GetLocalCredential(ctx context.Context, userID string) (models.LocalCredential, error) {
+	query := "SELECT user_id, password_hash, failed_attempts, locked_until FROM local_credentials WHERE user_id = ?;"
+	row := r.db.QueryRowContext(ctx, query, userID)
+
+	var cred models.LocalCredential
+	var lockedUntil sql.NullTime
+	err := row.Scan(&cred.UserID, &cred.PasswordHash, &cred.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.LocalCredential{}, ErrNotFound
+		}
+		return models.LocalCredential{}, err
+	}
+
+	if lockedUntil.Valid {
+		cred.LockedUntil = &lockedUntil.Time
+	}
+
+	return cred, nil
+}
+
+func (r *mySqlRepo) SetPasswordHash(ctx context.Context, userID string, hash string) error {
+	query := `INSERT INTO local_credentials (user_id, password_hash) VALUES(?, ?)
+			  ON DUPLICATE KEY UPDATE password_hash = VALUES(password_hash), failed_attempts = 0, locked_until = NULL;`
+	_, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) SetLoginFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	query := "UPDATE local_credentials SET failed_attempts = ?, locked_until = ? WHERE user_id = ?;"
+	_, err := r.db.ExecContext(ctx, query, failedAttempts, lockedUntil, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) IncrementLoginFailures(ctx context.Context, userID string, now time.Time) (models.LocalCredential, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.LocalCredential{}, err
+	}
+	defer tx.Rollback()
+
+	// MySQL has no RETURNING, the row stays locked by the update until it is read back.
+	// The assignments are made in order, so the count is decided before the lock is cleared.
+	query := `UPDATE local_credentials
+			  SET failed_attempts = CASE WHEN locked_until <= ? THEN 1 ELSE failed_attempts + 1 END,
+			  locked_until = CASE WHEN locked_until <= ? THEN NULL ELSE locked_until END
+			  WHERE user_id = ?;`
+	if _, err := tx.ExecContext(ctx, query, now, now, userID); err != nil {
+		return models.LocalCredential{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT user_id, password_hash, failed_attempts, locked_until FROM local_credentials WHERE user_id = ?;", userID)
+
+	var cred models.LocalCredential
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&cred.UserID, &cred.PasswordHash, &cred.FailedAttempts, &lockedUntil); err != nil {
+		if err == sql.ErrNoRows {
+			return models.LocalCredential{}, ErrNotFound
+		}
+		return models.LocalCredential{}, err
+	}
+
+	if lockedUntil.Valid {
+		cred.LockedUntil = &lockedUntil.Time
+	}
+
+	return cred, tx.Commit()
+}
+
+func (r *mySqlRepo) GetTOTP(ctx context.Context, userID string) (models.TOTP, error) {
+	query := "SELECT user_id, secret, enabled, last_used_step, failed_attempts, locked_until FROM mfa_totp WHERE user_id = ?;"
+	row := r.db.QueryRowContext(ctx, query, userID)
+
+	var totp models.TOTP
+	var lockedUntil sql.NullTime
+	err := row.Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+
+	if lockedUntil.Valid {
+		totp.LockedUntil = &lockedUntil.Time
+	}
+
+	return totp, nil
+}
+
+func (r *mySqlRepo) SetTOTP(ctx context.Context, totp models.TOTP) error {
+	query := `INSERT INTO mfa_totp (user_id, secret, enabled, last_used_step, failed_attempts, locked_until) VALUES(?, ?, ?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = VALUES(enabled), last_used_step = VALUES(last_used_step),
+			  failed_attempts = VALUES(failed_attempts), locked_until = VALUES(locked_until);`
+	_, err := r.db.ExecContext(ctx, query, totp.UserID, totp.Secret, totp.Enabled, totp.LastUsedStep, totp.FailedAttempts, totp.LockedUntil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) SetMFAFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	query := "UPDATE mfa_totp SET failed_attempts = ?, locked_until = ? WHERE user_id = ?;"
+	_, err := r.db.ExecContext(ctx, query, failedAttempts, lockedUntil, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) IncrementMFAFailures(ctx context.Context, userID string, now time.Time) (models.TOTP, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TOTP{}, err
+	}
+	defer tx.Rollback()
+
+	// Read back in the same transaction, as in IncrementLoginFailures
+	query := `UPDATE mfa_totp
+			  SET failed_attempts = CASE WHEN locked_until <= ? THEN 1 ELSE failed_attempts + 1 END,
+			  locked_until = CASE WHEN locked_until <= ? THEN NULL ELSE locked_until END
+			  WHERE user_id = ?;`
+	if _, err := tx.ExecContext(ctx, query, now, now, userID); err != nil {
+		return models.TOTP{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT user_id, secret, enabled, last_used_step, failed_attempts, locked_until FROM mfa_totp WHERE user_id = ?;", userID)
+
+	var totp models.TOTP
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &lockedUntil); err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+
+	if lockedUntil.Valid {
+		totp.LockedUntil = &lockedUntil.Time
+	}
+
+	return totp, tx.Commit()
+}
+
+func (r *mySqlRepo) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_totp WHERE user_id = ?;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) SetRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, h := range codeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES(?, ?);", userID, h)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+	query := "UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) CreateWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error {
+	query := `INSERT INTO webauthn_credentials (id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state)
+			  VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := r.db.ExecContext(ctx, query, cred.ID, cred.UserID, cred.Name, cred.PublicKey, cred.AttestationType,
+		strings.Join(cred.Transports, ","), cred.AAGUID, cred.SignCount, cred.BackupEligible, cred.BackupState)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetWebAuthnCredentialsOfUser(ctx context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	query := `SELECT id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at
+			  FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at;`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []models.WebAuthnCredential
+	for rows.Next() {
+		var cred models.WebAuthnCredential
+		var transports string
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&cred.ID, &cred.UserID, &cred.Name, &cred.PublicKey, &cred.AttestationType, &transports,
+			&cred.AAGUID, &cred.SignCount, &cred.BackupEligible, &cred.BackupState, &cred.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if transports != "" {
+			cred.Transports = strings.Split(transports, ",")
+		}
+
+		if lastUsedAt.Valid {
+			cred.LastUsedAt = &lastUsedAt.Time
+		}
+
+		creds = append(creds, cred)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
 
-		roles = append(roles, role)
+func (r *mySqlRepo) UpdateWebAuthnCredentialUsage(ctx context.Context, id []byte, signCount uint32, backupState bool) error {
+	query := "UPDATE webauthn_credentials SET sign_count = ?, backup_state = ?, last_used_at = CURRENT_TIMESTAMP WHERE id = ?;"
+	_, err := r.db.ExecContext(ctx, query, signCount, backupState, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error {
+	query := "DELETE FROM webauthn_credentials WHERE user_id = ? AND id = ?;"
+	res, err := r.db.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) SetProviderToken(ctx context.Context, token models.ProviderToken) error {
+	query := `INSERT INTO provider_tokens (provider_id, user_id, provider, provider_name, access_token, refresh_token, token_type, scope, expires_at)
+			  VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), provider = VALUES(provider), provider_name = VALUES(provider_name),
+			  access_token = VALUES(access_token), refresh_token = VALUES(refresh_token), token_type = VALUES(token_type),
+			  scope = VALUES(scope), expires_at = VALUES(expires_at);`
+	_, err := r.db.ExecContext(ctx, query, token.ProviderID, token.UserID, token.ProviderType, token.ProviderName, token.AccessToken, token.RefreshToken, token.TokenType, token.Scope, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetProviderToken(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (models.ProviderToken, error) {
+	query := `SELECT provider_id, user_id, provider, provider_name, access_token, refresh_token, token_type, scope, expires_at, updated_at
+			  FROM provider_tokens
+			  WHERE user_id = ? AND provider = ? AND provider_name = ?
+			  ORDER BY updated_at DESC LIMIT 1;`
+	row := r.db.QueryRowContext(ctx, query, userID, providerType, providerName)
+
+	var token models.ProviderToken
+	var expiresAt sql.NullTime
+	err := row.Scan(&token.ProviderID, &token.UserID, &token.ProviderType, &token.ProviderName, &token.AccessToken, &token.RefreshToken, &token.TokenType, &token.Scope, &expiresAt, &token.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ProviderToken{}, ErrNotFound
+		}
+		return models.ProviderToken{}, err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+
+	return token, nil
+}
+
+func (r *mySqlRepo) CreateInvitation(ctx context.Context, invitation models.Invitation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO invitations (id, email, invited_by, expires_at) VALUES(?, ?, ?, ?);"
+	_, err = tx.ExecContext(ctx, query, invitation.ID, invitation.Email, invitation.InvitedBy, invitation.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	for _, roleID := range invitation.RoleIDs {
+		_, err = tx.ExecContext(ctx, "INSERT INTO invitation_roles (invitation_id, role_id) VALUES(?, ?);", invitation.ID, roleID)
+		if err != nil {
+			tx.Rollback()
+			if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	query := "SELECT id, email, invited_by, created_at, expires_at, accepted_at, accepted_by FROM invitations WHERE id = ?;"
+	row := r.db.QueryRowContext(ctx, query, id)
+
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Invitation{}, ErrNotFound
+		}
+		return models.Invitation{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT role_id FROM invitation_roles WHERE invitation_id = ?;", id)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleID string
+		if err := rows.Scan(&roleID); err != nil {
+			return models.Invitation{}, err
+		}
+		invitation.RoleIDs = append(invitation.RoleIDs, roleID)
 	}
+
 	if err := rows.Err(); err != nil {
+		return models.Invitation{}, err
+	}
+
+	return invitation, nil
+}
+
+func (r *mySqlRepo) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	query := "SELECT id, email, invited_by, created_at, expires_at, accepted_at, accepted_by FROM invitations ORDER BY created_at;"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return roles, nil
+	var invitations []models.Invitation
+	index := make(map[string]int)
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[invitation.ID] = len(invitations)
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roleRows, err := r.db.QueryContext(ctx, "SELECT invitation_id, role_id FROM invitation_roles;")
+	if err != nil {
+		return nil, err
+	}
+	defer roleRows.Close()
+
+	for roleRows.Next() {
+		var invitationID, roleID string
+		if err := roleRows.Scan(&invitationID, &roleID); err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[invitationID]; ok {
+			invitations[i].RoleIDs = append(invitations[i].RoleIDs, roleID)
+		}
+	}
+
+	if err := roleRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row scanner) (models.Invitation, error) {
+	var invitation models.Invitation
+	var acceptedAt sql.NullTime
+	var acceptedBy sql.NullString
+	err := row.Scan(&invitation.ID, &invitation.Email, &invitation.InvitedBy, &invitation.CreatedAt, &invitation.ExpiresAt, &acceptedAt, &acceptedBy)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+
+	if acceptedBy.Valid {
+		invitation.AcceptedBy = &acceptedBy.String
+	}
+
+	return invitation, nil
+}
+
+func (r *mySqlRepo) DeleteInvitation(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM invitations WHERE id = ?;", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) AcceptInvitation(ctx context.Context, id string, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = ? WHERE id = ? AND accepted_at IS NULL;", userID, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+
+	// Roles the user already has are skipped
+	query := `INSERT IGNORE INTO user_roles (user_id, role_id)
+			  SELECT ?, role_id FROM invitation_roles WHERE invitation_id = ?;`
+	_, err = tx.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) CreateElevationRequest(ctx context.Context, request models.ElevationRequest) error {
+	err := createElevationRequest(ctx, r.db, "mysql", request)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == mysqlErrNoReferencedRow {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetElevationRequest(ctx context.Context, id string) (models.ElevationRequest, error) {
+	return getElevationRequest(ctx, r.db, "mysql", id)
+}
+
+func (r *mySqlRepo) ListElevationRequests(ctx context.Context, params ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	return listElevationRequests(ctx, r.db, "mysql", params)
+}
+
+func (r *mySqlRepo) ApproveElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error {
+	return r.decideElevationRequest(ctx, id, models.ElevationApproved, approverID, at)
+}
+
+func (r *mySqlRepo) DenyElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error {
+	return r.decideElevationRequest(ctx, id, models.ElevationDenied, approverID, at)
+}
+
+func (r *mySqlRepo) decideElevationRequest(ctx context.Context, id string, status models.ElevationStatus, approverID string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	request, err := decideElevationRequest(ctx, tx, "mysql", id, status, approverID, at)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if status == models.ElevationApproved {
+		// The user may already have the role for longer
+		extended, err := extendRoleAssignment(ctx, tx, "mysql", request.UserID, request.RoleID, request.ExpiresAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if !extended {
+			query := "INSERT IGNORE INTO user_roles (user_id, role_id, expires_at) VALUES(?, ?, ?);"
+			if _, err := tx.ExecContext(ctx, query, request.UserID, request.RoleID, request.ExpiresAt.UTC()); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) CreatePolicy(ctx context.Context, policy models.Policy) error {
+	if err := createPolicy(ctx, r.db, "mysql", policy); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) GetPolicy(ctx context.Context, id string) (models.Policy, error) {
+	return getPolicy(ctx, r.db, "mysql", id)
+}
+
+func (r *mySqlRepo) ListPolicies(ctx context.Context) ([]models.Policy, error) {
+	return listPolicies(ctx, r.db)
+}
+
+func (r *mySqlRepo) UpdatePolicy(ctx context.Context, policy models.Policy) error {
+	res, err := updatePolicy(ctx, r.db, "mysql", policy)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && (e.Number == mysqlErrDuplicateEntry || e.Number == mysqlErrDuplicateKey) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Rows that are not changed are not counted as affected
+	if n == 0 {
+		return r.exists(ctx, "SELECT 1 FROM policies WHERE id = ?;", policy.ID)
+	}
+
+	return nil
+}
+
+func (r *mySqlRepo) DeletePolicy(ctx context.Context, id string) error {
+	return deletePolicy(ctx, r.db, "mysql", id)
+}
+
+func (r *mySqlRepo) GetRolesWithPermissions(ctx context.Context, permissions []models.Permission, orgID string) ([][]models.Role, error) {
+	return getRolesWithPermissions(ctx, r.db, "mysql", permissions, orgID)
 }
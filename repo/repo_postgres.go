@@ -0,0 +1,1505 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/theleeeo/thor/models"
+)
+
+const (
+	postgresErrUniqueViolation     = "23505"
+	postgresErrForeignKeyViolation = "23503"
+)
+
+type PostgresConfig struct {
+	Addr     string `yaml:"addr"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password" json:"-"`
+	Database string `yaml:"database"`
+	// The sslmode of the connection, e.g. disable or verify-full. The driver defaults to require.
+	SSLMode string `yaml:"ssl-mode"`
+}
+
+// DSN returns the connection string of the configuration.
+func (c *PostgresConfig) DSN() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   c.Addr,
+		Path:   c.Database,
+	}
+
+	if c.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {c.SSLMode}}.Encode()
+	}
+
+	return u.String()
+}
+
+type postgresRepo struct {
+	db *sql.DB
+	migrator
+}
+
+// NewPostgres creates a repo implementation for PostgreSQL.
+// The repo must be closed after use.
+func NewPostgres(cfg *PostgresConfig) *postgresRepo {
+	return newPostgres(cfg.DSN())
+}
+
+func newPostgres(dsn string) *postgresRepo {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return &postgresRepo{
+		db:       db,
+		migrator: migrator{db: db, dialect: "postgres"},
+	}
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var e *pq.Error
+	return errors.As(err, &e) && e.Code == postgresErrUniqueViolation
+}
+
+func isPostgresForeignKeyViolation(err error) bool {
+	var e *pq.Error
+	return errors.As(err, &e) && e.Code == postgresErrForeignKeyViolation
+}
+
+func (r *postgresRepo) Close() error {
+	return r.db.Close()
+}
+
+func (r *postgresRepo) Ping() error {
+	return r.db.Ping()
+}
+
+func (r *postgresRepo) CreateUser(ctx context.Context, user models.User, provider models.UserProvider) error {
+	return r.createUser(ctx, user, provider, "")
+}
+
+func (r *postgresRepo) CreateUserWithPassword(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) error {
+	return r.createUser(ctx, user, provider, passwordHash)
+}
+
+// createUser creates the user and its provider, and the local credential if there is a password hash, in one transaction.
+func (r *postgresRepo) createUser(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	userQuery := "INSERT INTO users (id, name, email) VALUES($1, $2, $3);"
+	_, err = tx.ExecContext(ctx, userQuery, user.ID, user.Name, user.Email)
+	if err != nil {
+		tx.Rollback()
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	userProviderQuery := "INSERT INTO user_providers (user_id, provider, provider_id) VALUES($1, $2, $3);"
+	_, err = tx.ExecContext(ctx, userProviderQuery, user.ID, provider.Type, provider.UserID)
+	if err != nil {
+		tx.Rollback()
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	if passwordHash != "" {
+		_, err = tx.ExecContext(ctx, "INSERT INTO local_credentials (user_id, password_hash) VALUES($1, $2);", user.ID, passwordHash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetProvidersOfUser(ctx context.Context, userID string) ([]models.UserProvider, error) {
+	query := "SELECT provider, provider_id FROM user_providers WHERE user_id = $1;"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := make([]models.UserProvider, 0)
+	for rows.Next() {
+		var p models.UserProvider
+		if err := rows.Scan(&p.Type, &p.UserID); err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return providers, nil
+}
+
+func (r *postgresRepo) GetUserByProviderID(ctx context.Context, providerID string) (models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM users u
+			  JOIN user_providers up ON u.id = up.user_id
+			  WHERE up.provider_id = $1 AND u.deleted_at IS NULL;`
+	row := r.db.QueryRowContext(ctx, query, providerID)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *postgresRepo) GetUser(ctx context.Context, params GetUserParams) (models.User, error) {
+	var conditions []string
+	var args []any
+
+	if params.ID != nil {
+		args = append(args, *params.ID)
+		conditions = append(conditions, fmt.Sprintf("id = $%d", len(args)))
+	}
+
+	if params.Email != nil {
+		args = append(args, *params.Email)
+		conditions = append(conditions, fmt.Sprintf("email = $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return models.User{}, fmt.Errorf("no id or email given")
+	}
+
+	// Deleted users are kept until they are purged but are otherwise gone
+	conditions = append(conditions, "deleted_at IS NULL")
+
+	query := "SELECT id, name, email, disabled FROM users WHERE " + strings.Join(conditions, " AND ") + ";"
+	row := r.db.QueryRowContext(ctx, query, args...)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *postgresRepo) AddProvider(ctx context.Context, userID string, provider models.UserProvider) error {
+	query := "INSERT INTO user_providers (user_id, provider, provider_id) VALUES($1, $2, $3);"
+	_, err := r.db.ExecContext(ctx, query, userID, provider.Type, provider.UserID)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) ListUsers(ctx context.Context, params ListUsersParams) ([]models.User, string, error) {
+	return listUsers(ctx, r.db, "postgres", params)
+}
+
+func (r *postgresRepo) queryUsers(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *postgresRepo) GetPermissionsOfUser(ctx context.Context, userID string, orgID string) ([]models.Permission, error) {
+	grants, err := getPermissionGrantsOfUser(ctx, r.db, "postgres", userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedPermissions(grants), nil
+}
+
+func (r *postgresRepo) GetPermissionGrantsOfUser(ctx context.Context, userID string, orgID string) ([]models.PermissionGrant, error) {
+	return getPermissionGrantsOfUser(ctx, r.db, "postgres", userID, orgID)
+}
+
+func (r *postgresRepo) queryPermissions(ctx context.Context, query string, args ...any) ([]models.Permission, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make([]models.Permission, 0)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, models.Permission{Key: k, Val: v})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *postgresRepo) UpdateUser(ctx context.Context, user models.User) error {
+	query := "UPDATE users SET name = $1, email = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) DeleteUser(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// expectAffected returns ErrNotFound if no rows were affected.
+// Unlike MySQL, postgres and sqlite count the matched rows even if they were not changed.
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) SetUserDisabled(ctx context.Context, id string, disabled bool) error {
+	query := "UPDATE users SET disabled = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, disabled, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) SoftDeleteUser(ctx context.Context, id string, at time.Time) error {
+	query := "UPDATE users SET disabled = $1, deleted_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND deleted_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, true, at, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at < $1;", before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *postgresRepo) CreateRole(ctx context.Context, role models.Role, permissions []models.Permission) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	roleQuery := "INSERT INTO roles (id, name, description, org_id) VALUES($1, $2, $3, $4);"
+	_, err = tx.ExecContext(ctx, roleQuery, role.ID, role.Name, role.Description, nullString(role.OrgID))
+	if err != nil {
+		tx.Rollback()
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	for _, p := range permissions {
+		permissionQuery := "INSERT INTO role_permissions (role_id, p_key, p_val) VALUES($1, $2, $3);"
+		_, err = tx.ExecContext(ctx, permissionQuery, role.ID, p.Key, p.Val)
+		if err != nil {
+			tx.Rollback()
+			if isPostgresUniqueViolation(err) {
+				return ErrAlreadyExists
+			}
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) AssignRole(ctx context.Context, userID string, roleID string) error {
+	extended, err := extendRoleAssignment(ctx, r.db, "postgres", userID, roleID, nil)
+	if err != nil || extended {
+		return err
+	}
+
+	query := "INSERT INTO user_roles (user_id, role_id) VALUES($1, $2);"
+	_, err = r.db.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) AssignRoleUntil(ctx context.Context, userID string, roleID string, expiresAt time.Time) error {
+	extended, err := extendRoleAssignment(ctx, r.db, "postgres", userID, roleID, &expiresAt)
+	if err != nil || extended {
+		return err
+	}
+
+	query := "INSERT INTO user_roles (user_id, role_id, expires_at) VALUES($1, $2, $3);"
+	_, err = r.db.ExecContext(ctx, query, userID, roleID, expiresAt.UTC())
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) DeleteExpiredRoleAssignments(ctx context.Context, before time.Time) (int, error) {
+	return deleteExpiredRoleAssignments(ctx, r.db, "postgres", before)
+}
+
+func (r *postgresRepo) RemoveRole(ctx context.Context, userID string, roleID string) error {
+	query := "DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2;"
+	_, err := r.db.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetRole(ctx context.Context, roleID string) (models.Role, error) {
+	query := "SELECT id, name, COALESCE(description, ''), COALESCE(org_id, '') FROM roles WHERE id = $1;"
+	row := r.db.QueryRowContext(ctx, query, roleID)
+
+	var role models.Role
+	err := row.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Role{}, ErrNotFound
+		}
+		return models.Role{}, err
+	}
+
+	return role, nil
+}
+
+func (r *postgresRepo) UpdateRole(ctx context.Context, role models.Role) error {
+	query := "UPDATE roles SET name = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3;"
+	res, err := r.db.ExecContext(ctx, query, role.Name, role.Description, role.ID)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) SetRolePermissions(ctx context.Context, roleID string, permissions []models.Permission) error {
+	return r.changeRolePermissions(ctx, roleID, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = $1;", roleID); err != nil {
+			return err
+		}
+
+		for _, p := range permissions {
+			query := "INSERT INTO role_permissions (role_id, p_key, p_val) VALUES($1, $2, $3);"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				if isPostgresUniqueViolation(err) {
+					return ErrAlreadyExists
+				}
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *postgresRepo) UpdateRolePermissions(ctx context.Context, roleID string, add, remove []models.Permission) error {
+	return r.changeRolePermissions(ctx, roleID, func(tx *sql.Tx) error {
+		for _, p := range remove {
+			query := "DELETE FROM role_permissions WHERE role_id = $1 AND p_key = $2 AND p_val = $3;"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range add {
+			query := "INSERT INTO role_permissions (role_id, p_key, p_val) VALUES($1, $2, $3) ON CONFLICT DO NOTHING;"
+			if _, err := tx.ExecContext(ctx, query, roleID, p.Key, p.Val); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// changeRolePermissions runs change in a transaction after locking the role.
+func (r *postgresRepo) changeRolePermissions(ctx context.Context, roleID string, change func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var one int
+	if err := tx.QueryRowContext(ctx, "SELECT 1 FROM roles WHERE id = $1 FOR UPDATE;", roleID).Scan(&one); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepo) DeleteRole(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM roles WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) GetUsersWithRole(ctx context.Context, roleID string) ([]models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM user_roles ur
+			  JOIN users u ON ur.user_id = u.id
+			  WHERE ur.role_id = $1 AND u.deleted_at IS NULL;`
+	return r.queryUsers(ctx, query, roleID)
+}
+
+func (r *postgresRepo) GetUsersAffectedByRole(ctx context.Context, roleID string) ([]models.User, error) {
+	return getUsersAffectedByRole(ctx, r.db, "postgres", roleID)
+}
+
+func (r *postgresRepo) GetPermissionsOfRole(ctx context.Context, roleID string) ([]models.Permission, error) {
+	return r.queryPermissions(ctx, "SELECT p_key, p_val FROM role_permissions WHERE role_id = $1;", roleID)
+}
+
+func (r *postgresRepo) GetParentsOfRole(ctx context.Context, roleID string) ([]models.Role, error) {
+	return getParentsOfRole(ctx, r.db, "postgres", roleID)
+}
+
+func (r *postgresRepo) SetRoleParents(ctx context.Context, roleID string, parentIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Concurrent changes could otherwise create a cycle together
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE role_parents IN SHARE ROW EXCLUSIVE MODE;"); err != nil {
+		return err
+	}
+
+	if err := setRoleParents(ctx, tx, "postgres", "SELECT role_id, parent_id FROM role_parents;", roleID, parentIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepo) GetRolesOfUser(ctx context.Context, userID string) ([]models.Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
+			  FROM user_roles ur
+			  JOIN roles r ON ur.role_id = r.id
+			  WHERE ur.user_id = $1;`
+	return r.queryRoles(ctx, query, userID)
+}
+
+func (r *postgresRepo) ListRoles(ctx context.Context, params ListRolesParams) ([]models.Role, string, error) {
+	return listRoles(ctx, r.db, "postgres", params)
+}
+
+func (r *postgresRepo) queryRoles(ctx context.Context, query string, args ...any) ([]models.Role, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.OrgID); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *postgresRepo) CreateGroup(ctx context.Context, group models.Group) error {
+	query := "INSERT INTO groups (id, name, description) VALUES($1, $2, $3);"
+	if _, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.Description); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetGroup(ctx context.Context, id string) (models.Group, error) {
+	query := "SELECT id, name, COALESCE(description, '') FROM groups WHERE id = $1;"
+	row := r.db.QueryRowContext(ctx, query, id)
+
+	var group models.Group
+	if err := row.Scan(&group.ID, &group.Name, &group.Description); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Group{}, ErrNotFound
+		}
+		return models.Group{}, err
+	}
+
+	return group, nil
+}
+
+func (r *postgresRepo) ListGroups(ctx context.Context) ([]models.Group, error) {
+	return r.queryGroups(ctx, "SELECT id, name, COALESCE(description, '') FROM groups ORDER BY name;")
+}
+
+func (r *postgresRepo) queryGroups(ctx context.Context, query string, args ...any) ([]models.Group, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]models.Group, 0)
+	for rows.Next() {
+		var group models.Group
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (r *postgresRepo) UpdateGroup(ctx context.Context, group models.Group) error {
+	query := "UPDATE groups SET name = $1, description = $2 WHERE id = $3;"
+	res, err := r.db.ExecContext(ctx, query, group.Name, group.Description, group.ID)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) DeleteGroup(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM groups WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) AddGroupMember(ctx context.Context, groupID string, userID string) error {
+	query := "INSERT INTO group_members (group_id, user_id) VALUES($1, $2);"
+	if _, err := r.db.ExecContext(ctx, query, groupID, userID); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) RemoveGroupMember(ctx context.Context, groupID string, userID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = $1 AND user_id = $2;", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) GetGroupMembers(ctx context.Context, groupID string) ([]models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM group_members gm
+			  JOIN users u ON gm.user_id = u.id
+			  WHERE gm.group_id = $1 AND u.deleted_at IS NULL;`
+	return r.queryUsers(ctx, query, groupID)
+}
+
+func (r *postgresRepo) GetGroupsOfUser(ctx context.Context, userID string) ([]models.Group, error) {
+	query := `SELECT g.id, g.name, COALESCE(g.description, '')
+			  FROM group_members gm
+			  JOIN groups g ON gm.group_id = g.id
+			  WHERE gm.user_id = $1
+			  ORDER BY g.name;`
+	return r.queryGroups(ctx, query, userID)
+}
+
+func (r *postgresRepo) AssignGroupRole(ctx context.Context, groupID string, roleID string) error {
+	query := "INSERT INTO group_roles (group_id, role_id) VALUES($1, $2);"
+	if _, err := r.db.ExecContext(ctx, query, groupID, roleID); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) RemoveGroupRole(ctx context.Context, groupID string, roleID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM group_roles WHERE group_id = $1 AND role_id = $2;", groupID, roleID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) GetRolesOfGroup(ctx context.Context, groupID string) ([]models.Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(r.org_id, '')
+			  FROM group_roles gr
+			  JOIN roles r ON gr.role_id = r.id
+			  WHERE gr.group_id = $1;`
+	return r.queryRoles(ctx, query, groupID)
+}
+
+func (r *postgresRepo) CreateOrg(ctx context.Context, org models.Org) error {
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO orgs (id, name) VALUES($1, $2);", org.ID, org.Name); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetOrg(ctx context.Context, id string) (models.Org, error) {
+	var org models.Org
+	if err := r.db.QueryRowContext(ctx, "SELECT id, name FROM orgs WHERE id = $1;", id).Scan(&org.ID, &org.Name); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Org{}, ErrNotFound
+		}
+		return models.Org{}, err
+	}
+
+	return org, nil
+}
+
+func (r *postgresRepo) ListOrgs(ctx context.Context) ([]models.Org, error) {
+	return r.queryOrgs(ctx, "SELECT id, name FROM orgs ORDER BY name;")
+}
+
+func (r *postgresRepo) queryOrgs(ctx context.Context, query string, args ...any) ([]models.Org, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Org, 0)
+	for rows.Next() {
+		var org models.Org
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (r *postgresRepo) UpdateOrg(ctx context.Context, org models.Org) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE orgs SET name = $1 WHERE id = $2;", org.Name, org.ID)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) DeleteOrg(ctx context.Context, id string) error {
+	// The roles of the org are deleted by the foreign key
+	res, err := r.db.ExecContext(ctx, "DELETE FROM orgs WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) AddOrgMember(ctx context.Context, orgID string, userID string) error {
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO org_members (org_id, user_id) VALUES($1, $2);", orgID, userID); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) RemoveOrgMember(ctx context.Context, orgID string, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM org_members WHERE org_id = $1 AND user_id = $2;", orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := expectAffected(res); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM user_roles WHERE user_id = $1 AND role_id IN (SELECT id FROM roles WHERE org_id = $2);"
+	if _, err := tx.ExecContext(ctx, query, userID, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepo) GetOrgMembers(ctx context.Context, orgID string) ([]models.User, error) {
+	query := `SELECT u.id, u.name, u.email, u.disabled
+			  FROM org_members om
+			  JOIN users u ON om.user_id = u.id
+			  WHERE om.org_id = $1 AND u.deleted_at IS NULL;`
+	return r.queryUsers(ctx, query, orgID)
+}
+
+func (r *postgresRepo) GetOrgsOfUser(ctx context.Context, userID string) ([]models.Org, error) {
+	query := `SELECT o.id, o.name
+			  FROM org_members om
+			  JOIN orgs o ON om.org_id = o.id
+			  WHERE om.user_id = $1
+			  ORDER BY o.name;`
+	return r.queryOrgs(ctx, query, userID)
+}
+
+func (r *postgresRepo) GetLocalCredential(ctx context.Context, userID string) (models.LocalCredential, error) {
+	query := "SELECT user_id, password_hash, failed_attempts, locked_until FROM local_credentials WHERE user_id = $1;"
+	row := r.db.QueryRowContext(ctx, query, userID)
+
+	var cred models.LocalCredential
+	var lockedUntil sql.NullTime
+	err := row.Scan(&cred.UserID, &cred.PasswordHash, &cred.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.LocalCredential{}, ErrNotFound
+		}
+		return models.LocalCredential{}, err
+	}
+
+	if lockedUntil.Valid {
+		cred.LockedUntil = &lockedUntil.Time
+	}
+
+	return cred, nil
+}
+
+func (r *postgresRepo) SetPasswordHash(ctx context.Context, userID string, hash string) error {
+	query := `INSERT INTO local_credentials (user_id, password_hash) VALUES($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, failed_attempts = 0, locked_until = NULL,
+			  updated_at = CURRENT_TIMESTAMP;`
+	_, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) SetLoginFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	query := "UPDATE local_credentials SET failed_attempts = $1, locked_until = $2, updated_at = CURRENT_TIMESTAMP WHERE user_id = $3;"
+	_, err := r.db.ExecContext(ctx, query, failedAttempts, lockedUntil, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) IncrementLoginFailures(ctx context.Context, userID string, now time.Time) (models.LocalCredential, error) {
+	query := `UPDATE local_credentials
+			  SET failed_attempts = CASE WHEN locked_until <= $1 THEN 1 ELSE failed_attempts + 1 END,
+			  locked_until = CASE WHEN locked_until <= $1 THEN NULL ELSE locked_until END, updated_at = CURRENT_TIMESTAMP
+			  WHERE user_id = $2
+			  RETURNING user_id, password_hash, failed_attempts, locked_until;`
+	row := r.db.QueryRowContext(ctx, query, now, userID)
+
+	var cred models.LocalCredential
+	var lockedUntil sql.NullTime
+	err := row.Scan(&cred.UserID, &cred.PasswordHash, &cred.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.LocalCredential{}, ErrNotFound
+		}
+		return models.LocalCredential{}, err
+	}
+
+	if lockedUntil.Valid {
+		cred.LockedUntil = &lockedUntil.Time
+	}
+
+	return cred, nil
+}
+
+func (r *postgresRepo) GetTOTP(ctx context.Context, userID string) (models.TOTP, error) {
+	query := "SELECT user_id, secret, enabled, last_used_step, failed_attempts, locked_until FROM mfa_totp WHERE user_id = $1;"
+	row := r.db.QueryRowContext(ctx, query, userID)
+
+	var totp models.TOTP
+	var lockedUntil sql.NullTime
+	err := row.Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+
+	if lockedUntil.Valid {
+		totp.LockedUntil = &lockedUntil.Time
+	}
+
+	return totp, nil
+}
+
+func (r *postgresRepo) SetTOTP(ctx context.Context, totp models.TOTP) error {
+	query := `INSERT INTO mfa_totp (user_id, secret, enabled, last_used_step, failed_attempts, locked_until) VALUES($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = EXCLUDED.enabled, last_used_step = EXCLUDED.last_used_step,
+			  failed_attempts = EXCLUDED.failed_attempts, locked_until = EXCLUDED.locked_until;`
+	_, err := r.db.ExecContext(ctx, query, totp.UserID, totp.Secret, totp.Enabled, totp.LastUsedStep, totp.FailedAttempts, totp.LockedUntil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) SetMFAFailures(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	query := "UPDATE mfa_totp SET failed_attempts = $1, locked_until = $2 WHERE user_id = $3;"
+	_, err := r.db.ExecContext(ctx, query, failedAttempts, lockedUntil, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) IncrementMFAFailures(ctx context.Context, userID string, now time.Time) (models.TOTP, error) {
+	query := `UPDATE mfa_totp
+			  SET failed_attempts = CASE WHEN locked_until <= $1 THEN 1 ELSE failed_attempts + 1 END,
+			  locked_until = CASE WHEN locked_until <= $1 THEN NULL ELSE locked_until END
+			  WHERE user_id = $2
+			  RETURNING user_id, secret, enabled, last_used_step, failed_attempts, locked_until;`
+	row := r.db.QueryRowContext(ctx, query, now, userID)
+
+	var totp models.TOTP
+	var lockedUntil sql.NullTime
+	err := row.Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.TOTP{}, ErrNotFound
+		}
+		return models.TOTP{}, err
+	}
+
+	if lockedUntil.Valid {
+		totp.LockedUntil = &lockedUntil.Time
+	}
+
+	return totp, nil
+}
+
+func (r *postgresRepo) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_totp WHERE user_id = $1;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) SetRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1;", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, h := range codeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES($1, $2);", userID, h)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+	query := "UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;"
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) CreateWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error {
+	query := `INSERT INTO webauthn_credentials (id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state)
+			  VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+	_, err := r.db.ExecContext(ctx, query, cred.ID, cred.UserID, cred.Name, cred.PublicKey, cred.AttestationType,
+		strings.Join(cred.Transports, ","), cred.AAGUID, int64(cred.SignCount), cred.BackupEligible, cred.BackupState)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetWebAuthnCredentialsOfUser(ctx context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	query := `SELECT id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at
+			  FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at;`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []models.WebAuthnCredential
+	for rows.Next() {
+		var cred models.WebAuthnCredential
+		var transports string
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&cred.ID, &cred.UserID, &cred.Name, &cred.PublicKey, &cred.AttestationType, &transports,
+			&cred.AAGUID, &cred.SignCount, &cred.BackupEligible, &cred.BackupState, &cred.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if transports != "" {
+			cred.Transports = strings.Split(transports, ",")
+		}
+
+		if lastUsedAt.Valid {
+			cred.LastUsedAt = &lastUsedAt.Time
+		}
+
+		creds = append(creds, cred)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+func (r *postgresRepo) UpdateWebAuthnCredentialUsage(ctx context.Context, id []byte, signCount uint32, backupState bool) error {
+	query := "UPDATE webauthn_credentials SET sign_count = $1, backup_state = $2, last_used_at = CURRENT_TIMESTAMP WHERE id = $3;"
+	_, err := r.db.ExecContext(ctx, query, int64(signCount), backupState, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) DeleteWebAuthnCredential(ctx context.Context, userID string, id []byte) error {
+	query := "DELETE FROM webauthn_credentials WHERE user_id = $1 AND id = $2;"
+	res, err := r.db.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) SetProviderToken(ctx context.Context, token models.ProviderToken) error {
+	query := `INSERT INTO provider_tokens (provider_id, user_id, provider, provider_name, access_token, refresh_token, token_type, scope, expires_at)
+			  VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			  ON CONFLICT (provider_id) DO UPDATE SET user_id = EXCLUDED.user_id, provider = EXCLUDED.provider, provider_name = EXCLUDED.provider_name,
+			  access_token = EXCLUDED.access_token, refresh_token = EXCLUDED.refresh_token, token_type = EXCLUDED.token_type,
+			  scope = EXCLUDED.scope, expires_at = EXCLUDED.expires_at, updated_at = CURRENT_TIMESTAMP;`
+	_, err := r.db.ExecContext(ctx, query, token.ProviderID, token.UserID, token.ProviderType, token.ProviderName, token.AccessToken, token.RefreshToken, token.TokenType, token.Scope, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetProviderToken(ctx context.Context, userID string, providerType models.UserProviderType, providerName string) (models.ProviderToken, error) {
+	query := `SELECT provider_id, user_id, provider, provider_name, access_token, refresh_token, token_type, scope, expires_at, updated_at
+			  FROM provider_tokens
+			  WHERE user_id = $1 AND provider = $2 AND provider_name = $3
+			  ORDER BY updated_at DESC LIMIT 1;`
+	row := r.db.QueryRowContext(ctx, query, userID, providerType, providerName)
+
+	var token models.ProviderToken
+	var expiresAt sql.NullTime
+	err := row.Scan(&token.ProviderID, &token.UserID, &token.ProviderType, &token.ProviderName, &token.AccessToken, &token.RefreshToken, &token.TokenType, &token.Scope, &expiresAt, &token.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ProviderToken{}, ErrNotFound
+		}
+		return models.ProviderToken{}, err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+
+	return token, nil
+}
+
+func (r *postgresRepo) CreateInvitation(ctx context.Context, invitation models.Invitation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO invitations (id, email, invited_by, expires_at) VALUES($1, $2, $3, $4);"
+	_, err = tx.ExecContext(ctx, query, invitation.ID, invitation.Email, invitation.InvitedBy, invitation.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	for _, roleID := range invitation.RoleIDs {
+		_, err = tx.ExecContext(ctx, "INSERT INTO invitation_roles (invitation_id, role_id) VALUES($1, $2);", invitation.ID, roleID)
+		if err != nil {
+			tx.Rollback()
+			if isPostgresForeignKeyViolation(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	query := "SELECT id, email, invited_by, created_at, expires_at, accepted_at, accepted_by FROM invitations WHERE id = $1;"
+	row := r.db.QueryRowContext(ctx, query, id)
+
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Invitation{}, ErrNotFound
+		}
+		return models.Invitation{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT role_id FROM invitation_roles WHERE invitation_id = $1;", id)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleID string
+		if err := rows.Scan(&roleID); err != nil {
+			return models.Invitation{}, err
+		}
+		invitation.RoleIDs = append(invitation.RoleIDs, roleID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.Invitation{}, err
+	}
+
+	return invitation, nil
+}
+
+func (r *postgresRepo) ListInvitations(ctx context.Context) ([]models.Invitation, error) {
+	query := "SELECT id, email, invited_by, created_at, expires_at, accepted_at, accepted_by FROM invitations ORDER BY created_at;"
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+	index := make(map[string]int)
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[invitation.ID] = len(invitations)
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roleRows, err := r.db.QueryContext(ctx, "SELECT invitation_id, role_id FROM invitation_roles;")
+	if err != nil {
+		return nil, err
+	}
+	defer roleRows.Close()
+
+	for roleRows.Next() {
+		var invitationID, roleID string
+		if err := roleRows.Scan(&invitationID, &roleID); err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[invitationID]; ok {
+			invitations[i].RoleIDs = append(invitations[i].RoleIDs, roleID)
+		}
+	}
+
+	if err := roleRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (r *postgresRepo) DeleteInvitation(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM invitations WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) AcceptInvitation(ctx context.Context, id string, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = $1 WHERE id = $2 AND accepted_at IS NULL;", userID, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := expectAffected(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Roles the user already has are skipped
+	query := `INSERT INTO user_roles (user_id, role_id)
+			  SELECT $1::VARCHAR, role_id FROM invitation_roles WHERE invitation_id = $2
+			  ON CONFLICT DO NOTHING;`
+	_, err = tx.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) CreateElevationRequest(ctx context.Context, request models.ElevationRequest) error {
+	err := createElevationRequest(ctx, r.db, "postgres", request)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if isPostgresForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetElevationRequest(ctx context.Context, id string) (models.ElevationRequest, error) {
+	return getElevationRequest(ctx, r.db, "postgres", id)
+}
+
+func (r *postgresRepo) ListElevationRequests(ctx context.Context, params ListElevationRequestsParams) ([]models.ElevationRequest, error) {
+	return listElevationRequests(ctx, r.db, "postgres", params)
+}
+
+func (r *postgresRepo) ApproveElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error {
+	return r.decideElevationRequest(ctx, id, models.ElevationApproved, approverID, at)
+}
+
+func (r *postgresRepo) DenyElevationRequest(ctx context.Context, id string, approverID string, at time.Time) error {
+	return r.decideElevationRequest(ctx, id, models.ElevationDenied, approverID, at)
+}
+
+func (r *postgresRepo) decideElevationRequest(ctx context.Context, id string, status models.ElevationStatus, approverID string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	request, err := decideElevationRequest(ctx, tx, "postgres", id, status, approverID, at)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if status == models.ElevationApproved {
+		// The user may already have the role for longer
+		extended, err := extendRoleAssignment(ctx, tx, "postgres", request.UserID, request.RoleID, request.ExpiresAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if !extended {
+			query := "INSERT INTO user_roles (user_id, role_id, expires_at) VALUES($1, $2, $3) ON CONFLICT DO NOTHING;"
+			if _, err := tx.ExecContext(ctx, query, request.UserID, request.RoleID, request.ExpiresAt.UTC()); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) CreatePolicy(ctx context.Context, policy models.Policy) error {
+	if err := createPolicy(ctx, r.db, "postgres", policy); err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresRepo) GetPolicy(ctx context.Context, id string) (models.Policy, error) {
+	return getPolicy(ctx, r.db, "postgres", id)
+}
+
+func (r *postgresRepo) ListPolicies(ctx context.Context) ([]models.Policy, error) {
+	return listPolicies(ctx, r.db)
+}
+
+func (r *postgresRepo) UpdatePolicy(ctx context.Context, policy models.Policy) error {
+	res, err := updatePolicy(ctx, r.db, "postgres", policy)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepo) DeletePolicy(ctx context.Context, id string) error {
+	return deletePolicy(ctx, r.db, "postgres", id)
+}
+
+func (r *postgresRepo) GetRolesWithPermissions(ctx context.Context, permissions []models.Permission, orgID string) ([][]models.Role, error) {
+	return getRolesWithPermissions(ctx, r.db, "postgres", permissions, orgID)
+}
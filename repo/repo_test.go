@@ -0,0 +1,151 @@
+package repo_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/repo/repotest"
+)
+
+func Test_Memory(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repo.Repo {
+		return repo.NewMemory()
+	})
+}
+
+func Test_SQLite(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repo.Repo {
+		return newSQLite(t, filepath.Join(t.TempDir(), "thor.db"))
+	})
+}
+
+func newSQLite(t *testing.T, path string) repo.Repo {
+	t.Helper()
+
+	r, err := repo.NewSQLite(&repo.SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatalf("NewSQLite() = %v; want nil", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	migrate(t, r)
+	return r
+}
+
+func migrate(t *testing.T, r repo.Repo) {
+	t.Helper()
+
+	if _, err := r.(repo.Migrator).MigrateUp(context.Background()); err != nil {
+		t.Fatalf("MigrateUp() = %v; want nil", err)
+	}
+}
+
+// Test_Postgres runs against the database of THOR_TEST_POSTGRES_DSN, which is migrated first.
+// The suite only creates rows with new ids, so the database does not have to be empty.
+func Test_Postgres(t *testing.T) {
+	dsn := os.Getenv("THOR_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("THOR_TEST_POSTGRES_DSN is not set")
+	}
+
+	repotest.Run(t, func(t *testing.T) repo.Repo {
+		r := repo.NewPostgresDSN(dsn)
+		t.Cleanup(func() { r.Close() })
+		migrate(t, r)
+		return r
+	})
+}
+
+// Test_MySql runs against the database of THOR_TEST_MYSQL_DSN, which is migrated first.
+func Test_MySql(t *testing.T) {
+	dsn := os.Getenv("THOR_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("THOR_TEST_MYSQL_DSN is not set")
+	}
+
+	repotest.Run(t, func(t *testing.T) repo.Repo {
+		r := repo.NewMySqlDSN(dsn)
+		t.Cleanup(func() { r.Close() })
+		migrate(t, r)
+		return r
+	})
+}
+
+func Test_Migrations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "thor.db")
+
+	r, err := repo.NewSQLite(&repo.SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	statuses, err := r.MigrationStatus(ctx)
+	if err != nil || len(statuses) == 0 {
+		t.Fatalf("MigrationStatus() = %v, %v; want the migrations", statuses, err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			t.Errorf("migration %d is applied before migrating", s.Version)
+		}
+	}
+
+	// Migrating concurrently applies every migration once
+	var wg sync.WaitGroup
+	applied := make([][]repo.Migration, 2)
+	errs := make([]error, 2)
+	for i := range applied {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			other, err := repo.NewSQLite(&repo.SQLiteConfig{Path: path})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer other.Close()
+			applied[i], errs[i] = other.MigrateUp(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("MigrateUp() = %v, %v; want nil", errs[0], errs[1])
+	}
+	if n := len(applied[0]) + len(applied[1]); n != len(statuses) {
+		t.Errorf("MigrateUp() applied %d migrations; want %d", n, len(statuses))
+	}
+
+	if applied, err := r.MigrateUp(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("MigrateUp() of a migrated database = %v, %v; want none", applied, err)
+	}
+
+	latest := statuses[len(statuses)-1]
+	reverted, err := r.MigrateDown(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != latest.Version {
+		t.Errorf("MigrateDown(1) = %v, %v; want %d", reverted, err, latest.Version)
+	}
+
+	statuses, err = r.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if (s.AppliedAt == nil) != (s.Version == latest.Version) {
+			t.Errorf("migration %d applied at %v; want only the latest migration to be reverted", s.Version, s.AppliedAt)
+		}
+	}
+
+	// Every migration can be reverted and applied again
+	if reverted, err := r.MigrateDown(ctx, len(statuses)); err != nil || len(reverted) != len(statuses)-1 {
+		t.Errorf("MigrateDown(all) = %d migrations, %v; want %d", len(reverted), err, len(statuses)-1)
+	}
+	if applied, err := r.MigrateUp(ctx); err != nil || len(applied) != len(statuses) {
+		t.Errorf("MigrateUp() after reverting all = %d migrations, %v; want %d", len(applied), err, len(statuses))
+	}
+}
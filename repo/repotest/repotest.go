@@ -0,0 +1,1880 @@
+// Package repotest is a conformance suite for the implementations of repo.Repo.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+// Run checks that the repo created by newRepo fulfills the contract of every method of repo.Repo.
+// newRepo is called once per group of tests. The repo may be shared with other tests,
+// all rows are created with new ids and the suite does not assume that the repo is empty.
+func Run(t *testing.T, newRepo func(t *testing.T) repo.Repo) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s suite)
+	}{
+		{"Users", testUsers},
+		{"ListUsers", testListUsers},
+		{"Providers", testProviders},
+		{"DeleteUser", testDeleteUser},
+		{"DisableUser", testDisableUser},
+		{"SoftDeleteUser", testSoftDeleteUser},
+		{"Roles", testRoles},
+		{"RolePermissions", testRolePermissions},
+		{"RoleHierarchy", testRoleHierarchy},
+		{"RolesWithPermission", testRolesWithPermission},
+		{"ListRoles", testListRoles},
+		{"AssignRole", testAssignRole},
+		{"ExpiringRoles", testExpiringRoles},
+		{"DeleteRole", testDeleteRole},
+		{"UsersAffectedByRole", testUsersAffectedByRole},
+		{"Groups", testGroups},
+		{"GroupPermissions", testGroupPermissions},
+		{"Orgs", testOrgs},
+		{"OrgRoles", testOrgRoles},
+		{"LocalCredentials", testLocalCredentials},
+		{"MFA", testMFA},
+		{"WebAuthn", testWebAuthn},
+		{"ProviderTokens", testProviderTokens},
+		{"Invitations", testInvitations},
+		{"ElevationRequests", testElevationRequests},
+		{"Policies", testPolicies},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRepo(t)
+			if err := r.Ping(); err != nil {
+				t.Fatalf("Ping() = %v; want nil", err)
+			}
+			tt.run(t, suite{r: r, ctx: context.Background()})
+		})
+	}
+}
+
+type suite struct {
+	r   repo.Repo
+	ctx context.Context
+}
+
+// newID returns an id that is unique between the runs of the suite
+func newID() string {
+	return uuid.NewString()
+}
+
+func (s suite) createUser(t *testing.T) models.User {
+	t.Helper()
+
+	id := newID()
+	u := models.User{ID: id, Name: "Test " + id[:8], Email: id[:8] + "@example.com"}
+	if err := s.r.CreateUser(s.ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "provider-" + id}); err != nil {
+		t.Fatalf("CreateUser() = %v; want nil", err)
+	}
+
+	return u
+}
+
+func (s suite) createRole(t *testing.T, permissions ...models.Permission) models.Role {
+	t.Helper()
+
+	id := newID()
+	role := models.Role{ID: id, Name: "role-" + id, Description: "Test role " + id[:8]}
+	if err := s.r.CreateRole(s.ctx, role, permissions); err != nil {
+		t.Fatalf("CreateRole() = %v; want nil", err)
+	}
+
+	return role
+}
+
+func (s suite) createGroup(t *testing.T) models.Group {
+	t.Helper()
+
+	id := newID()
+	group := models.Group{ID: id, Name: "group-" + id, Description: "Test group " + id[:8]}
+	if err := s.r.CreateGroup(s.ctx, group); err != nil {
+		t.Fatalf("CreateGroup() = %v; want nil", err)
+	}
+
+	return group
+}
+
+func (s suite) createOrg(t *testing.T) models.Org {
+	t.Helper()
+
+	id := newID()
+	org := models.Org{ID: id, Name: "org-" + id}
+	if err := s.r.CreateOrg(s.ctx, org); err != nil {
+		t.Fatalf("CreateOrg() = %v; want nil", err)
+	}
+
+	return org
+}
+
+func (s suite) createOrgRole(t *testing.T, orgID string, permissions ...models.Permission) models.Role {
+	t.Helper()
+
+	id := newID()
+	role := models.Role{ID: id, Name: "role-" + id, OrgID: orgID}
+	if err := s.r.CreateRole(s.ctx, role, permissions); err != nil {
+		t.Fatalf("CreateRole() = %v; want nil", err)
+	}
+
+	return role
+}
+
+func (s suite) assignRole(t *testing.T, userID, roleID string) {
+	t.Helper()
+
+	if err := s.r.AssignRole(s.ctx, userID, roleID); err != nil {
+		t.Fatalf("AssignRole() = %v; want nil", err)
+	}
+}
+
+func wantErr(t *testing.T, method string, got, want error) {
+	t.Helper()
+
+	if !errors.Is(got, want) {
+		t.Errorf("%s = %v; want %v", method, got, want)
+	}
+}
+
+func wantNoErr(t *testing.T, method string, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s = %v; want nil", method, err)
+	}
+}
+
+// sameElements reports whether a and b have the same elements, ignoring the order.
+func sameElements[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := make(map[T]int)
+	for _, v := range a {
+		count[v]++
+	}
+	for _, v := range b {
+		count[v]--
+		if count[v] < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ids[T any](items []T, id func(T) string) []string {
+	var s []string
+	for _, item := range items {
+		s = append(s, id(item))
+	}
+	return s
+}
+
+func userID(u models.User) string     { return u.ID }
+func roleID(r models.Role) string     { return r.ID }
+func groupID(g models.Group) string   { return g.ID }
+func orgID(o models.Org) string       { return o.ID }
+func policyID(p models.Policy) string { return p.ID }
+
+func testUsers(t *testing.T, s suite) {
+	u := s.createUser(t)
+
+	got, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID})
+	if err != nil || got != u {
+		t.Errorf("GetUser() by id = %v, %v; want %v", got, err, u)
+	}
+
+	got, err = s.r.GetUser(s.ctx, repo.GetUserParams{Email: &u.Email})
+	if err != nil || got != u {
+		t.Errorf("GetUser() by email = %v, %v; want %v", got, err, u)
+	}
+
+	got, err = s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID, Email: &u.Email})
+	if err != nil || got != u {
+		t.Errorf("GetUser() by id and email = %v, %v; want %v", got, err, u)
+	}
+
+	otherEmail := "other-" + u.Email
+	_, err = s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID, Email: &otherEmail})
+	wantErr(t, "GetUser() by id and another email", err, repo.ErrNotFound)
+
+	missing := newID()
+	_, err = s.r.GetUser(s.ctx, repo.GetUserParams{ID: &missing})
+	wantErr(t, "GetUser() of a missing user", err, repo.ErrNotFound)
+
+	// Creating the user is atomic, the user is not created if the provider is taken
+	clash := models.User{ID: newID(), Name: "Clash", Email: "clash@example.com"}
+	err = s.r.CreateUser(s.ctx, clash, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "provider-" + u.ID})
+	wantErr(t, "CreateUser() with a taken provider id", err, repo.ErrAlreadyExists)
+	_, err = s.r.GetUser(s.ctx, repo.GetUserParams{ID: &clash.ID})
+	wantErr(t, "GetUser() of a user whose creation failed", err, repo.ErrNotFound)
+
+	err = s.r.CreateUser(s.ctx, u, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: newID()})
+	wantErr(t, "CreateUser() with a taken id", err, repo.ErrAlreadyExists)
+
+	users, _, err := s.r.ListUsers(s.ctx, repo.ListUsersParams{})
+	wantNoErr(t, "ListUsers()", err)
+	if !slices.Contains(users, u) {
+		t.Errorf("ListUsers() = %v; want it to contain %v", users, u)
+	}
+
+	// Updating without any changes is not a missing user
+	wantNoErr(t, "UpdateUser() without changes", s.r.UpdateUser(s.ctx, u))
+
+	u.Name = "Renamed"
+	u.Email = "renamed-" + u.Email
+	wantNoErr(t, "UpdateUser()", s.r.UpdateUser(s.ctx, u))
+	if got, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID}); err != nil || got != u {
+		t.Errorf("GetUser() after UpdateUser() = %v, %v; want %v", got, err, u)
+	}
+
+	err = s.r.UpdateUser(s.ctx, models.User{ID: missing, Name: "Missing", Email: "missing@example.com"})
+	wantErr(t, "UpdateUser() of a missing user", err, repo.ErrNotFound)
+}
+
+// listUsers lists the users, following the cursors until the last page.
+// Returns the ids of the users of each page.
+func (s suite) listUsers(t *testing.T, params repo.ListUsersParams) [][]string {
+	t.Helper()
+
+	var pages [][]string
+	for {
+		users, next, err := s.r.ListUsers(s.ctx, params)
+		wantNoErr(t, "ListUsers()", err)
+		pages = append(pages, ids(users, userID))
+
+		if next == "" {
+			return pages
+		}
+		if len(pages) > 10 {
+			t.Fatalf("ListUsers() returned more pages than there are users")
+		}
+		params.Cursor = next
+	}
+}
+
+func testListUsers(t *testing.T, s suite) {
+	// The users of the test are told apart from other users by the prefix of their emails
+	tag := newID()[:8]
+	create := func(name, email string, providerType models.UserProviderType) models.User {
+		u := models.User{ID: newID(), Name: name + " " + tag, Email: tag + "-" + email}
+		err := s.r.CreateUser(s.ctx, u, models.UserProvider{Type: providerType, UserID: "provider-" + u.ID})
+		wantNoErr(t, "CreateUser()", err)
+		return u
+	}
+
+	a := create("Carol", "a@example.com", models.UserProviderTypeGithub)
+	b := create("Alice", "b@example.com", models.UserProviderTypeGoogle)
+	c := create("Bob", "c@example.com", models.UserProviderTypeGithub)
+
+	role := s.createRole(t)
+	s.assignRole(t, a.ID, role.ID)
+	s.assignRole(t, c.ID, role.ID)
+
+	hourAgo := time.Now().Add(-time.Hour)
+	inAnHour := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		params repo.ListUsersParams
+		want   [][]string
+	}{
+		{"by email", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortEmail}, [][]string{{a.ID, b.ID, c.ID}}},
+		{"by email descending", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortEmail, Descending: true}, [][]string{{c.ID, b.ID, a.ID}}},
+		{"by name", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortName}, [][]string{{b.ID, c.ID, a.ID}}},
+		{"email prefix ignoring case", repo.ListUsersParams{EmailPrefix: strings.ToUpper(tag + "-A"), Sort: repo.UserSortEmail}, [][]string{{a.ID}}},
+		{"name prefix ignoring case", repo.ListUsersParams{NamePrefix: "alice " + strings.ToUpper(tag)}, [][]string{{b.ID}}},
+		{"wildcards in the prefix", repo.ListUsersParams{EmailPrefix: "_" + tag[1:]}, [][]string{nil}},
+		{"provider type", repo.ListUsersParams{EmailPrefix: tag, ProviderType: models.UserProviderTypeGoogle}, [][]string{{b.ID}}},
+		{"role", repo.ListUsersParams{EmailPrefix: tag, RoleID: role.ID, Sort: repo.UserSortEmail}, [][]string{{a.ID, c.ID}}},
+		{"created range", repo.ListUsersParams{EmailPrefix: tag, CreatedAfter: &hourAgo, CreatedBefore: &inAnHour, Sort: repo.UserSortEmail}, [][]string{{a.ID, b.ID, c.ID}}},
+		{"created after", repo.ListUsersParams{EmailPrefix: tag, CreatedAfter: &inAnHour}, [][]string{nil}},
+		{"created before", repo.ListUsersParams{EmailPrefix: tag, CreatedBefore: &hourAgo}, [][]string{nil}},
+		{"pages", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortEmail, Limit: 2}, [][]string{{a.ID, b.ID}, {c.ID}}},
+		{"pages descending", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortName, Descending: true, Limit: 2}, [][]string{{a.ID, c.ID}, {b.ID}}},
+		{"exact pages", repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortEmail, Limit: 3}, [][]string{{a.ID, b.ID, c.ID}}},
+	}
+
+	for _, tt := range tests {
+		if got := s.listUsers(t, tt.params); !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("ListUsers() %s = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// The users can be created in the same second, only the paging is checked when ordered by creation
+	var all []string
+	for _, page := range s.listUsers(t, repo.ListUsersParams{EmailPrefix: tag, Limit: 1}) {
+		all = append(all, page...)
+	}
+	if !sameElements(all, []string{a.ID, b.ID, c.ID}) {
+		t.Errorf("ListUsers() by creation in pages = %v; want each user once", all)
+	}
+
+	_, _, err := s.r.ListUsers(s.ctx, repo.ListUsersParams{Cursor: "invalid"})
+	wantErr(t, "ListUsers() with an invalid cursor", err, repo.ErrInvalidCursor)
+
+	_, next, err := s.r.ListUsers(s.ctx, repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortEmail, Limit: 1})
+	wantNoErr(t, "ListUsers()", err)
+	_, _, err = s.r.ListUsers(s.ctx, repo.ListUsersParams{EmailPrefix: tag, Sort: repo.UserSortName, Limit: 1, Cursor: next})
+	wantErr(t, "ListUsers() with the cursor of another sort", err, repo.ErrInvalidCursor)
+}
+
+func testProviders(t *testing.T, s suite) {
+	u := s.createUser(t)
+	other := s.createUser(t)
+
+	first := models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "provider-" + u.ID}
+	second := models.UserProvider{Type: models.UserProviderTypeGoogle, UserID: newID()}
+	wantNoErr(t, "AddProvider()", s.r.AddProvider(s.ctx, u.ID, second))
+
+	providers, err := s.r.GetProvidersOfUser(s.ctx, u.ID)
+	wantNoErr(t, "GetProvidersOfUser()", err)
+	if !sameElements(providers, []models.UserProvider{first, second}) {
+		t.Errorf("GetProvidersOfUser() = %v; want %v", providers, []models.UserProvider{first, second})
+	}
+
+	if got, err := s.r.GetUserByProviderID(s.ctx, second.UserID); err != nil || got != u {
+		t.Errorf("GetUserByProviderID() = %v, %v; want %v", got, err, u)
+	}
+
+	_, err = s.r.GetUserByProviderID(s.ctx, newID())
+	wantErr(t, "GetUserByProviderID() of a missing provider", err, repo.ErrNotFound)
+
+	err = s.r.AddProvider(s.ctx, other.ID, second)
+	wantErr(t, "AddProvider() of a provider of another user", err, repo.ErrAlreadyExists)
+
+	err = s.r.AddProvider(s.ctx, newID(), models.UserProvider{Type: models.UserProviderTypeGithub, UserID: newID()})
+	wantErr(t, "AddProvider() to a missing user", err, repo.ErrNotFound)
+
+	providers, err = s.r.GetProvidersOfUser(s.ctx, newID())
+	if err != nil || len(providers) != 0 {
+		t.Errorf("GetProvidersOfUser() of a missing user = %v, %v; want none", providers, err)
+	}
+}
+
+func testDeleteUser(t *testing.T, s suite) {
+	u := s.createUser(t)
+	role := s.createRole(t)
+	s.assignRole(t, u.ID, role.ID)
+
+	providerID := "provider-" + u.ID
+	wantNoErr(t, "SetPasswordHash()", s.r.SetPasswordHash(s.ctx, u.ID, "hash"))
+	wantNoErr(t, "SetTOTP()", s.r.SetTOTP(s.ctx, models.TOTP{UserID: u.ID, Secret: "SECRET"}))
+	wantNoErr(t, "SetRecoveryCodes()", s.r.SetRecoveryCodes(s.ctx, u.ID, []string{"code"}))
+	wantNoErr(t, "CreateWebAuthnCredential()", s.r.CreateWebAuthnCredential(s.ctx, newCredential(u.ID)))
+	wantNoErr(t, "SetProviderToken()", s.r.SetProviderToken(s.ctx, newProviderToken(u.ID, providerID)))
+
+	admin := s.createUser(t)
+	invitation := newInvitation(admin.ID)
+	wantNoErr(t, "CreateInvitation()", s.r.CreateInvitation(s.ctx, invitation))
+	wantNoErr(t, "AcceptInvitation()", s.r.AcceptInvitation(s.ctx, invitation.ID, u.ID))
+
+	wantNoErr(t, "DeleteUser()", s.r.DeleteUser(s.ctx, u.ID))
+
+	_, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID})
+	wantErr(t, "GetUser() of a deleted user", err, repo.ErrNotFound)
+
+	// Everything belonging to the user is deleted with it
+	_, err = s.r.GetUserByProviderID(s.ctx, providerID)
+	wantErr(t, "GetUserByProviderID() of a deleted user", err, repo.ErrNotFound)
+
+	if users, err := s.r.GetUsersWithRole(s.ctx, role.ID); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersWithRole() after the user was deleted = %v, %v; want none", users, err)
+	}
+
+	_, err = s.r.GetLocalCredential(s.ctx, u.ID)
+	wantErr(t, "GetLocalCredential() of a deleted user", err, repo.ErrNotFound)
+
+	_, err = s.r.GetTOTP(s.ctx, u.ID)
+	wantErr(t, "GetTOTP() of a deleted user", err, repo.ErrNotFound)
+
+	err = s.r.UseRecoveryCode(s.ctx, u.ID, "code")
+	wantErr(t, "UseRecoveryCode() of a deleted user", err, repo.ErrNotFound)
+
+	if creds, err := s.r.GetWebAuthnCredentialsOfUser(s.ctx, u.ID); err != nil || len(creds) != 0 {
+		t.Errorf("GetWebAuthnCredentialsOfUser() of a deleted user = %v, %v; want none", creds, err)
+	}
+
+	_, err = s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGithub, "app")
+	wantErr(t, "GetProviderToken() of a deleted user", err, repo.ErrNotFound)
+
+	// The invitation is kept, but no longer points to the user
+	got, err := s.r.GetInvitation(s.ctx, invitation.ID)
+	if err != nil || got.AcceptedAt == nil || got.AcceptedBy != nil {
+		t.Errorf("GetInvitation() accepted by a deleted user = %+v, %v; want accepted by nobody", got, err)
+	}
+
+	err = s.r.DeleteUser(s.ctx, u.ID)
+	wantErr(t, "DeleteUser() of a deleted user", err, repo.ErrNotFound)
+}
+
+func testDisableUser(t *testing.T, s suite) {
+	u := s.createUser(t)
+
+	wantNoErr(t, "SetUserDisabled()", s.r.SetUserDisabled(s.ctx, u.ID, true))
+	if got, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID}); err != nil || !got.Disabled {
+		t.Errorf("GetUser() of a disabled user = %+v, %v; want disabled", got, err)
+	}
+	if got, err := s.r.GetUserByProviderID(s.ctx, "provider-"+u.ID); err != nil || !got.Disabled {
+		t.Errorf("GetUserByProviderID() of a disabled user = %+v, %v; want disabled", got, err)
+	}
+
+	// Disabling is kept when the user is updated
+	wantNoErr(t, "UpdateUser()", s.r.UpdateUser(s.ctx, models.User{ID: u.ID, Name: "Renamed", Email: u.Email}))
+	if got, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID}); err != nil || !got.Disabled || got.Name != "Renamed" {
+		t.Errorf("GetUser() of an updated disabled user = %+v, %v; want disabled and renamed", got, err)
+	}
+
+	wantNoErr(t, "SetUserDisabled()", s.r.SetUserDisabled(s.ctx, u.ID, false))
+	if got, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID}); err != nil || got.Disabled {
+		t.Errorf("GetUser() of an enabled user = %+v, %v; want enabled", got, err)
+	}
+
+	err := s.r.SetUserDisabled(s.ctx, newID(), true)
+	wantErr(t, "SetUserDisabled() of an unknown user", err, repo.ErrNotFound)
+}
+
+func testSoftDeleteUser(t *testing.T, s suite) {
+	u := s.createUser(t)
+	role := s.createRole(t)
+	s.assignRole(t, u.ID, role.ID)
+
+	wantNoErr(t, "SoftDeleteUser()", s.r.SoftDeleteUser(s.ctx, u.ID, time.Now()))
+
+	// A soft deleted user is gone to everything but the purge
+	_, err := s.r.GetUser(s.ctx, repo.GetUserParams{ID: &u.ID})
+	wantErr(t, "GetUser() of a soft deleted user", err, repo.ErrNotFound)
+
+	_, err = s.r.GetUser(s.ctx, repo.GetUserParams{Email: &u.Email})
+	wantErr(t, "GetUser() by the email of a soft deleted user", err, repo.ErrNotFound)
+
+	_, err = s.r.GetUserByProviderID(s.ctx, "provider-"+u.ID)
+	wantErr(t, "GetUserByProviderID() of a soft deleted user", err, repo.ErrNotFound)
+
+	if users, err := s.r.GetUsersWithRole(s.ctx, role.ID); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersWithRole() of a soft deleted user = %v, %v; want none", users, err)
+	}
+
+	if pages := s.listUsers(t, repo.ListUsersParams{RoleID: role.ID}); len(pages) != 1 || len(pages[0]) != 0 {
+		t.Errorf("ListUsers() of a soft deleted user = %v; want none", pages)
+	}
+
+	err = s.r.UpdateUser(s.ctx, u)
+	wantErr(t, "UpdateUser() of a soft deleted user", err, repo.ErrNotFound)
+
+	err = s.r.SetUserDisabled(s.ctx, u.ID, false)
+	wantErr(t, "SetUserDisabled() of a soft deleted user", err, repo.ErrNotFound)
+
+	err = s.r.SoftDeleteUser(s.ctx, u.ID, time.Now())
+	wantErr(t, "SoftDeleteUser() of a soft deleted user", err, repo.ErrNotFound)
+
+	err = s.r.SoftDeleteUser(s.ctx, newID(), time.Now())
+	wantErr(t, "SoftDeleteUser() of an unknown user", err, repo.ErrNotFound)
+
+	// Only the users deleted before the time are purged
+	old := s.createUser(t)
+	wantNoErr(t, "SetPasswordHash()", s.r.SetPasswordHash(s.ctx, old.ID, "hash"))
+	wantNoErr(t, "SoftDeleteUser()", s.r.SoftDeleteUser(s.ctx, old.ID, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	purged, err := s.r.PurgeDeletedUsers(s.ctx, time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || purged < 1 {
+		t.Errorf("PurgeDeletedUsers() = %d, %v; want at least 1", purged, err)
+	}
+
+	_, err = s.r.GetLocalCredential(s.ctx, old.ID)
+	wantErr(t, "GetLocalCredential() of a purged user", err, repo.ErrNotFound)
+
+	err = s.r.DeleteUser(s.ctx, old.ID)
+	wantErr(t, "DeleteUser() of a purged user", err, repo.ErrNotFound)
+
+	// The user deleted after the time is kept until it is purged or deleted
+	wantNoErr(t, "DeleteUser() of a soft deleted user", s.r.DeleteUser(s.ctx, u.ID))
+}
+
+func testRoles(t *testing.T, s suite) {
+	permissions := []models.Permission{{Key: "admin", Val: "true"}, {Key: "team", Val: "a"}, {Key: "team", Val: "b"}}
+	role := s.createRole(t, permissions...)
+
+	if got, err := s.r.GetRole(s.ctx, role.ID); err != nil || got != role {
+		t.Errorf("GetRole() = %v, %v; want %v", got, err, role)
+	}
+
+	_, err := s.r.GetRole(s.ctx, newID())
+	wantErr(t, "GetRole() of a missing role", err, repo.ErrNotFound)
+
+	got, err := s.r.GetPermissionsOfRole(s.ctx, role.ID)
+	if err != nil || !sameElements(got, permissions) {
+		t.Errorf("GetPermissionsOfRole() = %v, %v; want %v", got, err, permissions)
+	}
+
+	empty := s.createRole(t)
+	if got, err := s.r.GetPermissionsOfRole(s.ctx, empty.ID); err != nil || len(got) != 0 {
+		t.Errorf("GetPermissionsOfRole() of a role without permissions = %v, %v; want none", got, err)
+	}
+
+	roles, _, err := s.r.ListRoles(s.ctx, repo.ListRolesParams{})
+	wantNoErr(t, "ListRoles()", err)
+	if !slices.Contains(roles, role) || !slices.Contains(roles, empty) {
+		t.Errorf("ListRoles() = %v; want it to contain %v and %v", roles, role, empty)
+	}
+
+	err = s.r.CreateRole(s.ctx, models.Role{ID: role.ID, Name: "role-" + newID()}, nil)
+	wantErr(t, "CreateRole() with a taken id", err, repo.ErrAlreadyExists)
+
+	err = s.r.CreateRole(s.ctx, models.Role{ID: newID(), Name: role.Name}, nil)
+	wantErr(t, "CreateRole() with a taken name", err, repo.ErrAlreadyExists)
+
+	// Creating the role is atomic, the role is not created if the permissions are invalid
+	duplicate := models.Role{ID: newID(), Name: "role-" + newID()}
+	err = s.r.CreateRole(s.ctx, duplicate, []models.Permission{{Key: "a", Val: "b"}, {Key: "a", Val: "b"}})
+	wantErr(t, "CreateRole() with duplicate permissions", err, repo.ErrAlreadyExists)
+	_, err = s.r.GetRole(s.ctx, duplicate.ID)
+	wantErr(t, "GetRole() of a role whose creation failed", err, repo.ErrNotFound)
+
+	wantNoErr(t, "UpdateRole() without changes", s.r.UpdateRole(s.ctx, role))
+
+	role.Name = "renamed-" + role.ID
+	role.Description = "Renamed"
+	wantNoErr(t, "UpdateRole()", s.r.UpdateRole(s.ctx, role))
+	if got, err := s.r.GetRole(s.ctx, role.ID); err != nil || got != role {
+		t.Errorf("GetRole() after UpdateRole() = %v, %v; want %v", got, err, role)
+	}
+
+	err = s.r.UpdateRole(s.ctx, models.Role{ID: empty.ID, Name: role.Name})
+	wantErr(t, "UpdateRole() to a taken name", err, repo.ErrAlreadyExists)
+
+	err = s.r.UpdateRole(s.ctx, models.Role{ID: newID(), Name: "role-" + newID()})
+	wantErr(t, "UpdateRole() of a missing role", err, repo.ErrNotFound)
+}
+
+func testRolePermissions(t *testing.T, s suite) {
+	role := s.createRole(t, models.Permission{Key: "team", Val: "a"}, models.Permission{Key: "team", Val: "b"})
+
+	wantPermissions := func(method string, want []models.Permission) {
+		t.Helper()
+		if got, err := s.r.GetPermissionsOfRole(s.ctx, role.ID); err != nil || !sameElements(got, want) {
+			t.Errorf("GetPermissionsOfRole() after %s = %v, %v; want %v", method, got, err, want)
+		}
+	}
+
+	// Adding an existing permission and removing a missing one are no-ops
+	err := s.r.UpdateRolePermissions(s.ctx, role.ID,
+		[]models.Permission{{Key: "team", Val: "a"}, {Key: "admin", Val: "true"}},
+		[]models.Permission{{Key: "team", Val: "b"}, {Key: "team", Val: "c"}},
+	)
+	wantNoErr(t, "UpdateRolePermissions()", err)
+	wantPermissions("UpdateRolePermissions()", []models.Permission{{Key: "team", Val: "a"}, {Key: "admin", Val: "true"}})
+
+	// A permission that is both removed and added is kept
+	err = s.r.UpdateRolePermissions(s.ctx, role.ID, []models.Permission{{Key: "admin", Val: "true"}}, []models.Permission{{Key: "admin", Val: "true"}})
+	wantNoErr(t, "UpdateRolePermissions()", err)
+	wantPermissions("UpdateRolePermissions() of the same permission", []models.Permission{{Key: "team", Val: "a"}, {Key: "admin", Val: "true"}})
+
+	err = s.r.UpdateRolePermissions(s.ctx, newID(), []models.Permission{{Key: "a", Val: "b"}}, nil)
+	wantErr(t, "UpdateRolePermissions() of a missing role", err, repo.ErrNotFound)
+
+	replaced := []models.Permission{{Key: "team", Val: "c"}, {Key: "team", Val: "d"}}
+	wantNoErr(t, "SetRolePermissions()", s.r.SetRolePermissions(s.ctx, role.ID, replaced))
+	wantPermissions("SetRolePermissions()", replaced)
+
+	// Replacing is atomic, the permissions are kept if the new ones are invalid
+	err = s.r.SetRolePermissions(s.ctx, role.ID, []models.Permission{{Key: "a", Val: "b"}, {Key: "a", Val: "b"}})
+	wantErr(t, "SetRolePermissions() with duplicate permissions", err, repo.ErrAlreadyExists)
+	wantPermissions("a failed SetRolePermissions()", replaced)
+
+	wantNoErr(t, "SetRolePermissions() to none", s.r.SetRolePermissions(s.ctx, role.ID, nil))
+	wantPermissions("SetRolePermissions() to none", nil)
+
+	err = s.r.SetRolePermissions(s.ctx, newID(), nil)
+	wantErr(t, "SetRolePermissions() of a missing role", err, repo.ErrNotFound)
+}
+
+// grantStrings formats the grants as key=val:role/role to be compared.
+func grantStrings(grants []models.PermissionGrant) []string {
+	var s []string
+	for _, g := range grants {
+		s = append(s, g.Key+"="+g.Val+":"+strings.Join(g.RolePath, "/"))
+	}
+	return s
+}
+
+func testRoleHierarchy(t *testing.T, s suite) {
+	shared := models.Permission{Key: "team", Val: "a"}
+	viewer := s.createRole(t, models.Permission{Key: "read", Val: "true"}, shared)
+	editor := s.createRole(t, models.Permission{Key: "write", Val: "true"})
+	admin := s.createRole(t, models.Permission{Key: "admin", Val: "true"}, shared)
+
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, editor.ID, []string{viewer.ID}))
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, admin.ID, []string{editor.ID, editor.ID}))
+
+	if got, err := s.r.GetParentsOfRole(s.ctx, admin.ID); err != nil || !slices.Equal(got, []models.Role{editor}) {
+		t.Errorf("GetParentsOfRole() = %v, %v; want %v", got, err, editor)
+	}
+
+	u := s.createUser(t)
+	s.assignRole(t, u.ID, admin.ID)
+
+	// The permissions are inherited through every level, and the shared permission is only returned once
+	want := []models.Permission{{Key: "admin", Val: "true"}, {Key: "write", Val: "true"}, {Key: "read", Val: "true"}, shared}
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, want) {
+		t.Errorf("GetPermissionsOfUser() = %v, %v; want %v", got, err, want)
+	}
+
+	wantGrants := []string{
+		"admin=true:" + admin.ID,
+		"team=a:" + admin.ID,
+		"write=true:" + admin.ID + "/" + editor.ID,
+		"read=true:" + admin.ID + "/" + editor.ID + "/" + viewer.ID,
+		"team=a:" + admin.ID + "/" + editor.ID + "/" + viewer.ID,
+	}
+	if grants, err := s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(grantStrings(grants), wantGrants) {
+		t.Errorf("GetPermissionGrantsOfUser() = %v, %v; want %v", grantStrings(grants), err, wantGrants)
+	}
+
+	// A user without roles has no permissions
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, s.createUser(t).ID, ""); err != nil || len(got) != 0 {
+		t.Errorf("GetPermissionsOfUser() of a user without roles = %v, %v; want none", got, err)
+	}
+
+	err := s.r.SetRoleParents(s.ctx, viewer.ID, []string{admin.ID})
+	wantErr(t, "SetRoleParents() creating a cycle", err, repo.ErrCycle)
+
+	err = s.r.SetRoleParents(s.ctx, viewer.ID, []string{viewer.ID})
+	wantErr(t, "SetRoleParents() to the role itself", err, repo.ErrCycle)
+
+	if got, err := s.r.GetParentsOfRole(s.ctx, viewer.ID); err != nil || len(got) != 0 {
+		t.Errorf("GetParentsOfRole() after a rejected cycle = %v, %v; want none", got, err)
+	}
+
+	err = s.r.SetRoleParents(s.ctx, viewer.ID, []string{newID()})
+	wantErr(t, "SetRoleParents() to a missing role", err, repo.ErrNotFound)
+
+	err = s.r.SetRoleParents(s.ctx, newID(), []string{viewer.ID})
+	wantErr(t, "SetRoleParents() of a missing role", err, repo.ErrNotFound)
+
+	// Deleting a role in the middle cuts off what was inherited through it
+	wantNoErr(t, "DeleteRole()", s.r.DeleteRole(s.ctx, editor.ID))
+	want = []models.Permission{{Key: "admin", Val: "true"}, shared}
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, want) {
+		t.Errorf("GetPermissionsOfUser() after the parent was deleted = %v, %v; want %v", got, err, want)
+	}
+
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, admin.ID, []string{viewer.ID}))
+	wantNoErr(t, "SetRoleParents() to none", s.r.SetRoleParents(s.ctx, admin.ID, nil))
+	if got, err := s.r.GetParentsOfRole(s.ctx, admin.ID); err != nil || len(got) != 0 {
+		t.Errorf("GetParentsOfRole() after SetRoleParents() to none = %v, %v; want none", got, err)
+	}
+}
+
+func testRolesWithPermission(t *testing.T, s suite) {
+	// The value is unique so that the roles of other tests do not match in a shared database
+	permission := models.Permission{Key: "deploy", Val: newID()}
+	org := s.createOrg(t)
+	other := s.createOrg(t)
+
+	having := s.createRole(t, permission)
+	child := s.createRole(t)
+	grandchild := s.createRole(t)
+	unrelated := s.createRole(t, models.Permission{Key: "deploy", Val: "other"})
+	orgRole := s.createOrgRole(t, org.ID, permission)
+	orgChild := s.createOrgRole(t, org.ID)
+	otherRole := s.createOrgRole(t, other.ID, permission)
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, child.ID, []string{having.ID, unrelated.ID}))
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, grandchild.ID, []string{child.ID}))
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, orgChild.ID, []string{orgRole.ID}))
+
+	testCases := []struct {
+		orgID string
+		want  []models.Role
+	}{
+		{orgID: "", want: []models.Role{having, child, grandchild}},
+		{orgID: org.ID, want: []models.Role{having, child, grandchild, orgRole, orgChild}},
+		{orgID: other.ID, want: []models.Role{having, child, grandchild, otherRole}},
+	}
+	for _, tC := range testCases {
+		// A permission that no role has next to the one that some have
+		got, err := s.r.GetRolesWithPermissions(s.ctx, []models.Permission{permission, {Key: "deploy", Val: newID()}}, tC.orgID)
+		wantNoErr(t, "GetRolesWithPermissions()", err)
+		if len(got) != 2 {
+			t.Fatalf("GetRolesWithPermissions() = %v; want the roles of 2 permissions", got)
+		}
+		if !sameElements(ids(got[0], roleID), ids(tC.want, roleID)) {
+			t.Errorf("GetRolesWithPermissions() in org %q = %v; want %v", tC.orgID, ids(got[0], roleID), ids(tC.want, roleID))
+		}
+		if !slices.IsSortedFunc(got[0], func(a, b models.Role) int { return strings.Compare(a.Name, b.Name) }) {
+			t.Errorf("GetRolesWithPermissions() = %v; want sorted by name", got[0])
+		}
+		if got[1] == nil || len(got[1]) != 0 {
+			t.Errorf("GetRolesWithPermissions() of a permission no role has = %v; want none", got[1])
+		}
+	}
+
+	if got, err := s.r.GetRolesWithPermissions(s.ctx, nil, ""); err != nil || len(got) != 0 {
+		t.Errorf("GetRolesWithPermissions() of no permissions = %v, %v; want none", got, err)
+	}
+
+	// The granted permissions are patterns, the key is unique for the same reason as the value above
+	key := "projects-" + newID()[:8]
+	wildcard := s.createRole(t, models.Permission{Key: key + ":*", Val: "org/*"})
+	wildcardChild := s.createRole(t)
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, wildcardChild.ID, []string{wildcard.ID}))
+	s.createRole(t, models.Permission{Key: key + ":*", Val: "team/a"})
+	s.createRole(t, models.Permission{Key: key + ":web:deploy", Val: "*"})
+
+	got, err := s.r.GetRolesWithPermissions(s.ctx, []models.Permission{{Key: key + ":web", Val: "org/acme/project"}}, "")
+	if want := []string{wildcard.ID, wildcardChild.ID}; err != nil || len(got) != 1 || !sameElements(ids(got[0], roleID), want) {
+		t.Errorf("GetRolesWithPermissions() of a permission granted by a wildcard = %v, %v; want %v", got, err, want)
+	}
+}
+
+func testListRoles(t *testing.T, s suite) {
+	tag := "role-" + newID()[:8]
+	create := func(name string) models.Role {
+		role := models.Role{ID: newID(), Name: tag + "-" + name}
+		wantNoErr(t, "CreateRole()", s.r.CreateRole(s.ctx, role, nil))
+		return role
+	}
+
+	b := create("b")
+	a := create("a")
+	c := create("c")
+
+	list := func(params repo.ListRolesParams) [][]string {
+		var pages [][]string
+		for {
+			roles, next, err := s.r.ListRoles(s.ctx, params)
+			wantNoErr(t, "ListRoles()", err)
+			pages = append(pages, ids(roles, roleID))
+
+			if next == "" || len(pages) > 10 {
+				return pages
+			}
+			params.Cursor = next
+		}
+	}
+
+	tests := []struct {
+		name   string
+		params repo.ListRolesParams
+		want   [][]string
+	}{
+		{"by name", repo.ListRolesParams{NamePrefix: tag}, [][]string{{a.ID, b.ID, c.ID}}},
+		{"descending", repo.ListRolesParams{NamePrefix: tag, Descending: true}, [][]string{{c.ID, b.ID, a.ID}}},
+		{"prefix ignoring case", repo.ListRolesParams{NamePrefix: strings.ToUpper(tag + "-b")}, [][]string{{b.ID}}},
+		{"pages", repo.ListRolesParams{NamePrefix: tag, Limit: 2}, [][]string{{a.ID, b.ID}, {c.ID}}},
+		{"pages descending", repo.ListRolesParams{NamePrefix: tag, Descending: true, Limit: 1}, [][]string{{c.ID}, {b.ID}, {a.ID}}},
+	}
+
+	for _, tt := range tests {
+		if got := list(tt.params); !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("ListRoles() %s = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	_, next, err := s.r.ListRoles(s.ctx, repo.ListRolesParams{NamePrefix: tag, Limit: 1})
+	wantNoErr(t, "ListRoles()", err)
+	_, _, err = s.r.ListRoles(s.ctx, repo.ListRolesParams{NamePrefix: tag, Descending: true, Cursor: next})
+	wantErr(t, "ListRoles() with the cursor of another sort", err, repo.ErrInvalidCursor)
+}
+
+func testAssignRole(t *testing.T, s suite) {
+	u := s.createUser(t)
+	other := s.createUser(t)
+	first := s.createRole(t, models.Permission{Key: "admin", Val: "true"}, models.Permission{Key: "team", Val: "a"})
+	second := s.createRole(t, models.Permission{Key: "team", Val: "b"})
+	unassigned := s.createRole(t, models.Permission{Key: "team", Val: "c"})
+
+	s.assignRole(t, u.ID, first.ID)
+	s.assignRole(t, u.ID, second.ID)
+	s.assignRole(t, other.ID, first.ID)
+
+	err := s.r.AssignRole(s.ctx, u.ID, first.ID)
+	wantErr(t, "AssignRole() of an assigned role", err, repo.ErrAlreadyExists)
+
+	err = s.r.AssignRole(s.ctx, u.ID, newID())
+	wantErr(t, "AssignRole() of a missing role", err, repo.ErrNotFound)
+
+	err = s.r.AssignRole(s.ctx, newID(), first.ID)
+	wantErr(t, "AssignRole() to a missing user", err, repo.ErrNotFound)
+
+	roles, err := s.r.GetRolesOfUser(s.ctx, u.ID)
+	if err != nil || !sameElements(roles, []models.Role{first, second}) {
+		t.Errorf("GetRolesOfUser() = %v, %v; want %v", roles, err, []models.Role{first, second})
+	}
+
+	// The permissions of the user are those of all its roles
+	want := []models.Permission{{Key: "admin", Val: "true"}, {Key: "team", Val: "a"}, {Key: "team", Val: "b"}}
+	permissions, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, "")
+	if err != nil || !sameElements(permissions, want) {
+		t.Errorf("GetPermissionsOfUser() = %v, %v; want %v", permissions, err, want)
+	}
+
+	users, err := s.r.GetUsersWithRole(s.ctx, first.ID)
+	if err != nil || !sameElements(ids(users, userID), []string{u.ID, other.ID}) {
+		t.Errorf("GetUsersWithRole() = %v, %v; want %s and %s", users, err, u.ID, other.ID)
+	}
+
+	if users, err := s.r.GetUsersWithRole(s.ctx, unassigned.ID); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersWithRole() of an unassigned role = %v, %v; want none", users, err)
+	}
+
+	wantNoErr(t, "RemoveRole()", s.r.RemoveRole(s.ctx, u.ID, first.ID))
+	wantNoErr(t, "RemoveRole() of an unassigned role", s.r.RemoveRole(s.ctx, u.ID, unassigned.ID))
+
+	roles, err = s.r.GetRolesOfUser(s.ctx, u.ID)
+	if err != nil || !sameElements(ids(roles, roleID), []string{second.ID}) {
+		t.Errorf("GetRolesOfUser() after RemoveRole() = %v, %v; want %s", roles, err, second.ID)
+	}
+
+	permissions, err = s.r.GetPermissionsOfUser(s.ctx, u.ID, "")
+	if err != nil || !sameElements(permissions, []models.Permission{{Key: "team", Val: "b"}}) {
+		t.Errorf("GetPermissionsOfUser() after RemoveRole() = %v, %v; want team=b", permissions, err)
+	}
+
+	// The role is only removed from the one user
+	if roles, err := s.r.GetRolesOfUser(s.ctx, other.ID); err != nil || !sameElements(ids(roles, roleID), []string{first.ID}) {
+		t.Errorf("GetRolesOfUser() of another user = %v, %v; want %s", roles, err, first.ID)
+	}
+}
+
+func testExpiringRoles(t *testing.T, s suite) {
+	u := s.createUser(t)
+	temporary := s.createRole(t, models.Permission{Key: "team", Val: "a"})
+	expired := s.createRole(t, models.Permission{Key: "team", Val: "b"})
+	permanent := s.createRole(t, models.Permission{Key: "team", Val: "c"})
+
+	soon := time.Now().Add(time.Hour)
+	wantNoErr(t, "AssignRoleUntil()", s.r.AssignRoleUntil(s.ctx, u.ID, temporary.ID, soon))
+	wantNoErr(t, "AssignRoleUntil() in the past", s.r.AssignRoleUntil(s.ctx, u.ID, expired.ID, time.Now().Add(-time.Minute)))
+	s.assignRole(t, u.ID, permanent.ID)
+
+	err := s.r.AssignRoleUntil(s.ctx, u.ID, newID(), soon)
+	wantErr(t, "AssignRoleUntil() of a missing role", err, repo.ErrNotFound)
+
+	// An expired assignment does not count even before it is deleted
+	want := []models.Permission{{Key: "team", Val: "a"}, {Key: "team", Val: "c"}}
+	permissions, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, "")
+	if err != nil || !sameElements(permissions, want) {
+		t.Errorf("GetPermissionsOfUser() with an expired role = %v, %v; want %v", permissions, err, want)
+	}
+
+	grants, err := s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, "")
+	wantNoErr(t, "GetPermissionGrantsOfUser()", err)
+	for _, g := range grants {
+		switch g.RolePath[0] {
+		case temporary.ID:
+			if g.ExpiresAt == nil || !sameSecond(*g.ExpiresAt, soon) {
+				t.Errorf("GetPermissionGrantsOfUser() grant of the temporary role expires at %v; want %v", g.ExpiresAt, soon)
+			}
+		case permanent.ID:
+			if g.ExpiresAt != nil {
+				t.Errorf("GetPermissionGrantsOfUser() grant of the permanent role expires at %v; want nil", g.ExpiresAt)
+			}
+		}
+	}
+
+	// An assignment is only extended, not shortened, and a permanent one is kept permanent
+	err = s.r.AssignRoleUntil(s.ctx, u.ID, temporary.ID, soon.Add(-time.Minute))
+	wantErr(t, "AssignRoleUntil() expiring earlier", err, repo.ErrAlreadyExists)
+	err = s.r.AssignRoleUntil(s.ctx, u.ID, permanent.ID, soon)
+	wantErr(t, "AssignRoleUntil() of a permanent role", err, repo.ErrAlreadyExists)
+
+	later := soon.Add(time.Hour)
+	wantNoErr(t, "AssignRoleUntil() expiring later", s.r.AssignRoleUntil(s.ctx, u.ID, temporary.ID, later))
+	grants, err = s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, "")
+	if err != nil || !slices.ContainsFunc(grants, func(g models.PermissionGrant) bool {
+		return g.RolePath[0] == temporary.ID && g.ExpiresAt != nil && sameSecond(*g.ExpiresAt, later)
+	}) {
+		t.Errorf("GetPermissionGrantsOfUser() after extending = %+v, %v; want the temporary role to expire at %v", grants, err, later)
+	}
+
+	deleted, err := s.r.DeleteExpiredRoleAssignments(s.ctx, time.Now())
+	if err != nil || deleted < 1 {
+		t.Errorf("DeleteExpiredRoleAssignments() = %d, %v; want at least 1", deleted, err)
+	}
+
+	roles, err := s.r.GetRolesOfUser(s.ctx, u.ID)
+	if err != nil || !sameElements(ids(roles, roleID), []string{temporary.ID, permanent.ID}) {
+		t.Errorf("GetRolesOfUser() after DeleteExpiredRoleAssignments() = %v, %v; want %s and %s", roles, err, temporary.ID, permanent.ID)
+	}
+
+	// Assigning the role permanently removes the expiry
+	wantNoErr(t, "AssignRole() of a temporary role", s.r.AssignRole(s.ctx, u.ID, temporary.ID))
+	if _, err := s.r.DeleteExpiredRoleAssignments(s.ctx, later.Add(time.Hour)); err != nil {
+		t.Errorf("DeleteExpiredRoleAssignments() = %v; want nil", err)
+	}
+	roles, err = s.r.GetRolesOfUser(s.ctx, u.ID)
+	if err != nil || !sameElements(ids(roles, roleID), []string{temporary.ID, permanent.ID}) {
+		t.Errorf("GetRolesOfUser() after assigning permanently = %v, %v; want %s and %s", roles, err, temporary.ID, permanent.ID)
+	}
+}
+
+func testDeleteRole(t *testing.T, s suite) {
+	u := s.createUser(t)
+	role := s.createRole(t, models.Permission{Key: "admin", Val: "true"})
+	kept := s.createRole(t, models.Permission{Key: "team", Val: "a"})
+	s.assignRole(t, u.ID, role.ID)
+	s.assignRole(t, u.ID, kept.ID)
+
+	invitation := newInvitation(u.ID, role.ID, kept.ID)
+	wantNoErr(t, "CreateInvitation()", s.r.CreateInvitation(s.ctx, invitation))
+
+	wantNoErr(t, "DeleteRole()", s.r.DeleteRole(s.ctx, role.ID))
+
+	_, err := s.r.GetRole(s.ctx, role.ID)
+	wantErr(t, "GetRole() of a deleted role", err, repo.ErrNotFound)
+
+	// The role is removed from the users and invitations, and its permissions are no longer granted
+	if roles, err := s.r.GetRolesOfUser(s.ctx, u.ID); err != nil || !sameElements(ids(roles, roleID), []string{kept.ID}) {
+		t.Errorf("GetRolesOfUser() after DeleteRole() = %v, %v; want %s", roles, err, kept.ID)
+	}
+
+	if permissions, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(permissions, []models.Permission{{Key: "team", Val: "a"}}) {
+		t.Errorf("GetPermissionsOfUser() after DeleteRole() = %v, %v; want team=a", permissions, err)
+	}
+
+	if permissions, err := s.r.GetPermissionsOfRole(s.ctx, role.ID); err != nil || len(permissions) != 0 {
+		t.Errorf("GetPermissionsOfRole() of a deleted role = %v, %v; want none", permissions, err)
+	}
+
+	if got, err := s.r.GetInvitation(s.ctx, invitation.ID); err != nil || !sameElements(got.RoleIDs, []string{kept.ID}) {
+		t.Errorf("GetInvitation().RoleIDs after DeleteRole() = %v, %v; want %s", got.RoleIDs, err, kept.ID)
+	}
+
+	// A new role can take the name
+	wantNoErr(t, "CreateRole() with the name of a deleted role", s.r.CreateRole(s.ctx, models.Role{ID: newID(), Name: role.Name}, nil))
+
+	err = s.r.DeleteRole(s.ctx, role.ID)
+	wantErr(t, "DeleteRole() of a deleted role", err, repo.ErrNotFound)
+}
+
+func testUsersAffectedByRole(t *testing.T, s suite) {
+	direct, member, inheriting, expired, unaffected := s.createUser(t), s.createUser(t), s.createUser(t), s.createUser(t), s.createUser(t)
+	role := s.createRole(t, models.Permission{Key: "admin", Val: "true"})
+	child := s.createRole(t, models.Permission{Key: "team", Val: "a"})
+	other := s.createRole(t, models.Permission{Key: "team", Val: "b"})
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, child.ID, []string{role.ID}))
+
+	s.assignRole(t, direct.ID, role.ID)
+	s.assignRole(t, inheriting.ID, child.ID)
+	s.assignRole(t, unaffected.ID, other.ID)
+	wantNoErr(t, "AssignRoleUntil()", s.r.AssignRoleUntil(s.ctx, expired.ID, role.ID, time.Now().Add(-time.Hour)))
+
+	// The role is only assigned to the group of the member
+	group := s.createGroup(t)
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, member.ID))
+	wantNoErr(t, "AssignGroupRole()", s.r.AssignGroupRole(s.ctx, group.ID, role.ID))
+
+	users, err := s.r.GetUsersAffectedByRole(s.ctx, role.ID)
+	if want := []string{direct.ID, member.ID, inheriting.ID}; err != nil || !sameElements(ids(users, userID), want) {
+		t.Errorf("GetUsersAffectedByRole() = %v, %v; want %v", users, err, want)
+	}
+
+	// The users of the child role do not get anything from its parent
+	if users, err := s.r.GetUsersAffectedByRole(s.ctx, child.ID); err != nil || !sameElements(ids(users, userID), []string{inheriting.ID}) {
+		t.Errorf("GetUsersAffectedByRole() of the child role = %v, %v; want %s", users, err, inheriting.ID)
+	}
+
+	if users, err := s.r.GetUsersAffectedByRole(s.ctx, newID()); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersAffectedByRole() of a missing role = %v, %v; want none", users, err)
+	}
+}
+
+func testGroups(t *testing.T, s suite) {
+	group := s.createGroup(t)
+
+	if got, err := s.r.GetGroup(s.ctx, group.ID); err != nil || got != group {
+		t.Errorf("GetGroup() = %v, %v; want %v", got, err, group)
+	}
+
+	_, err := s.r.GetGroup(s.ctx, newID())
+	wantErr(t, "GetGroup() of a missing group", err, repo.ErrNotFound)
+
+	err = s.r.CreateGroup(s.ctx, models.Group{ID: newID(), Name: group.Name})
+	wantErr(t, "CreateGroup() with a taken name", err, repo.ErrAlreadyExists)
+
+	other := s.createGroup(t)
+	group.Name = "a-" + group.Name
+	group.Description = "Renamed"
+	wantNoErr(t, "UpdateGroup()", s.r.UpdateGroup(s.ctx, group))
+	if got, err := s.r.GetGroup(s.ctx, group.ID); err != nil || got != group {
+		t.Errorf("GetGroup() after UpdateGroup() = %v, %v; want %v", got, err, group)
+	}
+
+	wantNoErr(t, "UpdateGroup() without changes", s.r.UpdateGroup(s.ctx, group))
+
+	err = s.r.UpdateGroup(s.ctx, models.Group{ID: group.ID, Name: other.Name})
+	wantErr(t, "UpdateGroup() to a taken name", err, repo.ErrAlreadyExists)
+
+	err = s.r.UpdateGroup(s.ctx, models.Group{ID: newID(), Name: "group-" + newID()})
+	wantErr(t, "UpdateGroup() of a missing group", err, repo.ErrNotFound)
+
+	// The groups are ordered by name, other groups may exist in a shared database
+	groups, err := s.r.ListGroups(s.ctx)
+	wantNoErr(t, "ListGroups()", err)
+	got := slices.DeleteFunc(ids(groups, groupID), func(id string) bool { return id != group.ID && id != other.ID })
+	if !slices.Equal(got, []string{group.ID, other.ID}) {
+		t.Errorf("ListGroups() = %v; want %s before %s", got, group.ID, other.ID)
+	}
+
+	u := s.createUser(t)
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, u.ID))
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, other.ID, u.ID))
+
+	err = s.r.AddGroupMember(s.ctx, group.ID, u.ID)
+	wantErr(t, "AddGroupMember() twice", err, repo.ErrAlreadyExists)
+
+	err = s.r.AddGroupMember(s.ctx, group.ID, newID())
+	wantErr(t, "AddGroupMember() of a missing user", err, repo.ErrNotFound)
+
+	err = s.r.AddGroupMember(s.ctx, newID(), u.ID)
+	wantErr(t, "AddGroupMember() to a missing group", err, repo.ErrNotFound)
+
+	if members, err := s.r.GetGroupMembers(s.ctx, group.ID); err != nil || !slices.Equal(members, []models.User{u}) {
+		t.Errorf("GetGroupMembers() = %v, %v; want %v", members, err, u)
+	}
+
+	if got, err := s.r.GetGroupsOfUser(s.ctx, u.ID); err != nil || !slices.Equal(got, []models.Group{group, other}) {
+		t.Errorf("GetGroupsOfUser() = %v, %v; want %v", got, err, []models.Group{group, other})
+	}
+
+	wantNoErr(t, "RemoveGroupMember()", s.r.RemoveGroupMember(s.ctx, other.ID, u.ID))
+	err = s.r.RemoveGroupMember(s.ctx, other.ID, u.ID)
+	wantErr(t, "RemoveGroupMember() of a user that is not a member", err, repo.ErrNotFound)
+
+	if got, err := s.r.GetGroupsOfUser(s.ctx, u.ID); err != nil || !slices.Equal(got, []models.Group{group}) {
+		t.Errorf("GetGroupsOfUser() after RemoveGroupMember() = %v, %v; want %v", got, err, group)
+	}
+
+	role := s.createRole(t)
+	wantNoErr(t, "AssignGroupRole()", s.r.AssignGroupRole(s.ctx, group.ID, role.ID))
+
+	err = s.r.AssignGroupRole(s.ctx, group.ID, role.ID)
+	wantErr(t, "AssignGroupRole() twice", err, repo.ErrAlreadyExists)
+
+	err = s.r.AssignGroupRole(s.ctx, group.ID, newID())
+	wantErr(t, "AssignGroupRole() of a missing role", err, repo.ErrNotFound)
+
+	err = s.r.AssignGroupRole(s.ctx, newID(), role.ID)
+	wantErr(t, "AssignGroupRole() to a missing group", err, repo.ErrNotFound)
+
+	if roles, err := s.r.GetRolesOfGroup(s.ctx, group.ID); err != nil || !slices.Equal(roles, []models.Role{role}) {
+		t.Errorf("GetRolesOfGroup() = %v, %v; want %v", roles, err, role)
+	}
+
+	// Roles of a group are not assigned to the members directly
+	if roles, err := s.r.GetRolesOfUser(s.ctx, u.ID); err != nil || len(roles) != 0 {
+		t.Errorf("GetRolesOfUser() of a group member = %v, %v; want none", roles, err)
+	}
+
+	if users, err := s.r.GetUsersWithRole(s.ctx, role.ID); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersWithRole() of a group role = %v, %v; want none", users, err)
+	}
+
+	wantNoErr(t, "RemoveGroupRole()", s.r.RemoveGroupRole(s.ctx, group.ID, role.ID))
+	err = s.r.RemoveGroupRole(s.ctx, group.ID, role.ID)
+	wantErr(t, "RemoveGroupRole() of a role that is not assigned", err, repo.ErrNotFound)
+
+	// Deleted users are not members
+	wantNoErr(t, "SoftDeleteUser()", s.r.SoftDeleteUser(s.ctx, u.ID, time.Now().UTC()))
+	if members, err := s.r.GetGroupMembers(s.ctx, group.ID); err != nil || len(members) != 0 {
+		t.Errorf("GetGroupMembers() after SoftDeleteUser() = %v, %v; want none", members, err)
+	}
+
+	wantNoErr(t, "DeleteGroup()", s.r.DeleteGroup(s.ctx, group.ID))
+	_, err = s.r.GetGroup(s.ctx, group.ID)
+	wantErr(t, "GetGroup() of a deleted group", err, repo.ErrNotFound)
+
+	err = s.r.DeleteGroup(s.ctx, group.ID)
+	wantErr(t, "DeleteGroup() of a deleted group", err, repo.ErrNotFound)
+
+	// A new group can take the name
+	wantNoErr(t, "CreateGroup() with the name of a deleted group", s.r.CreateGroup(s.ctx, models.Group{ID: newID(), Name: group.Name}))
+}
+
+func testGroupPermissions(t *testing.T, s suite) {
+	shared := models.Permission{Key: "team", Val: "a"}
+	viewer := s.createRole(t, models.Permission{Key: "read", Val: "true"})
+	editor := s.createRole(t, models.Permission{Key: "write", Val: "true"}, shared)
+	direct := s.createRole(t, shared)
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, editor.ID, []string{viewer.ID}))
+
+	group := s.createGroup(t)
+	wantNoErr(t, "AssignGroupRole()", s.r.AssignGroupRole(s.ctx, group.ID, editor.ID))
+
+	u := s.createUser(t)
+	s.assignRole(t, u.ID, direct.ID)
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, u.ID))
+
+	// The roles of the group and their parents are granted to the members
+	want := []models.Permission{{Key: "write", Val: "true"}, {Key: "read", Val: "true"}, shared}
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, want) {
+		t.Errorf("GetPermissionsOfUser() of a group member = %v, %v; want %v", got, err, want)
+	}
+
+	grants, err := s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, "")
+	wantNoErr(t, "GetPermissionGrantsOfUser()", err)
+	var got []string
+	for _, g := range grants {
+		got = append(got, g.GroupID+">"+grantStrings([]models.PermissionGrant{g})[0])
+	}
+	wantGrants := []string{
+		">team=a:" + direct.ID,
+		group.ID + ">write=true:" + editor.ID,
+		group.ID + ">team=a:" + editor.ID,
+		group.ID + ">read=true:" + editor.ID + "/" + viewer.ID,
+	}
+	if !sameElements(got, wantGrants) {
+		t.Errorf("GetPermissionGrantsOfUser() = %v; want %v", got, wantGrants)
+	}
+
+	// A user outside the group does not get its roles
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, s.createUser(t).ID, ""); err != nil || len(got) != 0 {
+		t.Errorf("GetPermissionsOfUser() of a user outside the group = %v, %v; want none", got, err)
+	}
+
+	wantNoErr(t, "RemoveGroupMember()", s.r.RemoveGroupMember(s.ctx, group.ID, u.ID))
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, []models.Permission{shared}) {
+		t.Errorf("GetPermissionsOfUser() after RemoveGroupMember() = %v, %v; want %v", got, err, shared)
+	}
+
+	// Deleting the role or the group takes away what was granted through it
+	other := s.createRole(t, models.Permission{Key: "admin", Val: "true"})
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, u.ID))
+	wantNoErr(t, "AssignGroupRole()", s.r.AssignGroupRole(s.ctx, group.ID, other.ID))
+	wantNoErr(t, "DeleteRole()", s.r.DeleteRole(s.ctx, editor.ID))
+	want = []models.Permission{{Key: "admin", Val: "true"}, shared}
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, want) {
+		t.Errorf("GetPermissionsOfUser() after DeleteRole() = %v, %v; want %v", got, err, want)
+	}
+
+	wantNoErr(t, "DeleteGroup()", s.r.DeleteGroup(s.ctx, group.ID))
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, ""); err != nil || !sameElements(got, []models.Permission{shared}) {
+		t.Errorf("GetPermissionsOfUser() after DeleteGroup() = %v, %v; want %v", got, err, shared)
+	}
+
+	// Deleting a member removes it from the group
+	group = s.createGroup(t)
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, u.ID))
+	wantNoErr(t, "DeleteUser()", s.r.DeleteUser(s.ctx, u.ID))
+	if groups, err := s.r.GetGroupsOfUser(s.ctx, u.ID); err != nil || len(groups) != 0 {
+		t.Errorf("GetGroupsOfUser() of a deleted user = %v, %v; want none", groups, err)
+	}
+}
+
+func testOrgs(t *testing.T, s suite) {
+	org := s.createOrg(t)
+
+	if got, err := s.r.GetOrg(s.ctx, org.ID); err != nil || got != org {
+		t.Errorf("GetOrg() = %v, %v; want %v", got, err, org)
+	}
+
+	_, err := s.r.GetOrg(s.ctx, newID())
+	wantErr(t, "GetOrg() of a missing org", err, repo.ErrNotFound)
+
+	err = s.r.CreateOrg(s.ctx, models.Org{ID: newID(), Name: org.Name})
+	wantErr(t, "CreateOrg() with a taken name", err, repo.ErrAlreadyExists)
+
+	other := s.createOrg(t)
+	org.Name = "a-" + org.Name
+	wantNoErr(t, "UpdateOrg()", s.r.UpdateOrg(s.ctx, org))
+	wantNoErr(t, "UpdateOrg() without changes", s.r.UpdateOrg(s.ctx, org))
+
+	err = s.r.UpdateOrg(s.ctx, models.Org{ID: org.ID, Name: other.Name})
+	wantErr(t, "UpdateOrg() to a taken name", err, repo.ErrAlreadyExists)
+
+	err = s.r.UpdateOrg(s.ctx, models.Org{ID: newID(), Name: "org-" + newID()})
+	wantErr(t, "UpdateOrg() of a missing org", err, repo.ErrNotFound)
+
+	// The orgs are ordered by name, other orgs may exist in a shared database
+	orgs, err := s.r.ListOrgs(s.ctx)
+	wantNoErr(t, "ListOrgs()", err)
+	got := slices.DeleteFunc(ids(orgs, orgID), func(id string) bool { return id != org.ID && id != other.ID })
+	if !slices.Equal(got, []string{org.ID, other.ID}) {
+		t.Errorf("ListOrgs() = %v; want %s before %s", got, org.ID, other.ID)
+	}
+
+	u := s.createUser(t)
+	wantNoErr(t, "AddOrgMember()", s.r.AddOrgMember(s.ctx, other.ID, u.ID))
+	wantNoErr(t, "AddOrgMember()", s.r.AddOrgMember(s.ctx, org.ID, u.ID))
+
+	err = s.r.AddOrgMember(s.ctx, org.ID, u.ID)
+	wantErr(t, "AddOrgMember() twice", err, repo.ErrAlreadyExists)
+
+	err = s.r.AddOrgMember(s.ctx, org.ID, newID())
+	wantErr(t, "AddOrgMember() of a missing user", err, repo.ErrNotFound)
+
+	err = s.r.AddOrgMember(s.ctx, newID(), u.ID)
+	wantErr(t, "AddOrgMember() to a missing org", err, repo.ErrNotFound)
+
+	if members, err := s.r.GetOrgMembers(s.ctx, org.ID); err != nil || !slices.Equal(members, []models.User{u}) {
+		t.Errorf("GetOrgMembers() = %v, %v; want %v", members, err, u)
+	}
+
+	if got, err := s.r.GetOrgsOfUser(s.ctx, u.ID); err != nil || !slices.Equal(got, []models.Org{org, other}) {
+		t.Errorf("GetOrgsOfUser() = %v, %v; want %v", got, err, []models.Org{org, other})
+	}
+
+	wantNoErr(t, "RemoveOrgMember()", s.r.RemoveOrgMember(s.ctx, other.ID, u.ID))
+	err = s.r.RemoveOrgMember(s.ctx, other.ID, u.ID)
+	wantErr(t, "RemoveOrgMember() of a user that is not a member", err, repo.ErrNotFound)
+
+	if got, err := s.r.GetOrgsOfUser(s.ctx, u.ID); err != nil || !slices.Equal(got, []models.Org{org}) {
+		t.Errorf("GetOrgsOfUser() after RemoveOrgMember() = %v, %v; want %v", got, err, org)
+	}
+
+	// Deleting the org deletes its roles, the global roles are kept
+	role := s.createOrgRole(t, org.ID)
+	global := s.createRole(t)
+	wantNoErr(t, "DeleteOrg()", s.r.DeleteOrg(s.ctx, org.ID))
+
+	_, err = s.r.GetOrg(s.ctx, org.ID)
+	wantErr(t, "GetOrg() of a deleted org", err, repo.ErrNotFound)
+
+	_, err = s.r.GetRole(s.ctx, role.ID)
+	wantErr(t, "GetRole() of a role of a deleted org", err, repo.ErrNotFound)
+
+	if got, err := s.r.GetRole(s.ctx, global.ID); err != nil || got != global {
+		t.Errorf("GetRole() of a global role after DeleteOrg() = %v, %v; want %v", got, err, global)
+	}
+
+	if got, err := s.r.GetOrgsOfUser(s.ctx, u.ID); err != nil || len(got) != 0 {
+		t.Errorf("GetOrgsOfUser() after DeleteOrg() = %v, %v; want none", got, err)
+	}
+
+	err = s.r.DeleteOrg(s.ctx, org.ID)
+	wantErr(t, "DeleteOrg() of a deleted org", err, repo.ErrNotFound)
+
+	err = s.r.CreateRole(s.ctx, models.Role{ID: newID(), Name: "role-" + newID(), OrgID: org.ID}, nil)
+	wantErr(t, "CreateRole() in a missing org", err, repo.ErrNotFound)
+}
+
+func testOrgRoles(t *testing.T, s suite) {
+	global := s.createRole(t, models.Permission{Key: "global", Val: "true"})
+	org := s.createOrg(t)
+	other := s.createOrg(t)
+	member := s.createOrgRole(t, org.ID, models.Permission{Key: "team", Val: "a"})
+	otherMember := s.createOrgRole(t, other.ID, models.Permission{Key: "team", Val: "b"})
+
+	if got, err := s.r.GetRole(s.ctx, member.ID); err != nil || got != member {
+		t.Errorf("GetRole() of an org role = %v, %v; want %v", got, err, member)
+	}
+
+	u := s.createUser(t)
+	wantNoErr(t, "AddOrgMember()", s.r.AddOrgMember(s.ctx, org.ID, u.ID))
+	wantNoErr(t, "AddOrgMember()", s.r.AddOrgMember(s.ctx, other.ID, u.ID))
+	s.assignRole(t, u.ID, global.ID)
+	s.assignRole(t, u.ID, member.ID)
+	s.assignRole(t, u.ID, otherMember.ID)
+
+	tests := []struct {
+		name  string
+		orgID string
+		want  []models.Permission
+	}{
+		{"without an org", "", []models.Permission{{Key: "global", Val: "true"}}},
+		{"in the org", org.ID, []models.Permission{{Key: "global", Val: "true"}, {Key: "team", Val: "a"}}},
+		{"in the other org", other.ID, []models.Permission{{Key: "global", Val: "true"}, {Key: "team", Val: "b"}}},
+	}
+	for _, tt := range tests {
+		if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, tt.orgID); err != nil || !sameElements(got, tt.want) {
+			t.Errorf("GetPermissionsOfUser() %s = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	_, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, newID())
+	wantErr(t, "GetPermissionsOfUser() in a missing org", err, repo.ErrNotMember)
+
+	// A parent of another org is not inherited, and a global role does not grant org roles outside the org
+	wantNoErr(t, "SetRoleParents()", s.r.SetRoleParents(s.ctx, global.ID, []string{otherMember.ID}))
+	want := []models.Permission{{Key: "global", Val: "true"}, {Key: "team", Val: "a"}}
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, u.ID, org.ID); err != nil || !sameElements(got, want) {
+		t.Errorf("GetPermissionsOfUser() with a parent of another org = %v, %v; want %v", got, err, want)
+	}
+
+	// The roles of the org are only granted to its members, also through groups
+	group := s.createGroup(t)
+	wantNoErr(t, "AssignGroupRole()", s.r.AssignGroupRole(s.ctx, group.ID, member.ID))
+	outsider := s.createUser(t)
+	wantNoErr(t, "AddGroupMember()", s.r.AddGroupMember(s.ctx, group.ID, outsider.ID))
+	_, err = s.r.GetPermissionsOfUser(s.ctx, outsider.ID, org.ID)
+	wantErr(t, "GetPermissionsOfUser() of a user outside the org", err, repo.ErrNotMember)
+	_, err = s.r.GetPermissionGrantsOfUser(s.ctx, outsider.ID, org.ID)
+	wantErr(t, "GetPermissionGrantsOfUser() of a user outside the org", err, repo.ErrNotMember)
+	if got, err := s.r.GetPermissionsOfUser(s.ctx, outsider.ID, ""); err != nil || len(got) != 0 {
+		t.Errorf("GetPermissionsOfUser() of a user outside the org without an org = %v, %v; want none", got, err)
+	}
+
+	// Leaving the org removes its roles from the user
+	wantNoErr(t, "RemoveOrgMember()", s.r.RemoveOrgMember(s.ctx, org.ID, u.ID))
+	if roles, err := s.r.GetRolesOfUser(s.ctx, u.ID); err != nil || !sameElements(ids(roles, roleID), []string{global.ID, otherMember.ID}) {
+		t.Errorf("GetRolesOfUser() after RemoveOrgMember() = %v, %v; want %s and %s", roles, err, global.ID, otherMember.ID)
+	}
+
+	// The roles can be listed by org
+	list := func(orgID *string) []string {
+		roles, _, err := s.r.ListRoles(s.ctx, repo.ListRolesParams{OrgID: orgID})
+		wantNoErr(t, "ListRoles()", err)
+		return slices.DeleteFunc(ids(roles, roleID), func(id string) bool {
+			return id != global.ID && id != member.ID && id != otherMember.ID
+		})
+	}
+	none := ""
+	if got := list(&org.ID); !slices.Equal(got, []string{member.ID}) {
+		t.Errorf("ListRoles() of the org = %v; want %s", got, member.ID)
+	}
+	if got := list(&none); !slices.Equal(got, []string{global.ID}) {
+		t.Errorf("ListRoles() of no org = %v; want %s", got, global.ID)
+	}
+	if got := list(nil); !sameElements(got, []string{global.ID, member.ID, otherMember.ID}) {
+		t.Errorf("ListRoles() = %v; want all three roles", got)
+	}
+}
+
+func testLocalCredentials(t *testing.T, s suite) {
+	u := s.createUser(t)
+
+	_, err := s.r.GetLocalCredential(s.ctx, u.ID)
+	wantErr(t, "GetLocalCredential() without a password", err, repo.ErrNotFound)
+
+	wantNoErr(t, "SetPasswordHash()", s.r.SetPasswordHash(s.ctx, u.ID, "hash"))
+	if cred, err := s.r.GetLocalCredential(s.ctx, u.ID); err != nil || cred != (models.LocalCredential{UserID: u.ID, PasswordHash: "hash"}) {
+		t.Errorf("GetLocalCredential() = %+v, %v; want hash without failures", cred, err)
+	}
+
+	lockedUntil := time.Now().Add(time.Hour)
+	wantNoErr(t, "SetLoginFailures()", s.r.SetLoginFailures(s.ctx, u.ID, 5, &lockedUntil))
+	cred, err := s.r.GetLocalCredential(s.ctx, u.ID)
+	if err != nil || cred.FailedAttempts != 5 || cred.LockedUntil == nil || !sameSecond(*cred.LockedUntil, lockedUntil) {
+		t.Errorf("GetLocalCredential() = %+v, %v; want 5 failures locked until %v", cred, err, lockedUntil)
+	}
+
+	wantNoErr(t, "SetLoginFailures() without a lock", s.r.SetLoginFailures(s.ctx, u.ID, 1, nil))
+	if cred, err := s.r.GetLocalCredential(s.ctx, u.ID); err != nil || cred.FailedAttempts != 1 || cred.LockedUntil != nil {
+		t.Errorf("GetLocalCredential() = %+v, %v; want 1 failure and no lock", cred, err)
+	}
+
+	// Every concurrent increment gets a count of its own
+	counts := make(chan int, 10)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cred, err := s.r.IncrementLoginFailures(s.ctx, u.ID, time.Now().UTC())
+			wantNoErr(t, "IncrementLoginFailures()", err)
+			counts <- cred.FailedAttempts
+		}()
+	}
+	wg.Wait()
+	close(counts)
+	var got []int
+	for n := range counts {
+		got = append(got, n)
+	}
+	if slices.Sort(got); !slices.Equal(got, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+		t.Errorf("IncrementLoginFailures() concurrently = %v; want each of 2 to 11", got)
+	}
+
+	// A lock is kept until it expires, then the count starts over
+	now := time.Now().UTC()
+	lockedUntil = now.Add(time.Hour)
+	wantNoErr(t, "SetLoginFailures()", s.r.SetLoginFailures(s.ctx, u.ID, 5, &lockedUntil))
+	if cred, err := s.r.IncrementLoginFailures(s.ctx, u.ID, now); err != nil || cred.FailedAttempts != 6 || cred.LockedUntil == nil {
+		t.Errorf("IncrementLoginFailures() while locked = %+v, %v; want 6 failures and the lock", cred, err)
+	}
+	if cred, err := s.r.IncrementLoginFailures(s.ctx, u.ID, lockedUntil.Add(time.Second)); err != nil || cred.FailedAttempts != 1 || cred.LockedUntil != nil {
+		t.Errorf("IncrementLoginFailures() after the lock = %+v, %v; want 1 failure and no lock", cred, err)
+	}
+
+	_, err = s.r.IncrementLoginFailures(s.ctx, newID(), now)
+	wantErr(t, "IncrementLoginFailures() without a credential", err, repo.ErrNotFound)
+
+	// Setting the password clears the failures
+	wantNoErr(t, "SetLoginFailures()", s.r.SetLoginFailures(s.ctx, u.ID, 5, &lockedUntil))
+	wantNoErr(t, "SetPasswordHash() of an existing credential", s.r.SetPasswordHash(s.ctx, u.ID, "new-hash"))
+	if cred, err := s.r.GetLocalCredential(s.ctx, u.ID); err != nil || cred != (models.LocalCredential{UserID: u.ID, PasswordHash: "new-hash"}) {
+		t.Errorf("GetLocalCredential() after SetPasswordHash() = %+v, %v; want new-hash without failures", cred, err)
+	}
+
+	id := newID()
+	withPassword := models.User{ID: id, Name: "Test " + id[:8], Email: id[:8] + "@example.com"}
+	wantNoErr(t, "CreateUserWithPassword()", s.r.CreateUserWithPassword(s.ctx, withPassword, models.UserProvider{Type: models.UserProviderTypeLocal, UserID: "local:" + id}, "hash"))
+	if cred, err := s.r.GetLocalCredential(s.ctx, id); err != nil || cred != (models.LocalCredential{UserID: id, PasswordHash: "hash"}) {
+		t.Errorf("GetLocalCredential() of a user created with a password = %+v, %v; want hash", cred, err)
+	}
+
+	// Nothing is saved if the provider id is taken
+	id = newID()
+	err = s.r.CreateUserWithPassword(s.ctx, models.User{ID: id, Name: "Test " + id[:8], Email: id[:8] + "@example.com"}, models.UserProvider{Type: models.UserProviderTypeLocal, UserID: "local:" + withPassword.ID}, "hash")
+	wantErr(t, "CreateUserWithPassword() with a taken provider id", err, repo.ErrAlreadyExists)
+	_, err = s.r.GetUser(s.ctx, repo.GetUserParams{ID: &id})
+	wantErr(t, "GetUser() after a failed CreateUserWithPassword()", err, repo.ErrNotFound)
+}
+
+func sameSecond(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func testMFA(t *testing.T, s suite) {
+	u := s.createUser(t)
+
+	_, err := s.r.GetTOTP(s.ctx, u.ID)
+	wantErr(t, "GetTOTP() without a secret", err, repo.ErrNotFound)
+
+	totp := models.TOTP{UserID: u.ID, Secret: "FIRST"}
+	wantNoErr(t, "SetTOTP()", s.r.SetTOTP(s.ctx, totp))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got != totp {
+		t.Errorf("GetTOTP() = %+v, %v; want %+v", got, err, totp)
+	}
+
+	totp = models.TOTP{UserID: u.ID, Secret: "SECOND", Enabled: true, LastUsedStep: 58000000}
+	wantNoErr(t, "SetTOTP() replacing the secret", s.r.SetTOTP(s.ctx, totp))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got != totp {
+		t.Errorf("GetTOTP() = %+v, %v; want %+v", got, err, totp)
+	}
+
+	lockedUntil := time.Now().Add(time.Hour)
+	locked := models.TOTP{UserID: u.ID, Secret: "SECOND", Enabled: true, LastUsedStep: 58000000, FailedAttempts: 3, LockedUntil: &lockedUntil}
+	wantNoErr(t, "SetTOTP() with failures", s.r.SetTOTP(s.ctx, locked))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got.FailedAttempts != 3 || got.LockedUntil == nil || !sameSecond(*got.LockedUntil, lockedUntil) {
+		t.Errorf("GetTOTP() = %+v, %v; want 3 failures locked until %v", got, err, lockedUntil)
+	}
+
+	wantNoErr(t, "SetTOTP() clearing the failures", s.r.SetTOTP(s.ctx, totp))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got != totp {
+		t.Errorf("GetTOTP() = %+v, %v; want %+v", got, err, totp)
+	}
+
+	// Only the failures are set, the secret is kept
+	wantNoErr(t, "SetMFAFailures()", s.r.SetMFAFailures(s.ctx, u.ID, 4, &lockedUntil))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got.Secret != totp.Secret || got.FailedAttempts != 4 || got.LockedUntil == nil || !sameSecond(*got.LockedUntil, lockedUntil) {
+		t.Errorf("GetTOTP() = %+v, %v; want the secret with 4 failures locked until %v", got, err, lockedUntil)
+	}
+
+	now := time.Now().UTC()
+	if got, err := s.r.IncrementMFAFailures(s.ctx, u.ID, now); err != nil || got.FailedAttempts != 5 || got.LockedUntil == nil {
+		t.Errorf("IncrementMFAFailures() while locked = %+v, %v; want 5 failures and the lock", got, err)
+	}
+	if got, err := s.r.IncrementMFAFailures(s.ctx, u.ID, lockedUntil.Add(time.Second)); err != nil || got.FailedAttempts != 1 || got.LockedUntil != nil || got.Secret != totp.Secret {
+		t.Errorf("IncrementMFAFailures() after the lock = %+v, %v; want the secret with 1 failure and no lock", got, err)
+	}
+
+	counts := make(chan int, 10)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := s.r.IncrementMFAFailures(s.ctx, u.ID, time.Now().UTC())
+			wantNoErr(t, "IncrementMFAFailures()", err)
+			counts <- got.FailedAttempts
+		}()
+	}
+	wg.Wait()
+	close(counts)
+	var got []int
+	for n := range counts {
+		got = append(got, n)
+	}
+	if slices.Sort(got); !slices.Equal(got, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+		t.Errorf("IncrementMFAFailures() concurrently = %v; want each of 2 to 11", got)
+	}
+
+	wantNoErr(t, "SetMFAFailures() clearing the failures", s.r.SetMFAFailures(s.ctx, u.ID, 0, nil))
+	if got, err := s.r.GetTOTP(s.ctx, u.ID); err != nil || got != totp {
+		t.Errorf("GetTOTP() = %+v, %v; want %+v", got, err, totp)
+	}
+
+	_, err = s.r.IncrementMFAFailures(s.ctx, newID(), now)
+	wantErr(t, "IncrementMFAFailures() without a TOTP", err, repo.ErrNotFound)
+
+	wantNoErr(t, "SetRecoveryCodes()", s.r.SetRecoveryCodes(s.ctx, u.ID, []string{"a", "b"}))
+	wantNoErr(t, "UseRecoveryCode()", s.r.UseRecoveryCode(s.ctx, u.ID, "a"))
+
+	err = s.r.UseRecoveryCode(s.ctx, u.ID, "a")
+	wantErr(t, "UseRecoveryCode() of a used code", err, repo.ErrNotFound)
+
+	err = s.r.UseRecoveryCode(s.ctx, u.ID, "c")
+	wantErr(t, "UseRecoveryCode() of a missing code", err, repo.ErrNotFound)
+
+	// The codes of the user are not valid for another user
+	other := s.createUser(t)
+	err = s.r.UseRecoveryCode(s.ctx, other.ID, "b")
+	wantErr(t, "UseRecoveryCode() of another user", err, repo.ErrNotFound)
+
+	// Setting the codes replaces the old ones
+	wantNoErr(t, "SetRecoveryCodes() replacing the codes", s.r.SetRecoveryCodes(s.ctx, u.ID, []string{"a", "c"}))
+	err = s.r.UseRecoveryCode(s.ctx, u.ID, "b")
+	wantErr(t, "UseRecoveryCode() of a replaced code", err, repo.ErrNotFound)
+	wantNoErr(t, "UseRecoveryCode() of a new code", s.r.UseRecoveryCode(s.ctx, u.ID, "a"))
+
+	wantNoErr(t, "DeleteTOTP()", s.r.DeleteTOTP(s.ctx, u.ID))
+
+	_, err = s.r.GetTOTP(s.ctx, u.ID)
+	wantErr(t, "GetTOTP() after DeleteTOTP()", err, repo.ErrNotFound)
+
+	err = s.r.UseRecoveryCode(s.ctx, u.ID, "c")
+	wantErr(t, "UseRecoveryCode() after DeleteTOTP()", err, repo.ErrNotFound)
+
+	wantNoErr(t, "DeleteTOTP() without a secret", s.r.DeleteTOTP(s.ctx, u.ID))
+}
+
+func newCredential(userID string) models.WebAuthnCredential {
+	return models.WebAuthnCredential{
+		ID:              []byte(newID()),
+		UserID:          userID,
+		Name:            "Security key",
+		PublicKey:       []byte{1, 2, 3},
+		AttestationType: "none",
+		Transports:      []string{"usb", "nfc"},
+		AAGUID:          make([]byte, 16),
+		BackupEligible:  true,
+	}
+}
+
+func testWebAuthn(t *testing.T, s suite) {
+	u := s.createUser(t)
+	other := s.createUser(t)
+
+	if creds, err := s.r.GetWebAuthnCredentialsOfUser(s.ctx, u.ID); err != nil || len(creds) != 0 {
+		t.Errorf("GetWebAuthnCredentialsOfUser() without credentials = %v, %v; want none", creds, err)
+	}
+
+	cred := newCredential(u.ID)
+	wantNoErr(t, "CreateWebAuthnCredential()", s.r.CreateWebAuthnCredential(s.ctx, cred))
+
+	err := s.r.CreateWebAuthnCredential(s.ctx, models.WebAuthnCredential{ID: cred.ID, UserID: other.ID, Name: "Copy", PublicKey: []byte{1}, AAGUID: make([]byte, 16)})
+	wantErr(t, "CreateWebAuthnCredential() with a taken id", err, repo.ErrAlreadyExists)
+
+	creds, err := s.r.GetWebAuthnCredentialsOfUser(s.ctx, u.ID)
+	wantNoErr(t, "GetWebAuthnCredentialsOfUser()", err)
+	if len(creds) != 1 {
+		t.Fatalf("GetWebAuthnCredentialsOfUser() = %d credentials; want 1", len(creds))
+	}
+
+	got := creds[0]
+	if string(got.ID) != string(cred.ID) || got.UserID != u.ID || got.Name != cred.Name || string(got.PublicKey) != string(cred.PublicKey) ||
+		got.AttestationType != cred.AttestationType || !slices.Equal(got.Transports, cred.Transports) || string(got.AAGUID) != string(cred.AAGUID) ||
+		got.SignCount != 0 || !got.BackupEligible || got.BackupState || got.CreatedAt.IsZero() || got.LastUsedAt != nil {
+		t.Errorf("GetWebAuthnCredentialsOfUser() = %+v; want %+v", got, cred)
+	}
+
+	// The counter is an unsigned 32 bit integer
+	wantNoErr(t, "UpdateWebAuthnCredentialUsage()", s.r.UpdateWebAuthnCredentialUsage(s.ctx, cred.ID, 1<<32-1, true))
+	creds, err = s.r.GetWebAuthnCredentialsOfUser(s.ctx, u.ID)
+	if err != nil || len(creds) != 1 || creds[0].SignCount != 1<<32-1 || !creds[0].BackupState || creds[0].LastUsedAt == nil {
+		t.Errorf("GetWebAuthnCredentialsOfUser() after UpdateWebAuthnCredentialUsage() = %+v, %v; want the used credential", creds, err)
+	}
+
+	err = s.r.DeleteWebAuthnCredential(s.ctx, other.ID, cred.ID)
+	wantErr(t, "DeleteWebAuthnCredential() of another user", err, repo.ErrNotFound)
+
+	wantNoErr(t, "DeleteWebAuthnCredential()", s.r.DeleteWebAuthnCredential(s.ctx, u.ID, cred.ID))
+	if creds, err := s.r.GetWebAuthnCredentialsOfUser(s.ctx, u.ID); err != nil || len(creds) != 0 {
+		t.Errorf("GetWebAuthnCredentialsOfUser() after DeleteWebAuthnCredential() = %v, %v; want none", creds, err)
+	}
+
+	err = s.r.DeleteWebAuthnCredential(s.ctx, u.ID, cred.ID)
+	wantErr(t, "DeleteWebAuthnCredential() of a deleted credential", err, repo.ErrNotFound)
+}
+
+func newProviderToken(userID, providerID string) models.ProviderToken {
+	return models.ProviderToken{
+		ProviderID:   providerID,
+		UserID:       userID,
+		ProviderType: models.UserProviderTypeGithub,
+		ProviderName: "app",
+		AccessToken:  []byte("access"),
+		TokenType:    "bearer",
+		Scope:        "repo",
+	}
+}
+
+func testProviderTokens(t *testing.T, s suite) {
+	u := s.createUser(t)
+	providerID := "provider-" + u.ID
+
+	_, err := s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGithub, "app")
+	wantErr(t, "GetProviderToken() without a token", err, repo.ErrNotFound)
+
+	token := newProviderToken(u.ID, providerID)
+	wantNoErr(t, "SetProviderToken()", s.r.SetProviderToken(s.ctx, token))
+
+	got, err := s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGithub, "app")
+	if err != nil || got.ProviderID != providerID || string(got.AccessToken) != "access" || len(got.RefreshToken) != 0 ||
+		got.TokenType != "bearer" || got.Scope != "repo" || got.ExpiresAt != nil || got.UpdatedAt.IsZero() {
+		t.Errorf("GetProviderToken() = %+v, %v; want %+v", got, err, token)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	token.AccessToken = []byte("refreshed")
+	token.RefreshToken = []byte("refresh")
+	token.ExpiresAt = &expiresAt
+	wantNoErr(t, "SetProviderToken() replacing the token", s.r.SetProviderToken(s.ctx, token))
+
+	got, err = s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGithub, "app")
+	if err != nil || string(got.AccessToken) != "refreshed" || string(got.RefreshToken) != "refresh" || got.ExpiresAt == nil || !sameSecond(*got.ExpiresAt, expiresAt) {
+		t.Errorf("GetProviderToken() after replacing the token = %+v, %v; want the refreshed token", got, err)
+	}
+
+	_, err = s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGithub, "other-app")
+	wantErr(t, "GetProviderToken() of another provider", err, repo.ErrNotFound)
+
+	_, err = s.r.GetProviderToken(s.ctx, u.ID, models.UserProviderTypeGoogle, "app")
+	wantErr(t, "GetProviderToken() of another provider type", err, repo.ErrNotFound)
+}
+
+func newInvitation(invitedBy string, roleIDs ...string) models.Invitation {
+	id := newID()
+	return models.Invitation{
+		ID:        id,
+		Email:     id[:8] + "@example.com",
+		RoleIDs:   roleIDs,
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func testInvitations(t *testing.T, s suite) {
+	admin := s.createUser(t)
+	u := s.createUser(t)
+	first := s.createRole(t, models.Permission{Key: "team", Val: "a"})
+	second := s.createRole(t, models.Permission{Key: "team", Val: "b"})
+
+	invitation := newInvitation(admin.ID, first.ID, second.ID)
+	wantNoErr(t, "CreateInvitation()", s.r.CreateInvitation(s.ctx, invitation))
+
+	got, err := s.r.GetInvitation(s.ctx, invitation.ID)
+	if err != nil || got.ID != invitation.ID || got.Email != invitation.Email || got.InvitedBy != admin.ID ||
+		!sameElements(got.RoleIDs, invitation.RoleIDs) || got.CreatedAt.IsZero() || !sameSecond(got.ExpiresAt, invitation.ExpiresAt) ||
+		got.AcceptedAt != nil || got.AcceptedBy != nil {
+		t.Errorf("GetInvitation() = %+v, %v; want %+v", got, err, invitation)
+	}
+
+	_, err = s.r.GetInvitation(s.ctx, newID())
+	wantErr(t, "GetInvitation() of a missing invitation", err, repo.ErrNotFound)
+
+	err = s.r.CreateInvitation(s.ctx, invitation)
+	wantErr(t, "CreateInvitation() with a taken id", err, repo.ErrAlreadyExists)
+
+	// Creating the invitation is atomic, it is not created if a role is missing
+	missingRole := newInvitation(admin.ID, first.ID, newID())
+	err = s.r.CreateInvitation(s.ctx, missingRole)
+	wantErr(t, "CreateInvitation() with a missing role", err, repo.ErrNotFound)
+	_, err = s.r.GetInvitation(s.ctx, missingRole.ID)
+	wantErr(t, "GetInvitation() of an invitation whose creation failed", err, repo.ErrNotFound)
+
+	withoutRoles := newInvitation(admin.ID)
+	wantNoErr(t, "CreateInvitation() without roles", s.r.CreateInvitation(s.ctx, withoutRoles))
+
+	invitations, err := s.r.ListInvitations(s.ctx)
+	wantNoErr(t, "ListInvitations()", err)
+	i := slices.IndexFunc(invitations, func(i models.Invitation) bool { return i.ID == invitation.ID })
+	if i == -1 || !sameElements(invitations[i].RoleIDs, invitation.RoleIDs) {
+		t.Errorf("ListInvitations() = %+v; want it to contain %+v", invitations, invitation)
+	}
+	if !slices.ContainsFunc(invitations, func(i models.Invitation) bool { return i.ID == withoutRoles.ID && len(i.RoleIDs) == 0 }) {
+		t.Errorf("ListInvitations() = %+v; want it to contain %+v", invitations, withoutRoles)
+	}
+
+	// Roles the user already has are kept
+	s.assignRole(t, u.ID, first.ID)
+	wantNoErr(t, "AcceptInvitation()", s.r.AcceptInvitation(s.ctx, invitation.ID, u.ID))
+
+	if roles, err := s.r.GetRolesOfUser(s.ctx, u.ID); err != nil || !sameElements(roles, []models.Role{first, second}) {
+		t.Errorf("GetRolesOfUser() after AcceptInvitation() = %v, %v; want %v", roles, err, []models.Role{first, second})
+	}
+
+	got, err = s.r.GetInvitation(s.ctx, invitation.ID)
+	if err != nil || got.AcceptedAt == nil || got.AcceptedBy == nil || *got.AcceptedBy != u.ID {
+		t.Errorf("GetInvitation() after AcceptInvitation() = %+v, %v; want accepted by %s", got, err, u.ID)
+	}
+
+	err = s.r.AcceptInvitation(s.ctx, invitation.ID, admin.ID)
+	wantErr(t, "AcceptInvitation() of an accepted invitation", err, repo.ErrNotFound)
+	if roles, err := s.r.GetRolesOfUser(s.ctx, admin.ID); err != nil || len(roles) != 0 {
+		t.Errorf("GetRolesOfUser() after accepting an accepted invitation = %v, %v; want none", roles, err)
+	}
+
+	err = s.r.AcceptInvitation(s.ctx, newID(), u.ID)
+	wantErr(t, "AcceptInvitation() of a missing invitation", err, repo.ErrNotFound)
+
+	wantNoErr(t, "DeleteInvitation()", s.r.DeleteInvitation(s.ctx, withoutRoles.ID))
+	_, err = s.r.GetInvitation(s.ctx, withoutRoles.ID)
+	wantErr(t, "GetInvitation() of a deleted invitation", err, repo.ErrNotFound)
+
+	err = s.r.AcceptInvitation(s.ctx, withoutRoles.ID, u.ID)
+	wantErr(t, "AcceptInvitation() of a deleted invitation", err, repo.ErrNotFound)
+
+	err = s.r.DeleteInvitation(s.ctx, withoutRoles.ID)
+	wantErr(t, "DeleteInvitation() of a deleted invitation", err, repo.ErrNotFound)
+}
+
+func newElevationRequest(userID, roleID string) models.ElevationRequest {
+	return models.ElevationRequest{
+		ID:              newID(),
+		UserID:          userID,
+		RoleID:          roleID,
+		Reason:          "incident",
+		DurationSeconds: 3600,
+		Status:          models.ElevationPending,
+		RequestedAt:     time.Now(),
+	}
+}
+
+func testElevationRequests(t *testing.T, s suite) {
+	u := s.createUser(t)
+	approver := s.createUser(t)
+	role := s.createRole(t, models.Permission{Key: "team", Val: "oncall"})
+
+	request := newElevationRequest(u.ID, role.ID)
+	wantNoErr(t, "CreateElevationRequest()", s.r.CreateElevationRequest(s.ctx, request))
+
+	got, err := s.r.GetElevationRequest(s.ctx, request.ID)
+	if err != nil || got.UserID != u.ID || got.RoleID != role.ID || got.Reason != request.Reason || got.DurationSeconds != 3600 ||
+		got.Status != models.ElevationPending || !sameSecond(got.RequestedAt, request.RequestedAt) || got.DecidedBy != nil || got.ExpiresAt != nil {
+		t.Errorf("GetElevationRequest() = %+v, %v; want %+v", got, err, request)
+	}
+
+	_, err = s.r.GetElevationRequest(s.ctx, newID())
+	wantErr(t, "GetElevationRequest() of a missing request", err, repo.ErrNotFound)
+
+	err = s.r.CreateElevationRequest(s.ctx, newElevationRequest(u.ID, newID()))
+	wantErr(t, "CreateElevationRequest() of a missing role", err, repo.ErrNotFound)
+
+	denied := newElevationRequest(u.ID, role.ID)
+	wantNoErr(t, "CreateElevationRequest()", s.r.CreateElevationRequest(s.ctx, denied))
+
+	requests, err := s.r.ListElevationRequests(s.ctx, repo.ListElevationRequestsParams{UserID: u.ID})
+	if err != nil || !slices.Equal(ids(requests, func(r models.ElevationRequest) string { return r.ID }), []string{request.ID, denied.ID}) {
+		t.Errorf("ListElevationRequests() = %+v, %v; want %s and %s", requests, err, request.ID, denied.ID)
+	}
+
+	wantNoErr(t, "DenyElevationRequest()", s.r.DenyElevationRequest(s.ctx, denied.ID, approver.ID, time.Now()))
+	got, err = s.r.GetElevationRequest(s.ctx, denied.ID)
+	if err != nil || got.Status != models.ElevationDenied || got.DecidedBy == nil || *got.DecidedBy != approver.ID || got.DecidedAt == nil {
+		t.Errorf("GetElevationRequest() after DenyElevationRequest() = %+v, %v; want denied by %s", got, err, approver.ID)
+	}
+	if roles, err := s.r.GetRolesOfUser(s.ctx, u.ID); err != nil || len(roles) != 0 {
+		t.Errorf("GetRolesOfUser() after DenyElevationRequest() = %v, %v; want none", roles, err)
+	}
+
+	at := time.Now()
+	wantNoErr(t, "ApproveElevationRequest()", s.r.ApproveElevationRequest(s.ctx, request.ID, approver.ID, at))
+	got, err = s.r.GetElevationRequest(s.ctx, request.ID)
+	if err != nil || got.Status != models.ElevationApproved || got.ExpiresAt == nil || !sameSecond(*got.ExpiresAt, at.Add(time.Hour)) {
+		t.Errorf("GetElevationRequest() after ApproveElevationRequest() = %+v, %v; want approved until %v", got, err, at.Add(time.Hour))
+	}
+
+	grants, err := s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, "")
+	if err != nil || len(grants) != 1 || grants[0].ExpiresAt == nil || !sameSecond(*grants[0].ExpiresAt, at.Add(time.Hour)) {
+		t.Errorf("GetPermissionGrantsOfUser() after ApproveElevationRequest() = %+v, %v; want team=oncall until %v", grants, err, at.Add(time.Hour))
+	}
+
+	err = s.r.ApproveElevationRequest(s.ctx, request.ID, approver.ID, time.Now())
+	wantErr(t, "ApproveElevationRequest() of an approved request", err, repo.ErrNotFound)
+	err = s.r.DenyElevationRequest(s.ctx, denied.ID, approver.ID, time.Now())
+	wantErr(t, "DenyElevationRequest() of a denied request", err, repo.ErrNotFound)
+	err = s.r.ApproveElevationRequest(s.ctx, newID(), approver.ID, time.Now())
+	wantErr(t, "ApproveElevationRequest() of a missing request", err, repo.ErrNotFound)
+
+	// Approving a shorter elevation keeps the longer assignment
+	shorter := newElevationRequest(u.ID, role.ID)
+	shorter.DurationSeconds = 60
+	wantNoErr(t, "CreateElevationRequest()", s.r.CreateElevationRequest(s.ctx, shorter))
+	wantNoErr(t, "ApproveElevationRequest() of a role the user has", s.r.ApproveElevationRequest(s.ctx, shorter.ID, approver.ID, time.Now()))
+	grants, err = s.r.GetPermissionGrantsOfUser(s.ctx, u.ID, "")
+	if err != nil || len(grants) != 1 || grants[0].ExpiresAt == nil || !sameSecond(*grants[0].ExpiresAt, at.Add(time.Hour)) {
+		t.Errorf("GetPermissionGrantsOfUser() after a shorter approval = %+v, %v; want team=oncall until %v", grants, err, at.Add(time.Hour))
+	}
+
+	requests, err = s.r.ListElevationRequests(s.ctx, repo.ListElevationRequestsParams{UserID: u.ID, Status: models.ElevationApproved})
+	if err != nil || !slices.Equal(ids(requests, func(r models.ElevationRequest) string { return r.ID }), []string{request.ID, shorter.ID}) {
+		t.Errorf("ListElevationRequests() of approved requests = %+v, %v; want %s and %s", requests, err, request.ID, shorter.ID)
+	}
+}
+
+func newPolicy() models.Policy {
+	id := newID()
+	return models.Policy{
+		ID:          id,
+		Name:        "policy-" + id,
+		Description: "Owners can delete their projects",
+		Effect:      models.PolicyAllow,
+		Actions:     []string{"projects:delete", "projects:archive"},
+		Condition:   "resource.owner == subject.id",
+	}
+}
+
+func testPolicies(t *testing.T, s suite) {
+	policy := newPolicy()
+	wantNoErr(t, "CreatePolicy()", s.r.CreatePolicy(s.ctx, policy))
+
+	if got, err := s.r.GetPolicy(s.ctx, policy.ID); err != nil || !reflect.DeepEqual(got, policy) {
+		t.Errorf("GetPolicy() = %+v, %v; want %+v", got, err, policy)
+	}
+
+	_, err := s.r.GetPolicy(s.ctx, newID())
+	wantErr(t, "GetPolicy() of a missing policy", err, repo.ErrNotFound)
+
+	taken := newPolicy()
+	taken.Name = policy.Name
+	err = s.r.CreatePolicy(s.ctx, taken)
+	wantErr(t, "CreatePolicy() with a taken name", err, repo.ErrAlreadyExists)
+
+	other := newPolicy()
+	other.Effect = models.PolicyDeny
+	other.Actions = []string{"*"}
+	other.Condition = ""
+	wantNoErr(t, "CreatePolicy()", s.r.CreatePolicy(s.ctx, other))
+
+	policy.Name = "a-" + policy.Name
+	policy.Actions = []string{"projects:**"}
+	policy.Condition = "resource.owner == subject.id || subject.perms.admin == 'true'"
+	wantNoErr(t, "UpdatePolicy()", s.r.UpdatePolicy(s.ctx, policy))
+	wantNoErr(t, "UpdatePolicy() without changes", s.r.UpdatePolicy(s.ctx, policy))
+
+	if got, err := s.r.GetPolicy(s.ctx, policy.ID); err != nil || !reflect.DeepEqual(got, policy) {
+		t.Errorf("GetPolicy() after UpdatePolicy() = %+v, %v; want %+v", got, err, policy)
+	}
+
+	taken = policy
+	taken.Name = other.Name
+	err = s.r.UpdatePolicy(s.ctx, taken)
+	wantErr(t, "UpdatePolicy() to a taken name", err, repo.ErrAlreadyExists)
+
+	missing := newPolicy()
+	err = s.r.UpdatePolicy(s.ctx, missing)
+	wantErr(t, "UpdatePolicy() of a missing policy", err, repo.ErrNotFound)
+
+	// The policies are ordered by name, other policies may exist in a shared database
+	policies, err := s.r.ListPolicies(s.ctx)
+	wantNoErr(t, "ListPolicies()", err)
+	got := slices.DeleteFunc(ids(policies, policyID), func(id string) bool { return id != policy.ID && id != other.ID })
+	if !slices.Equal(got, []string{policy.ID, other.ID}) {
+		t.Errorf("ListPolicies() = %v; want %s before %s", got, policy.ID, other.ID)
+	}
+
+	wantNoErr(t, "DeletePolicy()", s.r.DeletePolicy(s.ctx, policy.ID))
+	err = s.r.DeletePolicy(s.ctx, policy.ID)
+	wantErr(t, "DeletePolicy() of a deleted policy", err, repo.ErrNotFound)
+
+	_, err = s.r.GetPolicy(s.ctx, policy.ID)
+	wantErr(t, "GetPolicy() of a deleted policy", err, repo.ErrNotFound)
+}
@@ -2,40 +2,56 @@ package role
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/permission"
 	"github.com/theleeeo/thor/repo"
 )
 
+// How often the expired role assignments are removed
+const reapInterval = time.Minute
+
+// ErrInvalidPermission is returned together with what is wrong when a role can not be given a permission.
+var ErrInvalidPermission = errors.New("invalid permission")
+
 type Service struct {
-	repo repo.Repo
+	repo    repo.Repo
+	catalog *permission.Catalog
 }
 
-func NewService(repo repo.Repo) *Service {
+func NewService(repo repo.Repo, catalog *permission.Catalog) *Service {
 	return &Service{
-		repo: repo,
+		repo:    repo,
+		catalog: catalog,
 	}
 }
 
 func (s *Service) Create(ctx context.Context, role models.Role, permissions []models.Permission) (Role, error) {
-	if role.Name == "" {
-		return Role{}, fmt.Errorf("missing role name")
+	if len(permissions) == 0 {
+		return Role{}, fmt.Errorf("%w: missing role permissions", ErrInvalidPermission)
 	}
 
-	if len(permissions) == 0 {
-		return Role{}, fmt.Errorf("missing role permissions")
+	if err := s.validatePermissions(permissions); err != nil {
+		return Role{}, err
 	}
 
-	for i, p := range permissions {
-		if p.Key == "" {
-			return Role{}, fmt.Errorf("missing permission key on permission %d", i+1)
-		}
+	return s.create(ctx, role, permissions)
+}
 
-		if p.Val == "" {
-			return Role{}, fmt.Errorf("missing permission value on permission %d", i+1)
-		}
+// CreateWithoutPermissions creates a role that grants nothing until permissions are added to it,
+// e.g. a group provisioned by SCIM whose permissions are given in Thor.
+func (s *Service) CreateWithoutPermissions(ctx context.Context, role models.Role) (Role, error) {
+	return s.create(ctx, role, nil)
+}
+
+func (s *Service) create(ctx context.Context, role models.Role, permissions []models.Permission) (Role, error) {
+	if role.Name == "" {
+		return Role{}, fmt.Errorf("missing role name")
 	}
 
 	role.ID = uuid.NewString()
@@ -50,6 +66,29 @@ func (s *Service) Create(ctx context.Context, role models.Role, permissions []mo
 	}, nil
 }
 
+func (s *Service) validatePermissions(permissions []models.Permission) error {
+	for i, p := range permissions {
+		if p.Key == "" {
+			return fmt.Errorf("%w: missing permission key on permission %d", ErrInvalidPermission, i+1)
+		}
+
+		if p.Val == "" {
+			return fmt.Errorf("%w: missing permission value on permission %d", ErrInvalidPermission, i+1)
+		}
+
+		if err := s.catalog.Validate(p); err != nil {
+			return fmt.Errorf("%w: permission %d: %w", ErrInvalidPermission, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// PermissionDefinitions returns the permissions that roles can be given.
+func (s *Service) PermissionDefinitions() []permission.Definition {
+	return s.catalog.Definitions()
+}
+
 func (s *Service) Get(ctx context.Context, id string) (Role, error) {
 	role, err := s.repo.GetRole(ctx, id)
 	if err != nil {
@@ -79,10 +118,10 @@ func (s *Service) GetRolesOfUser(ctx context.Context, userID string) ([]Role, er
 	return roles, nil
 }
 
-func (s *Service) List(ctx context.Context, params repo.ListRolesParams) ([]Role, error) {
-	roleModels, err := s.repo.ListRoles(ctx, params)
+func (s *Service) List(ctx context.Context, params repo.ListRolesParams) ([]Role, string, error) {
+	roleModels, next, err := s.repo.ListRoles(ctx, params)
 	if err != nil {
-		return []Role{}, err
+		return []Role{}, "", err
 	}
 
 	roles := make([]Role, len(roleModels))
@@ -93,7 +132,7 @@ func (s *Service) List(ctx context.Context, params repo.ListRolesParams) ([]Role
 		}
 	}
 
-	return roles, nil
+	return roles, next, nil
 }
 
 func (s *Service) GetPermissionsOfRole(ctx context.Context, id string) ([]models.Permission, error) {
@@ -104,3 +143,106 @@ func (s *Service) GetPermissionsOfRole(ctx context.Context, id string) ([]models
 
 	return permissions, nil
 }
+
+func (s *Service) Update(ctx context.Context, role models.Role) (Role, error) {
+	if role.ID == "" {
+		return Role{}, fmt.Errorf("missing role id")
+	}
+
+	if role.Name == "" {
+		return Role{}, fmt.Errorf("missing role name")
+	}
+
+	if err := s.repo.UpdateRole(ctx, role); err != nil {
+		return Role{}, err
+	}
+
+	return Role{
+		Role: role,
+		repo: s.repo,
+	}, nil
+}
+
+// SetPermissions replaces all permissions of the role.
+func (s *Service) SetPermissions(ctx context.Context, id string, permissions []models.Permission) error {
+	if err := s.validatePermissions(permissions); err != nil {
+		return err
+	}
+
+	return s.repo.SetRolePermissions(ctx, id, permissions)
+}
+
+// UpdatePermissions removes and adds individual permissions of the role, all or none of the changes are made.
+func (s *Service) UpdatePermissions(ctx context.Context, id string, add, remove []models.Permission) error {
+	if err := s.validatePermissions(add); err != nil {
+		return err
+	}
+
+	return s.repo.UpdateRolePermissions(ctx, id, add, remove)
+}
+
+// GetParents returns the roles that the role inherits the permissions of.
+func (s *Service) GetParents(ctx context.Context, id string) ([]Role, error) {
+	roleModels, err := s.repo.GetParentsOfRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]Role, len(roleModels))
+	for i, r := range roleModels {
+		roles[i] = Role{
+			Role: r,
+			repo: s.repo,
+		}
+	}
+
+	return roles, nil
+}
+
+// SetParents replaces the roles that the role inherits the permissions of.
+// Returns repo.ErrCycle if the role would inherit from itself.
+func (s *Service) SetParents(ctx context.Context, id string, parentIDs []string) error {
+	return s.repo.SetRoleParents(ctx, id, parentIDs)
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.DeleteRole(ctx, id)
+}
+
+// GetUsersWithRole returns the users that the role is assigned to.
+func (s *Service) GetUsersWithRole(ctx context.Context, id string) ([]models.User, error) {
+	return s.repo.GetUsersWithRole(ctx, id)
+}
+
+// GetAffectedUsers returns the users that get permissions from the role, also through their groups
+// and the roles inheriting it.
+func (s *Service) GetAffectedUsers(ctx context.Context, id string) ([]models.User, error) {
+	return s.repo.GetUsersAffectedByRole(ctx, id)
+}
+
+// RemoveExpiredAssignments removes the role assignments that have expired and returns how many there were.
+func (s *Service) RemoveExpiredAssignments(ctx context.Context) (int, error) {
+	return s.repo.DeleteExpiredRoleAssignments(ctx, time.Now())
+}
+
+// RunReaper removes the expired role assignments periodically until the context is done.
+// The expired assignments grant nothing even before they are removed.
+func (s *Service) RunReaper(ctx context.Context) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.RemoveExpiredAssignments(ctx)
+		if err != nil {
+			slog.Error("failed to remove expired role assignments", "error", err)
+		} else if removed > 0 {
+			slog.Info("removed expired role assignments", "count", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -3,8 +3,18 @@ package runner
 import (
 	"time"
 
+	"github.com/theleeeo/thor/elevation"
+	"github.com/theleeeo/thor/invitation"
+	"github.com/theleeeo/thor/local"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/mfa"
 	"github.com/theleeeo/thor/oauth"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/permission"
+	"github.com/theleeeo/thor/providertoken"
 	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/scim"
+	"github.com/theleeeo/thor/user"
 )
 
 type Config struct {
@@ -16,6 +26,36 @@ type Config struct {
 	RepoCfg *repo.Config `yaml:"repo"`
 
 	OAuthConfig *oauth.Config `yaml:"oauth"`
+
+	// Optional, the defaults are used if not configured
+	UserCfg *user.Config `yaml:"users"`
+
+	// Optional, required by the features that send emails
+	MailCfg *mail.Config `yaml:"mail"`
+
+	// Local accounts are disabled if not configured
+	LocalCfg *local.Config `yaml:"local"`
+
+	// MFA is disabled if not configured
+	MFACfg *mfa.Config `yaml:"mfa"`
+
+	// Passkeys are disabled if not configured
+	PasskeyCfg *passkey.Config `yaml:"passkey"`
+
+	// Invitations are disabled if not configured, they require the mail configuration
+	InvitationCfg *invitation.Config `yaml:"invitations"`
+
+	// Storing the tokens of the providers is disabled if not configured
+	ProviderTokenCfg *providertoken.Config `yaml:"provider-tokens"`
+
+	// Requesting roles for a while is disabled if not configured
+	ElevationCfg *elevation.Config `yaml:"elevation"`
+
+	// The SCIM endpoints are disabled if not configured
+	SCIMCfg *scim.Config `yaml:"scim"`
+
+	// Optional, only the built-in permissions are known and any other key is allowed if not configured
+	PermissionsCfg *permission.Config `yaml:"permissions"`
 }
 
 type AuthConfig struct {
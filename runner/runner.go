@@ -1,18 +1,33 @@
 package runner
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/theleeeo/thor/app"
 	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/elevation"
 	"github.com/theleeeo/thor/entrypoints"
+	"github.com/theleeeo/thor/group"
+	"github.com/theleeeo/thor/invitation"
+	"github.com/theleeeo/thor/local"
+	"github.com/theleeeo/thor/mail"
+	"github.com/theleeeo/thor/mfa"
 	"github.com/theleeeo/thor/middlewares"
 	"github.com/theleeeo/thor/oauth"
+	"github.com/theleeeo/thor/org"
+	"github.com/theleeeo/thor/passkey"
+	"github.com/theleeeo/thor/permission"
+	"github.com/theleeeo/thor/policy"
+	"github.com/theleeeo/thor/providertoken"
 	"github.com/theleeeo/thor/repo"
 	"github.com/theleeeo/thor/role"
+	"github.com/theleeeo/thor/scim"
+	"github.com/theleeeo/thor/signer"
 	"github.com/theleeeo/thor/user"
 )
 
@@ -53,19 +68,134 @@ func Run(cfg *Config) error {
 	}
 	defer repo.Close()
 
+	//
 	// User service
 	//
-	userSrv := user.NewService(repo)
+	userSrv := user.NewService(cfg.UserCfg, repo)
+
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go userSrv.RunPurger(purgeCtx)
 
 	//
 	// Role service
 	//
-	roleSrv := role.NewService(repo)
+	catalog, err := permission.NewCatalog(cfg.PermissionsCfg)
+	if err != nil {
+		return err
+	}
+
+	roleSrv := role.NewService(repo, catalog)
+
+	reapCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	go roleSrv.RunReaper(reapCtx)
+
+	//
+	// Group service
+	//
+	groupSrv := group.NewService(repo)
+
+	//
+	// Org service
+	//
+	orgSrv := org.NewService(repo)
+
+	//
+	// Policy service
+	//
+	policySrv := policy.NewService(repo)
+
+	linkSigner := signer.New([]byte(cfg.OAuthConfig.CookieSecret))
+
+	//
+	// Local account service
+	//
+	var localSrv *local.Service
+	if cfg.LocalCfg != nil {
+		localSrv, err = local.NewService(cfg.LocalCfg, repo, userSrv, linkSigner)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// MFA service
+	//
+	var mfaSrv *mfa.Service
+	if cfg.MFACfg != nil {
+		mfaSrv = mfa.NewService(cfg.MFACfg, repo)
+	}
+
+	//
+	// Passkey service
+	//
+	var passkeySrv *passkey.Service
+	if cfg.PasskeyCfg != nil {
+		passkeySrv, err = passkey.NewService(cfg.PasskeyCfg, cfg.AppUrl, repo, userSrv)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Elevation service
+	//
+	var elevationSrv *elevation.Service
+	if cfg.ElevationCfg != nil {
+		elevationSrv = elevation.NewService(cfg.ElevationCfg, repo)
+	}
+
+	//
+	// Mail sender
+	//
+	var mailer mail.Sender
+	if cfg.MailCfg != nil {
+		mailer, err = mail.New(cfg.MailCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Invitation service
+	//
+	var invitationSrv *invitation.Service
+	if cfg.InvitationCfg != nil {
+		invitationSrv, err = invitation.NewService(cfg.InvitationCfg, repo, linkSigner, mailer, cfg.AppUrl)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Provider token service
+	//
+	var tokenSrv *providertoken.Service
+	if cfg.ProviderTokenCfg != nil {
+		tokenSrv, err = providertoken.NewService(cfg.ProviderTokenCfg, repo)
+		if err != nil {
+			return err
+		}
+	}
 
 	//
 	// App
 	//
-	appImpl := app.New(auth, userSrv, roleSrv)
+	appImpl := app.New(&app.Services{
+		Auth:           auth,
+		Users:          userSrv,
+		Roles:          roleSrv,
+		Groups:         groupSrv,
+		Orgs:           orgSrv,
+		Local:          localSrv,
+		MFA:            mfaSrv,
+		Passkeys:       passkeySrv,
+		Invitations:    invitationSrv,
+		ProviderTokens: tokenSrv,
+		Elevations:     elevationSrv,
+		Policies:       policySrv,
+	})
 
 	rootMux := http.DefaultServeMux
 
@@ -74,7 +204,7 @@ func Run(cfg *Config) error {
 	//
 	// Rest handler
 	//
-	restAPI := entrypoints.NewRestHandler(appImpl, cfg.OAuthConfig.CookieName)
+	restAPI := entrypoints.NewRestHandler(appImpl, cfg.OAuthConfig.CookieName, !strings.HasPrefix(cfg.AppUrl, "http://"))
 
 	apiMux := http.NewServeMux()
 	restAPI.Register(apiMux)
@@ -98,12 +228,36 @@ func Run(cfg *Config) error {
 		cfg.OAuthConfig.AppURL = cfg.AppUrl
 	}
 
-	oauthHandler, err := oauth.NewOAuthHandler(cfg.OAuthConfig, userSrv, auth)
+	oauthHandler, err := oauth.NewOAuthHandler(cfg.OAuthConfig, &oauth.Services{
+		Users:          userSrv,
+		Local:          localSrv,
+		MFA:            mfaSrv,
+		Passkeys:       passkeySrv,
+		Invitations:    invitationSrv,
+		ProviderTokens: tokenSrv,
+		Auth:           auth,
+		Mailer:         mailer,
+		LinkSigner:     linkSigner,
+	})
 	if err != nil {
 		return err
 	}
 
 	rootMux.Handle("/oauth/", errorPageDirector(oauthHandler))
+	// The device flow endpoints are called by clients and not browsers, so they respond with JSON instead of error pages
+	rootMux.HandleFunc("POST /oauth/device/code", oauthHandler.ServeDeviceCode)
+	rootMux.HandleFunc("POST /oauth/token", oauthHandler.ServeToken)
+
+	//
+	// SCIM provisioning
+	//
+	if cfg.SCIMCfg != nil {
+		scimHandler, err := scim.NewHandler(cfg.SCIMCfg, cfg.AppUrl, userSrv, roleSrv)
+		if err != nil {
+			return err
+		}
+		rootMux.Handle("/scim/v2/", scimHandler)
+	}
 
 	httpServer := &http.Server{
 		Addr:         cfg.Addr,
@@ -0,0 +1,57 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filter is an equality filter on a single attribute, e.g. `userName eq "alice@example.com"`.
+// This is what provisioning clients use to look up a resource before creating it,
+// the rest of the filter grammar (RFC 7644 section 3.4.2.2) is not supported.
+type filter struct {
+	attribute string
+	value     string
+}
+
+func parseFilter(s string) (*filter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	attribute, rest, ok := strings.Cut(s, " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid filter %q", s)
+	}
+
+	op, value, ok := strings.Cut(strings.TrimSpace(rest), " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid filter %q", s)
+	}
+
+	if !strings.EqualFold(op, "eq") {
+		return nil, fmt.Errorf("unsupported filter operator %q, only eq is supported", op)
+	}
+
+	value, err := strconv.Unquote(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter value in %q, it must be a quoted string", s)
+	}
+
+	return &filter{
+		attribute: attribute,
+		value:     value,
+	}, nil
+}
+
+// is reports whether the filter is on the attribute, attribute names are case-insensitive.
+func (f *filter) is(attributes ...string) bool {
+	for _, a := range attributes {
+		if strings.EqualFold(f.attribute, a) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,891 @@
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/role"
+	"github.com/theleeeo/thor/user"
+)
+
+const (
+	defaultCount = 100
+	maxCount     = 1000
+)
+
+type Config struct {
+	// The bearer token that the SCIM client authenticates with
+	Token string `yaml:"token" json:"-"`
+}
+
+// Handler serves the SCIM 2.0 (RFC 7644) endpoints at /scim/v2 for provisioning users and groups from an identity provider.
+// The groups are the roles of Thor, so the members of a group get the role.
+type Handler struct {
+	userService *user.Service
+	roleService *role.Service
+	token       []byte
+	// The url of the SCIM endpoints, used for the locations of the resources
+	baseURL string
+
+	mux *http.ServeMux
+}
+
+func NewHandler(cfg *Config, appURL string, userService *user.Service, roleService *role.Service) (*Handler, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("missing scim token")
+	}
+
+	h := &Handler{
+		userService: userService,
+		roleService: roleService,
+		token:       []byte(cfg.Token),
+		baseURL:     appURL + "/scim/v2",
+		mux:         http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /scim/v2/ServiceProviderConfig", h.handle(h.serveServiceProviderConfig))
+
+	h.mux.HandleFunc("GET /scim/v2/Users", h.handle(h.listUsers))
+	h.mux.HandleFunc("POST /scim/v2/Users", h.handle(h.createUser))
+	h.mux.HandleFunc("GET /scim/v2/Users/{id}", h.handle(h.getUser))
+	h.mux.HandleFunc("PUT /scim/v2/Users/{id}", h.handle(h.replaceUser))
+	h.mux.HandleFunc("PATCH /scim/v2/Users/{id}", h.handle(h.patchUser))
+	h.mux.HandleFunc("DELETE /scim/v2/Users/{id}", h.handle(h.deleteUser))
+
+	h.mux.HandleFunc("GET /scim/v2/Groups", h.handle(h.listGroups))
+	h.mux.HandleFunc("POST /scim/v2/Groups", h.handle(h.createGroup))
+	h.mux.HandleFunc("GET /scim/v2/Groups/{id}", h.handle(h.getGroup))
+	h.mux.HandleFunc("PUT /scim/v2/Groups/{id}", h.handle(h.replaceGroup))
+	h.mux.HandleFunc("PATCH /scim/v2/Groups/{id}", h.handle(h.patchGroup))
+	h.mux.HandleFunc("DELETE /scim/v2/Groups/{id}", h.handle(h.deleteGroup))
+
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		writeError(w, Error{Status: http.StatusUnauthorized, Detail: "missing or invalid token"})
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// Error is an error response (RFC 7644 section 3.12).
+type Error struct {
+	Status int
+	// The kind of error for bad requests and conflicts, e.g. invalidFilter or uniqueness
+	ScimType string
+	Detail   string
+}
+
+func (e Error) Error() string {
+	return e.Detail
+}
+
+func badRequest(scimType string, err error) Error {
+	return Error{
+		Status:   http.StatusBadRequest,
+		ScimType: scimType,
+		Detail:   err.Error(),
+	}
+}
+
+// handle responds with the SCIM error for the errors returned by the handler.
+func (h *Handler) handle(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f(w, r)
+		if err == nil {
+			return
+		}
+
+		var e Error
+		switch {
+		case errors.As(err, &e):
+		case errors.Is(err, repo.ErrNotFound):
+			e = Error{Status: http.StatusNotFound, Detail: "resource not found"}
+		case errors.Is(err, repo.ErrAlreadyExists):
+			e = Error{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "resource already exists"}
+		default:
+			slog.Error("scim request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			e = Error{Status: http.StatusInternalServerError, Detail: err.Error()}
+		}
+
+		writeError(w, e)
+	}
+}
+
+func writeError(w http.ResponseWriter, e Error) {
+	writeJSON(w, e.Status, struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{
+		Schemas:  []string{errorSchema},
+		Status:   strconv.Itoa(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write scim response", "error", err)
+	}
+}
+
+func decode[T any](r *http.Request) (T, error) {
+	var v T
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		return v, badRequest("invalidSyntax", err)
+	}
+
+	return v, nil
+}
+
+// pagination returns the 1-based start index and the number of resources requested (RFC 7644 section 3.4.2.4).
+func pagination(r *http.Request) (int, int, error) {
+	startIndex, count := 1, defaultCount
+
+	if v := r.URL.Query().Get("startIndex"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, badRequest("invalidValue", fmt.Errorf("invalid startIndex %q", v))
+		}
+		startIndex = max(i, 1)
+	}
+
+	if v := r.URL.Query().Get("count"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, badRequest("invalidValue", fmt.Errorf("invalid count %q", v))
+		}
+		count = min(max(c, 0), maxCount)
+	}
+
+	return startIndex, count, nil
+}
+
+func page[T any](items []T, startIndex, count int) []T {
+	start := min(startIndex-1, len(items))
+	end := min(start+count, len(items))
+	return items[start:end]
+}
+
+func (h *Handler) serveServiceProviderConfig(w http.ResponseWriter, r *http.Request) error {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{serviceConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxCount},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token configured for the SCIM endpoints",
+		}},
+	})
+	return nil
+}
+
+//
+// Users
+//
+
+func (h *Handler) toUser(ctx context.Context, u user.User) (User, error) {
+	providers, err := u.Providers(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	var externalID string
+	for _, p := range providers {
+		if p.Type == models.UserProviderTypeSCIM {
+			externalID = p.UserID
+			break
+		}
+	}
+
+	roles, err := u.Roles(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	groups := make([]Ref, len(roles))
+	for i, r := range roles {
+		groups[i] = Ref{
+			Value:   r.ID,
+			Ref:     h.baseURL + "/Groups/" + r.ID,
+			Display: r.Name,
+		}
+	}
+
+	active := !u.Disabled
+
+	return User{
+		Schemas:     []string{userSchema},
+		ID:          u.ID,
+		ExternalID:  externalID,
+		UserName:    u.Email,
+		Name:        &Name{Formatted: u.Name},
+		DisplayName: u.Name,
+		Emails:      []Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      groups,
+		Meta: &Meta{
+			ResourceType: "User",
+			Location:     h.baseURL + "/Users/" + u.ID,
+		},
+	}, nil
+}
+
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) error {
+	f, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return badRequest("invalidFilter", err)
+	}
+
+	startIndex, count, err := pagination(r)
+	if err != nil {
+		return err
+	}
+
+	users, err := h.findUsers(r.Context(), f)
+	if err != nil {
+		return err
+	}
+
+	resources := make([]User, 0)
+	for _, u := range page(users, startIndex, count) {
+		resource, err := h.toUser(r.Context(), u)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, resource)
+	}
+
+	writeJSON(w, http.StatusOK, ListResponse[User]{
+		Schemas:      []string{listResponseSchema},
+		TotalResults: len(users),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+	return nil
+}
+
+func (h *Handler) findUsers(ctx context.Context, f *filter) ([]user.User, error) {
+	if f == nil {
+		users, _, err := h.userService.List(ctx, repo.ListUsersParams{})
+		return users, err
+	}
+
+	var u user.User
+	var err error
+	switch {
+	case f.is("id"):
+		u, err = h.userService.Get(ctx, repo.GetUserParams{ID: &f.value})
+	case f.is("userName", "emails", "emails.value"):
+		u, err = h.userService.Get(ctx, repo.GetUserParams{Email: &f.value})
+	case f.is("externalId"):
+		u, err = h.userService.GetByProviderID(ctx, f.value)
+		if err == nil && !hasSCIMProvider(ctx, u, f.value) {
+			err = repo.ErrNotFound
+		}
+	default:
+		return nil, badRequest("invalidFilter", fmt.Errorf("filtering on %s is not supported", f.attribute))
+	}
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return []user.User{u}, nil
+}
+
+// hasSCIMProvider reports whether the user was provisioned with the external id, and not only has the same id at another provider.
+func hasSCIMProvider(ctx context.Context, u user.User, externalID string) bool {
+	providers, err := u.Providers(ctx)
+	if err != nil {
+		return false
+	}
+
+	for _, p := range providers {
+		if p.Type == models.UserProviderTypeSCIM && p.UserID == externalID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) error {
+	req, err := decode[User](r)
+	if err != nil {
+		return err
+	}
+
+	userModel := req.model()
+	if userModel.Email == "" {
+		return badRequest("invalidValue", errors.New("the user has no email"))
+	}
+
+	_, err = h.userService.Get(r.Context(), repo.GetUserParams{Email: &userModel.Email})
+	if err == nil {
+		return Error{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "a user with the email already exists"}
+	}
+	if !errors.Is(err, repo.ErrNotFound) {
+		return err
+	}
+
+	// The provider id identifies the user when the client looks it up by the external id
+	providerID := req.ExternalID
+	if providerID == "" {
+		providerID = req.UserName
+	}
+
+	u, err := h.userService.Create(r.Context(), userModel, models.UserProvider{
+		Type:   models.UserProviderTypeSCIM,
+		UserID: providerID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if req.Active != nil && !*req.Active {
+		if err := h.userService.Disable(r.Context(), u.ID); err != nil {
+			return err
+		}
+		u.Disabled = true
+	}
+
+	resource, err := h.toUser(r.Context(), u)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, resource)
+	return nil
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	resource, err := h.toUser(r.Context(), u)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+	return nil
+}
+
+func (h *Handler) replaceUser(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	req, err := decode[User](r)
+	if err != nil {
+		return err
+	}
+
+	userModel := req.model()
+	if userModel.Email == "" {
+		return badRequest("invalidValue", errors.New("the user has no email"))
+	}
+	userModel.ID = u.ID
+
+	return h.updateUser(w, r, u, userModel, req.Active)
+}
+
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	u, err := h.userService.Get(r.Context(), repo.GetUserParams{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	req, err := decode[PatchRequest](r)
+	if err != nil {
+		return err
+	}
+
+	var changes userChanges
+	for _, op := range req.Operations {
+		if err := changes.apply(op); err != nil {
+			return badRequest("invalidValue", err)
+		}
+	}
+
+	userModel := changes.applyTo(u.User)
+	if userModel.Email == "" {
+		return badRequest("invalidValue", errors.New("the user has no email"))
+	}
+
+	return h.updateUser(w, r, u, userModel, changes.active)
+}
+
+// updateUser changes the name and email of the user to the ones of userModel,
+// and deactivates or activates the user if active is set.
+func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request, u user.User, userModel models.User, active *bool) error {
+	if userModel.Name != u.Name || userModel.Email != u.Email {
+		userModel.Disabled = u.Disabled
+		updated, err := h.userService.Update(r.Context(), userModel)
+		if err != nil {
+			return err
+		}
+		u.User = updated.User
+	}
+
+	if active != nil && *active == u.Disabled {
+		var err error
+		if *active {
+			err = h.userService.Enable(r.Context(), u.ID)
+		} else {
+			err = h.userService.Disable(r.Context(), u.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		slog.Info("user activation changed by scim", "user", u.ID, "active", *active)
+		u.Disabled = !*active
+	}
+
+	resource, err := h.toUser(r.Context(), u)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+	return nil
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) error {
+	if err := h.userService.Delete(r.Context(), r.PathValue("id")); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//
+// Groups
+//
+
+func (h *Handler) toGroup(ctx context.Context, r role.Role, withMembers bool) (Group, error) {
+	group := Group{
+		Schemas:     []string{groupSchema},
+		ID:          r.ID,
+		DisplayName: r.Name,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Location:     h.baseURL + "/Groups/" + r.ID,
+		},
+	}
+
+	if !withMembers {
+		return group, nil
+	}
+
+	users, err := h.roleService.GetUsersWithRole(ctx, r.ID)
+	if err != nil {
+		return Group{}, err
+	}
+
+	for _, u := range users {
+		group.Members = append(group.Members, Ref{
+			Value:   u.ID,
+			Ref:     h.baseURL + "/Users/" + u.ID,
+			Display: u.Name,
+		})
+	}
+
+	return group, nil
+}
+
+// Clients that only want the groups can exclude the members, which are expensive to list.
+func membersExcluded(r *http.Request) bool {
+	for _, a := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), "members") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Handler) listGroups(w http.ResponseWriter, r *http.Request) error {
+	f, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return badRequest("invalidFilter", err)
+	}
+
+	startIndex, count, err := pagination(r)
+	if err != nil {
+		return err
+	}
+
+	roles, err := h.findRoles(r.Context(), f)
+	if err != nil {
+		return err
+	}
+
+	resources := make([]Group, 0)
+	for _, role := range page(roles, startIndex, count) {
+		group, err := h.toGroup(r.Context(), role, !membersExcluded(r))
+		if err != nil {
+			return err
+		}
+		resources = append(resources, group)
+	}
+
+	writeJSON(w, http.StatusOK, ListResponse[Group]{
+		Schemas:      []string{listResponseSchema},
+		TotalResults: len(roles),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+	return nil
+}
+
+func (h *Handler) findRoles(ctx context.Context, f *filter) ([]role.Role, error) {
+	if f != nil && f.is("id") {
+		r, err := h.roleService.Get(ctx, f.value)
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []role.Role{r}, nil
+	}
+
+	if f != nil && !f.is("displayName") {
+		return nil, badRequest("invalidFilter", fmt.Errorf("filtering on %s is not supported", f.attribute))
+	}
+
+	roles, _, err := h.roleService.List(ctx, repo.ListRolesParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	if f == nil {
+		return roles, nil
+	}
+
+	var matching []role.Role
+	for _, r := range roles {
+		if strings.EqualFold(r.Name, f.value) {
+			matching = append(matching, r)
+		}
+	}
+
+	return matching, nil
+}
+
+func (h *Handler) createGroup(w http.ResponseWriter, r *http.Request) error {
+	req, err := decode[Group](r)
+	if err != nil {
+		return err
+	}
+
+	if req.DisplayName == "" {
+		return badRequest("invalidValue", errors.New("the group has no display name"))
+	}
+
+	// The permissions of the role are managed in Thor
+	newRole, err := h.roleService.CreateWithoutPermissions(r.Context(), models.Role{Name: req.DisplayName})
+	if err != nil {
+		return err
+	}
+
+	if err := h.addMembers(r.Context(), newRole.ID, refIDs(req.Members)); err != nil {
+		return err
+	}
+
+	group, err := h.toGroup(r.Context(), newRole, true)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, group)
+	return nil
+}
+
+func (h *Handler) getGroup(w http.ResponseWriter, r *http.Request) error {
+	role, err := h.roleService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	group, err := h.toGroup(r.Context(), role, !membersExcluded(r))
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, group)
+	return nil
+}
+
+func (h *Handler) replaceGroup(w http.ResponseWriter, r *http.Request) error {
+	role, err := h.roleService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	req, err := decode[Group](r)
+	if err != nil {
+		return err
+	}
+
+	if req.DisplayName == "" {
+		return badRequest("invalidValue", errors.New("the group has no display name"))
+	}
+
+	if role, err = h.renameRole(r.Context(), role, req.DisplayName); err != nil {
+		return err
+	}
+
+	if err := h.setMembers(r.Context(), role.ID, refIDs(req.Members)); err != nil {
+		return err
+	}
+
+	group, err := h.toGroup(r.Context(), role, true)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, group)
+	return nil
+}
+
+func (h *Handler) patchGroup(w http.ResponseWriter, r *http.Request) error {
+	role, err := h.roleService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	req, err := decode[PatchRequest](r)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range req.Operations {
+		if role, err = h.applyGroupPatch(r.Context(), role, op); err != nil {
+			return err
+		}
+	}
+
+	group, err := h.toGroup(r.Context(), role, !membersExcluded(r))
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, group)
+	return nil
+}
+
+func (h *Handler) applyGroupPatch(ctx context.Context, r role.Role, op PatchOperation) (role.Role, error) {
+	opName := strings.ToLower(op.Op)
+	if opName != "add" && opName != "remove" && opName != "replace" {
+		return r, badRequest("invalidValue", fmt.Errorf("unsupported patch operation %q", op.Op))
+	}
+
+	if op.Path == "" {
+		if opName == "remove" {
+			return r, badRequest("noTarget", errors.New("a remove operation needs a path"))
+		}
+
+		// Without a path the value is an object of the attributes to set
+		var value struct {
+			DisplayName string `json:"displayName"`
+			Members     []Ref  `json:"members"`
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return r, badRequest("invalidValue", errors.New("the value of a patch without a path must be an object"))
+		}
+
+		if value.DisplayName != "" {
+			var err error
+			if r, err = h.renameRole(ctx, r, value.DisplayName); err != nil {
+				return r, err
+			}
+		}
+
+		if value.Members == nil {
+			return r, nil
+		}
+		if opName == "add" {
+			return r, h.addMembers(ctx, r.ID, refIDs(value.Members))
+		}
+		return r, h.setMembers(ctx, r.ID, refIDs(value.Members))
+	}
+
+	if strings.EqualFold(op.Path, "displayName") {
+		if opName == "remove" {
+			return r, badRequest("mutability", errors.New("the displayName attribute can not be removed"))
+		}
+
+		name, err := stringValue(op.Path, op.Value)
+		if err != nil {
+			return r, badRequest("invalidValue", err)
+		}
+
+		return h.renameRole(ctx, r, *name)
+	}
+
+	if strings.EqualFold(op.Path, "members") {
+		ids, err := memberIDs(op.Value)
+		if err != nil {
+			return r, badRequest("invalidValue", err)
+		}
+
+		switch opName {
+		case "add":
+			return r, h.addMembers(ctx, r.ID, ids)
+		case "replace":
+			return r, h.setMembers(ctx, r.ID, ids)
+		}
+
+		// Removing the members without a value removes all of them
+		if ids == nil {
+			return r, h.setMembers(ctx, r.ID, nil)
+		}
+		return r, h.removeMembers(ctx, r.ID, ids)
+	}
+
+	id, ok, err := memberFilter(op.Path)
+	if err != nil {
+		return r, badRequest("invalidPath", err)
+	}
+	if ok && opName == "remove" {
+		return r, h.removeMembers(ctx, r.ID, []string{id})
+	}
+
+	return r, badRequest("invalidPath", fmt.Errorf("unsupported path %q", op.Path))
+}
+
+func (h *Handler) renameRole(ctx context.Context, r role.Role, name string) (role.Role, error) {
+	if r.Name == name {
+		return r, nil
+	}
+
+	renamed := r.Role
+	renamed.Name = name
+	return h.roleService.Update(ctx, renamed)
+}
+
+func (h *Handler) addMembers(ctx context.Context, roleID string, userIDs []string) error {
+	for _, id := range userIDs {
+		u, err := h.userService.Get(ctx, repo.GetUserParams{ID: &id})
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				return badRequest("invalidValue", fmt.Errorf("user %s not found", id))
+			}
+			return err
+		}
+
+		if err := u.AssignRole(ctx, roleID); err != nil && !errors.Is(err, repo.ErrAlreadyExists) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) removeMembers(ctx context.Context, roleID string, userIDs []string) error {
+	for _, id := range userIDs {
+		u, err := h.userService.Get(ctx, repo.GetUserParams{ID: &id})
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				// Already gone
+				continue
+			}
+			return err
+		}
+
+		if err := u.RemoveRole(ctx, roleID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setMembers makes the users the only members of the group.
+func (h *Handler) setMembers(ctx context.Context, roleID string, userIDs []string) error {
+	current, err := h.roleService.GetUsersWithRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	var remove []string
+	for _, u := range current {
+		if wanted[u.ID] {
+			delete(wanted, u.ID)
+			continue
+		}
+		remove = append(remove, u.ID)
+	}
+
+	add := make([]string, 0, len(wanted))
+	for id := range wanted {
+		add = append(add, id)
+	}
+
+	if err := h.removeMembers(ctx, roleID, remove); err != nil {
+		return err
+	}
+
+	return h.addMembers(ctx, roleID, add)
+}
+
+func (h *Handler) deleteGroup(w http.ResponseWriter, r *http.Request) error {
+	if err := h.roleService.Delete(r.Context(), r.PathValue("id")); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func refIDs(refs []Ref) []string {
+	ids := make([]string, len(refs))
+	for i, r := range refs {
+		ids[i] = r.Value
+	}
+
+	return ids
+}
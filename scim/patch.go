@@ -0,0 +1,208 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/theleeeo/thor/models"
+)
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	// add, remove or replace. Some clients capitalize it.
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// userChanges collects the changes a patch makes to the attributes of a user that Thor stores.
+// The other attributes, e.g. titles and addresses, are accepted but ignored.
+type userChanges struct {
+	userName    *string
+	displayName *string
+	formatted   *string
+	givenName   *string
+	familyName  *string
+	email       *string
+	active      *bool
+}
+
+func (c *userChanges) apply(op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		if isStoredUserAttribute(op.Path) {
+			return fmt.Errorf("the %s attribute can not be removed", op.Path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported patch operation %q", op.Op)
+	}
+
+	if op.Path != "" {
+		return c.set(op.Path, op.Value)
+	}
+
+	// Without a path the value is an object of the attributes to set
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &attributes); err != nil {
+		return fmt.Errorf("the value of a patch without a path must be an object")
+	}
+
+	for path, value := range attributes {
+		if err := c.set(path, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isStoredUserAttribute(path string) bool {
+	path = strings.ToLower(path)
+	return path == "username" || path == "displayname" || path == "active" || path == "emails" || strings.HasPrefix(path, "emails[") || strings.HasPrefix(path, "name")
+}
+
+func (c *userChanges) set(path string, value json.RawMessage) error {
+	var err error
+
+	switch p := strings.ToLower(path); {
+	case p == "active":
+		active, ok := boolValue(value)
+		if !ok {
+			return fmt.Errorf("active must be a boolean")
+		}
+		c.active = &active
+	case p == "username":
+		c.userName, err = stringValue(path, value)
+	case p == "displayname":
+		c.displayName, err = stringValue(path, value)
+	case p == "name.formatted":
+		c.formatted, err = stringValue(path, value)
+	case p == "name.givenname":
+		c.givenName, err = stringValue(path, value)
+	case p == "name.familyname":
+		c.familyName, err = stringValue(path, value)
+	case p == "name":
+		var name Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return fmt.Errorf("name must be an object")
+		}
+		if name.Formatted != "" {
+			c.formatted = &name.Formatted
+		}
+		if name.GivenName != "" {
+			c.givenName = &name.GivenName
+		}
+		if name.FamilyName != "" {
+			c.familyName = &name.FamilyName
+		}
+	case p == "emails":
+		var emails []Email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return fmt.Errorf("emails must be a list of emails")
+		}
+		if email := (&User{Emails: emails}).email(); email != "" {
+			c.email = &email
+		}
+	case strings.HasPrefix(p, "emails["):
+		// e.g. emails[type eq "work"].value, Thor only keeps one email so the filter does not matter
+		if strings.HasSuffix(p, "].value") {
+			c.email, err = stringValue(path, value)
+			break
+		}
+
+		var email Email
+		if err := json.Unmarshal(value, &email); err != nil {
+			return fmt.Errorf("%s must be an email", path)
+		}
+		c.email = &email.Value
+	}
+
+	return err
+}
+
+// applyTo returns the user with the changes applied.
+func (c *userChanges) applyTo(u models.User) models.User {
+	switch {
+	case c.displayName != nil:
+		u.Name = *c.displayName
+	case c.formatted != nil:
+		u.Name = *c.formatted
+	case c.givenName != nil || c.familyName != nil:
+		var given, family string
+		if c.givenName != nil {
+			given = *c.givenName
+		}
+		if c.familyName != nil {
+			family = *c.familyName
+		}
+		u.Name = strings.TrimSpace(given + " " + family)
+	}
+
+	switch {
+	case c.email != nil:
+		u.Email = *c.email
+	case c.userName != nil && strings.Contains(*c.userName, "@"):
+		u.Email = *c.userName
+	}
+
+	return u
+}
+
+func stringValue(path string, value json.RawMessage) (*string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return nil, fmt.Errorf("%s must be a string", path)
+	}
+
+	return &s, nil
+}
+
+// memberIDs returns the ids of the members in the value of a patch to the members of a group.
+func memberIDs(value json.RawMessage) ([]string, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	var members []Ref
+	if err := json.Unmarshal(value, &members); err != nil {
+		return nil, fmt.Errorf("members must be a list of members")
+	}
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.Value
+	}
+
+	return ids, nil
+}
+
+// memberFilter returns the id in a path like `members[value eq "id"]`.
+func memberFilter(path string) (string, bool, error) {
+	const prefix = "members["
+	if len(path) < len(prefix) || !strings.EqualFold(path[:len(prefix)], prefix) {
+		return "", false, nil
+	}
+
+	inner, ok := strings.CutSuffix(path[len(prefix):], "]")
+	if !ok {
+		return "", false, fmt.Errorf("invalid path %q", path)
+	}
+
+	f, err := parseFilter(inner)
+	if err != nil {
+		return "", false, err
+	}
+
+	if f == nil || !f.is("value") {
+		return "", false, fmt.Errorf("members can only be filtered by value")
+	}
+
+	return f.value, true, nil
+}
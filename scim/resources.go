@@ -0,0 +1,151 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/theleeeo/thor/models"
+)
+
+const (
+	userSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	groupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	listResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	patchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	errorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	serviceConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// User is the SCIM representation of a user (RFC 7643 section 4.1).
+// Thor identifies users by their email, so the user name is the email of the user.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	// The roles of the user, read-only
+	Groups []Ref `json:"groups,omitempty"`
+	Meta   *Meta `json:"meta,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Group is the SCIM representation of a role (RFC 7643 section 4.2).
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Ref    `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Ref refers to another resource, e.g. a member of a group.
+type Ref struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Location     string     `json:"location,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+}
+
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+// displayName returns the name of the user to store in Thor, which only keeps a single name.
+func (u *User) displayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+
+	if u.Name == nil {
+		return ""
+	}
+
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// email returns the primary email of the user, or the first one if none is primary.
+// The user name is used if it is an email address and the user has no emails.
+func (u *User) email() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+
+	if strings.Contains(u.UserName, "@") {
+		return u.UserName
+	}
+
+	return ""
+}
+
+// model converts the user to a Thor user.
+// The part before the @ of the email is used as the name if the user has none.
+func (u *User) model() models.User {
+	email := u.email()
+
+	name := u.displayName()
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	return models.User{
+		Name:  name,
+		Email: email,
+	}
+}
+
+// boolValue parses a boolean that some clients send as a string, e.g. "False".
+func boolValue(raw json.RawMessage) (bool, bool) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, true
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, false
+	}
+
+	switch strings.ToLower(s) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+
+	return false, false
+}
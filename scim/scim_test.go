@@ -0,0 +1,153 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+)
+
+func Test_ParseFilter(t *testing.T) {
+	testCases := []struct {
+		filter    string
+		attribute string
+		value     string
+		wantErr   bool
+	}{
+		{filter: `userName eq "alice@example.com"`, attribute: "userName", value: "alice@example.com"},
+		{filter: `externalId EQ "a \"quoted\" id"`, attribute: "externalId", value: `a "quoted" id`},
+		{filter: `displayName eq "Engineering Team"`, attribute: "displayName", value: "Engineering Team"},
+		{filter: `userName sw "alice"`, wantErr: true},
+		{filter: `userName eq alice`, wantErr: true},
+		{filter: `userName`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filter, func(t *testing.T) {
+			f, err := parseFilter(tc.filter)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseFilter() = nil; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFilter() = %v; want nil", err)
+			}
+
+			if f.attribute != tc.attribute || f.value != tc.value {
+				t.Errorf("parseFilter() = %s %q; want %s %q", f.attribute, f.value, tc.attribute, tc.value)
+			}
+		})
+	}
+
+	if f, err := parseFilter(""); f != nil || err != nil {
+		t.Errorf("parseFilter(\"\") = %v, %v; want nil, nil", f, err)
+	}
+}
+
+func Test_UserChanges(t *testing.T) {
+	// The operations as sent by Microsoft Entra ID
+	body := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "emails[type eq \"work\"].value", "value": "alice@example.com"},
+			{"op": "Replace", "path": "name.givenName", "value": "Alice"},
+			{"op": "Replace", "path": "name.familyName", "value": "Smith"},
+			{"op": "Add", "path": "title", "value": "Engineer"},
+			{"op": "Replace", "value": {"active": "False"}}
+		]
+	}`
+
+	var req PatchRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes userChanges
+	for _, op := range req.Operations {
+		if err := changes.apply(op); err != nil {
+			t.Fatalf("apply() = %v; want nil", err)
+		}
+	}
+
+	got := changes.applyTo(models.User{ID: "1", Name: "alice", Email: "alice@old.example.com"})
+	want := models.User{ID: "1", Name: "Alice Smith", Email: "alice@example.com"}
+	if got != want {
+		t.Errorf("applyTo() = %+v; want %+v", got, want)
+	}
+
+	if changes.active == nil || *changes.active {
+		t.Errorf("active = %v; want false", changes.active)
+	}
+
+	var remove userChanges
+	if err := remove.apply(PatchOperation{Op: "remove", Path: "emails"}); err == nil {
+		t.Errorf("apply() removing the emails = nil; want error")
+	}
+}
+
+func Test_MemberFilter(t *testing.T) {
+	id, ok, err := memberFilter(`members[value eq "2819c223"]`)
+	if err != nil || !ok || id != "2819c223" {
+		t.Errorf("memberFilter() = %q, %v, %v; want \"2819c223\", true, nil", id, ok, err)
+	}
+
+	if _, ok, err := memberFilter("members"); ok || err != nil {
+		t.Errorf("memberFilter(\"members\") = %v, %v; want false, nil", ok, err)
+	}
+
+	if _, _, err := memberFilter(`members[display eq "Alice"]`); err == nil {
+		t.Errorf("memberFilter() on display = nil; want error")
+	}
+}
+
+func Test_Page(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	testCases := []struct {
+		startIndex int
+		count      int
+		want       int
+	}{
+		{startIndex: 1, count: 2, want: 2},
+		{startIndex: 4, count: 10, want: 2},
+		{startIndex: 6, count: 10, want: 0},
+		{startIndex: 1, count: 0, want: 0},
+	}
+
+	for _, tc := range testCases {
+		if got := page(items, tc.startIndex, tc.count); len(got) != tc.want {
+			t.Errorf("page(%d, %d) = %v; want %d items", tc.startIndex, tc.count, got, tc.want)
+		}
+	}
+}
+
+func Test_Handler_RequiresToken(t *testing.T) {
+	h, err := NewHandler(&Config{Token: "secret"}, "http://localhost", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status with authorization %q = %d; want %d", auth, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with the token = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
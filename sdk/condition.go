@@ -0,0 +1,532 @@
+package sdk
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Condition is a parsed condition of a policy, an expression over the attributes of an authorization request that
+// holds when it evaluates to true:
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) operand ]
+//	operand = primary { "." name | "[" expr "]" }
+//	primary = "subject" | "action" | "resource" | "context" | "true" | "false" | "null"
+//	        | string | [ "-" ] number | "[" [ expr { "," expr } ] "]" | "(" expr ")"
+//
+// Strings are quoted by " or ', a backslash escapes the next character.
+//
+// The attributes are:
+//   - subject: the user of the token, with id, org, perms, mfa and amr. A permission with a single value is a string and
+//     one with several values is a list, as in the token. The keys of permissions that are not names are looked up by
+//     index, e.g. subject.perms["projects:web"].
+//   - action: the action that is requested.
+//   - resource: the attributes of the resource it is requested on, given by the caller.
+//   - context: the attributes of the request, given by the caller, e.g. the ip address.
+//
+// Looking up what does not exist evaluates to null rather than failing, the conditions are evaluated on what the
+// caller gives. The operators work as follows:
+//   - == and != compare any values, a string is equal to a number if it is the number written out, e.g. "3" == 3.
+//   - <, <=, > and >= compare two strings alphabetically and numbers, or strings that are numbers, numerically.
+//     Other values are not ordered and the comparisons are false.
+//   - a in b is true if b is a list with an item equal to a, an object with the key a, or a value equal to a.
+//     The last lets a permission be checked the same way whether the user has one or several values of it,
+//     e.g. "prod" in subject.perms.env.
+//   - &&, || and ! treat true as true and every other value as false.
+type Condition struct {
+	source string
+	root   node
+}
+
+// conditionRoots are the attributes that the conditions are evaluated on.
+var conditionRoots = []string{"subject", "action", "resource", "context"}
+
+// ParseCondition parses the condition of a policy.
+func ParseCondition(s string) (*Condition, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = unexpected(p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+
+	return &Condition{source: s, root: root}, nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Holds evaluates the condition on the attributes, which are expected to have the types of decoded JSON.
+func (c *Condition) Holds(attributes map[string]any) bool {
+	return c.root.eval(attributes) == true
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// The value of a number or string
+	value any
+	pos   int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", ".", "-"}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+
+		case isNameStart(c):
+			for i < len(s) && (isNameStart(s[i]) || isDigit(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenName, text: s[start:i], pos: start})
+			continue
+
+		case isDigit(c):
+			for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(s[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", s[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[start:i], value: n, pos: start})
+			continue
+
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			i++
+			for i < len(s) && s[i] != c {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: s[start:i], value: b.String(), pos: start})
+			continue
+		}
+
+		op := ""
+		for _, candidate := range operators {
+			if strings.HasPrefix(s[i:], candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("unexpected character %q at %d", c, start)
+		}
+		i += len(op)
+		tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator or keyword.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenOperator || t.kind == tokenName) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return unexpected(p.peek())
+	}
+	return nil
+}
+
+func unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of condition")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op, left, right}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenName {
+				return nil, unexpected(t)
+			}
+			n = indexNode{n, literal{t.text}}
+
+		case p.accept("["):
+			key, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = indexNode{n, key}
+
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return literal{t.value}, nil
+
+	case tokenName:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if !slices.Contains(conditionRoots, t.text) {
+			return nil, fmt.Errorf("unknown name %q at %d, expected one of %s", t.text, t.pos, strings.Join(conditionRoots, ", "))
+		}
+		return rootNode{t.text}, nil
+
+	case tokenOperator:
+		switch t.text {
+		case "-":
+			number := p.next()
+			if number.kind != tokenNumber {
+				return nil, unexpected(number)
+			}
+			return literal{-number.value.(float64)}, nil
+
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+
+		case "[":
+			var items []node
+			if p.accept("]") {
+				return listNode{items}, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if p.accept("]") {
+					return listNode{items}, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return nil, unexpected(t)
+}
+
+type node interface {
+	eval(attributes map[string]any) any
+}
+
+type literal struct {
+	value any
+}
+
+func (n literal) eval(map[string]any) any {
+	return n.value
+}
+
+type rootNode struct {
+	name string
+}
+
+func (n rootNode) eval(attributes map[string]any) any {
+	return attributes[n.name]
+}
+
+type indexNode struct {
+	target node
+	key    node
+}
+
+func (n indexNode) eval(attributes map[string]any) any {
+	key := n.key.eval(attributes)
+	switch target := n.target.eval(attributes).(type) {
+	case map[string]any:
+		if k, ok := key.(string); ok {
+			return target[k]
+		}
+	case []any:
+		if i, ok := key.(float64); ok && i == math.Trunc(i) && i >= 0 && int(i) < len(target) {
+			return target[int(i)]
+		}
+	}
+	return nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n listNode) eval(attributes map[string]any) any {
+	list := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		list = append(list, item.eval(attributes))
+	}
+	return list
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(attributes map[string]any) any {
+	return n.operand.eval(attributes) != true
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(attributes map[string]any) any {
+	return n.left.eval(attributes) == true && n.right.eval(attributes) == true
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(attributes map[string]any) any {
+	return n.left.eval(attributes) == true || n.right.eval(attributes) == true
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(attributes map[string]any) any {
+	a, b := n.left.eval(attributes), n.right.eval(attributes)
+	switch n.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	case "in":
+		return contains(b, a)
+	}
+
+	c, ok := order(a, b)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// number returns the value as a number if it is one, or a string that is one.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func equal(a, b any) bool {
+	_, aIsNumber := a.(float64)
+	_, bIsNumber := b.(float64)
+	if aIsNumber || bIsNumber {
+		x, xOK := number(a)
+		y, yOK := number(b)
+		return xOK && yOK && x == y
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// order compares two strings or two numbers, and reports false if the values can not be ordered.
+func order(a, b any) (int, bool) {
+	x, xIsString := a.(string)
+	y, yIsString := b.(string)
+	if xIsString && yIsString {
+		return strings.Compare(x, y), true
+	}
+
+	m, mOK := number(a)
+	n, nOK := number(b)
+	if !mOK || !nOK {
+		return 0, false
+	}
+	return cmp.Compare(m, n), true
+}
+
+func contains(collection any, v any) bool {
+	switch c := collection.(type) {
+	case nil:
+		return false
+	case []any:
+		return slices.ContainsFunc(c, func(item any) bool { return equal(item, v) })
+	case map[string]any:
+		k, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, ok = c[k]
+		return ok
+	}
+	return equal(collection, v)
+}
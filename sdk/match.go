@@ -0,0 +1,157 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/sdk/pattern"
+)
+
+// Pattern matching of permissions.
+//
+// UserHas compares the keys and values of the permissions exactly. The functions in this file treat the granted
+// permissions as patterns instead, so that a role can grant access to a whole family of resources:
+//
+//	requirement = key op value
+//	op          = "=" | ">=" | "<=" | ">" | "<"
+//
+// Keys are made of segments separated by ":". In a granted key
+//   - "*" matches any one segment, e.g. "projects:*" matches "projects:web" but not "projects:web:deploy",
+//   - "**" as the last segment matches one or more segments, e.g. "projects:**" matches both of them.
+//
+// Values of the "=" operator are paths of segments separated by "/". A granted value
+//   - "*" matches every value,
+//   - matches the required value if it has as many segments or fewer, and each of them is equal to,
+//     or a "*" in place of, the segment of the required value in the same position. A granted path thus covers
+//     everything below it, e.g. "org/acme" matches "org/acme/project/x" and "org/*/project" matches "org/acme/project/x",
+//     but neither matches "org/other".
+//
+// A required value "*" is matched by any granted value, i.e. the user has the key at all.
+//
+// The other operators compare numbers, e.g. "level>=3" is matched by a granted value "3" or "5" of "level".
+// Granted values that are not numbers never match them, except for "*".
+
+// Requirement is a condition on the permissions of a user.
+type Requirement struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// ParseRequirement parses a requirement such as "projects:web=read", "org=org/acme/project/x" or "level>=3".
+func ParseRequirement(s string) (Requirement, error) {
+	i := strings.IndexAny(s, "=<>")
+	if i <= 0 {
+		return Requirement{}, fmt.Errorf("invalid requirement %q: expected key, operator and value", s)
+	}
+
+	r := Requirement{Key: s[:i]}
+	rest := s[i:]
+	for _, op := range []string{">=", "<=", "=", ">", "<"} {
+		if strings.HasPrefix(rest, op) {
+			r.Op = op
+			r.Value = rest[len(op):]
+			break
+		}
+	}
+
+	if r.Value == "" {
+		return Requirement{}, fmt.Errorf("invalid requirement %q: missing value", s)
+	}
+
+	if r.Op != "=" {
+		if _, err := strconv.ParseFloat(r.Value, 64); err != nil {
+			return Requirement{}, fmt.Errorf("invalid requirement %q: %s needs a number", s, r.Op)
+		}
+	}
+
+	return r, nil
+}
+
+// SatisfiedBy reports whether any of the granted permissions matches the requirement.
+func (r Requirement) SatisfiedBy(permissions map[string]authorizer.PermissionValues) bool {
+	for key, values := range permissions {
+		if !KeyMatches(key, r.Key) {
+			continue
+		}
+
+		for _, v := range values {
+			if r.matchesValue(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r Requirement) matchesValue(granted string) bool {
+	if granted == "*" {
+		return true
+	}
+
+	if r.Op == "=" {
+		return ValueMatches(granted, r.Value)
+	}
+
+	n, err := strconv.ParseFloat(granted, 64)
+	if err != nil {
+		return false
+	}
+	want, err := strconv.ParseFloat(r.Value, 64)
+	if err != nil {
+		return false
+	}
+
+	switch r.Op {
+	case ">=":
+		return n >= want
+	case "<=":
+		return n <= want
+	case ">":
+		return n > want
+	case "<":
+		return n < want
+	}
+	return false
+}
+
+// KeyMatches reports whether the granted key, which may contain wildcards, matches the key.
+func KeyMatches(granted string, key string) bool {
+	return pattern.KeyMatches(granted, key)
+}
+
+// ValueMatches reports whether the granted value, which may contain wildcards, covers the value.
+func ValueMatches(granted string, value string) bool {
+	return pattern.ValueMatches(granted, value)
+}
+
+// UserMatches reports whether the user is granted a permission that matches the key and value, see Requirement
+// for how the granted permissions are matched.
+func UserMatches(ctx context.Context, key string, value string) bool {
+	return UserSatisfies(ctx, Requirement{Key: key, Op: "=", Value: value})
+}
+
+// UserMeets parses the requirement and reports whether the user satisfies it.
+// A requirement that can not be parsed is never met.
+func UserMeets(ctx context.Context, requirement string) bool {
+	r, err := ParseRequirement(requirement)
+	if err != nil {
+		return false
+	}
+
+	return UserSatisfies(ctx, r)
+}
+
+// UserSatisfies reports whether the permissions of the user satisfy the requirement.
+func UserSatisfies(ctx context.Context, r Requirement) bool {
+	claims := ClaimFromCtx(ctx)
+	if claims == nil {
+		return false
+	}
+
+	return r.SatisfiedBy(claims.Permissions)
+}
@@ -0,0 +1,248 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/theleeeo/thor/authorizer"
+)
+
+func Test_KeyMatches(t *testing.T) {
+	testCases := []struct {
+		granted string
+		key     string
+		want    bool
+	}{
+		{granted: "admin", key: "admin", want: true},
+		{granted: "admin", key: "admins"},
+		{granted: "projects:web", key: "projects:web", want: true},
+		{granted: "projects:web", key: "projects:api"},
+		{granted: "projects:*", key: "projects:web", want: true},
+		{granted: "projects:*", key: "projects"},
+		{granted: "projects:*", key: "projects:web:deploy"},
+		{granted: "projects:*", key: "teams:web"},
+		{granted: "projects:*:deploy", key: "projects:web:deploy", want: true},
+		{granted: "projects:*:deploy", key: "projects:web:read"},
+		{granted: "*:read", key: "projects:read", want: true},
+		{granted: "*", key: "admin", want: true},
+		{granted: "*", key: "projects:web"},
+		{granted: "projects:**", key: "projects:web", want: true},
+		{granted: "projects:**", key: "projects:web:deploy", want: true},
+		{granted: "projects:**", key: "projects"},
+		{granted: "**", key: "anything:at:all", want: true},
+		{granted: "projects:**:deploy", key: "projects:**:deploy", want: true},
+		{granted: "projects:**:deploy", key: "projects:web:deploy"},
+		{granted: "projects:web", key: "projects:*"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.granted+" "+tC.key, func(t *testing.T) {
+			if got := KeyMatches(tC.granted, tC.key); got != tC.want {
+				t.Errorf("KeyMatches(%q, %q) = %v; want %v", tC.granted, tC.key, got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_ValueMatches(t *testing.T) {
+	testCases := []struct {
+		granted string
+		value   string
+		want    bool
+	}{
+		{granted: "true", value: "true", want: true},
+		{granted: "true", value: "false"},
+		{granted: "true", value: "True"},
+		{granted: "*", value: "prod", want: true},
+		{granted: "*", value: "org/acme/project/x", want: true},
+		{granted: "prod", value: "*", want: true},
+		{granted: "org/acme", value: "org/acme", want: true},
+		{granted: "org/acme", value: "org/acme/project/x", want: true},
+		{granted: "org/acme", value: "org/acmecorp"},
+		{granted: "org/acme", value: "org/other/project/x"},
+		{granted: "org/acme/project/x", value: "org/acme"},
+		{granted: "org/*/project", value: "org/acme/project/x", want: true},
+		{granted: "org/*/project", value: "org/acme/team/x"},
+		{granted: "org/acme/project/*", value: "org/acme/project/x", want: true},
+		{granted: "org/acme/project/*", value: "org/acme/project"},
+		{granted: "org/acme/*", value: "org/acme/project/x/env/prod", want: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.granted+" "+tC.value, func(t *testing.T) {
+			if got := ValueMatches(tC.granted, tC.value); got != tC.want {
+				t.Errorf("ValueMatches(%q, %q) = %v; want %v", tC.granted, tC.value, got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_ParseRequirement(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    Requirement
+		wantErr bool
+	}{
+		{input: "admin=true", want: Requirement{Key: "admin", Op: "=", Value: "true"}},
+		{input: "projects:web=read", want: Requirement{Key: "projects:web", Op: "=", Value: "read"}},
+		{input: "org=org/acme/project/x", want: Requirement{Key: "org", Op: "=", Value: "org/acme/project/x"}},
+		{input: "level>=3", want: Requirement{Key: "level", Op: ">=", Value: "3"}},
+		{input: "level<=3", want: Requirement{Key: "level", Op: "<=", Value: "3"}},
+		{input: "level>2.5", want: Requirement{Key: "level", Op: ">", Value: "2.5"}},
+		{input: "level<-1", want: Requirement{Key: "level", Op: "<", Value: "-1"}},
+		{input: "expr=a>=b", want: Requirement{Key: "expr", Op: "=", Value: "a>=b"}},
+		{input: "admin", wantErr: true},
+		{input: "=true", wantErr: true},
+		{input: ">=3", wantErr: true},
+		{input: "admin=", wantErr: true},
+		{input: "level>=", wantErr: true},
+		{input: "level>=high", wantErr: true},
+		{input: "", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			got, err := ParseRequirement(tC.input)
+			if tC.wantErr {
+				if err == nil {
+					t.Errorf("ParseRequirement(%q) = %+v; want error", tC.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRequirement(%q) = %v; want nil", tC.input, err)
+			}
+			if got != tC.want {
+				t.Errorf("ParseRequirement(%q) = %+v; want %+v", tC.input, got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_RequirementSatisfiedBy(t *testing.T) {
+	permissions := map[string]authorizer.PermissionValues{
+		"admin":       {"true"},
+		"env":         {"prod", "staging"},
+		"projects:*":  {"read"},
+		"projects:db": {"write"},
+		"teams:**":    {"*"},
+		"resource":    {"org/acme", "org/other/project/y"},
+		"level":       {"2", "5"},
+		"clearance":   {"secret"},
+		"quota":       {"*"},
+	}
+
+	testCases := []struct {
+		requirement string
+		want        bool
+	}{
+		{requirement: "admin=true", want: true},
+		{requirement: "admin=false"},
+		{requirement: "env=prod", want: true},
+		{requirement: "env=staging", want: true},
+		{requirement: "env=dev"},
+		{requirement: "env=*", want: true},
+		{requirement: "missing=*"},
+		{requirement: "projects:web=read", want: true},
+		{requirement: "projects:web=write"},
+		{requirement: "projects:db=write", want: true},
+		{requirement: "projects:db=read", want: true},
+		{requirement: "projects:web:deploy=read"},
+		{requirement: "teams:core:members=remove", want: true},
+		{requirement: "teams=remove"},
+		{requirement: "resource=org/acme/project/x", want: true},
+		{requirement: "resource=org/acme", want: true},
+		{requirement: "resource=org/other/project/y/env", want: true},
+		{requirement: "resource=org/other/project/x"},
+		{requirement: "resource=org"},
+		{requirement: "level>=5", want: true},
+		{requirement: "level>=3", want: true},
+		{requirement: "level>=6"},
+		{requirement: "level>5"},
+		{requirement: "level>4.5", want: true},
+		{requirement: "level<=2", want: true},
+		{requirement: "level<2"},
+		{requirement: "level=2", want: true},
+		{requirement: "level=3"},
+		{requirement: "clearance>=1"},
+		{requirement: "quota>=1000", want: true},
+		{requirement: "missing>=0"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.requirement, func(t *testing.T) {
+			r, err := ParseRequirement(tC.requirement)
+			if err != nil {
+				t.Fatalf("ParseRequirement(%q) = %v; want nil", tC.requirement, err)
+			}
+			if got := r.SatisfiedBy(permissions); got != tC.want {
+				t.Errorf("SatisfiedBy(%q) = %v; want %v", tC.requirement, got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_UserMeets(t *testing.T) {
+	ctx := WithClaims(context.Background(), &authorizer.Claims{
+		Permissions: map[string]authorizer.PermissionValues{
+			"projects:*": {"org/acme/*"},
+			"level":      {"3"},
+		},
+	})
+
+	testCases := []struct {
+		desc string
+		ctx  context.Context
+		got  func(ctx context.Context) bool
+		want bool
+	}{
+		{
+			desc: "Matching key and value",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserMatches(ctx, "projects:web", "org/acme/project/x") },
+			want: true,
+		},
+		{
+			desc: "Value outside of the path",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserMatches(ctx, "projects:web", "org/other/project/x") },
+		},
+		{
+			desc: "Numeric requirement",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserMeets(ctx, "level>=3") },
+			want: true,
+		},
+		{
+			desc: "Unmet numeric requirement",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserMeets(ctx, "level>3") },
+		},
+		{
+			desc: "Invalid requirement",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserMeets(ctx, "level") },
+		},
+		{
+			desc: "Numeric requirement built by hand",
+			ctx:  ctx,
+			got: func(ctx context.Context) bool {
+				return UserSatisfies(ctx, Requirement{Key: "level", Op: "<", Value: "4"})
+			},
+			want: true,
+		},
+		{
+			desc: "No claims",
+			ctx:  context.Background(),
+			got:  func(ctx context.Context) bool { return UserMeets(ctx, "level>=0") },
+		},
+		{
+			desc: "UserHas stays exact",
+			ctx:  ctx,
+			got:  func(ctx context.Context) bool { return UserHas(ctx, "projects:web", "org/acme/project/x") },
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.got(tC.ctx); got != tC.want {
+				t.Errorf("got %v; want %v", got, tC.want)
+			}
+		})
+	}
+}
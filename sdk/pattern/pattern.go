@@ -0,0 +1,57 @@
+// Package pattern matches permissions against granted permissions that may contain wildcards,
+// see the sdk package for the syntax. It does not depend on the rest of Thor, so that Thor itself matches
+// permissions the same way as the services using the sdk.
+package pattern
+
+import (
+	"strings"
+
+	"github.com/theleeeo/thor/models"
+)
+
+// KeyMatches reports whether the granted key, which may contain wildcards, matches the key.
+func KeyMatches(granted string, key string) bool {
+	if granted == key {
+		return true
+	}
+
+	g := strings.Split(granted, ":")
+	k := strings.Split(key, ":")
+	for i, segment := range g {
+		if segment == "**" && i == len(g)-1 {
+			return len(k) > i
+		}
+
+		if i >= len(k) || (segment != "*" && segment != k[i]) {
+			return false
+		}
+	}
+
+	return len(g) == len(k)
+}
+
+// ValueMatches reports whether the granted value, which may contain wildcards, covers the value.
+func ValueMatches(granted string, value string) bool {
+	if granted == value || granted == "*" || value == "*" {
+		return true
+	}
+
+	g := strings.Split(granted, "/")
+	v := strings.Split(value, "/")
+	if len(g) > len(v) {
+		return false
+	}
+
+	for i, segment := range g {
+		if segment != "*" && segment != v[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matches reports whether the granted permission matches both the key and the value of the permission.
+func Matches(granted models.Permission, permission models.Permission) bool {
+	return KeyMatches(granted.Key, permission.Key) && ValueMatches(granted.Val, permission.Val)
+}
@@ -0,0 +1,198 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/models"
+)
+
+// AuthorizeRequest asks whether the subject may take the action on the resource.
+type AuthorizeRequest struct {
+	// The action, e.g. "projects:delete"
+	Action string `json:"action"`
+	// The attributes of the resource, e.g. {"type": "project", "owner": "<user id>"}
+	Resource map[string]any `json:"resource"`
+	// The attributes of the request, e.g. {"ip": "10.0.0.1"}
+	Context map[string]any `json:"context"`
+}
+
+// Decision is the outcome of evaluating the policies on a request.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// The policy that made the decision, empty if no policy applied
+	PolicyID string `json:"policy_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// PolicySet is a set of policies with parsed conditions, ready to decide on requests.
+type PolicySet struct {
+	policies []compiledPolicy
+}
+
+type compiledPolicy struct {
+	models.Policy
+	// nil if the policy has no condition
+	condition *Condition
+}
+
+// NewPolicySet validates and parses the policies. The allowing policies are tried in the order they are given.
+func NewPolicySet(policies []models.Policy) (*PolicySet, error) {
+	set := &PolicySet{}
+	for _, p := range policies {
+		compiled, err := compilePolicy(p)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		set.policies = append(set.policies, compiled)
+	}
+
+	return set, nil
+}
+
+func compilePolicy(p models.Policy) (compiledPolicy, error) {
+	if p.Effect != models.PolicyAllow && p.Effect != models.PolicyDeny {
+		return compiledPolicy{}, fmt.Errorf("the effect must be %q or %q", models.PolicyAllow, models.PolicyDeny)
+	}
+
+	if len(p.Actions) == 0 {
+		return compiledPolicy{}, errors.New("missing actions")
+	}
+	for _, action := range p.Actions {
+		if action == "" || strings.Contains(action, ",") {
+			return compiledPolicy{}, fmt.Errorf("invalid action %q", action)
+		}
+	}
+
+	compiled := compiledPolicy{Policy: p}
+	if strings.TrimSpace(p.Condition) != "" {
+		condition, err := ParseCondition(p.Condition)
+		if err != nil {
+			return compiledPolicy{}, err
+		}
+		compiled.condition = condition
+	}
+
+	return compiled, nil
+}
+
+// ValidatePolicy returns an error describing what is wrong with the policy, if anything.
+func ValidatePolicy(p models.Policy) error {
+	_, err := compilePolicy(p)
+	return err
+}
+
+// Decide evaluates the policies that apply to the action for the subject of the claims.
+// Any denying policy whose condition holds denies the request, otherwise the first allowing one allows it.
+// Requests that no policy allows are denied.
+func (s *PolicySet) Decide(claims *authorizer.Claims, req AuthorizeRequest) Decision {
+	attributes, err := requestAttributes(claims, req)
+	if err != nil {
+		return Decision{Reason: fmt.Sprintf("invalid request: %v", err)}
+	}
+
+	var allowedBy *compiledPolicy
+	for i, p := range s.policies {
+		if !p.appliesTo(req.Action) || (p.condition != nil && !p.condition.Holds(attributes)) {
+			continue
+		}
+
+		if p.Effect == models.PolicyDeny {
+			return Decision{PolicyID: p.ID, Reason: fmt.Sprintf("denied by policy %q", p.Name)}
+		}
+		if allowedBy == nil {
+			allowedBy = &s.policies[i]
+		}
+	}
+
+	if allowedBy == nil {
+		return Decision{Reason: "no policy allows the action"}
+	}
+	return Decision{Allowed: true, PolicyID: allowedBy.ID, Reason: fmt.Sprintf("allowed by policy %q", allowedBy.Name)}
+}
+
+func (p compiledPolicy) appliesTo(action string) bool {
+	for _, pattern := range p.Actions {
+		if KeyMatches(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAttributes are what the conditions are evaluated on,
+// they are passed through JSON so that they have the same types however the caller gave them.
+func requestAttributes(claims *authorizer.Claims, req AuthorizeRequest) (map[string]any, error) {
+	subject := map[string]any{
+		"id":    claims.UserID,
+		"org":   claims.OrgID,
+		"perms": claims.Permissions,
+		"mfa":   claims.AuthContext == authorizer.ACRMultiFactor,
+		"amr":   claims.AuthMethods,
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"subject":  subject,
+		"action":   req.Action,
+		"resource": req.Resource,
+		"context":  req.Context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]any
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+type policiesContextKey struct{}
+
+type requestContextKey struct{}
+
+// WithPolicies adds the policies that Authorize decides by to the context.
+func WithPolicies(ctx context.Context, policies *PolicySet) context.Context {
+	return context.WithValue(ctx, policiesContextKey{}, policies)
+}
+
+// WithRequestContext adds the attributes of the request, which conditions refer to as context, to the context.
+func WithRequestContext(ctx context.Context, attributes map[string]any) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, attributes)
+}
+
+// Authorize reports whether the policies allow the user to take the action on the resource.
+// It decides in-process with the policies of the context, see WithPolicies. Without them it asks Thor,
+// see WithRemote, and a request that fails is not allowed. It is false if the context has no claims
+// and neither policies nor a remote.
+func Authorize(ctx context.Context, action string, resource map[string]any) bool {
+	claims := ClaimFromCtx(ctx)
+	if claims == nil {
+		return false
+	}
+
+	requestContext, _ := ctx.Value(requestContextKey{}).(map[string]any)
+	req := AuthorizeRequest{Action: action, Resource: resource, Context: requestContext}
+
+	if policies, _ := ctx.Value(policiesContextKey{}).(*PolicySet); policies != nil {
+		return policies.Decide(claims, req).Allowed
+	}
+
+	remote, ok := ctx.Value(remoteContextKey{}).(remoteAuthorization)
+	if !ok {
+		return false
+	}
+
+	decision, err := remote.remote.Decide(ctx, remote.token, req)
+	if err != nil {
+		slog.Error("failed to authorize with Thor", "action", action, "error", err)
+		return false
+	}
+	return decision.Allowed
+}
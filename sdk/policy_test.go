@@ -0,0 +1,304 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/models"
+)
+
+var testClaims = &authorizer.Claims{
+	UserID: "alice",
+	OrgID:  "acme",
+	Permissions: map[string]authorizer.PermissionValues{
+		"admin":        {"true"},
+		"env":          {"prod", "staging"},
+		"level":        {"5"},
+		"projects:web": {"read"},
+	},
+	AuthMethods: []string{authorizer.AuthMethodPassword, authorizer.AuthMethodOTP, authorizer.AuthMethodMFA},
+	AuthContext: authorizer.ACRMultiFactor,
+}
+
+func Test_ParseCondition(t *testing.T) {
+	testCases := []struct {
+		condition string
+		wantErr   bool
+	}{
+		{condition: "true"},
+		{condition: "subject.id == resource.owner"},
+		{condition: "!(resource.archived) && (subject.mfa || context.ip in ['10.0.0.1', '10.0.0.2'])"},
+		{condition: `subject.perms["projects:web"] == "read"`},
+		{condition: "resource.tags[0] != null"},
+		{condition: "resource.size <= -1.5"},
+		{condition: "[]"},
+		{condition: "", wantErr: true},
+		{condition: "user.id == 'alice'", wantErr: true},
+		{condition: "subject.id = 'alice'", wantErr: true},
+		{condition: "subject.id == ", wantErr: true},
+		{condition: "subject.id == 'alice", wantErr: true},
+		{condition: "(subject.mfa", wantErr: true},
+		{condition: "subject.", wantErr: true},
+		{condition: "subject.perms[", wantErr: true},
+		{condition: "['a' 'b']", wantErr: true},
+		{condition: "subject.mfa true", wantErr: true},
+		{condition: "1.2.3 == 1", wantErr: true},
+		{condition: "- 'a'", wantErr: true},
+		{condition: "subject.id == 'alice' # comment", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.condition, func(t *testing.T) {
+			_, err := ParseCondition(tC.condition)
+			if tC.wantErr && err == nil {
+				t.Errorf("ParseCondition(%q) = nil; want error", tC.condition)
+			}
+			if !tC.wantErr && err != nil {
+				t.Errorf("ParseCondition(%q) = %v; want nil", tC.condition, err)
+			}
+		})
+	}
+}
+
+func Test_ConditionHolds(t *testing.T) {
+	req := AuthorizeRequest{
+		Action: "projects:delete",
+		Resource: map[string]any{
+			"owner":    "alice",
+			"size":     3,
+			"tags":     []string{"public", "web"},
+			"path":     "org/acme/project/web",
+			"archived": false,
+			"labels":   map[string]string{"team": "core"},
+		},
+		Context: map[string]any{"ip": "10.0.0.1"},
+	}
+	attributes, err := requestAttributes(testClaims, req)
+	if err != nil {
+		t.Fatalf("requestAttributes() = %v; want nil", err)
+	}
+
+	testCases := []struct {
+		condition string
+		want      bool
+	}{
+		{condition: "true", want: true},
+		{condition: "false"},
+		{condition: "null"},
+		{condition: "'true'"},
+		{condition: "subject.id == 'alice'", want: true},
+		{condition: "subject.id == resource.owner", want: true},
+		{condition: "subject.id != resource.owner"},
+		{condition: "subject.org == 'acme'", want: true},
+		{condition: "subject.mfa", want: true},
+		{condition: "'otp' in subject.amr", want: true},
+		{condition: "action == 'projects:delete'", want: true},
+		{condition: "context.ip == '10.0.0.1'", want: true},
+		{condition: "context.ip in ['10.0.0.2', '10.0.0.1']", want: true},
+		{condition: "context.ip in ['10.0.0.2']"},
+
+		// Permissions with one value are strings and with several values lists
+		{condition: "subject.perms.admin == 'true'", want: true},
+		{condition: "'true' in subject.perms.admin", want: true},
+		{condition: "'prod' in subject.perms.env", want: true},
+		{condition: "'dev' in subject.perms.env"},
+		{condition: "subject.perms.env == 'prod'"},
+		{condition: `subject.perms["projects:web"] == "read"`, want: true},
+		{condition: "subject.perms.missing == null", want: true},
+		{condition: "'read' in subject.perms.missing"},
+
+		// Numbers and strings that are numbers
+		{condition: "subject.perms.level >= 3", want: true},
+		{condition: "subject.perms.level > 5"},
+		{condition: "subject.perms.level == 5", want: true},
+		{condition: "subject.perms.level == 5.0", want: true},
+		{condition: "resource.size < 3.5", want: true},
+		{condition: "resource.size <= 3", want: true},
+		{condition: "resource.size > -1", want: true},
+		{condition: "resource.size == '3'", want: true},
+		{condition: "resource.size == 'three'"},
+		{condition: "'b' > 'a'", want: true},
+		{condition: "'10' < '9'", want: true},
+		{condition: "resource.missing >= 0"},
+		{condition: "resource.missing < 0"},
+		{condition: "subject.mfa > 0"},
+
+		// Lookups
+		{condition: "resource.tags[1] == 'web'", want: true},
+		{condition: "resource.tags[2] == null", want: true},
+		{condition: "resource.tags[0.5] == null", want: true},
+		{condition: "resource.labels.team == 'core'", want: true},
+		{condition: "'team' in resource.labels", want: true},
+		{condition: "'owner' in resource.labels"},
+		{condition: "resource.owner.name == null", want: true},
+		{condition: "resource['path'] == 'org/acme/project/web'", want: true},
+		{condition: "resource.tags == ['public', 'web']", want: true},
+		{condition: "resource.tags == ['web', 'public']"},
+
+		// Logic
+		{condition: "!resource.archived", want: true},
+		{condition: "!resource.missing", want: true},
+		{condition: "!!subject.mfa", want: true},
+		{condition: "subject.mfa && resource.archived"},
+		{condition: "resource.archived || subject.mfa", want: true},
+		{condition: "resource.archived || resource.missing"},
+		{condition: "resource.owner && true"},
+		{condition: "subject.id == 'bob' || subject.id == 'alice' && subject.mfa", want: true},
+		{condition: "(subject.id == 'bob' || subject.id == 'alice') && resource.archived"},
+		{condition: `"it's" == 'it\'s'`, want: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.condition, func(t *testing.T) {
+			c, err := ParseCondition(tC.condition)
+			if err != nil {
+				t.Fatalf("ParseCondition(%q) = %v; want nil", tC.condition, err)
+			}
+			if got := c.Holds(attributes); got != tC.want {
+				t.Errorf("Holds(%q) = %v; want %v", tC.condition, got, tC.want)
+			}
+		})
+	}
+}
+
+func Test_ValidatePolicy(t *testing.T) {
+	valid := models.Policy{Name: "valid", Effect: models.PolicyAllow, Actions: []string{"projects:*"}}
+
+	testCases := []struct {
+		desc    string
+		change  func(p *models.Policy)
+		wantErr bool
+	}{
+		{desc: "Valid", change: func(p *models.Policy) {}},
+		{desc: "Valid condition", change: func(p *models.Policy) { p.Condition = "subject.mfa" }},
+		{desc: "Blank condition", change: func(p *models.Policy) { p.Condition = "  " }},
+		{desc: "Deny", change: func(p *models.Policy) { p.Effect = models.PolicyDeny }},
+		{desc: "Missing effect", change: func(p *models.Policy) { p.Effect = "" }, wantErr: true},
+		{desc: "Unknown effect", change: func(p *models.Policy) { p.Effect = "maybe" }, wantErr: true},
+		{desc: "Missing actions", change: func(p *models.Policy) { p.Actions = nil }, wantErr: true},
+		{desc: "Empty action", change: func(p *models.Policy) { p.Actions = []string{""} }, wantErr: true},
+		{desc: "Action with comma", change: func(p *models.Policy) { p.Actions = []string{"a,b"} }, wantErr: true},
+		{desc: "Invalid condition", change: func(p *models.Policy) { p.Condition = "subject.id ==" }, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := valid
+			tC.change(&p)
+			err := ValidatePolicy(p)
+			if tC.wantErr && err == nil {
+				t.Errorf("ValidatePolicy(%+v) = nil; want error", p)
+			}
+			if !tC.wantErr && err != nil {
+				t.Errorf("ValidatePolicy(%+v) = %v; want nil", p, err)
+			}
+		})
+	}
+}
+
+func Test_PolicySetDecide(t *testing.T) {
+	set, err := NewPolicySet([]models.Policy{
+		{ID: "owners", Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id"},
+		{ID: "readers", Name: "readers", Effect: models.PolicyAllow, Actions: []string{"projects:read"}},
+		{ID: "mfa", Name: "mfa", Effect: models.PolicyDeny, Actions: []string{"projects:delete"}, Condition: "!subject.mfa"},
+		{ID: "office", Name: "office", Effect: models.PolicyDeny, Actions: []string{"**"}, Condition: "context.ip == '1.2.3.4'"},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicySet() = %v; want nil", err)
+	}
+
+	noMFA := *testClaims
+	noMFA.AuthContext = authorizer.ACRSingleFactor
+
+	testCases := []struct {
+		desc   string
+		claims *authorizer.Claims
+		req    AuthorizeRequest
+		want   Decision
+	}{
+		{
+			desc:   "Allowed by the first policy that applies",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:read", Resource: map[string]any{"owner": "alice"}},
+			want:   Decision{Allowed: true, PolicyID: "owners", Reason: `allowed by policy "owners"`},
+		},
+		{
+			desc:   "Allowed by a policy without a condition",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:read", Resource: map[string]any{"owner": "bob"}},
+			want:   Decision{Allowed: true, PolicyID: "readers", Reason: `allowed by policy "readers"`},
+		},
+		{
+			desc:   "No policy allows",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "bob"}},
+			want:   Decision{Reason: "no policy allows the action"},
+		},
+		{
+			desc:   "No policy applies to the action",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "billing:read"},
+			want:   Decision{Reason: "no policy allows the action"},
+		},
+		{
+			desc:   "Allowed with MFA",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "alice"}},
+			want:   Decision{Allowed: true, PolicyID: "owners", Reason: `allowed by policy "owners"`},
+		},
+		{
+			desc:   "Deny overrides allow",
+			claims: &noMFA,
+			req:    AuthorizeRequest{Action: "projects:delete", Resource: map[string]any{"owner": "alice"}},
+			want:   Decision{PolicyID: "mfa", Reason: `denied by policy "mfa"`},
+		},
+		{
+			desc:   "Denied by the request context",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:read", Context: map[string]any{"ip": "1.2.3.4"}},
+			want:   Decision{PolicyID: "office", Reason: `denied by policy "office"`},
+		},
+		{
+			desc:   "Attributes that are not JSON",
+			claims: testClaims,
+			req:    AuthorizeRequest{Action: "projects:read", Resource: map[string]any{"f": func() {}}},
+			want:   Decision{Reason: "invalid request: json: unsupported type: func()"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := set.Decide(tC.claims, tC.req); got != tC.want {
+				t.Errorf("Decide() = %+v; want %+v", got, tC.want)
+			}
+		})
+	}
+
+	if _, err := NewPolicySet([]models.Policy{{Name: "broken", Effect: models.PolicyAllow, Actions: []string{"*"}, Condition: "("}}); err == nil {
+		t.Errorf("NewPolicySet() with an invalid condition = nil; want error")
+	}
+}
+
+func Test_Authorize(t *testing.T) {
+	set, err := NewPolicySet([]models.Policy{
+		{ID: "owners", Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id && context.ip != null"},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicySet() = %v; want nil", err)
+	}
+
+	ctx := WithRequestContext(WithPolicies(WithClaims(context.Background(), testClaims), set), map[string]any{"ip": "10.0.0.1"})
+
+	if !Authorize(ctx, "projects:delete", map[string]any{"owner": "alice"}) {
+		t.Errorf("Authorize() of an owned project = false; want true")
+	}
+	if Authorize(ctx, "projects:delete", map[string]any{"owner": "bob"}) {
+		t.Errorf("Authorize() of the project of someone else = true; want false")
+	}
+	if Authorize(WithPolicies(WithClaims(context.Background(), testClaims), set), "projects:delete", map[string]any{"owner": "alice"}) {
+		t.Errorf("Authorize() without a request context = true; want false")
+	}
+	if Authorize(WithClaims(context.Background(), testClaims), "projects:delete", map[string]any{"owner": "alice"}) {
+		t.Errorf("Authorize() without policies = true; want false")
+	}
+	if Authorize(WithPolicies(context.Background(), set), "projects:delete", map[string]any{"owner": "alice"}) {
+		t.Errorf("Authorize() without claims = true; want false")
+	}
+}
@@ -0,0 +1,77 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Remote decides on requests by asking Thor with POST /api/authorize, as the user of the token.
+// Services use it when they can not load the policies themselves, which only admins of Thor can list.
+type Remote struct {
+	// The url of Thor, e.g. "https://auth.example.com"
+	URL string
+	// The name of the cookie that Thor reads the token from
+	CookieName string
+	// The client to send the requests with, http.DefaultClient if nil
+	Client *http.Client
+}
+
+func NewRemote(thorURL string, cookieName string) *Remote {
+	return &Remote{
+		URL:        strings.TrimSuffix(thorURL, "/"),
+		CookieName: cookieName,
+	}
+}
+
+// Decide asks Thor whether the user of the token may take the action on the resource.
+func (r *Remote) Decide(ctx context.Context, token string, req AuthorizeRequest) (Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL+"/api/authorize", bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.AddCookie(&http.Cookie{Name: r.CookieName, Value: token})
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var decision Decision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return Decision{}, fmt.Errorf("failed to decode decision: %w", err)
+	}
+
+	return decision, nil
+}
+
+type remoteContextKey struct{}
+
+type remoteAuthorization struct {
+	remote *Remote
+	token  string
+}
+
+// WithRemote makes Authorize ask Thor for the decisions, as the user of the token.
+func WithRemote(ctx context.Context, remote *Remote, token string) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, remoteAuthorization{remote: remote, token: token})
+}
@@ -0,0 +1,123 @@
+package sdk_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/theleeeo/thor/app"
+	"github.com/theleeeo/thor/authorizer"
+	"github.com/theleeeo/thor/entrypoints"
+	"github.com/theleeeo/thor/middlewares"
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/policy"
+	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/sdk"
+	"github.com/theleeeo/thor/user"
+)
+
+const cookieName = "thor"
+
+func newAuthorizer(t *testing.T) *authorizer.Authorizer {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := authorizer.New(&authorizer.Config{
+		AppUrl:        "https://auth.example.com",
+		PrivateKey:    pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawPriv}),
+		PublicKey:     pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rawPub}),
+		ValidDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auth
+}
+
+// Test_AuthorizeRemote decides through the API of Thor, as a service that has not injected the policies does.
+func Test_AuthorizeRemote(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	userService := user.NewService(nil, r)
+	auth := newAuthorizer(t)
+
+	u, err := userService.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.CreateToken(ctx, u, authorizer.TokenParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.CreatePolicy(ctx, models.Policy{ID: "owners", Name: "owners", Effect: models.PolicyAllow, Actions: []string{"projects:*"}, Condition: "resource.owner == subject.id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Thor, with only the services that authorizing needs
+	thorApp := app.New(&app.Services{Auth: auth, Users: userService, Policies: policy.NewService(r)})
+	apiMux := http.NewServeMux()
+	entrypoints.NewRestHandler(thorApp, cookieName, false).Register(apiMux)
+	thorMux := http.NewServeMux()
+	thorMux.Handle("/api/", middlewares.Chain(apiMux, middlewares.ClaimsExtractor(auth.PublicKey(), cookieName), middlewares.PrefixStripper("/api")))
+	thor := httptest.NewServer(thorMux)
+	defer thor.Close()
+
+	// A service using the sdk
+	service := middlewares.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sdk.Authorize(r.Context(), "projects:delete", map[string]any{"owner": r.URL.Query().Get("owner")}) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}), middlewares.ClaimsExtractor(auth.PublicKey(), cookieName), middlewares.RemoteAuthorizer(sdk.NewRemote(thor.URL, cookieName)))
+
+	testCases := []struct {
+		desc  string
+		owner string
+		want  int
+	}{
+		{desc: "own project", owner: u.ID, want: http.StatusOK},
+		{desc: "project of someone else", owner: "someone-else", want: http.StatusForbidden},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/projects?owner="+tC.owner, nil)
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+
+			rec := httptest.NewRecorder()
+			service.ServeHTTP(rec, req)
+			if rec.Code != tC.want {
+				t.Errorf("status = %d; want %d", rec.Code, tC.want)
+			}
+		})
+	}
+
+	// Thor can not be reached
+	thor.Close()
+	req := httptest.NewRequest(http.MethodDelete, "/projects?owner="+u.ID, nil)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+	rec := httptest.NewRecorder()
+	service.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status without Thor = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -3,6 +3,7 @@ package sdk
 import (
 	"context"
 	"net/http"
+	"slices"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/theleeeo/thor/authorizer"
@@ -40,28 +41,36 @@ func ExtractClaims(r *http.Request, publicKey []byte, cookieName string) (*autho
 	return claims, nil
 }
 
+// UserHas reports whether the user is granted the value of the permission.
+// A user can be granted several values of a permission, by different roles, and has all of them.
 func UserHas(ctx context.Context, permission string, value string) bool {
+	return slices.Contains(UserValues(ctx, permission), value)
+}
+
+// UserValues returns the values of the permission that the user is granted, sorted, or nil if it has none.
+func UserValues(ctx context.Context, permission string) []string {
 	claims := ClaimFromCtx(ctx)
 	if claims == nil {
-		return false
+		return nil
 	}
 
-	if claims.Permissions == nil {
-		return false
-	}
+	return claims.Permissions[permission]
+}
 
-	v, ok := claims.Permissions[permission]
-	if !ok {
+func UserIs(ctx context.Context, userID string) bool {
+	claims := ClaimFromCtx(ctx)
+	if claims == nil {
 		return false
 	}
-
-	return v == value
+	return claims.UserID == userID
 }
 
-func UserIs(ctx context.Context, userID string) bool {
+// UserHasMFA reports whether the user used multi-factor authentication when logging in.
+// Use it to require MFA for sensitive operations.
+func UserHasMFA(ctx context.Context) bool {
 	claims := ClaimFromCtx(ctx)
 	if claims == nil {
 		return false
 	}
-	return claims.UserID == userID
+	return claims.AuthContext == authorizer.ACRMultiFactor
 }
@@ -0,0 +1,44 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/theleeeo/thor/authorizer"
+)
+
+func Test_UserHas(t *testing.T) {
+	ctx := WithClaims(context.Background(), &authorizer.Claims{
+		UserID: "user",
+		Permissions: map[string]authorizer.PermissionValues{
+			"admin": {"true"},
+			"team":  {"a", "b", "c"},
+		},
+	})
+
+	testCases := []struct {
+		desc       string
+		permission string
+		value      string
+		want       bool
+	}{
+		{desc: "single value", permission: "admin", value: "true", want: true},
+		{desc: "other than the single value", permission: "admin", value: "false"},
+		{desc: "first of the values", permission: "team", value: "a", want: true},
+		{desc: "last of the values", permission: "team", value: "c", want: true},
+		{desc: "not one of the values", permission: "team", value: "d"},
+		{desc: "all of the values", permission: "team", value: "a,b,c"},
+		{desc: "missing permission", permission: "env", value: "prod"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := UserHas(ctx, tC.permission, tC.value); got != tC.want {
+				t.Errorf("UserHas(%q, %q) = %v; want %v", tC.permission, tC.value, got, tC.want)
+			}
+		})
+	}
+
+	if UserHas(context.Background(), "admin", "true") {
+		t.Error("UserHas() without claims = true; want false")
+	}
+}
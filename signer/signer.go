@@ -0,0 +1,47 @@
+package signer
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer signs and verifies short-lived tokens that are handed out in links, e.g. login links sent by email.
+// The tokens are signed with a shared secret and are only meant to be read by Thor itself.
+type Signer struct {
+	key []byte
+}
+
+func New(secret []byte) *Signer {
+	return &Signer{
+		key: secret,
+	}
+}
+
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Verify parses the token into the claims.
+// The token has to be unexpired and issued for the given audience, this prevents a token meant for one purpose to be used for another.
+func (s *Signer) Verify(token string, audience string, claims jwt.Claims) error {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(audience),
+	)
+
+	_, err := parser.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.key, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -3,33 +3,64 @@ package user
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/theleeeo/thor/models"
 	"github.com/theleeeo/thor/repo"
+	"github.com/theleeeo/thor/sdk/pattern"
 )
 
+const (
+	defaultDeletedRetention = 30 * 24 * time.Hour
+	purgeInterval           = time.Hour
+)
+
+type Config struct {
+	// How long deleted users are kept before they are purged. Defaults to 30 days.
+	DeletedRetention time.Duration `yaml:"deleted-retention"`
+}
+
 type Service struct {
 	repo repo.Repo
+
+	deletedRetention time.Duration
 }
 
-func NewService(repo repo.Repo) *Service {
-	return &Service{
-		repo: repo,
+// NewService creates the user service, the defaults are used if cfg is nil.
+func NewService(cfg *Config, repo repo.Repo) *Service {
+	s := &Service{
+		repo:             repo,
+		deletedRetention: defaultDeletedRetention,
+	}
+
+	if cfg != nil && cfg.DeletedRetention != 0 {
+		s.deletedRetention = cfg.DeletedRetention
 	}
+
+	return s
 }
 
-func (s *Service) Create(ctx context.Context, user models.User, provider models.UserProvider) (User, error) {
+func validateNewUser(user models.User, provider models.UserProvider) error {
 	if user.Email == "" {
-		return User{}, fmt.Errorf("missing user email")
+		return fmt.Errorf("missing user email")
 	}
 
 	if provider.Type == "" {
-		return User{}, fmt.Errorf("missing user provider type")
+		return fmt.Errorf("missing user provider type")
 	}
 
 	if provider.UserID == "" {
-		return User{}, fmt.Errorf("missing user provider id")
+		return fmt.Errorf("missing user provider id")
+	}
+
+	return nil
+}
+
+func (s *Service) Create(ctx context.Context, user models.User, provider models.UserProvider) (User, error) {
+	if err := validateNewUser(user, provider); err != nil {
+		return User{}, err
 	}
 
 	user.ID = uuid.NewString()
@@ -44,6 +75,28 @@ func (s *Service) Create(ctx context.Context, user models.User, provider models.
 	}, nil
 }
 
+// CreateWithPassword creates a user that logs in with a password, the user is not created if the password can not be saved.
+func (s *Service) CreateWithPassword(ctx context.Context, user models.User, provider models.UserProvider, passwordHash string) (User, error) {
+	if err := validateNewUser(user, provider); err != nil {
+		return User{}, err
+	}
+
+	if passwordHash == "" {
+		return User{}, fmt.Errorf("missing password hash")
+	}
+
+	user.ID = uuid.NewString()
+
+	if err := s.repo.CreateUserWithPassword(ctx, user, provider, passwordHash); err != nil {
+		return User{}, err
+	}
+
+	return User{
+		User: user,
+		repo: s.repo,
+	}, nil
+}
+
 func (s *Service) Get(ctx context.Context, params repo.GetUserParams) (User, error) {
 	user, err := s.repo.GetUser(ctx, params)
 	if err != nil {
@@ -68,10 +121,10 @@ func (s *Service) GetByProviderID(ctx context.Context, providerID string) (User,
 	}, nil
 }
 
-func (s *Service) List(ctx context.Context, params repo.ListUsersParams) ([]User, error) {
-	userModels, err := s.repo.ListUsers(ctx, params)
+func (s *Service) List(ctx context.Context, params repo.ListUsersParams) ([]User, string, error) {
+	userModels, next, err := s.repo.ListUsers(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	users := make([]User, len(userModels))
@@ -82,14 +135,129 @@ func (s *Service) List(ctx context.Context, params repo.ListUsersParams) ([]User
 		}
 	}
 
-	return users, nil
+	return users, next, nil
 }
 
-func (s *Service) GetPermissionsOfUser(ctx context.Context, userID string) ([]models.Permission, error) {
-	permissions, err := s.repo.GetPermissionsOfUser(ctx, userID)
+func (s *Service) Update(ctx context.Context, user models.User) (User, error) {
+	if user.ID == "" {
+		return User{}, fmt.Errorf("missing user id")
+	}
+
+	if user.Email == "" {
+		return User{}, fmt.Errorf("missing user email")
+	}
+
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return User{}, err
+	}
+
+	return User{
+		User: user,
+		repo: s.repo,
+	}, nil
+}
+
+func (s *Service) Disable(ctx context.Context, id string) error {
+	return s.repo.SetUserDisabled(ctx, id, true)
+}
+
+func (s *Service) Enable(ctx context.Context, id string) error {
+	return s.repo.SetUserDisabled(ctx, id, false)
+}
+
+// Delete disables the user and hides it until it is purged after the retention period.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.SoftDeleteUser(ctx, id, time.Now().UTC())
+}
+
+// PurgeDeleted permanently deletes the users that were deleted longer ago than the retention period.
+func (s *Service) PurgeDeleted(ctx context.Context) (int, error) {
+	return s.repo.PurgeDeletedUsers(ctx, time.Now().UTC().Add(-s.deletedRetention))
+}
+
+// RunPurger purges the deleted users periodically until the context is done.
+func (s *Service) RunPurger(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDeleted(ctx)
+		if err != nil {
+			slog.Error("failed to purge deleted users", "error", err)
+		} else if purged > 0 {
+			slog.Info("purged deleted users", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) GetPermissionsOfUser(ctx context.Context, userID string, orgID string) ([]models.Permission, error) {
+	permissions, err := s.repo.GetPermissionsOfUser(ctx, userID, orgID)
 	if err != nil {
 		return []models.Permission{}, err
 	}
 
 	return permissions, nil
 }
+
+// GetPermissionGrantsOfUser returns the effective permissions of the user in the org with the roles they were granted through.
+func (s *Service) GetPermissionGrantsOfUser(ctx context.Context, userID string, orgID string) ([]models.PermissionGrant, error) {
+	return s.repo.GetPermissionGrantsOfUser(ctx, userID, orgID)
+}
+
+// CheckPermissions tells for each of the permissions whether the user is granted it in the org, through which roles
+// and groups, or which roles would grant it if it is not. The granted permissions are matched as patterns, the same
+// way as sdk.UserMatches does. Returns ErrNotFound if the user does not exist.
+func (s *Service) CheckPermissions(ctx context.Context, userID string, orgID string, permissions []models.Permission) ([]models.PermissionCheck, error) {
+	if _, err := s.repo.GetUser(ctx, repo.GetUserParams{ID: &userID}); err != nil {
+		return nil, err
+	}
+
+	grants, err := s.repo.GetPermissionGrantsOfUser(ctx, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]models.PermissionCheck, 0, len(permissions))
+	var denied []int
+	for _, p := range permissions {
+		check := models.PermissionCheck{Permission: p, Grants: make([]models.PermissionGrant, 0)}
+		for _, g := range grants {
+			if pattern.Matches(g.Permission, p) {
+				check.Grants = append(check.Grants, g)
+			}
+		}
+		check.Allowed = len(check.Grants) > 0
+
+		if !check.Allowed {
+			denied = append(denied, len(checks))
+		}
+
+		checks = append(checks, check)
+	}
+
+	if len(denied) == 0 {
+		return checks, nil
+	}
+
+	// The roles of all the denied permissions are looked up at once, so the roles are only loaded once per check
+	deniedPermissions := make([]models.Permission, 0, len(denied))
+	for _, i := range denied {
+		deniedPermissions = append(deniedPermissions, checks[i].Permission)
+	}
+
+	granting, err := s.repo.GetRolesWithPermissions(ctx, deniedPermissions, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range denied {
+		checks[i].GrantingRoles = granting[j]
+	}
+
+	return checks, nil
+}
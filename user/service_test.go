@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+	"github.com/theleeeo/thor/repo"
+)
+
+func Test_CheckPermissionsMatchesPatterns(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(nil, r)
+
+	u, err := s.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	granted := models.Permission{Key: "projects:*", Val: "org/acme"}
+	role := models.Role{ID: "role", Name: "acme-projects"}
+	if err := r.CreateRole(ctx, role, []models.Permission{granted}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignRole(ctx, u.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		permission models.Permission
+		want       bool
+	}{
+		{permission: models.Permission{Key: "projects:web", Val: "org/acme/project/x"}, want: true},
+		{permission: models.Permission{Key: "projects:*", Val: "org/acme"}, want: true},
+		{permission: models.Permission{Key: "projects:web", Val: "org/other"}},
+		{permission: models.Permission{Key: "projects:web:deploy", Val: "org/acme"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.permission.Key+"="+tC.permission.Val, func(t *testing.T) {
+			checks, err := s.CheckPermissions(ctx, u.ID, "", []models.Permission{tC.permission})
+			if err != nil {
+				t.Fatalf("CheckPermissions() = %v; want nil", err)
+			}
+
+			check := checks[0]
+			if check.Allowed != tC.want {
+				t.Errorf("CheckPermissions().Allowed = %v; want %v", check.Allowed, tC.want)
+			}
+			if tC.want && (len(check.Grants) != 1 || check.Grants[0].Permission != granted) {
+				t.Errorf("CheckPermissions().Grants = %v; want the grant of %v", check.Grants, granted)
+			}
+		})
+	}
+}
+
+func Test_CheckPermissionsGrantingRoles(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	s := NewService(nil, r)
+
+	u, err := s.Create(ctx, models.User{Name: "Leo", Email: "leo@example.com"}, models.UserProvider{Type: models.UserProviderTypeGithub, UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projects := models.Role{ID: "projects", Name: "projects"}
+	if err := r.CreateRole(ctx, projects, []models.Permission{{Key: "projects:*", Val: "*"}}); err != nil {
+		t.Fatal(err)
+	}
+	billing := models.Role{ID: "billing", Name: "billing"}
+	if err := r.CreateRole(ctx, billing, []models.Permission{{Key: "billing", Val: "read"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AssignRole(ctx, u.ID, billing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := s.CheckPermissions(ctx, u.ID, "", []models.Permission{
+		{Key: "projects:web", Val: "x"},
+		{Key: "billing", Val: "read"},
+		{Key: "deploy", Val: "prod"},
+		{Key: "projects:api", Val: "y"},
+	})
+	if err != nil {
+		t.Fatalf("CheckPermissions() = %v; want nil", err)
+	}
+
+	want := [][]string{{projects.ID}, nil, {}, {projects.ID}}
+	for i, check := range checks {
+		var got []string
+		for _, role := range check.GrantingRoles {
+			got = append(got, role.ID)
+		}
+		if want[i] == nil && check.GrantingRoles != nil {
+			t.Errorf("CheckPermissions()[%d].GrantingRoles = %v; want none for an allowed permission", i, got)
+		}
+		if want[i] != nil && (check.GrantingRoles == nil || !slices.Equal(got, want[i])) {
+			t.Errorf("CheckPermissions()[%d].GrantingRoles = %v; want %v", i, got, want[i])
+		}
+	}
+}
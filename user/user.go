@@ -3,6 +3,9 @@ package user
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/theleeeo/thor/models"
 	"github.com/theleeeo/thor/repo"
@@ -17,8 +20,9 @@ type User struct {
 
 	roles []models.Role
 
-	// Permission key-value pairs of the user
-	permissions []models.Permission
+	// The effective permissions of the user in grantsOrg, with the roles they were granted through
+	grants    []models.PermissionGrant
+	grantsOrg string
 }
 
 func (u *User) Providers(ctx context.Context) ([]models.UserProvider, error) {
@@ -51,19 +55,64 @@ func (u *User) Roles(ctx context.Context) ([]models.Role, error) {
 	return roles, err
 }
 
-func (u *User) Permissions(ctx context.Context) ([]models.Permission, error) {
-	if u.permissions != nil {
-		return u.permissions, nil
+func (u *User) permissionGrants(ctx context.Context, orgID string) ([]models.PermissionGrant, error) {
+	if u.grants != nil && u.grantsOrg == orgID {
+		return u.grants, nil
 	}
 
-	permissions, err := u.repo.GetPermissionsOfUser(ctx, u.ID)
+	grants, err := u.repo.GetPermissionGrantsOfUser(ctx, u.ID, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting the key-value pairs of the user: %w", err)
 	}
 
-	u.permissions = permissions
+	u.grants = grants
+	u.grantsOrg = orgID
 
-	return permissions, err
+	return grants, nil
+}
+
+// Permissions returns the permissions of the user in the org, only those of the global roles if orgID is empty.
+func (u *User) Permissions(ctx context.Context, orgID string) ([]models.Permission, error) {
+	grants, err := u.permissionGrants(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]models.Permission, 0)
+	for _, g := range grants {
+		if !slices.Contains(permissions, g.Permission) {
+			permissions = append(permissions, g.Permission)
+		}
+	}
+
+	return permissions, nil
+}
+
+// PermissionsExpireAt returns when the first of the permissions of the user in the org is lost because the role
+// assignments granting it expire, or nil if none of them expire.
+func (u *User) PermissionsExpireAt(ctx context.Context, orgID string) (*time.Time, error) {
+	grants, err := u.permissionGrants(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A permission is kept until its last grant expires, and never lost if it has a grant that does not expire
+	lastGrant := make(map[models.Permission]*time.Time)
+	for _, g := range grants {
+		last, ok := lastGrant[g.Permission]
+		if !ok || (last != nil && (g.ExpiresAt == nil || g.ExpiresAt.After(*last))) {
+			lastGrant[g.Permission] = g.ExpiresAt
+		}
+	}
+
+	var first *time.Time
+	for _, expiresAt := range lastGrant {
+		if expiresAt != nil && (first == nil || expiresAt.Before(*first)) {
+			first = expiresAt
+		}
+	}
+
+	return first, nil
 }
 
 func (u *User) AddProvider(ctx context.Context, provider models.UserProvider) error {
@@ -86,6 +135,17 @@ func (u *User) AssignRole(ctx context.Context, roleID string) error {
 	return nil
 }
 
+// AssignRoleUntil assigns the role to the user until expiresAt, when it is removed again.
+func (u *User) AssignRoleUntil(ctx context.Context, roleID string, expiresAt time.Time) error {
+	if err := u.repo.AssignRoleUntil(ctx, u.ID, roleID, expiresAt); err != nil {
+		return fmt.Errorf("error assigning role to the user: %w", err)
+	}
+
+	u.roles = append(u.roles, models.Role{ID: roleID})
+
+	return nil
+}
+
 func (u *User) RemoveRole(ctx context.Context, roleID string) error {
 	if err := u.repo.RemoveRole(ctx, u.ID, roleID); err != nil {
 		return fmt.Errorf("error removing role from the user: %w", err)
@@ -100,3 +160,24 @@ func (u *User) RemoveRole(ctx context.Context, roleID string) error {
 
 	return nil
 }
+
+// PermissionConflicts returns the keys that the permissions have several values of, sorted by key and value.
+func PermissionConflicts(permissions []models.Permission) []models.PermissionConflict {
+	values := make(map[string][]string)
+	for _, p := range permissions {
+		if !slices.Contains(values[p.Key], p.Val) {
+			values[p.Key] = append(values[p.Key], p.Val)
+		}
+	}
+
+	conflicts := make([]models.PermissionConflict, 0)
+	for key, vals := range values {
+		if len(vals) > 1 {
+			slices.Sort(vals)
+			conflicts = append(conflicts, models.PermissionConflict{Key: key, Values: vals})
+		}
+	}
+	slices.SortFunc(conflicts, func(a, b models.PermissionConflict) int { return strings.Compare(a.Key, b.Key) })
+
+	return conflicts
+}
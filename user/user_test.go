@@ -0,0 +1,50 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/theleeeo/thor/models"
+)
+
+func Test_PermissionConflicts(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		permissions []models.Permission
+		want        []models.PermissionConflict
+	}{
+		{
+			desc: "none",
+			want: []models.PermissionConflict{},
+		},
+		{
+			desc:        "one value of each key",
+			permissions: []models.Permission{{Key: "admin", Val: "true"}, {Key: "team", Val: "a"}},
+			want:        []models.PermissionConflict{},
+		},
+		{
+			desc:        "the same value from several roles",
+			permissions: []models.Permission{{Key: "team", Val: "a"}, {Key: "team", Val: "a"}},
+			want:        []models.PermissionConflict{},
+		},
+		{
+			desc:        "several values",
+			permissions: []models.Permission{{Key: "team", Val: "b"}, {Key: "admin", Val: "true"}, {Key: "team", Val: "a"}, {Key: "team", Val: "b"}},
+			want:        []models.PermissionConflict{{Key: "team", Values: []string{"a", "b"}}},
+		},
+		{
+			desc: "sorted by key",
+			permissions: []models.Permission{
+				{Key: "team", Val: "b"}, {Key: "env", Val: "prod"}, {Key: "team", Val: "a"}, {Key: "env", Val: "dev"},
+			},
+			want: []models.PermissionConflict{{Key: "env", Values: []string{"dev", "prod"}}, {Key: "team", Values: []string{"a", "b"}}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := PermissionConflicts(tC.permissions); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("PermissionConflicts() = %v; want %v", got, tC.want)
+			}
+		})
+	}
+}